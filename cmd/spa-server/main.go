@@ -0,0 +1,7 @@
+package main
+
+import "github.com/ikasamt/spa-server/spaserver"
+
+func main() {
+	spaserver.Main()
+}
@@ -1,5 +1,19 @@
-module spa-server
+module github.com/ikasamt/spa-server
 
 go 1.21.3
 
-require github.com/joho/godotenv v1.5.1
+require (
+	github.com/andybalholm/brotli v1.1.0
+	github.com/fsnotify/fsnotify v1.7.0
+	github.com/joho/godotenv v1.5.1
+	golang.org/x/image v0.18.0
+	golang.org/x/net v0.33.0
+	golang.org/x/sync v0.10.0
+	gopkg.in/natefinch/lumberjack.v2 v2.2.1
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	golang.org/x/sys v0.28.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+)
@@ -0,0 +1,204 @@
+package spaserver
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// アクセスログの形式
+const (
+	accessLogCommon   = "common"
+	accessLogCombined = "combined"
+)
+
+// responseRecorder はステータスコードと送信バイト数を記録する ResponseWriter
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+	// レスポンスヘッダーを送信した時刻
+	wroteHeaderAt time.Time
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	// 103 Early Hints などの中間レスポンスは記録しない
+	if rec.status == 0 && status >= 200 {
+		rec.status = status
+		rec.wroteHeaderAt = time.Now()
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+		rec.wroteHeaderAt = time.Now()
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Flush はストリーミングレスポンスのために元の ResponseWriter の Flush を呼ぶ
+func (rec *responseRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack は WebSocket などのプロトコル切り替えのために接続を引き渡す
+func (rec *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := rec.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, fmt.Errorf("hijack not supported")
+}
+
+// Unwrap は http.ResponseController から元の ResponseWriter を参照できるようにする
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// Status は記録したステータスコードを返す（何も書き込まれていない場合は 200）
+func (rec *responseRecorder) Status() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
+
+// accessLogger はアクセスログを Common/Combined Log Format で出力する
+type accessLogger struct {
+	format string
+	// 処理時間とプロキシ先の処理時間の内訳を追記する
+	timing bool
+	// 静的ファイルへの成功したリクエストは sampleStatic 件に1件だけ出力する（1 以下の場合はすべて）
+	sampleStatic uint64
+	staticCount  atomic.Uint64
+	// 出力しないパス（BLOCKED_PATHS と同じ形式）
+	exclude []string
+	// クライアントIPアドレスの下位を 0 にする
+	anonymize bool
+	logger    *log.Logger
+}
+
+func newAccessLogger(cfg LogConfig) (*accessLogger, error) {
+	switch cfg.AccessFormat {
+	case "":
+		return nil, nil
+	case accessLogCommon, accessLogCombined:
+		out, err := accessLogOutput(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &accessLogger{format: cfg.AccessFormat, timing: cfg.AccessTiming, sampleStatic: uint64(cfg.AccessSampleStatic), exclude: cfg.AccessExclude, anonymize: cfg.AnonymizeIPs, logger: log.New(out, "", 0)}, nil
+	default:
+		return nil, fmt.Errorf("unknown access log format %q", cfg.AccessFormat)
+	}
+}
+
+// Wrap はハンドラーにアクセスログの出力を追加する
+func (l *accessLogger) Wrap(next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// ヘルスチェックなどはメトリクスにだけ記録する
+		if blockedPattern(l.exclude, r.URL.Path) != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		var timing *requestTiming
+		if l.timing {
+			r, timing = withTiming(r)
+		}
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if !l.sampled(r, rec.Status()) {
+			return
+		}
+		line := l.formatLine(r, rec.Status(), rec.bytes, start)
+		// キャッシュから返したか（X-Cache ヘッダー）を追記する
+		if cache := rec.Header().Get("X-Cache"); cache != "" {
+			line += fmt.Sprintf(" cache=\"%s\"", escapeLogValue(cache))
+		}
+		if timing != nil {
+			line += " request_time=" + formatDuration(time.Since(start)) + " " + timing.String()
+		}
+		l.logger.Print(line)
+	})
+}
+
+// sampled はリクエストをアクセスログに出力するかを返す
+// 間引くのは静的ファイルへの 4xx・5xx 以外のリクエストだけで、エラーやプロキシへのリクエストはすべて出力する
+func (l *accessLogger) sampled(r *http.Request, status int) bool {
+	if l.sampleStatic <= 1 || status >= 400 || routeClassOf(r.Context()) != routeStatic {
+		return true
+	}
+	return (l.staticCount.Add(1)-1)%l.sampleStatic == 0
+}
+
+// formatLine は1リクエスト分のログ行を作成する
+// common:   %h %l %u %t "%r" %>s %b
+// combined: %h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i"
+func (l *accessLogger) formatLine(r *http.Request, status int, bytes int64, start time.Time) string {
+	user := "-"
+	if u, _, ok := r.BasicAuth(); ok && u != "" {
+		user = escapeLogField(u)
+	}
+	size := "-"
+	if bytes > 0 {
+		size = fmt.Sprint(bytes)
+	}
+	line := fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s",
+		logClientIP(r, l.anonymize), user, start.Format("02/Jan/2006:15:04:05 -0700"),
+		escapeLogValue(r.Method), escapeLogValue(r.RequestURI), escapeLogValue(r.Proto), status, size)
+	if l.format == accessLogCombined {
+		line += fmt.Sprintf(" \"%s\" \"%s\"", logValueOrDash(r.Referer()), logValueOrDash(r.UserAgent()))
+	}
+	// GRAPHQL_PATHS に一致したリクエストは操作名とクエリのハッシュを追記する
+	if info := graphQLFrom(r.Context()); info != nil && info.operation != "" {
+		line += fmt.Sprintf(" graphql=\"%s\"", escapeLogValue(info.operation))
+		if info.hash != "" {
+			line += fmt.Sprintf(" query_hash=\"%s\"", escapeLogValue(info.hash))
+		}
+	}
+	return line
+}
+
+func logValueOrDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return escapeLogValue(s)
+}
+
+// escapeLogValue はログ行を壊さないように引用符と制御文字をエスケープする
+func escapeLogValue(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, "\\x%02x", c)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// escapeLogField は引用符で囲まない項目（Basic 認証のユーザー名）をエスケープする
+// 空白も項目の区切りと区別できるようにエスケープする
+func escapeLogField(s string) string {
+	return strings.ReplaceAll(escapeLogValue(s), " ", `\x20`)
+}
@@ -0,0 +1,251 @@
+package spaserver
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestAccessLogFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		expected string
+	}{
+		{
+			name:     "common形式",
+			format:   accessLogCommon,
+			expected: `^192\.168\.1\.10 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /app\.js\?v=1 HTTP/1\.1" 200 5$`,
+		},
+		{
+			name:     "combined形式",
+			format:   accessLogCombined,
+			expected: `^192\.168\.1\.10 - - \[.+\] "GET /app\.js\?v=1 HTTP/1\.1" 200 5 "https://example\.com/" "Mozilla/5\.0 \\"test\\""$`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := newAccessLogger(LogConfig{AccessFormat: tt.format})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			l.logger = log.New(&buf, "", 0)
+
+			handler := l.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("hello"))
+			}))
+			req := httptest.NewRequest("GET", "/app.js?v=1", nil)
+			req.RemoteAddr = "192.168.1.10:54321"
+			req.Header.Set("Referer", "https://example.com/")
+			req.Header.Set("User-Agent", `Mozilla/5.0 "test"`)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			line := bytes.TrimSpace(buf.Bytes())
+			if !regexp.MustCompile(tt.expected).Match(line) {
+				t.Errorf("ログの形式が期待と異なります: %s", line)
+			}
+		})
+	}
+
+	if _, err := newAccessLogger(LogConfig{AccessFormat: "xml"}); err == nil {
+		t.Error("未知の形式はエラーになるべきです")
+	}
+}
+
+func TestAccessLogTiming(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer backend.Close()
+
+	l, err := newAccessLogger(LogConfig{AccessFormat: accessLogCommon, AccessTiming: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	l.logger = log.New(&buf, "", 0)
+
+	// プロキシの代わりにプロキシ先へのリクエストを記録するハンドラー
+	handler := l.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api" {
+			w.Write([]byte("static"))
+			return
+		}
+		timing := timingFrom(r.Context())
+		req, _ := http.NewRequestWithContext(timing.traceUpstream(r.Context(), backend.URL), "GET", backend.URL, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(w, resp.Body)
+		resp.Body.Close()
+		timing.finishUpstream()
+	}))
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/api", `" 200 5 request_time=\S+ upstream=http://127\.0\.0\.1:\d+ dns=\S+ connect=\S+ upstream_ttfb=\S+ upstream_time=\S+$`},
+		{"/app.js", `" 200 6 request_time=\S+ upstream=-$`},
+	}
+	for _, tt := range tests {
+		buf.Reset()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", tt.path, nil))
+		line := bytes.TrimSpace(buf.Bytes())
+		if !regexp.MustCompile(tt.expected).Match(line) {
+			t.Errorf("%s: ログに処理時間の内訳が含まれていません: %s", tt.path, line)
+		}
+	}
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	l, err := newAccessLogger(LogConfig{AccessFormat: accessLogCommon, AccessSampleStatic: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	l.logger = log.New(&buf, "", 0)
+
+	handler := l.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api":
+			setRouteClass(r.Context(), routeProxy)
+		case "/missing.js":
+			setRouteClass(r.Context(), routeStatic)
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			setRouteClass(r.Context(), routeStatic)
+		}
+	}))
+
+	tests := []struct {
+		path     string
+		expected int
+	}{
+		{"/app.js", 3},
+		{"/missing.js", 25},
+		{"/api", 25},
+	}
+	for _, tt := range tests {
+		buf.Reset()
+		for i := 0; i < 25; i++ {
+			r, _ := withRouteClass(httptest.NewRequest("GET", tt.path, nil))
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+		}
+		if n := bytes.Count(buf.Bytes(), []byte("\n")); n != tt.expected {
+			t.Errorf("%s: 期待される行数 %d, 実際の行数 %d", tt.path, tt.expected, n)
+		}
+	}
+}
+
+func TestAccessLogExclude(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+	accessFile := filepath.Join(t.TempDir(), "access.log")
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Log.AccessFormat = accessLogCommon
+	cfg.Log.AccessFile = accessFile
+	cfg.Log.AccessExclude = []string{"/healthz", "favicon.ico"}
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, path := range []string{"/healthz", "/favicon.ico", "/"} {
+		s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	data, err := os.ReadFile(accessFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Count(data, []byte("\n")) != 1 || !bytes.Contains(data, []byte(`"GET / HTTP/1.1"`)) {
+		t.Errorf("除外したパスがアクセスログに出力されています: %s", data)
+	}
+	// メトリクスには記録する
+	var total float64
+	for _, sample := range s.state.metrics.requests.samples() {
+		total += sample.value
+	}
+	if total != 3 {
+		t.Errorf("期待されるリクエスト数 %d, 実際のリクエスト数 %g", 3, total)
+	}
+}
+
+func TestAccessLogAnonymizeIPs(t *testing.T) {
+	l, err := newAccessLogger(LogConfig{AccessFormat: accessLogCommon, AnonymizeIPs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	l.logger = log.New(&buf, "", 0)
+	handler := l.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	trusted, _ := parseTrustedProxies(defaultTrustedProxies)
+
+	tests := []struct {
+		remoteAddr   string
+		forwardedFor string
+		expected     string
+	}{
+		{"203.0.113.57:1234", "", "203.0.113.0 "},
+		{"[2001:db8:85a3:8d3:1319:8a2e:370:7348]:1234", "", "2001:db8:85a3:: "},
+		{"unknown", "", "unknown "},
+		// 信頼するプロキシ経由の場合は X-Forwarded-For のクライアント、それ以外の接続元の X-Forwarded-For は使わない
+		{"10.0.0.5:1234", "203.0.113.57", "203.0.113.0 "},
+		{"198.51.100.7:1234", "203.0.113.57", "198.51.100.0 "},
+	}
+	for _, tt := range tests {
+		buf.Reset()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		if tt.forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), withClientIP(r, trusted))
+		if !bytes.HasPrefix(buf.Bytes(), []byte(tt.expected)) {
+			t.Errorf("%s: 期待されるIPアドレス %q, 実際のログ %s", tt.remoteAddr, tt.expected, buf.Bytes())
+		}
+	}
+}
+
+func TestAccessLogEscapesUserAndMethod(t *testing.T) {
+	l, err := newAccessLogger(LogConfig{AccessFormat: accessLogCommon})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	l.logger = log.New(&buf, "", 0)
+	handler := l.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// ユーザー名とメソッドで偽のログ行や項目を作れない
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Method = "GET\n203.0.113.1"
+	r.SetBasicAuth("admin - [01/Jan/2026] \"GET /", "password")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	expected := `192.0.2.1 - admin\x20-\x20[01/Jan/2026]\x20\"GET\x20/ [`
+	line := buf.String()
+	if !strings.HasPrefix(line, expected) {
+		t.Errorf("ユーザー名がエスケープされていません: %s", line)
+	}
+	if !strings.Contains(line, `"GET\x0a203.0.113.1 / HTTP/1.1"`) {
+		t.Errorf("メソッドがエスケープされていません: %s", line)
+	}
+	if strings.Count(line, "\n") != 1 {
+		t.Errorf("ログ行が分割されています: %q", line)
+	}
+}
@@ -0,0 +1,112 @@
+package spaserver
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+)
+
+// newAdminHandler は管理用エンドポイントのハンドラーを作成する
+func newAdminHandler(cfg Config, s *server) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/__version", serveVersion)
+	mux.HandleFunc("/healthz", serveHealthz)
+	mux.HandleFunc("/readyz", s.serveReadyz)
+	mux.Handle(cfg.Metrics.Path, s.state.metrics)
+	mux.Handle("/debug/vars", expvar.Handler())
+	if cfg.Stats.Enabled {
+		mux.Handle(statsPath, s.state.stats)
+	}
+	mux.HandleFunc(ipRulesPath, requireTokenForChanges(cfg.Admin.Token, s.serveIPRules))
+	mux.HandleFunc(ipRulesPath+"/", requireTokenForChanges(cfg.Admin.Token, s.serveIPRules))
+	s.registerOperations(mux)
+	s.dashboard = newDashboard(s)
+	mux.HandleFunc(dashboardPath, s.dashboard.serveHTML)
+	mux.HandleFunc(dashboardEventsPath, s.dashboard.serveEvents)
+
+	// リリース管理
+	if s.releases != nil {
+		mux.HandleFunc("/__releases", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			releases, active := s.releases.Releases()
+			writeJSON(w, http.StatusOK, map[string]interface{}{
+				"active":   active,
+				"releases": releases,
+			})
+		})
+		mux.HandleFunc("/__rollback", requireTokenForChanges(cfg.Admin.Token, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			active, err := s.releases.Rollback(r.URL.Query().Get("to"))
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]string{"active": active})
+		}))
+	}
+
+	// プロファイリング（公開ポートには登録しない）
+	if cfg.Admin.Pprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+
+	return s.audit.Wrap(requireAdminToken(cfg.Admin.Token, mux))
+}
+
+// requireAdminToken は ADMIN_TOKEN が設定されている場合に Bearer トークンを検証する
+// ブラウザーで管理画面を開けるよう、参照（GET・HEAD）に限りパスワードにトークンを指定した Basic 認証も受け付ける。
+// ブラウザーは Basic 認証の資格情報を他のサイトからのフォームの送信にも付けるため、状態の変更には Bearer トークンを必須にする
+func requireAdminToken(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, password, basic := r.BasicAuth()
+		basic = basic && (r.Method == http.MethodGet || r.Method == http.MethodHead)
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 &&
+			(!basic || subtle.ConstantTimeCompare([]byte(password), []byte(token)) != 1) {
+			recordAuditRule(r.Context(), "ADMIN_TOKEN")
+			w.Header().Set("WWW-Authenticate", `Basic realm="spa-server admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireTokenForChanges は ADMIN_TOKEN が設定されていない場合に、状態を変更するリクエスト（GET・HEAD 以外）を 403 で拒否する
+// 管理用インターフェースに接続できるだけで、誰でもクライアントを締め出したりできないようにする
+func requireTokenForChanges(token string, next http.HandlerFunc) http.HandlerFunc {
+	if token != "" {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			recordAuditRule(r.Context(), "ADMIN_TOKEN")
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "set ADMIN_TOKEN to make changes through the admin interface"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		errorf("Error writing JSON response: %v", err)
+	}
+}
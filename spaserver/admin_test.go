@@ -0,0 +1,132 @@
+package spaserver
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestAdminPprof(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+
+	for _, enabled := range []bool{true, false} {
+		cfg := testConfig(t)
+		cfg.DistDir = dir
+		cfg.Admin.Pprof = enabled
+		cfg.Admin.Token = "secret"
+		s, err := newServer(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := httptest.NewRequest("GET", "/debug/pprof/", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		rr := httptest.NewRecorder()
+		s.admin.ServeHTTP(rr, req)
+		expected := http.StatusNotFound
+		if enabled {
+			expected = http.StatusOK
+		}
+		if rr.Code != expected {
+			t.Errorf("ENABLE_PPROF=%v: 期待されるステータスコード %d, 実際のステータスコード %d", enabled, expected, rr.Code)
+		}
+
+		// 公開ポートでは提供されない
+		rr = httptest.NewRecorder()
+		s.ServeHTTP(rr, httptest.NewRequest("GET", "/debug/pprof/", nil))
+		if rr.Body.String() != "SPA" {
+			t.Errorf("公開ポートで pprof が提供されています: %s", rr.Body.String())
+		}
+	}
+}
+
+func TestAdminToken(t *testing.T) {
+	handler := requireAdminToken("secret", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	basic := func(password string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte("admin:"+password))
+	}
+	for _, tc := range []struct {
+		method, header string
+		expected       int
+	}{
+		{"GET", "", http.StatusUnauthorized},
+		{"GET", "Bearer wrong", http.StatusUnauthorized},
+		{"GET", "Bearer secret", http.StatusOK},
+		{"POST", "Bearer secret", http.StatusOK},
+		// ブラウザー用の Basic 認証（パスワードがトークン）
+		{"GET", basic("wrong"), http.StatusUnauthorized},
+		{"GET", basic("secret"), http.StatusOK},
+		{"HEAD", basic("secret"), http.StatusOK},
+		// ブラウザーが他のサイトからのフォームの送信に資格情報を付けても状態を変更できない
+		{"POST", basic("secret"), http.StatusUnauthorized},
+		{"DELETE", basic("secret"), http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(tc.method, "/__ips/deny?ip=203.0.113.1", nil)
+		if tc.header != "" {
+			req.Header.Set("Authorization", tc.header)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tc.expected {
+			t.Errorf("%s Authorization %q: 期待されるステータスコード %d, 実際のステータスコード %d", tc.method, tc.header, tc.expected, rr.Code)
+		}
+	}
+}
+
+func TestAdminRollbackWithoutToken(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Now().Add(-time.Hour)
+	createRelease(t, dir, "v1", base)
+	createRelease(t, dir, "v2", base.Add(time.Minute))
+	cfg := testConfig(t)
+	cfg.Releases.Dir = dir
+	cfg.Admin.Token = ""
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// ADMIN_TOKEN がない場合はロールバックできない
+	rr := httptest.NewRecorder()
+	s.admin.ServeHTTP(rr, httptest.NewRequest("POST", "/__rollback?to=v1", nil))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("期待されるステータスコード %d, 実際のステータスコード %d", http.StatusForbidden, rr.Code)
+	}
+	if _, active := s.releases.Releases(); active != "v2" {
+		t.Errorf("配信中のリリースが変更されています: %s", active)
+	}
+	rr = httptest.NewRecorder()
+	s.admin.ServeHTTP(rr, httptest.NewRequest("GET", "/__releases", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("リリースの一覧は参照できるべきです: %d", rr.Code)
+	}
+}
+
+func TestAdminExpvar(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	s.admin.ServeHTTP(rr, httptest.NewRequest("GET", "/debug/vars", nil))
+	var vars map[string]json.RawMessage
+	if err := json.Unmarshal(rr.Body.Bytes(), &vars); err != nil {
+		t.Fatalf("JSON の解析に失敗しました: %v", err)
+	}
+	for _, key := range []string{"memstats", "goroutines", "spa_server"} {
+		if _, ok := vars[key]; !ok {
+			t.Errorf("%s が含まれていません", key)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package spaserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// エラーの急増の通知
+// 5xx の割合またはプロキシのエラー数が ALERT_WINDOW の間にしきい値を超えたら、ALERT_WEBHOOK_URL に JSON を POST する。
+// Slack の Incoming Webhook でそのまま表示できるよう text に本文を入れる。同じ種類の通知は ALERT_COOLDOWN の間は送らない
+
+const (
+	// カウンターを確認する間隔
+	alertCheckInterval = 10 * time.Second
+	// Webhook への送信のタイムアウト
+	alertTimeout = 10 * time.Second
+
+	alert5xxRate     = "5xx_rate"
+	alertProxyErrors = "proxy_errors"
+)
+
+// alertTimes は種類ごとの最後に通知した時刻（設定を読み込み直しても通知が重複しないよう serverState に持つ）
+type alertTimes struct {
+	mu    sync.Mutex
+	times map[string]time.Time
+}
+
+// allow は cooldown の間に同じ種類の通知を送っていなければ記録して true を返す
+func (a *alertTimes) allow(kind string, now time.Time, cooldown time.Duration) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if last, ok := a.times[kind]; ok && now.Sub(last) < cooldown {
+		return false
+	}
+	if a.times == nil {
+		a.times = map[string]time.Time{}
+	}
+	a.times[kind] = now
+	return true
+}
+
+// alertPayload は Webhook に送る JSON
+type alertPayload struct {
+	Text      string  `json:"text"`
+	Alert     string  `json:"alert"`
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+	Window    string  `json:"window"`
+	Host      string  `json:"host"`
+}
+
+// alertSample はある時点のカウンターの累計
+type alertSample struct {
+	time        time.Time
+	requests    float64
+	errors      float64
+	proxyErrors float64
+}
+
+// alerter はカウンターを定期的に確認し、しきい値を超えたら通知する
+type alerter struct {
+	cfg     AlertConfig
+	client  *http.Client
+	host    string
+	metrics *serverMetrics
+	last    *alertTimes
+	samples []alertSample
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func newAlerter(cfg AlertConfig, st *serverState) *alerter {
+	if cfg.WebhookURL == "" {
+		return nil
+	}
+	host, _ := os.Hostname()
+	return &alerter{cfg: cfg, client: &http.Client{Timeout: alertTimeout}, host: host, metrics: st.metrics, last: st.lastAlerts}
+}
+
+// start は定期的な確認を始める
+func (a *alerter) start() {
+	if a == nil {
+		return
+	}
+	a.stop = make(chan struct{})
+	a.done = make(chan struct{})
+	go a.run()
+}
+
+func (a *alerter) run() {
+	defer close(a.done)
+	ticker := time.NewTicker(alertCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			a.check(now)
+		case <-a.stop:
+			return
+		}
+	}
+}
+
+// Close は定期的な確認を止める
+func (a *alerter) Close() {
+	if a == nil || a.stop == nil {
+		return
+	}
+	close(a.stop)
+	<-a.done
+}
+
+// currentSample は現在のカウンターの累計を返す
+func (a *alerter) currentSample(now time.Time) alertSample {
+	sample := alertSample{time: now, proxyErrors: a.metrics.proxyErrors.Value()}
+	for _, s := range a.metrics.requests.samples() {
+		sample.requests += s.value
+		if code, _ := strconv.Atoi(s.labelValues[1]); code >= 500 && code < 600 {
+			sample.errors += s.value
+		}
+	}
+	return sample
+}
+
+// check は ALERT_WINDOW の間の増加をしきい値と比べる
+func (a *alerter) check(now time.Time) {
+	current := a.currentSample(now)
+	a.samples = append(a.samples, current)
+	// ALERT_WINDOW より前の値は、比較の起点にする最も新しい1つだけ残す
+	for len(a.samples) > 1 && now.Sub(a.samples[1].time) >= a.cfg.Window {
+		a.samples = a.samples[1:]
+	}
+	base := a.samples[0]
+
+	requests := current.requests - base.requests
+	if a.cfg.ErrorPercent > 0 && requests > 0 && requests >= float64(a.cfg.MinRequests) {
+		percent := (current.errors - base.errors) / requests * 100
+		if percent >= a.cfg.ErrorPercent {
+			a.send(now, alertPayload{
+				Text:      fmt.Sprintf("%.1f%% of %d requests returned 5xx in the last %s (threshold %g%%)", percent, int(requests), a.cfg.Window, a.cfg.ErrorPercent),
+				Alert:     alert5xxRate,
+				Value:     percent,
+				Threshold: a.cfg.ErrorPercent,
+			})
+		}
+	}
+	if errors := current.proxyErrors - base.proxyErrors; a.cfg.ProxyErrors > 0 && errors >= float64(a.cfg.ProxyErrors) {
+		a.send(now, alertPayload{
+			Text:      fmt.Sprintf("%d proxy errors in the last %s (threshold %d)", int(errors), a.cfg.Window, a.cfg.ProxyErrors),
+			Alert:     alertProxyErrors,
+			Value:     errors,
+			Threshold: float64(a.cfg.ProxyErrors),
+		})
+	}
+}
+
+// send は ALERT_COOLDOWN の間に同じ種類の通知を送っていなければ Webhook に送る
+func (a *alerter) send(now time.Time, payload alertPayload) {
+	if !a.last.allow(payload.Alert, now, a.cfg.Cooldown) {
+		return
+	}
+	payload.Window = a.cfg.Window.String()
+	payload.Host = a.host
+	payload.Text = fmt.Sprintf("spa-server on %s: %s", a.host, payload.Text)
+	warnf("Alert: %s", payload.Text)
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		errorf("Alert: %v", err)
+		return
+	}
+	resp, err := a.client.Post(a.cfg.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		errorf("Sending alert to webhook: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		errorf("Sending alert to webhook: %s", resp.Status)
+	}
+}
@@ -0,0 +1,78 @@
+package spaserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAlerter(t *testing.T) {
+	var mu sync.Mutex
+	var received []alertPayload
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload alertPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		received = append(received, payload)
+		mu.Unlock()
+	}))
+	defer webhook.Close()
+
+	cfg := DefaultConfig().Alert
+	cfg.WebhookURL = webhook.URL
+	cfg.ErrorPercent = 10
+	cfg.MinRequests = 10
+	cfg.ProxyErrors = 3
+	st := newServerState()
+	a := newAlerter(cfg, st)
+
+	start := time.Now()
+	a.check(start)
+	// 5xx が 2/20 = 10%、プロキシのエラーは 2 件
+	st.metrics.requests.Add(18, "GET", "200")
+	st.metrics.requests.Add(2, "GET", "502")
+	st.metrics.proxyErrors.Add(2)
+	a.check(start.Add(time.Minute))
+	if len(received) != 1 || received[0].Alert != alert5xxRate || received[0].Value != 10 {
+		t.Fatalf("5xx の割合の通知が送られていません: %+v", received)
+	}
+	if !strings.Contains(received[0].Text, "10.0% of 20 requests") || received[0].Window != "5m0s" {
+		t.Errorf("通知の内容が正しくありません: %+v", received[0])
+	}
+
+	// ALERT_COOLDOWN の間は同じ種類の通知を送らない
+	st.metrics.proxyErrors.Add(1)
+	a.check(start.Add(2 * time.Minute))
+	if len(received) != 2 || received[1].Alert != alertProxyErrors || received[1].Value != 3 {
+		t.Fatalf("プロキシのエラーの通知のみ送られるべきです: %+v", received)
+	}
+
+	// ALERT_WINDOW を過ぎた増加は数えない
+	a.check(start.Add(cfg.Cooldown + 10*time.Minute))
+	st.metrics.requests.Add(100, "GET", "200")
+	a.check(start.Add(cfg.Cooldown + 11*time.Minute))
+	if len(received) != 2 {
+		t.Errorf("しきい値を下回る場合は通知するべきではありません: %+v", received[2:])
+	}
+}
+
+func TestAlerterMinRequests(t *testing.T) {
+	cfg := DefaultConfig().Alert
+	cfg.WebhookURL = "http://127.0.0.1:1/"
+	cfg.ErrorPercent = 10
+	st := newServerState()
+	a := newAlerter(cfg, st)
+	start := time.Now()
+	a.check(start)
+	st.metrics.requests.Add(5, "GET", "500")
+	a.check(start.Add(time.Minute))
+	if _, sent := st.lastAlerts.times[alert5xxRate]; sent {
+		t.Error("ALERT_MIN_REQUESTS に満たない場合は通知するべきではありません")
+	}
+}
@@ -0,0 +1,124 @@
+package spaserver
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// 拒否したリクエストの監査ログ
+// AUDIT_LOG_FILE を設定した場合、401・403・429 を返したリクエストと BLOCKED_PATHS に一致したリクエストを
+// 一般のログとは別に JSON Lines 形式で出力する。AUDIT_LOG_FILE=syslog の場合は SYSLOG_ADDR に MSGID audit で送る
+
+const auditLogSyslog = "syslog"
+
+// auditHeaders は監査ログに含めるリクエストヘッダー（Cookie や Authorization の値は含めない）
+var auditHeaders = []string{"User-Agent", "Referer", "Origin", "X-Forwarded-For", "X-Real-IP"}
+
+// auditEntry は監査ログの1行
+type auditEntry struct {
+	Time       string            `json:"time"`
+	Status     int               `json:"status"`
+	Rule       string            `json:"rule"`
+	ClientIP   string            `json:"client_ip"`
+	RemoteAddr string            `json:"remote_addr"`
+	Method     string            `json:"method"`
+	Host       string            `json:"host"`
+	Path       string            `json:"path"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	// Authorization ヘッダーが送られたか（値は含めない）
+	Authorization bool `json:"authorization,omitempty"`
+}
+
+// auditLogger は拒否したリクエストを監査ログに出力する
+type auditLogger struct {
+	logger *log.Logger
+}
+
+func newAuditLogger(cfg LogConfig) (*auditLogger, error) {
+	switch cfg.AuditFile {
+	case "":
+		return nil, nil
+	case auditLogSyslog:
+		out, err := openSyslog(cfg, syslogMsgAudit)
+		if err != nil {
+			return nil, err
+		}
+		return &auditLogger{logger: log.New(out, "", 0)}, nil
+	default:
+		return &auditLogger{logger: log.New(openLogFile(cfg.AuditFile, cfg), "", 0)}, nil
+	}
+}
+
+// auditRuleKey は拒否の理由の記録先のコンテキストキー
+type auditRuleKey struct{}
+
+// recordAuditRule はリクエストを拒否した理由（一致したルール）を記録する（監査ログが無効の場合は何もしない）
+func recordAuditRule(ctx context.Context, rule string) {
+	if p, ok := ctx.Value(auditRuleKey{}).(*string); ok {
+		*p = rule
+	}
+}
+
+// blockRequest は拒否したリクエストを管理画面と監査ログに記録する
+func (s *server) blockRequest(r *http.Request, reason string) {
+	s.state.recentBlocked.add(getClientIP(r), r.URL.Path, reason)
+	recordAuditRule(r.Context(), reason)
+}
+
+// isAuditStatus は理由が記録されていなくても監査ログに出力するステータスコードかを返す
+func isAuditStatus(status int) bool {
+	return status == http.StatusUnauthorized || status == http.StatusForbidden || status == http.StatusTooManyRequests
+}
+
+// Wrap は拒否したリクエストを監査ログに出力する
+func (a *auditLogger) Wrap(next http.Handler) http.Handler {
+	if a == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rule string
+		r = r.WithContext(context.WithValue(r.Context(), auditRuleKey{}, &rule))
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rule == "" && !isAuditStatus(rec.Status()) {
+			return
+		}
+		if rule == "" {
+			// プロキシ先が返したもの
+			rule = "-"
+			if routeClassOf(r.Context()) == routeProxy {
+				rule = "upstream"
+			}
+		}
+		a.log(r, rec.Status(), rule)
+	})
+}
+
+func (a *auditLogger) log(r *http.Request, status int, rule string) {
+	entry := auditEntry{
+		Time:          time.Now().UTC().Format(time.RFC3339Nano),
+		Status:        status,
+		Rule:          rule,
+		ClientIP:      getClientIP(r),
+		RemoteAddr:    r.RemoteAddr,
+		Method:        r.Method,
+		Host:          r.Host,
+		Path:          r.URL.Path,
+		Headers:       map[string]string{},
+		Authorization: r.Header.Get("Authorization") != "",
+	}
+	for _, name := range auditHeaders {
+		if v := r.Header.Get(name); v != "" {
+			entry.Headers[name] = v
+		}
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		errorf("Audit log: %v", err)
+		return
+	}
+	a.logger.Print(string(line))
+}
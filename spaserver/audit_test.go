@@ -0,0 +1,67 @@
+package spaserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+	auditFile := filepath.Join(t.TempDir(), "audit.log")
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.AllowRemoteIPs = []string{"10.0.0."}
+	cfg.BlockedPaths = []string{"*.php"}
+	cfg.Admin.Token = "secret"
+	cfg.Log.AuditFile = auditFile
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	request := func(path, remoteAddr string) *http.Request {
+		r := httptest.NewRequest("GET", path, nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("User-Agent", "scanner/1.0")
+		return r
+	}
+	// 許可されたリクエストは出力しない
+	s.ServeHTTP(httptest.NewRecorder(), request("/", "10.0.0.1:1234"))
+	s.ServeHTTP(httptest.NewRecorder(), request("/", "192.0.2.1:1234"))
+	s.ServeHTTP(httptest.NewRecorder(), request("/wp-login.php", "10.0.0.1:1234"))
+	s.admin.ServeHTTP(httptest.NewRecorder(), request(statsPath, "127.0.0.1:1234"))
+
+	data, err := os.ReadFile(auditFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []auditEntry{
+		{Status: http.StatusForbidden, Rule: "ALLOW_REMOTE_IPS", ClientIP: "192.0.2.1", Path: "/"},
+		{Status: http.StatusNotFound, Rule: "BLOCKED_PATHS *.php", ClientIP: "10.0.0.1", Path: "/wp-login.php"},
+		{Status: http.StatusUnauthorized, Rule: "ADMIN_TOKEN", ClientIP: "127.0.0.1", Path: statsPath},
+	}
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	if len(lines) != len(expected) {
+		t.Fatalf("期待される行数 %d, 実際の監査ログ %s", len(expected), data)
+	}
+	for i, line := range lines {
+		var entry auditEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			t.Fatalf("%v: %s", err, line)
+		}
+		want := expected[i]
+		if entry.Status != want.Status || entry.Rule != want.Rule || entry.ClientIP != want.ClientIP || entry.Path != want.Path {
+			t.Errorf("期待される値 %+v, 実際の値 %s", want, line)
+		}
+		if entry.Time == "" || entry.Headers["User-Agent"] != "scanner/1.0" {
+			t.Errorf("時刻とヘッダーが含まれていません: %s", line)
+		}
+	}
+}
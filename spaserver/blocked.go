@@ -0,0 +1,46 @@
+package spaserver
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// ブロックするパス
+// スキャナーが送ってくる /wp-admin/ や *.php などへのリクエストをルーティングより前に 404 で返す。
+// "/" を含まないパターン（*.php）は最後のセグメントと、"/" で始まるパターンはパス全体と照合し、
+// 末尾の "/*" は配下のすべてのパスに一致する
+
+// blockedPattern はパスに一致するブロック対象のパターンを返す（一致しない場合は空文字列）
+func blockedPattern(patterns []string, urlPath string) string {
+	base := path.Base(urlPath)
+	for _, pattern := range patterns {
+		if !strings.HasPrefix(pattern, "/") {
+			if ok, _ := path.Match(pattern, base); ok {
+				return pattern
+			}
+			continue
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && (urlPath == prefix || strings.HasPrefix(urlPath, prefix+"/")) {
+			return pattern
+		}
+		if ok, _ := path.Match(pattern, urlPath); ok {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// blockPath はブロック対象のパスに 404 を返して false を返す
+func (s *server) blockPath(w http.ResponseWriter, r *http.Request) bool {
+	pattern := blockedPattern(s.cfg.BlockedPaths, r.URL.Path)
+	if pattern == "" {
+		return true
+	}
+	s.state.metrics.blockedRequests.Add(1, pattern)
+	s.blockRequest(r, "BLOCKED_PATHS "+pattern)
+	setRouteClass(r.Context(), routeBlocked)
+	infof("Blocked path: %s %s (client IP %s)", metricMethod(r.Method), escapeLogValue(r.URL.Path), getClientIP(r))
+	http.NotFound(w, r)
+	return false
+}
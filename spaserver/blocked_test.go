@@ -0,0 +1,46 @@
+package spaserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestBlockedPaths(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.BlockedPaths = []string{"*.php", "/wp-admin/*", "/backup-*.zip"}
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		name         string
+		path         string
+		expectedCode int
+	}{
+		{"拡張子", "/xmlrpc.php", http.StatusNotFound},
+		{"サブディレクトリの拡張子", "/blog/wp-login.php", http.StatusNotFound},
+		{"配下のすべてのパス", "/wp-admin/includes/setup.js", http.StatusNotFound},
+		{"ディレクトリそのもの", "/wp-admin", http.StatusNotFound},
+		{"パス全体のパターン", "/backup-2024.zip", http.StatusNotFound},
+		{"一致しないパスは SPA を返す", "/wp-admins", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+			if rr.Code != tt.expectedCode {
+				t.Errorf("期待されるステータスコード %d, 実際のステータスコード %d", tt.expectedCode, rr.Code)
+			}
+		})
+	}
+	if got := s.state.metrics.blockedRequests.Value("*.php"); got != 2 {
+		t.Errorf("期待されるブロック数 2, 実際のブロック数 %v", got)
+	}
+}
@@ -0,0 +1,114 @@
+package spaserver
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+)
+
+// リクエストボディのバッファリング
+// プロキシする前にボディを読み切り、PROXY_BUFFER_BYTES までをメモリ、それを超える分を PROXY_BUFFER_DIR の
+// 一時ファイルに保存する。Content-Length が付き、接続の切断時などにトランスポートがボディを送り直せるようになる
+
+// bodyBuffer はリクエストボディのバッファリングの設定
+type bodyBuffer struct {
+	// メモリに保持するボディの上限
+	memory int64
+	// 上限を超えたボディを保存するディレクトリ（空の場合は 413 を返す）
+	dir string
+	// 一時ファイルに保存するボディの上限（0 は無制限）
+	max int64
+}
+
+func newBodyBuffer(cfg ProxyConfig) *bodyBuffer {
+	if cfg.BufferBytes <= 0 {
+		return nil
+	}
+	return &bodyBuffer{memory: int64(cfg.BufferBytes), dir: cfg.BufferDir, max: int64(cfg.BufferMaxBytes)}
+}
+
+// limit はバッファリングできるボディの上限を返す（0 は無制限）
+func (b *bodyBuffer) limit() int64 {
+	if b.dir == "" {
+		return b.memory
+	}
+	return b.max
+}
+
+// buffer はリクエストボディを読み切り、読み直せるボディに置き換える
+// 上限を超えた場合や読み込みに失敗した場合はエラーを返して false を返す。cleanup は一時ファイルを削除する
+func (b *bodyBuffer) buffer(w http.ResponseWriter, r *http.Request) (cleanup func(), ok bool) {
+	cleanup = func() {}
+	if b == nil || r.Body == nil || r.Body == http.NoBody {
+		return cleanup, true
+	}
+	if limit := b.limit(); limit > 0 && r.ContentLength > limit {
+		debugf("Request body too large to buffer: %s %s (%d bytes)", r.Method, r.URL.Path, r.ContentLength)
+		http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+		return cleanup, false
+	}
+
+	var mem bytes.Buffer
+	n, err := io.CopyN(&mem, r.Body, b.memory+1)
+	if err != nil && err != io.EOF {
+		bufferError(w, r, err)
+		return cleanup, false
+	}
+	if n <= b.memory {
+		data := mem.Bytes()
+		setBufferedBody(r, int64(len(data)), func() io.ReadCloser { return io.NopCloser(bytes.NewReader(data)) })
+		return cleanup, true
+	}
+	if b.dir == "" {
+		debugf("Request body too large to buffer: %s %s", r.Method, r.URL.Path)
+		http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+		return cleanup, false
+	}
+
+	// メモリに収まらない分は一時ファイルに保存する
+	f, err := os.CreateTemp(b.dir, "spa-body-*")
+	if err != nil {
+		errorf("Error creating request body buffer: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return cleanup, false
+	}
+	cleanup = func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	src := io.MultiReader(&mem, r.Body)
+	if b.max > 0 {
+		src = io.LimitReader(src, b.max+1)
+	}
+	size, err := io.Copy(f, src)
+	if err != nil {
+		bufferError(w, r, err)
+		return cleanup, false
+	}
+	if b.max > 0 && size > b.max {
+		debugf("Request body too large to buffer: %s %s", r.Method, r.URL.Path)
+		http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+		return cleanup, false
+	}
+	setBufferedBody(r, size, func() io.ReadCloser { return io.NopCloser(io.NewSectionReader(f, 0, size)) })
+	return cleanup, true
+}
+
+// setBufferedBody はバッファリングしたボディをリクエストに設定する
+func setBufferedBody(r *http.Request, size int64, body func() io.ReadCloser) {
+	r.Body = body()
+	r.GetBody = func() (io.ReadCloser, error) { return body(), nil }
+	r.ContentLength = size
+	r.TransferEncoding = nil
+}
+
+// bufferError はボディの読み込みのエラーを返す（MAX_BODY_BYTES を超えた場合は 413）
+func bufferError(w http.ResponseWriter, r *http.Request, err error) {
+	if isBodyTooLarge(err) {
+		http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	debugf("Error reading request body: %s %s: %v", r.Method, r.URL.Path, err)
+	http.Error(w, "Bad Request", http.StatusBadRequest)
+}
@@ -0,0 +1,69 @@
+package spaserver
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBodyBuffer(t *testing.T) {
+	// バックエンドは受け取った Content-Length とボディの長さを返す
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%d %d", r.ContentLength, len(body))
+	}))
+	defer backend.Close()
+
+	dist := t.TempDir()
+	os.WriteFile(dist+"/index.html", []byte("SPA"), 0644)
+	spill := t.TempDir()
+
+	tests := []struct {
+		name     string
+		dir      string
+		size     int
+		expected int
+	}{
+		{"メモリに収まる", "", 10, http.StatusOK},
+		{"一時ファイルなしで上限を超える", "", 100, http.StatusRequestEntityTooLarge},
+		{"一時ファイルに保存する", spill, 100, http.StatusOK},
+		{"一時ファイルの上限を超える", spill, 1000, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.DistDir = dist
+			cfg.Proxy.URL = backend.URL
+			cfg.Proxy.Paths = []string{"/upload"}
+			cfg.Proxy.BufferBytes = 50
+			cfg.Proxy.BufferDir = tt.dir
+			cfg.Proxy.BufferMaxBytes = 500
+			s, err := newServer(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			// Content-Length のないチャンク形式のボディ
+			req := httptest.NewRequest("POST", "/upload", strings.NewReader(strings.Repeat("a", tt.size)))
+			req.ContentLength = -1
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, req)
+			if rr.Code != tt.expected {
+				t.Fatalf("期待されるステータスコード %d, 実際のステータスコード %d", tt.expected, rr.Code)
+			}
+			if tt.expected == http.StatusOK {
+				if want := fmt.Sprintf("%d %d", tt.size, tt.size); rr.Body.String() != want {
+					t.Errorf("期待されるボディ %q, 実際のボディ %q", want, rr.Body.String())
+				}
+			}
+			if entries, _ := os.ReadDir(spill); len(entries) != 0 {
+				t.Errorf("一時ファイルが削除されていません: %v", entries)
+			}
+		})
+	}
+}
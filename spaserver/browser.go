@@ -0,0 +1,43 @@
+package spaserver
+
+import (
+	"net"
+	"os/exec"
+	"runtime"
+	"strconv"
+)
+
+// browserURL はリスナーのアドレスからブラウザーで開く URL を作成する（unix ドメインソケットの場合は空）
+func browserURL(addr net.Addr, https bool) string {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return ""
+	}
+	host := "localhost"
+	if !tcp.IP.IsUnspecified() && !tcp.IP.IsLoopback() {
+		host = tcp.IP.String()
+	}
+	scheme := "http"
+	if https {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(host, strconv.Itoa(tcp.Port)) + "/"
+}
+
+// openBrowser は URL をデフォルトのブラウザーで開く
+func openBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
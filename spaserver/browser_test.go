@@ -0,0 +1,24 @@
+package spaserver
+
+import (
+	"net"
+	"testing"
+)
+
+func TestBrowserURL(t *testing.T) {
+	tests := []struct {
+		addr     net.Addr
+		https    bool
+		expected string
+	}{
+		{&net.TCPAddr{IP: net.IPv6unspecified, Port: 8080}, false, "http://localhost:8080/"},
+		{&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8443}, true, "https://localhost:8443/"},
+		{&net.TCPAddr{IP: net.IPv4(192, 168, 1, 10), Port: 8080}, false, "http://192.168.1.10:8080/"},
+		{&net.UnixAddr{Name: "/run/spa.sock", Net: "unix"}, false, ""},
+	}
+	for _, tt := range tests {
+		if got := browserURL(tt.addr, tt.https); got != tt.expected {
+			t.Errorf("browserURL(%s) = %q, 期待値 %q", tt.addr, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package spaserver
+
+import (
+	"container/list"
+	"sync"
+)
+
+// byteCache は合計サイズの上限を持つ LRU のメモリキャッシュ
+type byteCache struct {
+	mu    sync.Mutex
+	max   int64
+	size  int64
+	order *list.List
+	items map[string]*list.Element
+}
+
+type byteCacheEntry struct {
+	key  string
+	data []byte
+}
+
+func newByteCache(max int64) *byteCache {
+	return &byteCache{max: max, order: list.New(), items: map[string]*list.Element{}}
+}
+
+// get はキャッシュされた値を返す
+func (c *byteCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*byteCacheEntry).data, true
+}
+
+// put は値をキャッシュし、上限を超えた分を古いものから削除する（上限より大きい値はキャッシュしない）
+func (c *byteCache) put(key string, data []byte) {
+	if int64(len(data)) > c.max {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.size -= int64(len(e.Value.(*byteCacheEntry).data))
+		c.order.Remove(e)
+	}
+	c.items[key] = c.order.PushFront(&byteCacheEntry{key: key, data: data})
+	c.size += int64(len(data))
+	for c.size > c.max {
+		oldest := c.order.Back()
+		entry := oldest.Value.(*byteCacheEntry)
+		c.order.Remove(oldest)
+		delete(c.items, entry.key)
+		c.size -= int64(len(entry.data))
+	}
+}
+
+// clear はすべての値を削除する
+func (c *byteCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.items = map[string]*list.Element{}
+	c.size = 0
+}
@@ -0,0 +1,23 @@
+package spaserver
+
+import "net/http"
+
+// キャッシュの状態
+// 最小化した HTML とリサイズした画像のレスポンスに X-Cache ヘッダーでキャッシュから返したかを付け、
+// アクセスログとメトリクスにも記録する
+// キャッシュはファイルのサイズと更新日時をキーにするため、古い内容を返すこと（STALE）はない
+
+const (
+	cacheHit  = "HIT"
+	cacheMiss = "MISS"
+)
+
+// setCacheStatus はレスポンスに X-Cache ヘッダーを付け、キャッシュごとの件数を m に記録する
+func setCacheStatus(w http.ResponseWriter, m *serverMetrics, cache string, hit bool) {
+	status := cacheMiss
+	if hit {
+		status = cacheHit
+	}
+	w.Header().Set("X-Cache", status)
+	m.cacheRequests.Add(1, cache, status)
+}
@@ -0,0 +1,76 @@
+package spaserver
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCacheStatus(t *testing.T) {
+	dir := t.TempDir()
+	indexPath := filepath.Join(dir, "index.html")
+	os.WriteFile(indexPath, []byte("<p>  SPA  </p>"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.MinifyHTML = true
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	steps := []struct {
+		name     string
+		change   bool
+		expected string
+	}{
+		{"最初のリクエスト", false, cacheMiss},
+		{"2回目のリクエスト", false, cacheHit},
+		{"ファイルの変更後", true, cacheMiss},
+		{"変更後の2回目のリクエスト", false, cacheHit},
+	}
+	for _, step := range steps {
+		if step.change {
+			os.WriteFile(indexPath, []byte("<p>  SPA v2  </p>"), 0644)
+			later := time.Now().Add(time.Minute)
+			os.Chtimes(indexPath, later, later)
+		}
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, httptest.NewRequest("GET", "/users/1", nil))
+		if got := rr.Header().Get("X-Cache"); got != step.expected {
+			t.Errorf("%s: 期待される X-Cache %q, 実際の X-Cache %q", step.name, step.expected, got)
+		}
+	}
+
+	// 静的ファイルのキャッシュを使わないレスポンスには付けない
+	os.WriteFile(filepath.Join(dir, "app.js"), []byte("var a = 1;"), 0644)
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest("GET", "/app.js", nil))
+	if got := rr.Header().Get("X-Cache"); got != "" {
+		t.Errorf("キャッシュを使わないレスポンスに X-Cache が付いています: %q", got)
+	}
+}
+
+func TestCacheStatusAccessLog(t *testing.T) {
+	l, err := newAccessLogger(LogConfig{AccessFormat: accessLogCommon})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	l.logger = log.New(&buf, "", 0)
+
+	handler := l.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		setCacheStatus(w, newServerMetrics(), "html", true)
+		w.Write([]byte("hello"))
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if line := strings.TrimSpace(buf.String()); !strings.HasSuffix(line, ` cache="HIT"`) {
+		t.Errorf("アクセスログに cache=\"HIT\" が含まれていません: %s", line)
+	}
+}
@@ -0,0 +1,67 @@
+package spaserver
+
+import (
+	"math/rand"
+	"net/http"
+	"strings"
+)
+
+const (
+	variantStable = "stable"
+	variantCanary = "canary"
+)
+
+// canaryMaxAge は振り分け結果を保持するクッキーの有効期間（秒）
+const canaryMaxAge = 30 * 24 * 60 * 60
+
+// canary は安定版とカナリア版のビルドへのトラフィック振り分けを行う
+type canary struct {
+	root    *distRoot
+	percent float64
+	cookie  string
+	header  string
+	// 管理 API で変更した割合
+	ops *runtimeOperations
+}
+
+func newCanary(cfg Config, root *distRoot, ops *runtimeOperations) *canary {
+	return &canary{
+		root:    root,
+		percent: cfg.Canary.Percent,
+		cookie:  cfg.Canary.Cookie,
+		header:  cfg.Canary.Header,
+		ops:     ops,
+	}
+}
+
+// variant はリクエストの振り分け先を決定する
+// ヘッダー指定 > クッキー > 割合による抽選 の順で判定し、抽選した場合はクッキーで固定する
+func (c *canary) variant(w http.ResponseWriter, r *http.Request) string {
+	if c.header != "" {
+		switch strings.ToLower(r.Header.Get(c.header)) {
+		case "1", "true", variantCanary:
+			return variantCanary
+		case "0", "false", variantStable:
+			return variantStable
+		}
+	}
+	if cookie, err := r.Cookie(c.cookie); err == nil {
+		if cookie.Value == variantStable || cookie.Value == variantCanary {
+			return cookie.Value
+		}
+	}
+
+	v := variantStable
+	if rand.Float64()*100 < c.ops.canary(c.percent) {
+		v = variantCanary
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     c.cookie,
+		Value:    v,
+		Path:     "/",
+		MaxAge:   canaryMaxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return v
+}
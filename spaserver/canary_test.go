@@ -0,0 +1,81 @@
+package spaserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestCanary(t *testing.T) {
+	stableDir := t.TempDir()
+	canaryDir := t.TempDir()
+	os.WriteFile(stableDir+"/index.html", []byte("stable"), 0644)
+	os.WriteFile(canaryDir+"/index.html", []byte("canary"), 0644)
+
+	tests := []struct {
+		name         string
+		percent      float64
+		cookie       string
+		header       string
+		expectedBody string
+		expectCookie bool
+	}{
+		{
+			name:         "割合が0の場合は安定版が返され、クッキーで固定される",
+			percent:      0,
+			expectedBody: "stable",
+			expectCookie: true,
+		},
+		{
+			name:         "割合が100の場合はカナリア版が返される",
+			percent:      100,
+			expectedBody: "canary",
+			expectCookie: true,
+		},
+		{
+			name:         "クッキーがある場合はクッキーの振り分けが優先される",
+			percent:      100,
+			cookie:       "stable",
+			expectedBody: "stable",
+		},
+		{
+			name:         "ヘッダー指定はクッキーより優先される",
+			percent:      0,
+			cookie:       "stable",
+			header:       "1",
+			expectedBody: "canary",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.DistDir = stableDir
+			cfg.Canary.Dir = canaryDir
+			cfg.Canary.Percent = tt.percent
+			cfg.Canary.Header = "X-Canary"
+			s, err := newServer(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest("GET", "/some/route", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: cfg.Canary.Cookie, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				req.Header.Set("X-Canary", tt.header)
+			}
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, req)
+
+			if body := rr.Body.String(); body != tt.expectedBody {
+				t.Errorf("期待されるレスポンス %q, 実際のレスポンス %q", tt.expectedBody, body)
+			}
+			if hasCookie := rr.Header().Get("Set-Cookie") != ""; hasCookie != tt.expectCookie {
+				t.Errorf("クッキーの設定が期待と異なります: %v", rr.Header().Get("Set-Cookie"))
+			}
+		})
+	}
+}
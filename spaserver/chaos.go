@@ -0,0 +1,50 @@
+package spaserver
+
+import (
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// chaosInjector はプロキシパスへのリクエストに遅延・エラー・切断を確率的に発生させる
+// フロントエンドのリトライやエラー表示を確認するためのテスト用の機能
+type chaosInjector struct {
+	cfg    ChaosConfig
+	random func() float64 // [0, 100) の乱数
+	sleep  func(time.Duration)
+}
+
+func newChaosInjector(cfg ChaosConfig) *chaosInjector {
+	if cfg.LatencyPercent <= 0 && cfg.ErrorPercent <= 0 && cfg.DropPercent <= 0 {
+		return nil
+	}
+	warnf("Chaos injection enabled: latency %s (%g%%), errors %d (%g%%), dropped connections (%g%%)",
+		cfg.Latency, cfg.LatencyPercent, cfg.ErrorStatus, cfg.ErrorPercent, cfg.DropPercent)
+	return &chaosInjector{
+		cfg:    cfg,
+		random: func() float64 { return rand.Float64() * 100 },
+		sleep:  time.Sleep,
+	}
+}
+
+// inject は障害を発生させる。リクエストの処理を続ける場合は true を返す
+func (c *chaosInjector) inject(w http.ResponseWriter, r *http.Request) bool {
+	if len(c.cfg.Paths) > 0 && !matchProxyPath(c.cfg.Paths, r.URL.Path) {
+		return true
+	}
+	if c.random() < c.cfg.LatencyPercent {
+		debugf("Chaos: delaying %s %s by %s", r.Method, r.URL.Path, c.cfg.Latency)
+		c.sleep(c.cfg.Latency)
+	}
+	if c.random() < c.cfg.DropPercent {
+		debugf("Chaos: dropping connection for %s %s", r.Method, r.URL.Path)
+		// レスポンスを返さずに接続を切る
+		panic(http.ErrAbortHandler)
+	}
+	if c.random() < c.cfg.ErrorPercent {
+		debugf("Chaos: responding %d to %s %s", c.cfg.ErrorStatus, r.Method, r.URL.Path)
+		http.Error(w, http.StatusText(c.cfg.ErrorStatus), c.cfg.ErrorStatus)
+		return false
+	}
+	return true
+}
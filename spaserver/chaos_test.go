@@ -0,0 +1,97 @@
+package spaserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func newChaosTestServer(t *testing.T, chaos ChaosConfig) *server {
+	t.Helper()
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("backend"))
+	}))
+	t.Cleanup(backend.Close)
+
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Proxy.URL = backend.URL
+	cfg.Proxy.Paths = []string{"/api", "/query"}
+	cfg.Chaos = chaos
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestChaosError(t *testing.T) {
+	s := newChaosTestServer(t, ChaosConfig{ErrorPercent: 100, ErrorStatus: http.StatusBadGateway, Paths: []string{"/api"}})
+
+	tests := []struct {
+		path           string
+		expectedStatus int
+	}{
+		{"/api/users", http.StatusBadGateway},
+		{"/query", http.StatusOK},
+		{"/", http.StatusOK},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+		if rr.Code != tt.expectedStatus {
+			t.Errorf("%s: 期待されるステータスコード %d, 実際のステータスコード %d", tt.path, tt.expectedStatus, rr.Code)
+		}
+	}
+}
+
+func TestChaosLatency(t *testing.T) {
+	s := newChaosTestServer(t, ChaosConfig{Latency: 5 * time.Second, LatencyPercent: 50, ErrorStatus: 503})
+	var slept []time.Duration
+	s.chaos.sleep = func(d time.Duration) { slept = append(slept, d) }
+
+	// 割合未満の乱数のときだけ遅延させる
+	for _, n := range []float64{10, 60} {
+		s.chaos.random = func() float64 { return n }
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, httptest.NewRequest("GET", "/api/users", nil))
+		if rr.Code != http.StatusOK {
+			t.Errorf("期待されるステータスコード %d, 実際のステータスコード %d", http.StatusOK, rr.Code)
+		}
+	}
+	if len(slept) != 1 || slept[0] != 5*time.Second {
+		t.Errorf("1回だけ 5s 遅延させる必要があります: %v", slept)
+	}
+}
+
+func TestChaosDrop(t *testing.T) {
+	s := newChaosTestServer(t, ChaosConfig{DropPercent: 100, ErrorStatus: 503})
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/api/users")
+	if err == nil {
+		resp.Body.Close()
+		t.Fatalf("接続が切られていません: %d", resp.StatusCode)
+	}
+
+	resp, err = http.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("期待されるステータスコード %d, 実際のステータスコード %d", http.StatusOK, resp.StatusCode)
+	}
+}
+
+func TestChaosDisabled(t *testing.T) {
+	if newChaosInjector(ChaosConfig{Latency: time.Second, ErrorStatus: 503}) != nil {
+		t.Error("割合が 0 の場合は無効にする必要があります")
+	}
+}
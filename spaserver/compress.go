@@ -0,0 +1,178 @@
+package spaserver
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// プロキシしたレスポンスの圧縮
+// PROXY_COMPRESS_PATHS に一致するパスで、プロキシ先が圧縮していないレスポンスを
+// クライアントの Accept-Encoding に合わせて brotli または gzip で圧縮する
+
+// compressor はレスポンスの圧縮の設定
+type compressor struct {
+	paths []string
+	// 圧縮する Content-Type（text/* のような指定もできる）
+	types []string
+	// Content-Length がこれより小さいレスポンスは圧縮しない
+	minBytes int64
+}
+
+func newCompressor(cfg ProxyConfig) *compressor {
+	if len(cfg.CompressPaths) == 0 {
+		return nil
+	}
+	return &compressor{paths: cfg.CompressPaths, types: cfg.CompressTypes, minBytes: int64(cfg.CompressMinBytes)}
+}
+
+// wrap はパスが一致する場合に圧縮するライターを返す
+func (c *compressor) wrap(w http.ResponseWriter, r *http.Request) *compressWriter {
+	if c == nil || r.Method == http.MethodHead || !matchProxyPath(c.paths, r.URL.Path) {
+		return nil
+	}
+	// 圧縮に対応していないクライアントにも Vary を返すため、encoding が空でもラップする
+	return &compressWriter{ResponseWriter: w, c: c, encoding: negotiateEncoding(r.Header.Get("Accept-Encoding"))}
+}
+
+// negotiateEncoding は Accept-Encoding から使う圧縮方式を選ぶ（brotli を優先し、対応していない場合は空）
+func negotiateEncoding(accept string) string {
+	q := map[string]float64{}
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		weight := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				weight = f
+			}
+		}
+		q[name] = weight
+	}
+	for _, encoding := range []string{"br", "gzip"} {
+		weight, ok := q[encoding]
+		if !ok {
+			weight, ok = q["*"]
+		}
+		if ok && weight > 0 {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// compressible はレスポンスを圧縮するかを判定する
+func (c *compressor) compressible(code int, h http.Header) bool {
+	if code < 200 || code == http.StatusNoContent || code == http.StatusPartialContent || code == http.StatusNotModified {
+		return false
+	}
+	// プロキシ先が圧縮済み
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	if strings.Contains(h.Get("Cache-Control"), "no-transform") {
+		return false
+	}
+	if n, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); err == nil && n < c.minBytes {
+		return false
+	}
+	return matchContentType(c.types, h.Get("Content-Type"))
+}
+
+var (
+	gzipWriters   = sync.Pool{New: func() any { return gzip.NewWriter(io.Discard) }}
+	brotliWriters = sync.Pool{New: func() any { return brotli.NewWriterLevel(io.Discard, brotli.DefaultCompression) }}
+)
+
+// encoder は圧縮する io.WriteCloser と書き出し用の Flush
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+// compressWriter はレスポンスヘッダーを見て、必要な場合にボディを圧縮して書き込む
+type compressWriter struct {
+	http.ResponseWriter
+	c        *compressor
+	encoding string
+	decided  bool
+	enc      encoder
+}
+
+// decide はレスポンスヘッダーから圧縮するかを決め、圧縮する場合はヘッダーを書き換える
+func (cw *compressWriter) decide(code int) {
+	if cw.decided {
+		return
+	}
+	cw.decided = true
+	h := cw.Header()
+	// 圧縮の有無に関わらず、キャッシュが Accept-Encoding ごとに保存するようにする
+	if code >= 200 && code != http.StatusNotModified {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	if cw.encoding == "" || !cw.c.compressible(code, h) {
+		return
+	}
+	h.Set("Content-Encoding", cw.encoding)
+	h.Del("Content-Length")
+	// 圧縮後のボディは元とバイト単位で一致しないため弱い ETag にする
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		h.Set("ETag", "W/"+etag)
+	}
+	if cw.encoding == "br" {
+		cw.enc = brotliWriters.Get().(*brotli.Writer)
+	} else {
+		cw.enc = gzipWriters.Get().(*gzip.Writer)
+	}
+	cw.enc.Reset(cw.ResponseWriter)
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if code >= 200 {
+		cw.decide(code)
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.decided {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.enc == nil {
+		return cw.ResponseWriter.Write(p)
+	}
+	return cw.enc.Write(p)
+}
+
+// Flush は圧縮途中のデータも書き出してからクライアントに送る
+func (cw *compressWriter) Flush() {
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// close は圧縮の残りを書き出して encoder を再利用できるように戻す
+func (cw *compressWriter) close() {
+	if cw.enc == nil {
+		return
+	}
+	cw.enc.Close()
+	cw.enc.Reset(io.Discard)
+	if cw.encoding == "br" {
+		brotliWriters.Put(cw.enc)
+	} else {
+		gzipWriters.Put(cw.enc)
+	}
+	cw.enc = nil
+}
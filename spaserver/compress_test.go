@@ -0,0 +1,114 @@
+package spaserver
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestCompressProxiedResponse(t *testing.T) {
+	body := strings.Repeat(`{"id":1,"name":"test"},`, 100)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/gzipped":
+			w.Header().Set("Content-Encoding", "gzip")
+		case "/api/small":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{}`))
+			return
+		case "/api/image":
+			w.Header().Set("Content-Type", "image/png")
+		default:
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(body))
+	}))
+	defer backend.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Proxy.URL = backend.URL
+	cfg.Proxy.Paths = []string{"/api", "/raw"}
+	cfg.Proxy.CompressPaths = []string{"/api"}
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		name     string
+		path     string
+		accept   string
+		expected string
+	}{
+		{"brotli を優先する", "/api/users", "gzip, deflate, br", "br"},
+		{"gzip", "/api/users", "gzip", "gzip"},
+		{"brotli を拒否", "/api/users", "br;q=0, *", "gzip"},
+		{"Accept-Encoding なし", "/api/users", "", ""},
+		{"圧縮済み", "/api/gzipped", "gzip", "gzip"},
+		{"小さいレスポンス", "/api/small", "gzip", ""},
+		{"対象外の Content-Type", "/api/image", "gzip", ""},
+		{"対象外のパス", "/raw/users", "gzip", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept-Encoding", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, req)
+			if got := rr.Header().Get("Content-Encoding"); got != tt.expected {
+				t.Fatalf("期待される Content-Encoding %q, 実際の Content-Encoding %q", tt.expected, got)
+			}
+			if tt.path != "/api/users" {
+				return
+			}
+			var r io.Reader = rr.Body
+			switch tt.expected {
+			case "br":
+				r = brotli.NewReader(rr.Body)
+			case "gzip":
+				gr, err := gzip.NewReader(rr.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r = gr
+			}
+			if got, _ := io.ReadAll(r); string(got) != body {
+				t.Errorf("展開したボディが元のボディと一致しません: %q", got)
+			}
+			if tt.expected != "" && rr.Header().Get("ETag") != `W/"v1"` {
+				t.Errorf("圧縮したレスポンスの ETag は弱い ETag にするべきです: %s", rr.Header().Get("ETag"))
+			}
+			if rr.Header().Get("Vary") != "Accept-Encoding" {
+				t.Errorf("Vary: Accept-Encoding がありません: %q", rr.Header().Get("Vary"))
+			}
+		})
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := map[string]string{
+		"gzip, br":           "br",
+		"gzip;q=1.0, br;q=0": "gzip",
+		"identity":           "",
+		"*":                  "br",
+		"*;q=0, gzip":        "gzip",
+	}
+	for accept, expected := range tests {
+		if got := negotiateEncoding(accept); got != expected {
+			t.Errorf("%q: 期待される圧縮方式 %q, 実際の圧縮方式 %q", accept, expected, got)
+		}
+	}
+}
@@ -0,0 +1,724 @@
+package spaserver
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config はサーバーの設定
+// 各項目は設定ファイル（yaml タグ）、環境変数（env タグ）、コマンドラインフラグから読み込む
+// フラグ名は flag タグ、未指定の場合は環境変数名を小文字のケバブケースにしたもの
+// secret タグの付いた項目は設定の表示時に伏せる
+type Config struct {
+	Port string `yaml:"port" env:"PORT" usage:"port to listen on"`
+	// PORT で待ち受けるインターフェースのアドレス（空の場合は全て）
+	BindAddr string `yaml:"bind_addr" env:"BIND_ADDR" usage:"interface address to bind PORT to (all interfaces if empty)"`
+	// PORT の代わりに待ち受けるアドレス（host:port または unix:/path）
+	Listen         []string `yaml:"listen" env:"LISTEN" usage:"comma-separated addresses to listen on instead of PORT: host:port or unix:/path/to.sock"`
+	SocketMode     string   `yaml:"socket_mode" env:"LISTEN_SOCKET_MODE" usage:"permissions of the unix socket (octal)"`
+	DistDir        string   `yaml:"dist_dir" env:"DIST_DIR" flag:"dist" usage:"directory containing the built SPA"`
+	AllowRemoteIPs []string `yaml:"allow_remote_ips" env:"ALLOW_REMOTE_IPS" usage:"comma-separated list of allowed client IPs or prefixes"`
+	// 起動時に DIST_DIR の index.html（RELEASES_DIR のリリース）が現れるまで待つ時間（0 の場合はすぐに終了する）
+	DistWait time.Duration `yaml:"dist_wait" env:"DIST_DIR_WAIT" usage:"on startup, wait up to this long for index.html in DIST_DIR (or a release) to appear, answering 503 meanwhile (0 exits immediately)"`
+	// 起動時に設定の検証、index.html の解析、プロキシ先の名前解決を行い、問題があれば終了する
+	Preflight bool `yaml:"preflight" env:"PREFLIGHT" usage:"on startup, validate the configuration and parse index.html, exiting with a report of every problem found; proxy hosts that do not resolve are logged as warnings"`
+	// 管理 API で追加した許可・拒否する IP アドレスを保存するファイル
+	IPRulesFile string `yaml:"ip_rules_file" env:"IP_RULES_FILE" usage:"file storing IPs allowed or denied through the admin API (kept in memory only if empty)"`
+	// ルーティングの前に重複したスラッシュとドットセグメントを取り除く
+	NormalizePaths bool `yaml:"normalize_paths" env:"NORMALIZE_PATHS" usage:"collapse duplicate slashes and dot segments before routing"`
+	// 受け付ける HTTP メソッド（それ以外は 405）と、パスごとに受け付けるメソッド（パターン=メソッド|メソッド）
+	AllowedMethods []string `yaml:"allowed_methods" env:"ALLOWED_METHODS" usage:"comma-separated HTTP methods accepted; others get 405"`
+	PathMethods    []string `yaml:"path_methods" env:"PATH_METHODS" usage:"comma-separated per path accepted methods overriding ALLOWED_METHODS, e.g. /api/reports=GET|HEAD"`
+
+	// DIST_DIR の変更を監視してキャッシュを無効化する
+	WatchDistDir bool `yaml:"watch_dist_dir" env:"WATCH_DIST_DIR" usage:"watch served directories for changes"`
+
+	// ドットで始まるファイル（.env や .git など）も配信する
+	ServeHiddenFiles bool `yaml:"serve_hidden_files" env:"SERVE_HIDDEN_FILES" usage:"serve files and directories starting with a dot (except .well-known, which is always served)"`
+	// index.html のないディレクトリの一覧を表示する（無効の場合は index.html にフォールバックする）
+	DirectoryListing bool `yaml:"directory_listing" env:"DIRECTORY_LISTING" usage:"list the contents of directories without index.html instead of serving the SPA"`
+	// Accept に応じて差し替える画像の形式（優先順、photo.jpg に対して photo.avif や photo.webp を配信する）
+	ImageFormats []string `yaml:"image_formats" env:"IMAGE_FORMATS" usage:"comma-separated image formats served instead of JPEG/PNG/GIF when accepted, in order of preference, e.g. avif,webp"`
+	// 配信する HTML からコメントと余分な空白を取り除く
+	MinifyHTML bool `yaml:"minify_html" env:"MINIFY_HTML" usage:"strip comments and collapse whitespace in served HTML files"`
+	// index.html のエントリーの script と stylesheet を Link ヘッダーでプリロードさせる
+	PreloadLinks bool `yaml:"preload_links" env:"PRELOAD_LINKS" usage:"add Link preload headers for the entry scripts and stylesheets of index.html"`
+	// DIST_DIR 内のビルドのマニフェスト（.vite/manifest.json や asset-manifest.json）
+	AssetManifest string `yaml:"asset_manifest" env:"ASSET_MANIFEST" usage:"path of the Vite/webpack manifest.json in DIST_DIR used for preloading, immutable caching and warmup"`
+	// プリロードする Link ヘッダーを 103 Early Hints でも先に送る（HTTP/2 と TLS の接続のみ）
+	EarlyHints bool `yaml:"early_hints" env:"EARLY_HINTS" usage:"send the preload Link headers in a 103 Early Hints response first (HTTP/2 and TLS only)"`
+	// ルーティングより前に 404 を返すパスのパターン（*.php や /wp-admin/* など）
+	BlockedPaths []string `yaml:"blocked_paths" env:"BLOCKED_PATHS" usage:"comma-separated path globs answered with 404 before routing, e.g. *.php,/wp-admin/*"`
+
+	// レスポンスに処理の段階ごとの時間を Server-Timing ヘッダーで付ける
+	ServerTiming bool `yaml:"server_timing" env:"SERVER_TIMING" usage:"add a Server-Timing header with ip-filter, route, upstream and serve durations"`
+
+	// 公開ポートで /__version を提供する（管理用インターフェースでは常に提供）
+	VersionEndpoint bool `yaml:"version_endpoint" env:"VERSION_ENDPOINT" usage:"serve build information at /__version"`
+
+	// 読み込む Go プラグイン（-buildmode=plugin でビルドした .so）
+	Plugins []string `yaml:"plugins" env:"PLUGINS" usage:"comma-separated Go plugin (.so) files with request/response hooks"`
+
+	// SIGTERM を受け取ってから処理中のリクエストの完了を待つ時間
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" usage:"how long to wait for in-flight requests on shutdown"`
+	// キープアライブの接続をアイドル状態で保つ時間（0 の場合は閉じない）。前段のロードバランサーより長くする
+	IdleTimeout time.Duration `yaml:"idle_timeout" env:"IDLE_TIMEOUT" usage:"close keep-alive connections idle for this long; keep it longer than the load balancer's (0 keeps them)"`
+
+	Proxy       ProxyConfig       `yaml:"proxy"`
+	GRPC        GRPCConfig        `yaml:"grpc"`
+	GraphQL     GraphQLConfig     `yaml:"graphql"`
+	CORS        CORSConfig        `yaml:"cors"`
+	Images      ImagesConfig      `yaml:"images"`
+	Limits      LimitsConfig      `yaml:"limits"`
+	RateLimit   RateLimitConfig   `yaml:"rate_limit"`
+	Releases    ReleasesConfig    `yaml:"releases"`
+	Canary      CanaryConfig      `yaml:"canary"`
+	Admin       AdminConfig       `yaml:"admin"`
+	Log         LogConfig         `yaml:"log"`
+	Metrics     MetricsConfig     `yaml:"metrics"`
+	Statsd      StatsdConfig      `yaml:"statsd"`
+	Health      HealthConfig      `yaml:"health"`
+	TLS         TLSConfig         `yaml:"tls"`
+	Dev         DevConfig         `yaml:"dev"`
+	Dump        DumpConfig        `yaml:"dump"`
+	Chaos       ChaosConfig       `yaml:"chaos"`
+	Stats       StatsConfig       `yaml:"stats"`
+	Maintenance MaintenanceConfig `yaml:"maintenance"`
+	Alert       AlertConfig       `yaml:"alert"`
+	Sentry      SentryConfig      `yaml:"sentry"`
+	Vault       VaultConfig       `yaml:"vault"`
+}
+
+// ProxyConfig はバックエンドへのプロキシの設定
+type ProxyConfig struct {
+	URL   string   `yaml:"url" env:"PROXY_URL" usage:"backend URL to proxy requests to"`
+	Paths []string `yaml:"paths" env:"PROXY_PATHS" usage:"comma-separated list of paths to proxy"`
+	// 重みを付けて振り分ける複数のプロキシ先（URL=重み）。PROXY_URL の代わりに使う
+	Upstreams []string `yaml:"upstreams" env:"PROXY_UPSTREAMS" usage:"comma-separated weighted upstreams used instead of PROXY_URL, e.g. http://api-v1:8080=90,http://api-v2:8080=10"`
+	// クライアントを PROXY_UPSTREAMS の同じプロキシ先に固定するクッキー（空の場合は固定しない）
+	AffinityCookie string `yaml:"affinity_cookie" env:"PROXY_AFFINITY_COOKIE" usage:"cookie that pins a client to one of PROXY_UPSTREAMS (empty disables)"`
+	// プロキシパスへのリクエストにフィクスチャを返すディレクトリ（ない場合は PROXY_URL にプロキシする）
+	MockDir string `yaml:"mock_dir" env:"MOCK_DIR" usage:"directory of JSON fixtures served for proxy paths (e.g. api/users.GET.json)"`
+	// プロキシしたリクエストとレスポンスを保存するディレクトリ
+	RecordDir string `yaml:"record_dir" env:"PROXY_RECORD_DIR" usage:"record proxied requests and responses to this directory"`
+	// 保存したレスポンスをバックエンドの代わりに返すディレクトリ
+	ReplayDir string `yaml:"replay_dir" env:"PROXY_REPLAY_DIR" usage:"serve responses recorded with PROXY_RECORD_DIR instead of proxying"`
+	// プロキシパスごとのリクエストボディの上限（パターン=バイト数）。MAX_BODY_BYTES より優先する
+	MaxBodyBytes []string `yaml:"max_body_bytes" env:"PROXY_MAX_BODY_BYTES" usage:"comma-separated per proxy path body limits, e.g. /upload=104857600"`
+	// プロキシする前にリクエストボディを読み切ってメモリに保持する上限（0 はバッファリングせずに転送する）
+	BufferBytes int `yaml:"buffer_bytes" env:"PROXY_BUFFER_BYTES" usage:"buffer request bodies up to this size in memory before proxying (0 streams them)"`
+	// PROXY_BUFFER_BYTES を超えたボディを一時ファイルに保存するディレクトリ（空の場合は 413 を返す）
+	BufferDir string `yaml:"buffer_dir" env:"PROXY_BUFFER_DIR" usage:"directory where bodies larger than PROXY_BUFFER_BYTES are spilled (empty rejects them)"`
+	// 一時ファイルに保存するボディの上限（0 は無制限）。超えた場合は 413 を返す
+	BufferMaxBytes int `yaml:"buffer_max_bytes" env:"PROXY_BUFFER_MAX_BYTES" usage:"hard cap on bodies spilled to PROXY_BUFFER_DIR in bytes (0 is unlimited)"`
+	// プロキシ先との通信方法（auto: https のみ HTTP/2、h2c: http も HTTP/2、http1: 常に HTTP/1.1）
+	Protocol string `yaml:"protocol" env:"PROXY_PROTOCOL" usage:"protocol used toward upstreams: auto, h2c or http1"`
+	// プロキシ先に転送する前に取り除くヘッダーとクッキー（パターン=名前|名前）。クッキー名の末尾の * は前方一致
+	StripHeaders []string `yaml:"strip_headers" env:"PROXY_STRIP_HEADERS" usage:"comma-separated per proxy path request headers removed before proxying, e.g. /api=X-Debug|X-Internal-Token"`
+	StripCookies []string `yaml:"strip_cookies" env:"PROXY_STRIP_COOKIES" usage:"comma-separated per proxy path cookies removed before proxying, e.g. /=_ga*|_gid|_fbp"`
+	// X-Forwarded-* ヘッダーを引き継ぎ、X-Forwarded-For からクライアントIPを求める接続元（IP アドレスまたは CIDR）。それ以外の接続元の転送ヘッダーは作り直す
+	TrustedProxies []string `yaml:"trusted_proxies" env:"PROXY_TRUSTED_PROXIES" usage:"comma-separated IPs or CIDRs of load balancers whose X-Forwarded-* headers are passed on and trusted for the client IP"`
+	// プロキシ先への接続の再利用（0 は無制限。MaxIdleConnsPerHost の 0 は Go の既定の 2）
+	MaxIdleConns        int           `yaml:"max_idle_conns" env:"PROXY_MAX_IDLE_CONNS" usage:"maximum number of idle upstream connections in total (0 is unlimited)"`
+	MaxIdleConnsPerHost int           `yaml:"max_idle_conns_per_host" env:"PROXY_MAX_IDLE_CONNS_PER_HOST" usage:"maximum number of idle connections kept per upstream host"`
+	MaxConnsPerHost     int           `yaml:"max_conns_per_host" env:"PROXY_MAX_CONNS_PER_HOST" usage:"maximum number of connections per upstream host, including active ones (0 is unlimited)"`
+	IdleConnTimeout     time.Duration `yaml:"idle_conn_timeout" env:"PROXY_IDLE_CONN_TIMEOUT" usage:"close idle upstream connections after this time (0 keeps them)"`
+	// プロキシ先のホスト名を名前解決し直す間隔（0 は接続ごとの名前解決のみ。srv+http:// の URL は既定で 30 秒）
+	ResolveInterval time.Duration `yaml:"resolve_interval" env:"PROXY_RESOLVE_INTERVAL" usage:"re-resolve upstream host names at this interval, e.g. 30s (0 disables)"`
+	// consul+http:// のプロキシ先を探す Consul エージェント
+	ConsulAddr  string `yaml:"consul_addr" env:"CONSUL_HTTP_ADDR" usage:"address of the Consul agent used for consul+http:// upstreams"`
+	ConsulToken string `yaml:"consul_token" env:"CONSUL_HTTP_TOKEN" secret:"true" usage:"ACL token for the Consul agent"`
+	// GET・HEAD のプロキシがこの時間を過ぎても応答しない場合に2回目のリクエストを送る（0 は無効）
+	HedgeDelay time.Duration `yaml:"hedge_delay" env:"PROXY_HEDGE_DELAY" usage:"send a second attempt for GET and HEAD requests not answered within this time, e.g. 200ms (0 disables)"`
+	// プロキシ先の応答を待つ時間（0 は無制限）。超えた場合は 504 を返す
+	Timeout time.Duration `yaml:"timeout" env:"PROXY_TIMEOUT" usage:"timeout of proxied requests, e.g. 30s (0 is unlimited)"`
+	// プロキシパスごとのタイムアウト（パターン=時間）。PROXY_TIMEOUT より優先する
+	Timeouts []string `yaml:"timeouts" env:"PROXY_TIMEOUTS" usage:"comma-separated per proxy path timeouts, e.g. /api=5s,/export=120s"`
+	// プロキシパスごとのレスポンスをクライアントに送る間隔（パターン=時間、-1 は書き込みごと）
+	FlushIntervals []string `yaml:"flush_intervals" env:"PROXY_FLUSH_INTERVALS" usage:"comma-separated per proxy path flush intervals for responses, e.g. /api/stream=-1,/export=100ms (-1 flushes every write)"`
+	// 書き込みごとにクライアントに送るレスポンスの Content-Type
+	StreamContentTypes []string `yaml:"stream_content_types" env:"PROXY_STREAM_CONTENT_TYPES" usage:"comma-separated response content types flushed on every write, e.g. application/x-ndjson"`
+	// プロキシ先が圧縮していないレスポンスを圧縮するプロキシパス
+	CompressPaths []string `yaml:"compress_paths" env:"PROXY_COMPRESS_PATHS" usage:"comma-separated proxy paths whose uncompressed responses are compressed with brotli or gzip"`
+	// 圧縮するレスポンスの Content-Type
+	CompressTypes []string `yaml:"compress_types" env:"PROXY_COMPRESS_TYPES" usage:"comma-separated response content types compressed on PROXY_COMPRESS_PATHS, e.g. application/json,text/*"`
+	// Content-Length がこれより小さいレスポンスは圧縮しない
+	CompressMinBytes int `yaml:"compress_min_bytes" env:"PROXY_COMPRESS_MIN_BYTES" usage:"minimum response size in bytes to compress"`
+	// 条件式で振り分け先を決めるルール（PROXY_PATHS より優先する）。式にカンマを含められるようセミコロンで区切る
+	Routes []string `yaml:"routes" env:"PROXY_ROUTES" sep:";" usage:"semicolon-separated routing rules, e.g. when header(\"X-Env\") == \"beta\" && path.startsWith(\"/api\") to http://beta-api:8081"`
+}
+
+// GRPCConfig は gRPC のプロキシの設定
+type GRPCConfig struct {
+	// gRPC として HTTP/2 のまま転送するパス（PROXY_PATHS と同じパターン）
+	Paths []string `yaml:"paths" env:"GRPC_PATHS" usage:"comma-separated paths proxied as gRPC, e.g. /helloworld.Greeter/*"`
+	// gRPC のプロキシ先（空の場合は PROXY_URL）
+	URL string `yaml:"url" env:"GRPC_URL" usage:"gRPC backend URL (defaults to PROXY_URL)"`
+	// ブラウザの gRPC-Web のリクエストを gRPC に変換する
+	Web bool `yaml:"web" env:"GRPC_WEB" usage:"translate gRPC-Web requests from browsers into gRPC"`
+}
+
+// GraphQLConfig は GraphQL のリクエストの記録の設定
+type GraphQLConfig struct {
+	// 操作名をアクセスログとメトリクスに記録するプロキシパス（PROXY_PATHS と同じパターン）
+	Paths []string `yaml:"paths" env:"GRAPHQL_PATHS" usage:"comma-separated proxy paths whose GraphQL operation names are logged, e.g. /query"`
+	// クエリの SHA-256 もアクセスログに記録する
+	QueryHash bool `yaml:"query_hash" env:"GRAPHQL_QUERY_HASH" usage:"also log the SHA-256 hash of GraphQL queries"`
+}
+
+// CORSConfig はプロキシパスの CORS の設定
+type CORSConfig struct {
+	// プリフライトリクエストに応答し、レスポンスに CORS のヘッダーを付けるプロキシパス（PROXY_PATHS と同じパターン）
+	Paths []string `yaml:"paths" env:"CORS_PATHS" usage:"comma-separated proxy paths whose CORS preflights are answered locally, e.g. /api"`
+	// 許可するオリジン（* はすべて、https://*.example.com はサブドメイン）
+	Origins []string `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS" usage:"comma-separated allowed origins, e.g. https://app.example.com,https://*.example.com (* allows any)"`
+	Methods []string `yaml:"allowed_methods" env:"CORS_ALLOWED_METHODS" usage:"comma-separated methods allowed in CORS requests"`
+	// 許可するリクエストヘッダー（* はすべて）
+	Headers       []string `yaml:"allowed_headers" env:"CORS_ALLOWED_HEADERS" usage:"comma-separated request headers allowed in CORS requests (* allows any)"`
+	ExposeHeaders []string `yaml:"exposed_headers" env:"CORS_EXPOSED_HEADERS" usage:"comma-separated response headers readable by scripts"`
+	// クッキーなどの認証情報を送らせる
+	Credentials bool `yaml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS" usage:"allow CORS requests with cookies and other credentials"`
+	// ブラウザーがプリフライトの結果をキャッシュする時間
+	MaxAge time.Duration `yaml:"max_age" env:"CORS_MAX_AGE" usage:"how long browsers may cache preflight results"`
+}
+
+// ImagesConfig は /__img による画像のリサイズの設定
+type ImagesConfig struct {
+	Resize bool `yaml:"resize" env:"IMAGE_RESIZE" usage:"serve resized JPEG/PNG images from DIST_DIR at /__img?src=/path.jpg&w=400"`
+	// 許可する幅（空の場合は MaxWidth までの任意の幅）
+	Widths   []string `yaml:"widths" env:"IMAGE_RESIZE_WIDTHS" usage:"comma-separated widths allowed for resizing (empty allows any width up to IMAGE_RESIZE_MAX_WIDTH)"`
+	MaxWidth int      `yaml:"max_width" env:"IMAGE_RESIZE_MAX_WIDTH" usage:"maximum width of resized images in pixels"`
+	// Widths が空の場合、要求された幅をこの倍数に切り上げる（作られる画像の種類を抑える）
+	WidthStep int `yaml:"width_step" env:"IMAGE_RESIZE_WIDTH_STEP" usage:"without IMAGE_RESIZE_WIDTHS, requested widths are rounded up to a multiple of this"`
+	Quality   int `yaml:"quality" env:"IMAGE_RESIZE_QUALITY" usage:"JPEG quality of resized images (1-100)"`
+	// リサイズした画像のキャッシュ（上限を超えると最近使われていないものから削除）
+	CacheBytes    int    `yaml:"cache_bytes" env:"IMAGE_RESIZE_CACHE_BYTES" usage:"size of the in-memory cache of resized images in bytes"`
+	CacheDir      string `yaml:"cache_dir" env:"IMAGE_RESIZE_CACHE_DIR" usage:"directory where resized images are also cached on disk"`
+	CacheDirBytes int    `yaml:"cache_dir_bytes" env:"IMAGE_RESIZE_CACHE_DIR_BYTES" usage:"maximum total size of IMAGE_RESIZE_CACHE_DIR in bytes (0 is unlimited)"`
+}
+
+// LimitsConfig はリクエストサイズと同時処理数の上限の設定
+type LimitsConfig struct {
+	MaxHeaderBytes int `yaml:"max_header_bytes" env:"MAX_HEADER_BYTES" usage:"maximum size of request headers in bytes"`
+	// 超えた場合は 414 を返す（0 は無制限）
+	MaxURLBytes int `yaml:"max_url_bytes" env:"MAX_URL_BYTES" usage:"maximum length of request URLs in bytes (0 is unlimited)"`
+	// 超えた場合は 413 を返す（0 は無制限）
+	MaxBodyBytes int `yaml:"max_body_bytes" env:"MAX_BODY_BYTES" usage:"maximum size of request bodies in bytes (0 is unlimited)"`
+
+	// 同時に処理するリクエスト数の上限（0 は無制限）。超えた分は待ち行列で待たせる
+	MaxConcurrentRequests int `yaml:"max_concurrent_requests" env:"MAX_CONCURRENT_REQUESTS" usage:"maximum number of requests served at the same time (0 is unlimited)"`
+	// 待たせるリクエスト数の上限（0 の場合は待たせずに 503 を返す）
+	QueueSize    int           `yaml:"queue_size" env:"REQUEST_QUEUE_SIZE" usage:"number of requests that may wait for MAX_CONCURRENT_REQUESTS before 503 is returned"`
+	QueueTimeout time.Duration `yaml:"queue_timeout" env:"REQUEST_QUEUE_TIMEOUT" usage:"how long a request may wait in the queue before 503 is returned"`
+}
+
+// RateLimitConfig はクライアントIPごとのリクエスト数と同時接続数の上限の設定（超えた場合は 429 を返す）
+type RateLimitConfig struct {
+	// すべてのリクエストに適用する上限（例: 600/min）。空の場合は制限しない
+	Limit string `yaml:"limit" env:"RATE_LIMIT" usage:"requests allowed per client IP, e.g. 600/min (empty disables)"`
+	// パスごとの上限（パターン=上限）。一致したリクエストは RATE_LIMIT にも数える
+	Paths []string `yaml:"paths" env:"RATE_LIMIT_PATHS" usage:"comma-separated per path limits per client IP, also counted against RATE_LIMIT, e.g. /api/login=5/min,/graphql=60/min"`
+	// クライアントIPごとに同時に処理するリクエスト（開いたままのストリーミング・SSE・WebSocket を含む）の上限（0 は無制限）
+	MaxConnsPerIP int `yaml:"max_conns_per_ip" env:"MAX_CONNS_PER_IP" usage:"maximum number of concurrent requests, including open streams and WebSockets, per client IP (0 is unlimited)"`
+}
+
+// ReleasesConfig はリリース管理の設定（Dir 配下のサブディレクトリを1リリースとして扱う）
+type ReleasesConfig struct {
+	Dir  string `yaml:"dir" env:"RELEASES_DIR" usage:"directory containing one subdirectory per release"`
+	Keep int    `yaml:"keep" env:"RELEASES_KEEP" usage:"number of releases to keep (0 keeps all)"`
+}
+
+// CanaryConfig はカナリアリリースの設定
+type CanaryConfig struct {
+	Dir     string  `yaml:"dir" env:"DIST_DIR_CANARY" flag:"dist-canary" usage:"directory containing the canary build"`
+	Percent float64 `yaml:"percent" env:"CANARY_PERCENT" usage:"percentage of new visitors served the canary build"`
+	Cookie  string  `yaml:"cookie" env:"CANARY_COOKIE" usage:"cookie that pins a visitor to a variant"`
+	Header  string  `yaml:"header" env:"CANARY_HEADER" usage:"request header that forces a variant"`
+}
+
+// MaintenanceConfig はメンテナンスモードの設定（管理 API で実行中に切り替えられる）
+type MaintenanceConfig struct {
+	Enabled bool   `yaml:"enabled" env:"MAINTENANCE" usage:"answer every request except health checks with 503"`
+	Page    string `yaml:"page" env:"MAINTENANCE_PAGE" usage:"HTML file returned in maintenance mode"`
+	// Retry-After ヘッダーで伝える再試行までの時間（0 の場合は付けない）
+	RetryAfter time.Duration `yaml:"retry_after" env:"MAINTENANCE_RETRY_AFTER" usage:"Retry-After sent in maintenance mode (0 omits it)"`
+}
+
+// AdminConfig は管理用インターフェースの設定
+type AdminConfig struct {
+	Addr  string `yaml:"addr" env:"ADMIN_ADDR" usage:"address of the admin interface"`
+	Token string `yaml:"token" env:"ADMIN_TOKEN" secret:"true" usage:"bearer token required by the admin interface (without it, runtime changes are refused)"`
+	// net/http/pprof を管理用インターフェースで提供する
+	Pprof bool `yaml:"pprof" env:"ENABLE_PPROF" usage:"serve net/http/pprof at /debug/pprof/ on the admin interface"`
+}
+
+// TLSConfig は HTTPS で待ち受けるリスナーの設定（平文のリスナーと同時に使える）
+type TLSConfig struct {
+	Listen   []string `yaml:"listen" env:"TLS_LISTEN" usage:"comma-separated addresses to serve HTTPS on, e.g. :443"`
+	CertFile string   `yaml:"cert_file" env:"TLS_CERT_FILE" usage:"TLS certificate file (PEM)"`
+	KeyFile  string   `yaml:"key_file" env:"TLS_KEY_FILE" usage:"TLS private key file (PEM)"`
+}
+
+// DevConfig はローカル開発用の設定
+type DevConfig struct {
+	// 配信ディレクトリの変更時にブラウザーを自動で再読み込みする
+	Enabled bool `yaml:"enabled" env:"DEV" flag:"dev" usage:"development mode: disable caching and live-reload browsers when files change"`
+	// 起動時にブラウザーで開く
+	Open bool `yaml:"open" env:"DEV_OPEN" flag:"open" usage:"open the served URL in the default browser on startup (with --dev)"`
+	// 公開用リスナーを開発用の証明書（mkcert の CA があればそれで署名）で HTTPS にする
+	TLS bool `yaml:"tls" env:"DEV_TLS" flag:"dev-tls" usage:"serve HTTPS on the public listeners with a generated localhost certificate"`
+}
+
+// DumpConfig はリクエストとレスポンスの内容をログに出力するデバッグ用の設定
+// 認証情報を含むヘッダーやクエリパラメーターの値は伏せる
+type DumpConfig struct {
+	Enabled bool `yaml:"enabled" env:"DEBUG_DUMP" usage:"log request and response headers of every request"`
+	// 指定した場合はこのパスのみ出力する（PROXY_PATHS と同じ形式）
+	Paths []string `yaml:"paths" env:"DEBUG_DUMP_PATHS" usage:"comma-separated paths to dump (enables dumping for these paths only)"`
+	// 出力するボディの上限（0 の場合はボディを出力しない）
+	BodyBytes int `yaml:"body_bytes" env:"DEBUG_DUMP_BODY_BYTES" usage:"also log up to this many bytes of request and response bodies"`
+}
+
+// ChaosConfig はプロキシパスへのリクエストに障害を発生させるテスト用の設定（割合は 0〜100）
+type ChaosConfig struct {
+	Latency        time.Duration `yaml:"latency" env:"CHAOS_LATENCY" usage:"latency added to delayed requests"`
+	LatencyPercent float64       `yaml:"latency_percent" env:"CHAOS_LATENCY_PERCENT" usage:"percentage of proxy requests delayed by CHAOS_LATENCY"`
+	ErrorPercent   float64       `yaml:"error_percent" env:"CHAOS_ERROR_PERCENT" usage:"percentage of proxy requests answered with CHAOS_ERROR_STATUS"`
+	ErrorStatus    int           `yaml:"error_status" env:"CHAOS_ERROR_STATUS" usage:"status code of injected errors"`
+	DropPercent    float64       `yaml:"drop_percent" env:"CHAOS_DROP_PERCENT" usage:"percentage of proxy requests whose connection is dropped"`
+	// 指定した場合はこのパスのみ対象にする（空の場合はすべてのプロキシパス）
+	Paths []string `yaml:"paths" env:"CHAOS_PATHS" usage:"comma-separated proxy paths to inject faults into (all proxy paths if empty)"`
+}
+
+// StatsConfig は組み込みのアクセス統計の設定
+type StatsConfig struct {
+	Enabled bool `yaml:"enabled" env:"STATS" usage:"count requests by path prefix, status, referrer and user agent family (served at /__stats on the admin interface)"`
+	// 公開ポートでも /__stats を提供する（ALLOW_REMOTE_IPS は適用する）
+	Endpoint bool `yaml:"endpoint" env:"STATS_ENDPOINT" usage:"also serve /__stats on the public port"`
+	// 定期的に保存し、起動時に読み込むファイル（空の場合は再起動でリセットされる）
+	File     string        `yaml:"file" env:"STATS_FILE" usage:"file the statistics are saved to periodically and restored from on startup"`
+	Interval time.Duration `yaml:"interval" env:"STATS_SAVE_INTERVAL" usage:"how often the statistics are saved to STATS_FILE"`
+	// パスをまとめるセグメント数（1 の場合 /users/1/posts は /users）
+	PathDepth int `yaml:"path_depth" env:"STATS_PATH_DEPTH" usage:"number of leading path segments requests are grouped by"`
+}
+
+// AlertConfig はエラーの急増を Webhook に通知する設定（しきい値が 0 の項目は確認しない）
+type AlertConfig struct {
+	WebhookURL string `yaml:"webhook_url" env:"ALERT_WEBHOOK_URL" secret:"true" usage:"webhook (e.g. Slack incoming webhook) that receives alerts as JSON"`
+	// 5xx の割合（%）のしきい値と、割合を確認する最小のリクエスト数
+	ErrorPercent float64 `yaml:"error_percent" env:"ALERT_5XX_PERCENT" usage:"alert when this percentage of requests return 5xx within ALERT_WINDOW"`
+	MinRequests  int     `yaml:"min_requests" env:"ALERT_MIN_REQUESTS" usage:"minimum number of requests within ALERT_WINDOW before ALERT_5XX_PERCENT is checked"`
+	// プロキシのエラー数のしきい値
+	ProxyErrors int           `yaml:"proxy_errors" env:"ALERT_PROXY_ERRORS" usage:"alert when this many proxy requests fail within ALERT_WINDOW"`
+	Window      time.Duration `yaml:"window" env:"ALERT_WINDOW" usage:"period the thresholds are evaluated over"`
+	// 同じ種類の通知を再び送るまでの時間
+	Cooldown time.Duration `yaml:"cooldown" env:"ALERT_COOLDOWN" usage:"minimum time between two alerts of the same kind"`
+}
+
+// SentryConfig はサーバー側のエラーを Sentry に送る設定
+type SentryConfig struct {
+	DSN         string `yaml:"dsn" env:"SENTRY_DSN" secret:"true" usage:"Sentry DSN that panics, proxy errors and 5xx responses are reported to"`
+	Environment string `yaml:"environment" env:"SENTRY_ENVIRONMENT" usage:"environment name attached to Sentry events (e.g. production)"`
+	// 空の場合は spa-server@バージョン
+	Release string `yaml:"release" env:"SENTRY_RELEASE" usage:"release attached to Sentry events (defaults to spa-server@version)"`
+}
+
+// VaultConfig は vault: で始まる秘密の値を読み込む HashiCorp Vault の設定
+type VaultConfig struct {
+	Addr      string `yaml:"addr" env:"VAULT_ADDR" usage:"address of the Vault server that secrets set to vault:path#key are read from"`
+	Token     string `yaml:"token" env:"VAULT_TOKEN" secret:"true" usage:"Vault token used to read secrets"`
+	Namespace string `yaml:"namespace" env:"VAULT_NAMESPACE" usage:"Vault Enterprise namespace"`
+}
+
+// LogConfig はログ出力の設定
+// ファイルに出力する場合はサイズまたは一定間隔でローテーションし、古いファイルは保持数・保持日数を超えると削除する
+type LogConfig struct {
+	// ログレベル（debug, info, warn, error）
+	Level string `yaml:"level" env:"LOG_LEVEL" usage:"log level: debug, info, warn or error"`
+
+	// アクセスログの形式（common, combined）。空の場合は出力しない
+	AccessFormat string `yaml:"access_format" env:"ACCESS_LOG_FORMAT" usage:"access log format: common or combined (empty disables)"`
+	AccessFile   string `yaml:"access_file" env:"ACCESS_LOG_FILE" usage:"write the access log to this file instead of stdout"`
+	// 各行に処理時間とプロキシ先の処理時間の内訳（接続・最初のバイト・全体）を追記する
+	AccessTiming bool   `yaml:"access_timing" env:"ACCESS_LOG_TIMING" usage:"append the request time and the upstream timing breakdown to access log lines"`
+	ErrorFile    string `yaml:"error_file" env:"ERROR_LOG_FILE" usage:"write the error log to this file instead of stderr"`
+
+	// 静的ファイルへの成功したリクエストは N 件に1件だけ出力する（0, 1 の場合はすべて出力する）
+	AccessSampleStatic int `yaml:"access_sample_static" env:"ACCESS_LOG_SAMPLE_STATIC" usage:"log only 1 in N successful static file requests (errors and proxied requests are always logged)"`
+	// アクセスログに出力しないパス（BLOCKED_PATHS と同じ形式、メトリクスには記録する）
+	AccessExclude []string `yaml:"access_exclude" env:"ACCESS_LOG_EXCLUDE" usage:"comma-separated path globs left out of the access log, e.g. /healthz,/readyz,favicon.ico"`
+
+	// 拒否したリクエスト（401, 403, 429, BLOCKED_PATHS）を JSON Lines 形式で出力するファイル（syslog の場合は SYSLOG_ADDR に送る）
+	AuditFile string `yaml:"audit_file" env:"AUDIT_LOG_FILE" usage:"write rejected requests (401, 403, 429 and BLOCKED_PATHS) as JSON lines to this file, or syslog to send them to SYSLOG_ADDR"`
+
+	MaxSizeMB      int           `yaml:"max_size_mb" env:"LOG_MAX_SIZE_MB" usage:"rotate log files when they exceed this size in megabytes"`
+	RotateInterval time.Duration `yaml:"rotate_interval" env:"LOG_ROTATE_INTERVAL" usage:"also rotate log files at this interval, e.g. 24h (0 disables)"`
+	MaxBackups     int           `yaml:"max_backups" env:"LOG_MAX_BACKUPS" usage:"number of rotated log files to keep (0 keeps all)"`
+	MaxAgeDays     int           `yaml:"max_age_days" env:"LOG_MAX_AGE_DAYS" usage:"delete rotated log files older than this many days (0 disables)"`
+	Compress       bool          `yaml:"compress" env:"LOG_COMPRESS" usage:"gzip rotated log files"`
+
+	// アクセスログ・管理画面・Sentry に記録するクライアントIPアドレスの下位（IPv4 は 8 ビット、IPv6 は 80 ビット）を 0 にする
+	AnonymizeIPs bool `yaml:"anonymize_ips" env:"ANONYMIZE_IPS" usage:"zero the last octet of IPv4 and the last 80 bits of IPv6 client addresses in the access log, the dashboard and Sentry events"`
+
+	// アクセスログとエラーログを送る syslog（local, udp://host:port, tcp://host:port, unix:/path）
+	SyslogAddr     string `yaml:"syslog_addr" env:"SYSLOG_ADDR" usage:"send access and error logs to syslog (RFC 5424): local, udp://host:port, tcp://host:port or unix:/path"`
+	SyslogFacility string `yaml:"syslog_facility" env:"SYSLOG_FACILITY" usage:"syslog facility, e.g. daemon or local0"`
+	SyslogTag      string `yaml:"syslog_tag" env:"SYSLOG_TAG" usage:"APP-NAME of syslog messages"`
+
+	// この時間を超えたリクエストを処理時間の内訳とともに警告として出力する（0 は無効）
+	SlowRequestThreshold time.Duration `yaml:"slow_request_threshold" env:"SLOW_REQUEST_THRESHOLD" usage:"log a warning for requests slower than this, e.g. 2s (0 disables)"`
+}
+
+// MetricsConfig は Prometheus 形式のメトリクスの設定
+// メトリクスは管理用インターフェースで提供し、Addr を指定した場合は専用のリスナーでも提供する
+type MetricsConfig struct {
+	Addr string `yaml:"addr" env:"METRICS_ADDR" usage:"address of a dedicated metrics listener"`
+	Path string `yaml:"path" env:"METRICS_PATH" usage:"path of the Prometheus metrics endpoint"`
+}
+
+// StatsdConfig は statsd / DogStatsD へのメトリクス送信の設定
+type StatsdConfig struct {
+	Addr      string   `yaml:"addr" env:"STATSD_ADDR" usage:"statsd address (host:port) to send metrics to"`
+	Prefix    string   `yaml:"prefix" env:"STATSD_PREFIX" usage:"prefix added to statsd metric names"`
+	DogStatsD bool     `yaml:"dogstatsd" env:"STATSD_DOGSTATSD" usage:"send labels and STATSD_TAGS as DogStatsD tags"`
+	Tags      []string `yaml:"tags" env:"STATSD_TAGS" usage:"comma-separated DogStatsD tags added to every metric, e.g. env:prod"`
+}
+
+// HealthConfig はヘルスチェック用エンドポイントとプロキシ先のヘルスチェックの設定
+type HealthConfig struct {
+	// /healthz と /readyz を公開ポートで提供する（IPアドレスの制限は適用しない）
+	Endpoints bool `yaml:"endpoints" env:"HEALTH_ENDPOINTS" usage:"serve /healthz and /readyz on the public port"`
+	// /readyz で確認する項目
+	CheckDist     bool `yaml:"check_dist" env:"READY_CHECK_DIST" usage:"report not ready while index.html is missing from the served directory"`
+	CheckUpstream bool `yaml:"check_upstream" env:"READY_CHECK_UPSTREAM" usage:"report not ready while the proxy upstream is unhealthy"`
+
+	// プロキシ先のヘルスチェック（UpstreamPath を設定するか CheckUpstream が有効な場合に実行）
+	UpstreamPath     string        `yaml:"upstream_path" env:"UPSTREAM_HEALTH_PATH" usage:"path on the proxy upstream used for health checks"`
+	UpstreamInterval time.Duration `yaml:"upstream_interval" env:"UPSTREAM_HEALTH_INTERVAL" usage:"interval between upstream health checks"`
+	UpstreamTimeout  time.Duration `yaml:"upstream_timeout" env:"UPSTREAM_HEALTH_TIMEOUT" usage:"timeout of an upstream health check"`
+}
+
+// DefaultConfig はデフォルトの設定を返す
+func DefaultConfig() Config {
+	return Config{
+		Port:            "8080",
+		SocketMode:      "0660",
+		WatchDistDir:    true,
+		ShutdownTimeout: 30 * time.Second,
+		NormalizePaths:  true,
+		Preflight:       true,
+		AllowedMethods:  []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		Proxy: ProxyConfig{
+			Paths:               []string{"/query"},
+			Protocol:            protocolAuto,
+			TrustedProxies:      append([]string(nil), defaultTrustedProxies...),
+			BufferMaxBytes:      1 << 30,
+			MaxIdleConns:        512,
+			MaxIdleConnsPerHost: 64,
+			IdleConnTimeout:     90 * time.Second,
+			CompressTypes: []string{
+				"application/json", "application/javascript", "application/xml",
+				"application/graphql-response+json", "image/svg+xml", "text/*",
+			},
+			CompressMinBytes: 1024,
+		},
+		CORS: CORSConfig{
+			Methods: []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"},
+			Headers: []string{"Accept", "Authorization", "Content-Type", "X-Requested-With"},
+			MaxAge:  10 * time.Minute,
+		},
+		Images: ImagesConfig{
+			MaxWidth:      2048,
+			WidthStep:     100,
+			Quality:       85,
+			CacheBytes:    64 << 20,
+			CacheDirBytes: 1 << 30,
+		},
+		Limits: LimitsConfig{
+			MaxHeaderBytes: http.DefaultMaxHeaderBytes,
+			MaxURLBytes:    8192,
+			QueueTimeout:   5 * time.Second,
+		},
+		Releases: ReleasesConfig{
+			Keep: 5,
+		},
+		Canary: CanaryConfig{
+			Cookie: "spa_variant",
+		},
+		Metrics: MetricsConfig{
+			Path: "/metrics",
+		},
+		Stats: StatsConfig{
+			Interval:  time.Minute,
+			PathDepth: 1,
+		},
+		Alert: AlertConfig{
+			MinRequests: 20,
+			Window:      5 * time.Minute,
+			Cooldown:    30 * time.Minute,
+		},
+		Health: HealthConfig{
+			Endpoints:        true,
+			CheckDist:        true,
+			UpstreamInterval: 10 * time.Second,
+			UpstreamTimeout:  2 * time.Second,
+		},
+		Chaos: ChaosConfig{
+			ErrorStatus: http.StatusServiceUnavailable,
+		},
+		Statsd: StatsdConfig{
+			Prefix: "spa_server.",
+		},
+		Log: LogConfig{
+			Level:          "info",
+			MaxSizeMB:      100,
+			MaxBackups:     7,
+			SyslogFacility: "daemon",
+			SyslogTag:      "spa-server",
+		},
+	}
+}
+
+// PublicAddrs は平文の公開用リスナーのアドレスを返す
+func (c Config) PublicAddrs() []string {
+	if len(c.Listen) > 0 {
+		return c.Listen
+	}
+	return []string{net.JoinHostPort(c.BindAddr, c.Port)}
+}
+
+// LoadConfig は設定を読み込む
+// 優先順位は デフォルト < 設定ファイル < 環境変数（.env と <環境変数名>_FILE を含む）
+// コマンドラインフラグは呼び出し側で configFlags.apply により最後に適用する
+func LoadConfig(path string) (Config, error) {
+	var data []byte
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return DefaultConfig(), err
+		}
+	}
+	return parseConfig(data, path)
+}
+
+// parseConfig は YAML の設定（空の場合はデフォルト値）に環境変数を適用する
+func parseConfig(data []byte, name string) (Config, error) {
+	cfg := DefaultConfig()
+	applyPlatformDefaults(&cfg)
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("parsing %s: %w", name, err)
+	}
+	// 空の環境変数は未設定として扱う
+	err := applyValues(&cfg, func(key string) (string, bool) {
+		value := os.Getenv(key)
+		return value, value != ""
+	})
+	if err == nil {
+		err = applySecretFiles(&cfg)
+	}
+	return cfg, err
+}
+
+// secretFileSuffix は秘密の値をファイルから読み込む環境変数の接尾辞（Docker・Kubernetes の secret 用）
+const secretFileSuffix = "_FILE"
+
+// applySecretFiles は secret タグの付いた項目を <環境変数名>_FILE で指定したファイルの内容で上書きする
+// 末尾の改行は取り除く。同じ項目の環境変数と両方設定した場合はエラーにする
+func applySecretFiles(cfg *Config) error {
+	var err error
+	walkFields(reflect.ValueOf(cfg).Elem(), func(field reflect.Value, tag reflect.StructTag) {
+		if err != nil || tag.Get("secret") != "true" {
+			return
+		}
+		key := tag.Get("env")
+		path := os.Getenv(key + secretFileSuffix)
+		if path == "" {
+			return
+		}
+		if os.Getenv(key) != "" {
+			err = fmt.Errorf("%s and %s%s are both set", key, key, secretFileSuffix)
+			return
+		}
+		data, e := os.ReadFile(path)
+		if e != nil {
+			err = fmt.Errorf("%s%s: %w", key, secretFileSuffix, e)
+			return
+		}
+		field.SetString(strings.TrimRight(string(data), "\r\n"))
+	})
+	return err
+}
+
+// applyValues は env タグの付いた項目を lookup が返す値で上書きする
+func applyValues(cfg *Config, lookup func(key string) (string, bool)) error {
+	var err error
+	walkFields(reflect.ValueOf(cfg).Elem(), func(field reflect.Value, tag reflect.StructTag) {
+		key := tag.Get("env")
+		if value, ok := lookup(key); ok && err == nil {
+			if e := setField(field, value, listSeparator(tag)); e != nil {
+				err = fmt.Errorf("invalid value for %s: %w", key, e)
+			}
+		}
+	})
+	return err
+}
+
+// walkFields は env タグの付いた項目を（入れ子の構造体も含めて）順に処理する
+func walkFields(v reflect.Value, fn func(field reflect.Value, tag reflect.StructTag)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			walkFields(field, fn)
+			continue
+		}
+		if t.Field(i).Tag.Get("env") != "" {
+			fn(field, t.Field(i).Tag)
+		}
+	}
+}
+
+// configFlags はコマンドラインで指定された設定値（環境変数名をキーとする）
+type configFlags map[string]string
+
+// bindFlags は設定の各項目に対応するフラグを登録する
+func bindFlags(fs *flag.FlagSet) configFlags {
+	flags := configFlags{}
+	def := DefaultConfig()
+	walkFields(reflect.ValueOf(&def).Elem(), func(field reflect.Value, tag reflect.StructTag) {
+		name := tag.Get("flag")
+		if name == "" {
+			name = strings.ReplaceAll(strings.ToLower(tag.Get("env")), "_", "-")
+		}
+		usage := fmt.Sprintf("%s (env %s)", tag.Get("usage"), tag.Get("env"))
+		v := &flagValue{key: tag.Get("env"), flags: flags, isBool: field.Kind() == reflect.Bool}
+		fs.Var(v, name, usage)
+		// デフォルト値をヘルプに表示する
+		if def := formatField(field, listSeparator(tag)); def != "" {
+			fs.Lookup(name).DefValue = def
+		}
+	})
+	return flags
+}
+
+// apply はフラグで指定された値で設定を上書きする
+func (f configFlags) apply(cfg *Config) error {
+	return applyValues(cfg, func(key string) (string, bool) {
+		value, ok := f[key]
+		return value, ok
+	})
+}
+
+// flagValue は設定項目に対応する flag.Value
+type flagValue struct {
+	key    string
+	flags  configFlags
+	isBool bool
+}
+
+func (v *flagValue) String() string {
+	if v == nil || v.flags == nil {
+		return ""
+	}
+	return v.flags[v.key]
+}
+
+func (v *flagValue) Set(s string) error {
+	v.flags[v.key] = s
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool {
+	return v.isBool
+}
+
+// listSeparator はリストの区切り文字を返す（sep タグがない場合はカンマ）
+func listSeparator(tag reflect.StructTag) string {
+	if sep := tag.Get("sep"); sep != "" {
+		return sep
+	}
+	return ","
+}
+
+// formatField は項目の値を環境変数と同じ形式の文字列にする
+func formatField(field reflect.Value, sep string) string {
+	switch value := field.Interface().(type) {
+	case []string:
+		return strings.Join(value, sep)
+	case time.Duration:
+		if value == 0 {
+			return ""
+		}
+		return value.String()
+	case bool:
+		if !value {
+			return ""
+		}
+	case int:
+		if value == 0 {
+			return ""
+		}
+	case float64:
+		if value == 0 {
+			return ""
+		}
+	}
+	return fmt.Sprint(field.Interface())
+}
+
+// setField は文字列の値を項目の型に変換して設定する（リストは sep で区切る）
+func setField(field reflect.Value, value, sep string) error {
+	switch field.Interface().(type) {
+	case string:
+		field.SetString(value)
+	case []string:
+		field.Set(reflect.ValueOf(splitList(value, sep)))
+	case bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+// splitList は sep 区切りの文字列をトリムしたスライスに変換する（空要素は除外）
+func splitList(s, sep string) []string {
+	var list []string
+	for _, v := range strings.Split(s, sep) {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,117 @@
+package spaserver
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte(`
+port: "9000"
+dist_dir: ./dist
+allow_remote_ips:
+  - 127.0.0.1
+  - 192.168.1.
+proxy:
+  url: http://backend:3000
+  paths: [/api, /graphql]
+canary:
+  dir: ./dist-canary
+  percent: 10
+`), 0644)
+
+	for _, key := range []string{"DIST_DIR", "ALLOW_REMOTE_IPS", "PROXY_URL", "PROXY_PATHS", "DIST_DIR_CANARY", "CANARY_PERCENT"} {
+		t.Setenv(key, "")
+	}
+	t.Setenv("PORT", "9100")
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 環境変数は設定ファイルより優先される
+	if cfg.Port != "9100" {
+		t.Errorf("環境変数で上書きされていません。実際: %s", cfg.Port)
+	}
+	if cfg.DistDir != "./dist" || cfg.Proxy.URL != "http://backend:3000" || cfg.Canary.Percent != 10 {
+		t.Errorf("設定ファイルの値が読み込まれていません: %+v", cfg)
+	}
+	if !reflect.DeepEqual(cfg.Proxy.Paths, []string{"/api", "/graphql"}) {
+		t.Errorf("リストの値が読み込まれていません: %v", cfg.Proxy.Paths)
+	}
+	if !reflect.DeepEqual(cfg.AllowRemoteIPs, []string{"127.0.0.1", "192.168.1."}) {
+		t.Errorf("リストの値が読み込まれていません: %v", cfg.AllowRemoteIPs)
+	}
+	// 設定ファイルにない項目はデフォルト値のまま
+	if cfg.Releases.Keep != 5 || cfg.Canary.Cookie != "spa_variant" {
+		t.Errorf("デフォルト値が維持されていません: %+v", cfg)
+	}
+}
+
+func TestLoadConfigInvalidEnv(t *testing.T) {
+	t.Setenv("RELEASES_KEEP", "many")
+	if _, err := LoadConfig(""); err == nil {
+		t.Error("不正な値の環境変数はエラーになるべきです")
+	}
+}
+
+func TestLoadConfigSecretFiles(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "admin_token"), []byte("s3cret\n"), 0600)
+	t.Setenv("ADMIN_TOKEN", "")
+	t.Setenv("ADMIN_TOKEN_FILE", filepath.Join(dir, "admin_token"))
+	// secret タグのない項目には _FILE を使わない
+	t.Setenv("PORT", "")
+	t.Setenv("PORT_FILE", filepath.Join(dir, "admin_token"))
+
+	cfg, err := LoadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Admin.Token != "s3cret" {
+		t.Errorf("ファイルの内容（末尾の改行を除く）が読み込まれていません: %q", cfg.Admin.Token)
+	}
+	if cfg.Port != "8080" {
+		t.Errorf("PORT_FILE は使われるべきではありません: %s", cfg.Port)
+	}
+
+	t.Setenv("ADMIN_TOKEN", "other")
+	if _, err := LoadConfig(""); err == nil {
+		t.Error("ADMIN_TOKEN と ADMIN_TOKEN_FILE の両方を設定した場合はエラーになるべきです")
+	}
+	t.Setenv("ADMIN_TOKEN", "")
+	t.Setenv("ADMIN_TOKEN_FILE", filepath.Join(dir, "missing"))
+	if _, err := LoadConfig(""); err == nil {
+		t.Error("読み込めないファイルはエラーになるべきです")
+	}
+}
+
+func TestConfigFlags(t *testing.T) {
+	t.Setenv("PORT", "9100")
+	t.Setenv("PROXY_PATHS", "/query")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := bindFlags(fs)
+	if err := fs.Parse([]string{"--port", "9200", "--dist", "./build", "--proxy-paths", "/api,/graphql", "--watch-dist-dir=false"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := flags.apply(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	// フラグは環境変数より優先される
+	if cfg.Port != "9200" || cfg.DistDir != "./build" || cfg.WatchDistDir {
+		t.Errorf("フラグの値が反映されていません: %+v", cfg)
+	}
+	if !reflect.DeepEqual(cfg.Proxy.Paths, []string{"/api", "/graphql"}) {
+		t.Errorf("リストのフラグが反映されていません: %v", cfg.Proxy.Paths)
+	}
+}
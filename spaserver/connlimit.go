@@ -0,0 +1,61 @@
+package spaserver
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// クライアントIPごとの同時接続数の制限
+// MAX_CONNS_PER_IP を設定した場合、1つのクライアントIPから同時に処理するリクエスト（ストリーミング・SSE・WebSocket の
+// 開いたままの接続を含む）の数を制限し、超えた場合は 429 を返す。ロードバランサーの後ろでも使えるよう、
+// TCP 接続ではなくクライアントIP（信頼するプロキシからの X-Forwarded-For で求めたもの）ごとに数える
+
+// connCounter はクライアントIPごとの処理中のリクエスト数
+type connCounter struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+// acquire は max 未満の場合に数を増やして true を返す
+func (c *connCounter) acquire(ip string, max int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts[ip] >= max {
+		return false
+	}
+	if c.counts == nil {
+		c.counts = map[string]int{}
+	}
+	c.counts[ip]++
+	return true
+}
+
+func (c *connCounter) release(ip string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts[ip]--; c.counts[ip] <= 0 {
+		delete(c.counts, ip)
+	}
+}
+
+// acquireConn は同時接続数の上限に達したクライアントに 429 を返して false を返す
+// true の場合はリクエストの処理後に返された関数を呼ぶ
+func (s *server) acquireConn(w http.ResponseWriter, r *http.Request, clientIP string) (func(), bool) {
+	max := s.cfg.RateLimit.MaxConnsPerIP
+	if max <= 0 {
+		return func() {}, true
+	}
+	conns := s.state.conns
+	if !conns.acquire(clientIP, max) {
+		s.state.metrics.rateLimited.Add(1, "MAX_CONNS_PER_IP")
+		s.blockRequest(r, "MAX_CONNS_PER_IP")
+		infof("Too many connections: %s %s (client IP %s, MAX_CONNS_PER_IP %d)", metricMethod(r.Method), escapeLogValue(r.URL.Path), clientIP, max)
+		w.Header().Set("Retry-After", "1")
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, rateLimitBody)
+		return nil, false
+	}
+	return func() { conns.release(clientIP) }, true
+}
@@ -0,0 +1,82 @@
+package spaserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMaxConnsPerIP(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.RateLimit.MaxConnsPerIP = 1
+
+	// /stream は release が閉じられるまで応答を終えない
+	started, release := make(chan struct{}), make(chan struct{})
+	stream := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/stream" {
+				close(started)
+				<-release
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	s, err := newServer(cfg, WithMiddleware(MiddlewareStatic, stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	request := func(path, remoteAddr string, forwardedFor ...string) int {
+		r := httptest.NewRequest("GET", path, nil)
+		r.RemoteAddr = remoteAddr
+		for _, v := range forwardedFor {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, r)
+		return rr.Code
+	}
+	done := make(chan int)
+	go func() { done <- request("/stream", "192.0.2.1:1234") }()
+	<-started
+
+	if code := request("/", "192.0.2.1:1234"); code != http.StatusTooManyRequests {
+		t.Errorf("期待されるステータスコード %d, 実際のステータスコード %d", http.StatusTooManyRequests, code)
+	}
+	// 信頼するプロキシでない接続元の X-Forwarded-For では別のクライアントにならない
+	if code := request("/", "192.0.2.1:1234", "198.51.100.7"); code != http.StatusTooManyRequests {
+		t.Errorf("X-Forwarded-For を変えても制限されるべきです: %d", code)
+	}
+	if code := request("/", "192.0.2.2:1234"); code != http.StatusOK {
+		t.Errorf("別のクライアントは制限されないべきです: %d", code)
+	}
+	close(release)
+	<-done
+
+	// IPv6 のクライアントはアドレス全体で区別する
+	started, release = make(chan struct{}), make(chan struct{})
+	go func() { done <- request("/stream", "[2001:db8::1]:1234") }()
+	<-started
+	if code := request("/", "[2001:db8::2]:1234"); code != http.StatusOK {
+		t.Errorf("別の IPv6 のクライアントは制限されないべきです: %d", code)
+	}
+	if code := request("/", "[2001:db8::1]:5678"); code != http.StatusTooManyRequests {
+		t.Errorf("期待されるステータスコード %d, 実際のステータスコード %d", http.StatusTooManyRequests, code)
+	}
+	close(release)
+	<-done
+	// 処理が終わると再び受け付ける
+	if code := request("/", "192.0.2.1:1234"); code != http.StatusOK {
+		t.Errorf("期待されるステータスコード %d, 実際のステータスコード %d", http.StatusOK, code)
+	}
+	if conns := s.state.conns; len(conns.counts) != 0 {
+		t.Errorf("処理中のリクエスト数が残っています: %v", conns.counts)
+	}
+}
@@ -0,0 +1,199 @@
+package spaserver
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORS
+// CORS_PATHS に一致するプロキシパスでは、プリフライトリクエスト（OPTIONS）をプロキシ先に転送せずに設定したポリシーで応答し、
+// 通常のリクエストのレスポンスにも Access-Control-* ヘッダーを付ける（プロキシ先が付けたものは置き換える）
+
+// corsPolicy は CORS のポリシー
+type corsPolicy struct {
+	paths       []string
+	origins     []string
+	methods     string
+	headers     []string
+	expose      string
+	credentials bool
+	maxAge      string
+}
+
+func newCORSPolicy(cfg CORSConfig) *corsPolicy {
+	if len(cfg.Paths) == 0 {
+		return nil
+	}
+	p := &corsPolicy{
+		paths:       cfg.Paths,
+		origins:     cfg.Origins,
+		methods:     strings.Join(cfg.Methods, ", "),
+		headers:     cfg.Headers,
+		expose:      strings.Join(cfg.ExposeHeaders, ", "),
+		credentials: cfg.Credentials,
+	}
+	if cfg.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(cfg.MaxAge / time.Second))
+	}
+	return p
+}
+
+// allowOrigin は許可するオリジンの場合に Access-Control-Allow-Origin の値を返す（許可しない場合は空）
+func (p *corsPolicy) allowOrigin(origin string) string {
+	for _, allowed := range p.origins {
+		if allowed == "*" {
+			// クッキーを送らせる場合はオリジンを明示する必要がある
+			if p.credentials {
+				return origin
+			}
+			return "*"
+		}
+		if matchOrigin(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// matchOrigin はオリジンが許可するオリジンに一致するかを判定する（https://*.example.com はサブドメインに一致する）
+func matchOrigin(allowed, origin string) bool {
+	if strings.EqualFold(allowed, origin) {
+		return true
+	}
+	scheme, host, ok := strings.Cut(allowed, "://*.")
+	if !ok {
+		return false
+	}
+	rest, ok := strings.CutPrefix(strings.ToLower(origin), strings.ToLower(scheme)+"://")
+	return ok && strings.HasSuffix(rest, "."+strings.ToLower(host))
+}
+
+func (p *corsPolicy) allowMethod(method string) bool {
+	for _, m := range strings.Split(p.methods, ", ") {
+		if m == "*" || strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowHeaders はリクエストされたヘッダーがすべて許可されている場合に Access-Control-Allow-Headers の値を返す
+func (p *corsPolicy) allowHeaders(requested string) (string, bool) {
+	if strings.TrimSpace(requested) == "" {
+		return "", true
+	}
+	for _, name := range strings.Split(requested, ",") {
+		name = strings.TrimSpace(name)
+		allowed := false
+		for _, h := range p.headers {
+			if h == "*" || strings.EqualFold(h, name) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return "", false
+		}
+	}
+	return requested, true
+}
+
+// serve は CORS のリクエストを処理する
+// プリフライトリクエストに応答した場合は done に true を返し、それ以外は CORS のヘッダーを付けるライターを返す
+func (p *corsPolicy) serve(w http.ResponseWriter, r *http.Request) (_ http.ResponseWriter, done bool) {
+	if p == nil || !matchProxyPath(p.paths, r.URL.Path) {
+		return w, false
+	}
+	origin := r.Header.Get("Origin")
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+		p.preflight(w, r, origin)
+		return w, true
+	}
+	if origin == "" {
+		return w, false
+	}
+	// 許可しないオリジンの場合もプロキシ先が付けた CORS のヘッダーは取り除く
+	return &corsWriter{ResponseWriter: w, p: p, origin: p.allowOrigin(origin)}, false
+}
+
+// preflight はプリフライトリクエストにプロキシ先の代わりに応答する
+func (p *corsPolicy) preflight(w http.ResponseWriter, r *http.Request, origin string) {
+	allowOrigin := p.allowOrigin(origin)
+	method := r.Header.Get("Access-Control-Request-Method")
+	headers, headersOK := p.allowHeaders(r.Header.Get("Access-Control-Request-Headers"))
+	if allowOrigin == "" || !p.allowMethod(method) || !headersOK {
+		debugf("CORS preflight rejected: origin %q, method %q, headers %q", origin, method, r.Header.Get("Access-Control-Request-Headers"))
+		recordAuditRule(r.Context(), "CORS preflight")
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	h := w.Header()
+	h.Set("Access-Control-Allow-Origin", allowOrigin)
+	h.Set("Access-Control-Allow-Methods", p.methods)
+	if headers != "" {
+		h.Set("Access-Control-Allow-Headers", headers)
+	}
+	if p.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if p.maxAge != "" {
+		h.Set("Access-Control-Max-Age", p.maxAge)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// corsWriter はレスポンスヘッダーを送る直前に CORS のヘッダーを設定する
+type corsWriter struct {
+	http.ResponseWriter
+	p *corsPolicy
+	// Access-Control-Allow-Origin の値（許可しないオリジンの場合は空）
+	origin      string
+	wroteHeader bool
+}
+
+func (cw *corsWriter) WriteHeader(code int) {
+	if !cw.wroteHeader && code >= 200 {
+		cw.wroteHeader = true
+		h := cw.Header()
+		// プロキシ先が付けた CORS のヘッダーと重複しないようにする
+		for name := range h {
+			if strings.HasPrefix(name, "Access-Control-") {
+				h.Del(name)
+			}
+		}
+		if cw.origin != "" {
+			h.Set("Access-Control-Allow-Origin", cw.origin)
+			if cw.p.credentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+			if cw.p.expose != "" {
+				h.Set("Access-Control-Expose-Headers", cw.p.expose)
+			}
+		}
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *corsWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+func (cw *corsWriter) Flush() {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+func (cw *corsWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,114 @@
+package spaserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCORSPreflight(t *testing.T) {
+	var proxied atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Add(1)
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("X-Request-Id", "42")
+		w.Write([]byte("OK"))
+	}))
+	defer backend.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Proxy.URL = backend.URL
+	cfg.Proxy.Paths = []string{"/api"}
+	cfg.CORS.Paths = []string{"/api"}
+	cfg.CORS.Origins = []string{"https://app.example.com", "https://*.preview.example.com"}
+	cfg.CORS.ExposeHeaders = []string{"X-Request-Id"}
+	cfg.CORS.Credentials = true
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		name     string
+		origin   string
+		method   string
+		headers  string
+		expected int
+		allowed  string
+	}{
+		{"許可するオリジン", "https://app.example.com", "PUT", "Content-Type, Authorization", http.StatusNoContent, "https://app.example.com"},
+		{"サブドメインのワイルドカード", "https://pr-1.preview.example.com", "POST", "", http.StatusNoContent, "https://pr-1.preview.example.com"},
+		{"許可しないオリジン", "https://evil.example.net", "POST", "", http.StatusForbidden, ""},
+		{"許可しないメソッド", "https://app.example.com", "CONNECT", "", http.StatusForbidden, ""},
+		{"許可しないヘッダー", "https://app.example.com", "POST", "X-Secret", http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("OPTIONS", "/api/items", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", tt.method)
+			if tt.headers != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.headers)
+			}
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, req)
+			if rr.Code != tt.expected {
+				t.Errorf("期待されるステータスコード %d, 実際のステータスコード %d", tt.expected, rr.Code)
+			}
+			if got := rr.Header().Get("Access-Control-Allow-Origin"); got != tt.allowed {
+				t.Errorf("期待される Access-Control-Allow-Origin %q, 実際の値 %q", tt.allowed, got)
+			}
+			if tt.expected == http.StatusNoContent && rr.Header().Get("Access-Control-Max-Age") != "600" {
+				t.Errorf("Access-Control-Max-Age がありません: %v", rr.Header())
+			}
+		})
+	}
+	if n := proxied.Load(); n != 0 {
+		t.Errorf("プリフライトリクエストがプロキシ先に転送されました: %d 回", n)
+	}
+
+	// 通常のリクエストはプロキシ先の CORS のヘッダーを置き換える
+	req := httptest.NewRequest("GET", "/api/items", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, req)
+	if got := rr.Header().Values("Access-Control-Allow-Origin"); len(got) != 1 || got[0] != "https://app.example.com" {
+		t.Errorf("Access-Control-Allow-Origin が置き換えられていません: %q", got)
+	}
+	if rr.Header().Get("Access-Control-Allow-Credentials") != "true" || rr.Header().Get("Access-Control-Expose-Headers") != "X-Request-Id" {
+		t.Errorf("CORS のヘッダーが不足しています: %v", rr.Header())
+	}
+}
+
+func TestCORSDisallowedOrigin(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	}))
+	defer backend.Close()
+
+	cfg := testConfig(t)
+	cfg.DistDir = t.TempDir()
+	cfg.Proxy.URL = backend.URL
+	cfg.Proxy.Paths = []string{"/api"}
+	cfg.CORS.Paths = []string{"/api"}
+	cfg.CORS.Origins = []string{"https://app.example.com"}
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	req := httptest.NewRequest("GET", "/api/items", nil)
+	req.Header.Set("Origin", "https://evil.example.net")
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, req)
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("許可しないオリジンに Access-Control-Allow-Origin が返されました: %q", got)
+	}
+}
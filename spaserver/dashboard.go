@@ -0,0 +1,278 @@
+package spaserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 管理画面
+// 管理用インターフェースの /__dashboard で、リクエスト数・ステータスコード・よく参照されるパス・プロキシ先の状態・
+// キャッシュのヒット率・最近拒否したクライアントを表示する。値は Server-Sent Events で定期的に送る
+
+const (
+	dashboardPath       = "/__dashboard"
+	dashboardEventsPath = "/__dashboard/events"
+	// 値を送る間隔
+	dashboardInterval = 2 * time.Second
+	// 表示する最近拒否したリクエストの件数
+	recentBlockedSize = 20
+)
+
+// blockedRequest は拒否したリクエスト
+type blockedRequest struct {
+	Time   time.Time `json:"time"`
+	IP     string    `json:"ip"`
+	Path   string    `json:"path"`
+	Reason string    `json:"reason"`
+}
+
+// blockedLog は拒否したリクエストを新しい順に recentBlockedSize 件まで保持する（serverState に持ち、設定の再読み込みでリセットしない）
+type blockedLog struct {
+	mu      sync.Mutex
+	entries []blockedRequest
+}
+
+func (l *blockedLog) add(ip, path, reason string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append([]blockedRequest{{Time: time.Now(), IP: ip, Path: path, Reason: reason}}, l.entries...)
+	if len(l.entries) > recentBlockedSize {
+		l.entries = l.entries[:recentBlockedSize]
+	}
+}
+
+func (l *blockedLog) list() []blockedRequest {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]blockedRequest{}, l.entries...)
+}
+
+// dashboardState は管理画面に送る値
+type dashboardState struct {
+	Time              time.Time                 `json:"time"`
+	RequestsPerSecond float64                   `json:"requests_per_second"`
+	InFlight          float64                   `json:"in_flight"`
+	Statuses          map[string]float64        `json:"statuses"`
+	TopPaths          []dashboardPathCount      `json:"top_paths"`
+	Upstream          *dashboardUpstream        `json:"upstream,omitempty"`
+	Caches            map[string]dashboardCache `json:"caches"`
+	Blocked           []blockedRequest          `json:"blocked"`
+}
+
+type dashboardPathCount struct {
+	Path  string `json:"path"`
+	Count int64  `json:"count"`
+}
+
+type dashboardUpstream struct {
+	URL     string `json:"url"`
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+type dashboardCache struct {
+	Hits    float64 `json:"hits"`
+	Misses  float64 `json:"misses"`
+	HitRate float64 `json:"hit_rate"`
+}
+
+// dashboard は管理画面と値の配信を行う
+type dashboard struct {
+	s         *server
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newDashboard(s *server) *dashboard {
+	return &dashboard{s: s, closed: make(chan struct{})}
+}
+
+// Close は接続中の管理画面との接続を閉じる（停止時とサーバーの Close の両方から呼ばれる）
+func (d *dashboard) Close() {
+	if d == nil {
+		return
+	}
+	d.closeOnce.Do(func() { close(d.closed) })
+}
+
+// requestCounts はステータスコードの区分ごとのリクエスト数の累計を返す
+func requestCounts(m *serverMetrics) (float64, map[string]float64) {
+	var total float64
+	counts := map[string]float64{}
+	for _, sample := range m.requests.samples() {
+		code, _ := strconv.Atoi(sample.labelValues[1])
+		counts[statusClass(code)] += sample.value
+		total += sample.value
+	}
+	return total, counts
+}
+
+// state は前回の累計からの差分を使って現在の値を作る
+func (d *dashboard) state(prevTotal float64, prevCounts map[string]float64, elapsed time.Duration) dashboardState {
+	total, counts := requestCounts(d.s.state.metrics)
+	st := dashboardState{
+		Time:     time.Now(),
+		InFlight: d.s.state.metrics.inFlight.Value(),
+		Statuses: map[string]float64{},
+		Caches:   map[string]dashboardCache{},
+		Blocked:  d.s.state.recentBlocked.list(),
+	}
+	if d.s.cfg.Log.AnonymizeIPs {
+		for i := range st.Blocked {
+			st.Blocked[i].IP = anonymizeIP(st.Blocked[i].IP)
+		}
+	}
+	if elapsed > 0 {
+		st.RequestsPerSecond = (total - prevTotal) / elapsed.Seconds()
+		for class, n := range counts {
+			st.Statuses[class] = (n - prevCounts[class]) / elapsed.Seconds()
+		}
+	}
+
+	// よく参照されるパス（STATS が有効な場合）
+	if d.s.stats != nil {
+		for path, count := range d.s.state.stats.snapshot().Paths {
+			st.TopPaths = append(st.TopPaths, dashboardPathCount{Path: path, Count: count})
+		}
+		sort.Slice(st.TopPaths, func(i, j int) bool {
+			if st.TopPaths[i].Count != st.TopPaths[j].Count {
+				return st.TopPaths[i].Count > st.TopPaths[j].Count
+			}
+			return st.TopPaths[i].Path < st.TopPaths[j].Path
+		})
+		if len(st.TopPaths) > 10 {
+			st.TopPaths = st.TopPaths[:10]
+		}
+	}
+
+	if d.s.health != nil {
+		st.Upstream = &dashboardUpstream{URL: d.s.cfg.Proxy.URL, Healthy: true}
+		if err := d.s.health.Healthy(); err != nil {
+			st.Upstream.Healthy = false
+			st.Upstream.Error = err.Error()
+		}
+	}
+
+	for _, sample := range d.s.state.metrics.cacheRequests.samples() {
+		c := st.Caches[sample.labelValues[0]]
+		if sample.labelValues[1] == cacheHit {
+			c.Hits += sample.value
+		} else {
+			c.Misses += sample.value
+		}
+		if c.Hits+c.Misses > 0 {
+			c.HitRate = c.Hits / (c.Hits + c.Misses)
+		}
+		st.Caches[sample.labelValues[0]] = c
+	}
+	return st
+}
+
+// serveEvents は dashboardInterval ごとに値を Server-Sent Events で送る
+func (d *dashboard) serveEvents(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	rc := http.NewResponseController(w)
+	ticker := time.NewTicker(dashboardInterval)
+	defer ticker.Stop()
+
+	prevTotal, prevCounts := requestCounts(d.s.state.metrics)
+	prevTime := time.Now()
+	for {
+		now := time.Now()
+		data, err := json.Marshal(d.state(prevTotal, prevCounts, now.Sub(prevTime)))
+		if err != nil {
+			errorf("Dashboard: %v", err)
+			return
+		}
+		prevTotal, prevCounts = requestCounts(d.s.state.metrics)
+		prevTime = now
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-r.Context().Done():
+			return
+		case <-d.closed:
+			return
+		}
+	}
+}
+
+// serveHTML は管理画面を返す
+func (d *dashboard) serveHTML(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprint(w, dashboardHTML)
+}
+
+const dashboardHTML = `<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>spa-server</title>
+<style>
+body{font:14px system-ui,sans-serif;margin:2em;color:#222}
+h1{font-size:1.4em}h2{font-size:1.1em;margin-top:1.5em}
+.cards{display:flex;gap:1em;flex-wrap:wrap}
+.card{border:1px solid #ddd;border-radius:6px;padding:.8em 1.2em;min-width:9em}
+.card b{display:block;font-size:1.8em}
+table{border-collapse:collapse}td,th{padding:.2em .8em;text-align:left;border-bottom:1px solid #eee}
+.ok{color:#197a2e}.ng{color:#b3261e}#status{color:#888}
+</style>
+</head>
+<body>
+<h1>spa-server <span id="status">connecting…</span></h1>
+<div class="cards">
+<div class="card">Requests/s<b id="rps">-</b></div>
+<div class="card">In flight<b id="inflight">-</b></div>
+<div class="card">Upstream<b id="upstream">-</b></div>
+</div>
+<h2>Status codes (per second)</h2><table id="statuses"></table>
+<h2>Cache hit rate</h2><table id="caches"></table>
+<h2>Top paths</h2><table id="paths"></table>
+<h2>Recently blocked</h2><table id="blocked"></table>
+<script>
+function rows(id, head, items) {
+  var t = document.getElementById(id);
+  t.textContent = "";
+  var tr = t.insertRow();
+  head.forEach(function (h) { var th = document.createElement("th"); th.textContent = h; tr.appendChild(th); });
+  items.forEach(function (item) {
+    var r = t.insertRow();
+    item.forEach(function (v) { r.insertCell().textContent = v; });
+  });
+}
+var es = new EventSource("` + dashboardEventsPath + `");
+es.onopen = function () { document.getElementById("status").textContent = "live"; };
+es.onerror = function () { document.getElementById("status").textContent = "reconnecting…"; };
+es.onmessage = function (e) {
+  var s = JSON.parse(e.data);
+  document.getElementById("rps").textContent = s.requests_per_second.toFixed(1);
+  document.getElementById("inflight").textContent = s.in_flight;
+  var up = document.getElementById("upstream");
+  up.textContent = s.upstream ? (s.upstream.healthy ? "healthy" : "down") : "-";
+  up.className = s.upstream ? (s.upstream.healthy ? "ok" : "ng") : "";
+  up.title = s.upstream ? s.upstream.url + (s.upstream.error ? ": " + s.upstream.error : "") : "";
+  rows("statuses", ["Status", "Requests/s"], Object.keys(s.statuses).sort().map(function (k) { return [k, s.statuses[k].toFixed(1)]; }));
+  rows("caches", ["Cache", "Hits", "Misses", "Hit rate"], Object.keys(s.caches).sort().map(function (k) {
+    var c = s.caches[k]; return [k, c.hits, c.misses, (c.hit_rate * 100).toFixed(1) + "%"];
+  }));
+  rows("paths", ["Path", "Requests"], s.top_paths ? s.top_paths.map(function (p) { return [p.path, p.count]; }) : [["Set STATS=true to count paths", ""]]);
+  rows("blocked", ["Time", "Client IP", "Path", "Reason"], (s.blocked || []).map(function (b) {
+    return [new Date(b.time).toLocaleTimeString(), b.ip, b.path, b.reason];
+  }));
+};
+</script>
+</body>
+</html>
+`
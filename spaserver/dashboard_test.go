@@ -0,0 +1,78 @@
+package spaserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDashboard(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.BlockedPaths = []string{"*.php"}
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/wp-login.php", nil))
+
+	rr := httptest.NewRecorder()
+	s.admin.ServeHTTP(rr, httptest.NewRequest("GET", dashboardPath, nil))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), dashboardEventsPath) {
+		t.Fatalf("管理画面が返されていません: %d %s", rr.Code, rr.Body.String())
+	}
+
+	// 最初の値を読んだら接続を切る
+	admin := httptest.NewServer(s.admin)
+	defer admin.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", admin.URL+dashboardEventsPath, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("期待される Content-Type %q, 実際の Content-Type %q", "text/event-stream", ct)
+	}
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	var st dashboardState
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &st); err != nil {
+		t.Fatalf("%v: %q", err, line)
+	}
+	if len(st.Blocked) != 1 || st.Blocked[0].Path != "/wp-login.php" {
+		t.Errorf("拒否したリクエストが含まれていません: %+v", st.Blocked)
+	}
+	if st.Upstream != nil {
+		t.Errorf("プロキシ先がない場合は状態を含めるべきではありません: %+v", st.Upstream)
+	}
+}
+
+func TestBlockedLog(t *testing.T) {
+	l := &blockedLog{}
+	for i := 0; i < recentBlockedSize+5; i++ {
+		l.add("192.0.2.1", "/"+strings.Repeat("a", i), "test")
+	}
+	entries := l.list()
+	if len(entries) != recentBlockedSize {
+		t.Fatalf("期待される件数 %d, 実際の件数 %d", recentBlockedSize, len(entries))
+	}
+	if entries[0].Path != "/"+strings.Repeat("a", recentBlockedSize+4) {
+		t.Errorf("新しい順に並べるべきです: %q", entries[0].Path)
+	}
+}
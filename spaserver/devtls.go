@@ -0,0 +1,109 @@
+package spaserver
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// generateDevCertificate は開発用に localhost の証明書をメモリ上に作成する
+// mkcert のローカル CA（caRoot に rootCA.pem と rootCA-key.pem）があればそれで署名し、ブラウザーで信頼されるようにする
+// ない場合は自己署名証明書を作成する
+func generateDevCertificate(caRoot string) (*tls.Certificate, bool, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, false, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, false, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"spa-server development certificate"}, CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(30 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "localhost" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+
+	parent, signer, trusted := template, crypto.Signer(key), false
+	if ca, caKey, err := loadMkcertCA(caRoot); err == nil {
+		parent, signer, trusted = ca, caKey, true
+	} else if !errors.Is(err, os.ErrNotExist) {
+		warnf("Ignoring mkcert CA in %s: %v", caRoot, err)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		return nil, false, err
+	}
+	cert := &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	if trusted {
+		cert.Certificate = append(cert.Certificate, parent.Raw)
+	}
+	return cert, trusted, nil
+}
+
+// loadMkcertCA は mkcert のローカル CA の証明書と秘密鍵を読み込む
+func loadMkcertCA(caRoot string) (*x509.Certificate, crypto.Signer, error) {
+	if caRoot == "" {
+		return nil, nil, os.ErrNotExist
+	}
+	pair, err := tls.LoadX509KeyPair(filepath.Join(caRoot, "rootCA.pem"), filepath.Join(caRoot, "rootCA-key.pem"))
+	if err != nil {
+		return nil, nil, err
+	}
+	ca, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok || !ca.IsCA {
+		return nil, nil, errors.New("not a CA certificate")
+	}
+	return ca, signer, nil
+}
+
+// mkcertCARoot は mkcert の CA を保存するディレクトリを返す（mkcert -CAROOT と同じ場所）
+func mkcertCARoot() string {
+	if dir := os.Getenv("CAROOT"); dir != "" {
+		return dir
+	}
+	var base string
+	switch runtime.GOOS {
+	case "windows":
+		base = os.Getenv("LOCALAPPDATA")
+	case "darwin":
+		if home, err := os.UserHomeDir(); err == nil {
+			base = filepath.Join(home, "Library", "Application Support")
+		}
+	default:
+		base = os.Getenv("XDG_DATA_HOME")
+		if base == "" {
+			if home, err := os.UserHomeDir(); err == nil {
+				base = filepath.Join(home, ".local", "share")
+			}
+		}
+	}
+	if base == "" {
+		return ""
+	}
+	return filepath.Join(base, "mkcert")
+}
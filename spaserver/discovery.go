@@ -0,0 +1,185 @@
+package spaserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// consulDiscovery は Consul のヘルスチェックに合格したサービスのインスタンスを探す
+type consulDiscovery struct {
+	addr    string
+	token   string
+	service string
+	client  *http.Client
+}
+
+func newConsulDiscovery(addr, token, service string) *consulDiscovery {
+	if addr == "" {
+		addr = "127.0.0.1:8500"
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return &consulDiscovery{
+		addr:    strings.TrimSuffix(addr, "/"),
+		token:   token,
+		service: service,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (d *consulDiscovery) lookup(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", d.addr+"/v1/health/service/"+url.PathEscape(d.service)+"?passing=true", nil)
+	if err != nil {
+		return nil, err
+	}
+	if d.token != "" {
+		req.Header.Set("X-Consul-Token", d.token)
+	}
+	var entries []struct {
+		Node struct {
+			Address string
+		}
+		Service struct {
+			Address string
+			Port    int
+		}
+	}
+	if err := getJSON(d.client, req, &entries); err != nil {
+		return nil, fmt.Errorf("consul: %w", err)
+	}
+	var addrs []string
+	for _, e := range entries {
+		// サービスのアドレスがない場合はノードのアドレスを使う
+		host := e.Service.Address
+		if host == "" {
+			host = e.Node.Address
+		}
+		addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(e.Service.Port)))
+	}
+	return addrs, nil
+}
+
+// Pod 内から Kubernetes API に接続するためのサービスアカウントのファイル
+const k8sServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// k8sDiscovery は Kubernetes の Service の EndpointSlice から準備のできた Pod のアドレスを探す
+type k8sDiscovery struct {
+	apiURL    string
+	tokenFile string
+	namespace string
+	service   string
+	// Pod のポート（空の場合は EndpointSlice の最初のポート）
+	port   string
+	client *http.Client
+}
+
+// newK8sDiscovery は "サービス名[.名前空間]" の Service を探す（名前空間の省略時は自身の名前空間）
+func newK8sDiscovery(host, port string) (*k8sDiscovery, error) {
+	apiHost, apiPort := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if apiHost == "" || apiPort == "" {
+		return nil, fmt.Errorf("k8s: not running in a Kubernetes cluster (KUBERNETES_SERVICE_HOST is not set)")
+	}
+	service, namespace, _ := strings.Cut(host, ".")
+	if namespace == "" {
+		data, err := os.ReadFile(filepath.Join(k8sServiceAccountDir, "namespace"))
+		if err != nil {
+			return nil, fmt.Errorf("k8s: %w", err)
+		}
+		namespace = strings.TrimSpace(string(data))
+	}
+	ca, err := os.ReadFile(filepath.Join(k8sServiceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("k8s: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("k8s: no certificates in ca.crt")
+	}
+	return &k8sDiscovery{
+		apiURL:    "https://" + net.JoinHostPort(apiHost, apiPort),
+		tokenFile: filepath.Join(k8sServiceAccountDir, "token"),
+		namespace: namespace,
+		service:   service,
+		port:      port,
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+	}, nil
+}
+
+func (d *k8sDiscovery) lookup(ctx context.Context) ([]string, error) {
+	u := fmt.Sprintf("%s/apis/discovery.k8s.io/v1/namespaces/%s/endpointslices?labelSelector=%s",
+		d.apiURL, url.PathEscape(d.namespace), url.QueryEscape("kubernetes.io/service-name="+d.service))
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	// トークンは定期的に更新されるので毎回読み込む
+	token, err := os.ReadFile(d.tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("k8s: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	var list struct {
+		Items []struct {
+			Ports []struct {
+				Port int
+			}
+			Endpoints []struct {
+				Addresses  []string
+				Conditions struct {
+					Ready *bool
+				}
+			}
+		}
+	}
+	if err := getJSON(d.client, req, &list); err != nil {
+		return nil, fmt.Errorf("k8s: %w", err)
+	}
+	var addrs []string
+	for _, slice := range list.Items {
+		port := d.port
+		if port == "" {
+			if len(slice.Ports) == 0 {
+				continue
+			}
+			port = strconv.Itoa(slice.Ports[0].Port)
+		}
+		for _, ep := range slice.Endpoints {
+			// ready が未設定の場合は準備ができているとみなす
+			if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+				continue
+			}
+			for _, addr := range ep.Addresses {
+				addrs = append(addrs, net.JoinHostPort(addr, port))
+			}
+		}
+	}
+	return addrs, nil
+}
+
+// getJSON はリクエストを送信し、JSON のレスポンスを v に読み込む
+func getJSON(client *http.Client, req *http.Request, v interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", req.URL.Path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
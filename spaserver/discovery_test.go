@@ -0,0 +1,108 @@
+package spaserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestConsulDiscovery(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+
+	consul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/health/service/api" || r.URL.Query().Get("passing") != "true" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("X-Consul-Token") != "secret" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`[{"Node":{"Address":"` + u.Hostname() + `"},"Service":{"Address":"","Port":` + u.Port() + `}}]`))
+	}))
+	defer consul.Close()
+
+	target := "consul+http://api"
+	proxy, err := newProxy(target, protocolAuto, nil, newServerMetrics())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver, err := newUpstreamResolver(target, ProxyConfig{ConsulAddr: consul.URL, ConsulToken: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver.attach(proxy.Transport.(*upstreamTransport))
+	resolver.start()
+	defer resolver.Close()
+
+	rr := httptest.NewRecorder()
+	proxy.ServeHTTP(rr, httptest.NewRequest("GET", "/api/items", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("期待されるステータスコード %d, 実際のステータスコード %d", http.StatusOK, rr.Code)
+	}
+}
+
+func TestK8sDiscovery(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/discovery.k8s.io/v1/namespaces/prod/endpointslices" ||
+			r.URL.Query().Get("labelSelector") != "kubernetes.io/service-name=api" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"items":[
+			{"ports":[{"name":"http","port":8080}],"endpoints":[
+				{"addresses":["10.0.0.1"],"conditions":{"ready":true}},
+				{"addresses":["10.0.0.2"],"conditions":{"ready":false}},
+				{"addresses":["10.0.0.3"]}
+			]},
+			{"ports":[{"name":"http","port":8080}],"endpoints":[{"addresses":["10.0.1.1"],"conditions":{"ready":true}}]}
+		]}`))
+	}))
+	defer api.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(tokenFile, []byte("token\n"), 0600)
+
+	tests := []struct {
+		name     string
+		port     string
+		expected []string
+	}{
+		{"EndpointSlice のポート", "", []string{"10.0.0.1:8080", "10.0.0.3:8080", "10.0.1.1:8080"}},
+		{"URL で指定したポート", "9090", []string{"10.0.0.1:9090", "10.0.0.3:9090", "10.0.1.1:9090"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &k8sDiscovery{apiURL: api.URL, tokenFile: tokenFile, namespace: "prod", service: "api", port: tt.port, client: api.Client()}
+			addrs, err := d.lookup(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(addrs)
+			if !reflect.DeepEqual(addrs, tt.expected) {
+				t.Errorf("期待されるアドレス %v, 実際のアドレス %v", tt.expected, addrs)
+			}
+		})
+	}
+}
+
+func TestK8sDiscoveryOutsideCluster(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	if _, err := newUpstreamResolver("k8s+http://api.default", ProxyConfig{}); err == nil {
+		t.Error("クラスターの外ではエラーになるべきです")
+	}
+}
@@ -0,0 +1,58 @@
+package spaserver
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// distRoot は配信ディレクトリのパスを解決する
+// `current -> releases/xyz` のようなシンボリックリンクを実体のパスに解決し、
+// リクエスト中は同じ実体を使うことで、切り替え時に新旧のファイルが混ざらないようにする
+type distRoot struct {
+	path string
+
+	// cached が true の場合は変更通知があるまで解決結果を使い回す
+	cached   bool
+	mu       sync.RWMutex
+	resolved string
+}
+
+func newDistRoot(path string, cached bool) *distRoot {
+	d := &distRoot{path: path, cached: cached}
+	d.Refresh()
+	return d
+}
+
+// Resolve は配信ディレクトリの実体のパスを返す
+func (d *distRoot) Resolve() string {
+	if !d.cached {
+		return d.eval()
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.resolved
+}
+
+// Refresh はシンボリックリンクを解決し直し、実体が変わった場合は true を返す
+func (d *distRoot) Refresh() bool {
+	resolved := d.eval()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if resolved == d.resolved {
+		return false
+	}
+	if d.resolved != "" {
+		infof("%s now points to %s", d.path, resolved)
+	}
+	d.resolved = resolved
+	return true
+}
+
+func (d *distRoot) eval() string {
+	resolved, err := filepath.EvalSymlinks(d.path)
+	if err != nil {
+		// 解決できない場合は設定されたパスをそのまま使う
+		return d.path
+	}
+	return resolved
+}
@@ -0,0 +1,66 @@
+package spaserver
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// flipSymlink はシンボリックリンクをアトミックに差し替える
+func flipSymlink(t *testing.T, target, link string) {
+	t.Helper()
+	tmp := link + ".tmp"
+	if err := os.Symlink(target, tmp); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSymlinkDistDir(t *testing.T) {
+	for _, watch := range []bool{false, true} {
+		name := "リクエストごとに解決"
+		if watch {
+			name = "変更通知で解決"
+		}
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, release := range []string{"a", "b"} {
+				os.MkdirAll(filepath.Join(dir, "releases", release), 0755)
+				os.WriteFile(filepath.Join(dir, "releases", release, "index.html"), []byte(release), 0644)
+			}
+			current := filepath.Join(dir, "current")
+			flipSymlink(t, filepath.Join(dir, "releases", "a"), current)
+
+			cfg := testConfig(t)
+			cfg.DistDir = current
+			cfg.WatchDistDir = watch
+			s, err := newServer(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			get := func() string {
+				rr := httptest.NewRecorder()
+				s.ServeHTTP(rr, httptest.NewRequest("GET", "/route", nil))
+				return rr.Body.String()
+			}
+			if body := get(); body != "a" {
+				t.Fatalf("リンク先のリリースが配信されていません。実際: %q", body)
+			}
+
+			flipSymlink(t, filepath.Join(dir, "releases", "b"), current)
+			deadline := time.Now().Add(2 * time.Second)
+			for get() != "b" {
+				if time.Now().After(deadline) {
+					t.Fatal("シンボリックリンクの切り替えが反映されませんでした")
+				}
+				time.Sleep(50 * time.Millisecond)
+			}
+		})
+	}
+}
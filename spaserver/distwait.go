@@ -0,0 +1,103 @@
+package spaserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 起動時の配信ディレクトリの待機
+// コンテナでは配信ファイルのボリュームがプロセスの起動より少し遅れてマウントされることがある。
+// DIST_DIR_WAIT を設定した場合、DIST_DIR の index.html（RELEASES_DIR の場合はリリース）が現れるまで
+// 終了せずに待ち、その間は 503 を返す。DIST_DIR_WAIT の間に現れなかった場合は終了する
+
+const (
+	// 配信ディレクトリを確認する間隔
+	distWaitInterval = time.Second
+	startingBody     = "Service Unavailable: waiting for the dist directory\n"
+)
+
+// distReady は配信するファイルがそろっているかを確認する
+func distReady(cfg Config) error {
+	if cfg.Releases.Dir != "" {
+		releases, err := listReleases(cfg.Releases.Dir)
+		if err == nil && len(releases) == 0 {
+			err = fmt.Errorf("no releases in %s", cfg.Releases.Dir)
+		}
+		return err
+	}
+	if cfg.DistDir == "" {
+		return errors.New("DIST_DIR is not defined")
+	}
+	_, err := os.Stat(filepath.Join(cfg.DistDir, "index.html"))
+	return err
+}
+
+// newStartingServer は配信ディレクトリを待つ間の仮のサーバーを作成する
+// /healthz は 200、/readyz とその他のリクエストは 503 を返す
+func newStartingServer(cfg Config, waitErr error) *server {
+	s := &server{cfg: cfg, state: newServerState()}
+	readyz := func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]interface{}{
+			"status": "unavailable",
+			"checks": map[string]string{"dist_dir": waitErr.Error()},
+		})
+	}
+	s.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			serveHealthz(w, r)
+		case "/readyz":
+			readyz(w, r)
+		default:
+			w.Header().Set("Cache-Control", "no-store")
+			w.Header().Set("Retry-After", "5")
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, startingBody)
+		}
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/__version", serveVersion)
+	mux.HandleFunc("/healthz", serveHealthz)
+	mux.HandleFunc("/readyz", readyz)
+	mux.Handle(cfg.Metrics.Path, s.state.metrics)
+	s.admin = requireAdminToken(cfg.Admin.Token, mux)
+	return s
+}
+
+// waitForDist は配信ファイルがそろうまで待ってからサーバーを作成し、仮のサーバーと差し替える
+// DIST_DIR_WAIT を過ぎた場合と、サーバーを作成できない場合は終了する
+func waitForDist(cfg Config, h *handlerSwitch, starting *server) {
+	deadline := time.Now().Add(cfg.DistWait)
+	ticker := time.NewTicker(distWaitInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		// 待っている間に SIGHUP で設定が読み込み直された
+		if h.current.Load() != starting {
+			return
+		}
+		err := distReady(cfg)
+		if err != nil {
+			if time.Now().After(deadline) {
+				errorf("Dist directory not available after %s: %v", cfg.DistWait, err)
+				os.Exit(1)
+			}
+			continue
+		}
+		srv, err := newServer(cfg, withState(starting.state))
+		if err != nil {
+			errorf("Error: %v", err)
+			os.Exit(1)
+		}
+		if !h.current.CompareAndSwap(starting, srv) {
+			srv.Close()
+			return
+		}
+		infof("Dist directory is available, serving")
+		return
+	}
+}
@@ -0,0 +1,58 @@
+package spaserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWaitForDist(t *testing.T) {
+	dir := t.TempDir()
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.DistWait = time.Minute
+
+	err := distReady(cfg)
+	if err == nil {
+		t.Fatal("index.html がない場合はエラーになるべきです")
+	}
+	h := &handlerSwitch{}
+	starting := newStartingServer(cfg, err)
+	h.current.Store(starting)
+
+	for path, expected := range map[string]int{
+		"/":        http.StatusServiceUnavailable,
+		"/app.js":  http.StatusServiceUnavailable,
+		"/healthz": http.StatusOK,
+		"/readyz":  http.StatusServiceUnavailable,
+	} {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != expected {
+			t.Errorf("%s: 期待されるステータスコード %d, 実際のステータスコード %d", path, expected, rr.Code)
+		}
+	}
+
+	// index.html が現れたら配信を始める
+	done := make(chan struct{})
+	go func() {
+		waitForDist(cfg, h, starting)
+		close(done)
+	}()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("配信ディレクトリを待ち続けています")
+	}
+	defer h.current.Load().Close()
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "SPA" {
+		t.Errorf("期待されるレスポンス 200 SPA, 実際のレスポンス %d %s", rr.Code, rr.Body.String())
+	}
+}
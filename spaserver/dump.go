@@ -0,0 +1,143 @@
+package spaserver
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// requestDumper はリクエストとレスポンスのヘッダー（とボディの先頭）をログに出力する
+type requestDumper struct {
+	paths     []string
+	bodyBytes int
+}
+
+func newRequestDumper(cfg DumpConfig) *requestDumper {
+	if !cfg.Enabled && len(cfg.Paths) == 0 {
+		return nil
+	}
+	return &requestDumper{paths: cfg.Paths, bodyBytes: cfg.BodyBytes}
+}
+
+// Wrap はハンドラーにリクエスト・レスポンスの出力を追加する
+func (d *requestDumper) Wrap(next http.Handler) http.Handler {
+	if d == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(d.paths) > 0 && !matchProxyPath(d.paths, r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		var reqBody limitedBuffer
+		if d.bodyBytes > 0 && r.Body != nil && r.Body != http.NoBody {
+			reqBody.limit = d.bodyBytes
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.TeeReader(r.Body, &reqBody), r.Body}
+		}
+		// ログに出すのはプロキシ先に送る前（プロキシが書き換える前）のヘッダー
+		reqHeader := redactHeader(r.Header)
+		rec := &dumpRecorder{responseRecorder: responseRecorder{ResponseWriter: w}, body: limitedBuffer{limit: d.bodyBytes}}
+		next.ServeHTTP(rec, r)
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "Dump: %s %s %s\n", r.Method, redactQuery(r.URL), r.Proto)
+		fmt.Fprintf(&b, "> Host: %s\n", r.Host)
+		writeDumpHeader(&b, "> ", reqHeader)
+		writeDumpBody(&b, "> ", &reqBody)
+		fmt.Fprintf(&b, "< %d %s (%s)\n", rec.Status(), http.StatusText(rec.Status()), formatDuration(time.Since(start)))
+		writeDumpHeader(&b, "< ", redactHeader(w.Header()))
+		writeDumpBody(&b, "< ", &rec.body)
+		infof("%s", strings.TrimSuffix(b.String(), "\n"))
+	})
+}
+
+func writeDumpHeader(b *strings.Builder, prefix string, h http.Header) {
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range h[key] {
+			fmt.Fprintf(b, "%s%s: %s\n", prefix, key, value)
+		}
+	}
+}
+
+func writeDumpBody(b *strings.Builder, prefix string, body *limitedBuffer) {
+	if body.total == 0 {
+		return
+	}
+	b.WriteString(prefix + "\n")
+	data := body.buf.Bytes()
+	if !utf8.Valid(data) {
+		fmt.Fprintf(b, "%s[%d bytes of binary data]\n", prefix, body.total)
+		return
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		b.WriteString(prefix + line + "\n")
+	}
+	if body.total > int64(len(data)) {
+		fmt.Fprintf(b, "%s... (%d bytes total)\n", prefix, body.total)
+	}
+}
+
+// limitedBuffer は先頭の limit バイトだけを保持し、全体のサイズを数える
+type limitedBuffer struct {
+	buf   bytes.Buffer
+	limit int
+	total int64
+}
+
+func (lb *limitedBuffer) Write(p []byte) (int, error) {
+	lb.total += int64(len(p))
+	if room := lb.limit - lb.buf.Len(); room > 0 {
+		if len(p) > room {
+			lb.buf.Write(p[:room])
+		} else {
+			lb.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// dumpRecorder はレスポンスのボディの先頭を記録する
+type dumpRecorder struct {
+	responseRecorder
+	body limitedBuffer
+}
+
+func (rec *dumpRecorder) Write(b []byte) (int, error) {
+	if rec.body.limit > 0 {
+		rec.body.Write(b)
+	}
+	return rec.responseRecorder.Write(b)
+}
+
+// redactQuery はトークンやパスワードらしいクエリパラメーターの値を伏せた URL を返す
+func redactQuery(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.RequestURI()
+	}
+	query := u.Query()
+	for key := range query {
+		lower := strings.ToLower(key)
+		for _, word := range []string{"token", "key", "secret", "password", "signature"} {
+			if strings.Contains(lower, word) {
+				query[key] = []string{"REDACTED"}
+				break
+			}
+		}
+	}
+	return u.EscapedPath() + "?" + query.Encode()
+}
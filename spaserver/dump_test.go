@@ -0,0 +1,69 @@
+package spaserver
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRequestDump(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "https://app.example.com")
+		w.Header().Set("Set-Cookie", "session=abc")
+		w.Write([]byte(`{"ok":true,"items":[1,2,3,4,5,6,7,8,9]}`))
+	}))
+	defer backend.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Proxy.URL = backend.URL
+	cfg.Proxy.Paths = []string{"/api"}
+	cfg.Dump.Paths = []string{"/api"}
+	cfg.Dump.BodyBytes = 16
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "/api/login?api_key=k123&page=2", strings.NewReader(`{"user":"alice"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Origin", "https://app.example.com")
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, req)
+	if !strings.HasPrefix(rr.Body.String(), `{"ok":true`) {
+		t.Fatalf("レスポンスが変更されています: %s", rr.Body.String())
+	}
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/index.html", nil))
+
+	output := buf.String()
+	for _, expected := range []string{
+		"Dump: POST /api/login?api_key=REDACTED&page=2 HTTP/1.1",
+		"> Authorization: REDACTED",
+		"> Origin: https://app.example.com",
+		`> {"user":"alice"}`,
+		"< 200 OK",
+		"< Access-Control-Allow-Origin: https://app.example.com",
+		"< Set-Cookie: REDACTED",
+		`< {"ok":true,"item`,
+		"... (39 bytes total)",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("出力に %q が含まれていません:\n%s", expected, output)
+		}
+	}
+	for _, unexpected := range []string{"secret", "k123", "session=abc", "/index.html"} {
+		if strings.Contains(output, unexpected) {
+			t.Errorf("出力に %q が含まれています:\n%s", unexpected, output)
+		}
+	}
+}
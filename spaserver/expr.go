@@ -0,0 +1,389 @@
+package spaserver
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// 振り分けルールの条件式
+//
+//	header("X-Env") == "beta" && (path.startsWith("/api") || query("preview") != "")
+//
+// 値は path, method, host, ip と header(name), query(name), cookie(name)（文字列）
+// 文字列には startsWith, endsWith, contains, matches（正規表現）が使える
+// 演算子は ==, !=, &&, ||, ! と括弧
+
+// exprType は式の型
+type exprType int
+
+const (
+	exprString exprType = iota
+	exprBool
+)
+
+func (t exprType) String() string {
+	if t == exprBool {
+		return "bool"
+	}
+	return "string"
+}
+
+// exprNode はコンパイル済みの式（型に応じて str か bool を使う）
+type exprNode struct {
+	typ     exprType
+	str     func(r *http.Request) string
+	boolean func(r *http.Request) bool
+}
+
+// exprToken は字句
+type exprToken struct {
+	kind  string // ident, string, op, eof
+	text  string
+	value string // 文字列リテラルの値
+	pos   int
+}
+
+// lexExpr は式を字句に分割する
+func lexExpr(src string) ([]exprToken, error) {
+	var tokens []exprToken
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '"' || c == '\'':
+			end := i + 1
+			for end < len(src) && src[end] != c {
+				if src[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(src) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			lit := src[i : end+1]
+			if c == '\'' {
+				lit = strconv.Quote(strings.ReplaceAll(lit[1:len(lit)-1], `\'`, `'`))
+			}
+			value, err := strconv.Unquote(lit)
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at %d: %w", i, err)
+			}
+			tokens = append(tokens, exprToken{kind: "string", text: src[i : end+1], value: value, pos: i})
+			i = end + 1
+		case c == '_' || unicode.IsLetter(rune(c)):
+			end := i
+			for end < len(src) && (src[end] == '_' || unicode.IsLetter(rune(src[end])) || unicode.IsDigit(rune(src[end]))) {
+				end++
+			}
+			tokens = append(tokens, exprToken{kind: "ident", text: src[i:end], pos: i})
+			i = end
+		default:
+			op := ""
+			for _, candidate := range []string{"==", "!=", "&&", "||", "!", "(", ")", ".", ","} {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i)
+			}
+			tokens = append(tokens, exprToken{kind: "op", text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, exprToken{kind: "eof", pos: len(src)}), nil
+}
+
+// exprParser は字句列から式をコンパイルする再帰下降パーサー
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	t := p.tokens[p.pos]
+	if t.kind != "eof" {
+		p.pos++
+	}
+	return t
+}
+
+// accept は次の字句が op の場合に読み進める
+func (p *exprParser) accept(op string) bool {
+	if t := p.peek(); t.kind == "op" && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) expect(op string) error {
+	if !p.accept(op) {
+		return p.errorf("expected %q", op)
+	}
+	return nil
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	t := p.peek()
+	found := t.text
+	if t.kind == "eof" {
+		found = "end of expression"
+	}
+	return fmt.Errorf("%s at %d (found %s)", fmt.Sprintf(format, args...), t.pos, found)
+}
+
+// compileExpr は真偽値を返す条件式をコンパイルする
+func compileExpr(src string) (func(r *http.Request) bool, error) {
+	tokens, err := lexExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	node, err := p.parseCondition()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != "eof" {
+		return nil, p.errorf("unexpected token")
+	}
+	return node.boolean, nil
+}
+
+// parseCondition は bool 型の式を読む
+func (p *exprParser) parseCondition() (exprNode, error) {
+	pos := p.peek().pos
+	node, err := p.parseOr()
+	if err != nil {
+		return node, err
+	}
+	if node.typ != exprBool {
+		return node, fmt.Errorf("condition at %d is a string, not a bool", pos)
+	}
+	return node, nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return left, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return right, err
+		}
+		if left.typ != exprBool || right.typ != exprBool {
+			return left, fmt.Errorf("|| requires bool operands")
+		}
+		l, r := left.boolean, right.boolean
+		left = exprNode{typ: exprBool, boolean: func(req *http.Request) bool { return l(req) || r(req) }}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return left, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseComparison()
+		if err != nil {
+			return right, err
+		}
+		if left.typ != exprBool || right.typ != exprBool {
+			return left, fmt.Errorf("&& requires bool operands")
+		}
+		l, r := left.boolean, right.boolean
+		left = exprNode{typ: exprBool, boolean: func(req *http.Request) bool { return l(req) && r(req) }}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return left, err
+	}
+	for _, op := range []string{"==", "!="} {
+		if !p.accept(op) {
+			continue
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return right, err
+		}
+		if left.typ != right.typ {
+			return left, fmt.Errorf("cannot compare %s with %s", left.typ, right.typ)
+		}
+		negate := op == "!="
+		var eq func(req *http.Request) bool
+		if left.typ == exprString {
+			l, r := left.str, right.str
+			eq = func(req *http.Request) bool { return l(req) == r(req) }
+		} else {
+			l, r := left.boolean, right.boolean
+			eq = func(req *http.Request) bool { return l(req) == r(req) }
+		}
+		return exprNode{typ: exprBool, boolean: func(req *http.Request) bool { return eq(req) != negate }}, nil
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.accept("!") {
+		node, err := p.parseUnary()
+		if err != nil {
+			return node, err
+		}
+		if node.typ != exprBool {
+			return node, fmt.Errorf("! requires a bool operand")
+		}
+		inner := node.boolean
+		return exprNode{typ: exprBool, boolean: func(req *http.Request) bool { return !inner(req) }}, nil
+	}
+	return p.parsePostfix()
+}
+
+// parsePostfix は値と、それに続く文字列メソッドの呼び出しを読む
+func (p *exprParser) parsePostfix() (exprNode, error) {
+	node, err := p.parsePrimary()
+	if err != nil {
+		return node, err
+	}
+	for p.accept(".") {
+		name := p.peek()
+		if name.kind != "ident" {
+			return node, p.errorf("expected method name")
+		}
+		p.next()
+		arg, err := p.parseStringArg()
+		if err != nil {
+			return node, err
+		}
+		if node.typ != exprString {
+			return node, fmt.Errorf("%s requires a string receiver", name.text)
+		}
+		if node, err = stringMethod(node.str, name.text, arg); err != nil {
+			return node, err
+		}
+	}
+	return node, nil
+}
+
+// stringMethod は文字列メソッドの呼び出しをコンパイルする
+func stringMethod(recv func(*http.Request) string, name, arg string) (exprNode, error) {
+	var fn func(s string) bool
+	switch name {
+	case "startsWith":
+		fn = func(s string) bool { return strings.HasPrefix(s, arg) }
+	case "endsWith":
+		fn = func(s string) bool { return strings.HasSuffix(s, arg) }
+	case "contains":
+		fn = func(s string) bool { return strings.Contains(s, arg) }
+	case "matches":
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return exprNode{}, fmt.Errorf("matches: %w", err)
+		}
+		fn = re.MatchString
+	default:
+		return exprNode{}, fmt.Errorf("unknown method %s", name)
+	}
+	return exprNode{typ: exprBool, boolean: func(req *http.Request) bool { return fn(recv(req)) }}, nil
+}
+
+// parseStringArg は ("...") の形の引数を読む（引数は文字列リテラルのみ）
+func (p *exprParser) parseStringArg() (string, error) {
+	if err := p.expect("("); err != nil {
+		return "", err
+	}
+	arg := p.peek()
+	if arg.kind != "string" {
+		return "", p.errorf("expected string argument")
+	}
+	p.next()
+	if err := p.expect(")"); err != nil {
+		return "", err
+	}
+	return arg.value, nil
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	t := p.peek()
+	switch t.kind {
+	case "string":
+		p.next()
+		value := t.value
+		return exprNode{typ: exprString, str: func(*http.Request) string { return value }}, nil
+	case "op":
+		if t.text == "(" {
+			p.next()
+			node, err := p.parseOr()
+			if err != nil {
+				return node, err
+			}
+			return node, p.expect(")")
+		}
+	case "ident":
+		p.next()
+		switch t.text {
+		case "true", "false":
+			value := t.text == "true"
+			return exprNode{typ: exprBool, boolean: func(*http.Request) bool { return value }}, nil
+		case "path":
+			return exprNode{typ: exprString, str: func(r *http.Request) string { return r.URL.Path }}, nil
+		case "method":
+			return exprNode{typ: exprString, str: func(r *http.Request) string { return r.Method }}, nil
+		case "host":
+			return exprNode{typ: exprString, str: requestHost}, nil
+		case "ip":
+			return exprNode{typ: exprString, str: getClientIP}, nil
+		case "header", "query", "cookie":
+			name, err := p.parseStringArg()
+			if err != nil {
+				return exprNode{}, err
+			}
+			return exprNode{typ: exprString, str: requestValue(t.text, name)}, nil
+		}
+		return exprNode{}, fmt.Errorf("unknown identifier %s at %d", t.text, t.pos)
+	}
+	return exprNode{}, p.errorf("expected value")
+}
+
+// requestHost はポートを除いたリクエストのホスト名を返す
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && !strings.Contains(host[i:], "]") {
+		host = host[:i]
+	}
+	return strings.ToLower(host)
+}
+
+// requestValue はヘッダー・クエリパラメーター・クッキーの値を返す関数を作る
+func requestValue(kind, name string) func(r *http.Request) string {
+	switch kind {
+	case "header":
+		return func(r *http.Request) string { return r.Header.Get(name) }
+	case "query":
+		return func(r *http.Request) string { return r.URL.Query().Get(name) }
+	}
+	return func(r *http.Request) string {
+		if c, err := r.Cookie(name); err == nil {
+			return c.Value
+		}
+		return ""
+	}
+}
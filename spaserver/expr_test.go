@@ -0,0 +1,67 @@
+package spaserver
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompileExpr(t *testing.T) {
+	req := httptest.NewRequest("POST", "http://api.example.com:8080/api/v2/users?preview=1", nil)
+	req.Header.Set("X-Env", "beta")
+	req.Header.Set("Cookie", "variant=b")
+	req.RemoteAddr = "192.0.2.1:1234"
+
+	tests := []struct {
+		expr     string
+		expected bool
+	}{
+		{`header("X-Env") == "beta"`, true},
+		{`header("x-env") != "beta"`, false},
+		{`header("X-Env") == "beta" && path.startsWith("/api")`, true},
+		{`header("X-Env") == "prod" || query("preview") == "1"`, true},
+		{`!(method == "GET")`, true},
+		{`host == "api.example.com"`, true},
+		{`ip.startsWith("192.0.2.")`, true},
+		{`cookie("variant") == 'b'`, true},
+		{`cookie("missing") == ""`, true},
+		{`path.matches("^/api/v[0-9]+/")`, true},
+		{`path.endsWith("/users") && path.contains("/v2/")`, true},
+		{`path.startsWith("/api") == false`, false},
+		{`true && !false`, true},
+	}
+	for _, tt := range tests {
+		when, err := compileExpr(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if got := when(req); got != tt.expected {
+			t.Errorf("%s: 期待される結果 %v, 実際の結果 %v", tt.expr, tt.expected, got)
+		}
+	}
+}
+
+func TestCompileExprError(t *testing.T) {
+	tests := []struct {
+		expr        string
+		expectedErr string
+	}{
+		{`path`, "not a bool"},
+		{`path == true`, "cannot compare"},
+		{`header(X) == "beta"`, "expected string argument"},
+		{`path.startsWith("/api"`, `expected ")"`},
+		{`path.lower("x")`, "unknown method"},
+		{`user == "admin"`, "unknown identifier"},
+		{`path.matches("[")`, "matches"},
+		{`path == "/api" &&`, "expected value"},
+		{`path == "/api`, "unterminated string"},
+		{`path == "/api" path`, "unexpected token"},
+	}
+	for _, tt := range tests {
+		_, err := compileExpr(tt.expr)
+		if err == nil || !strings.Contains(err.Error(), tt.expectedErr) {
+			t.Errorf("%s: エラーに %q が含まれていません: %v", tt.expr, tt.expectedErr, err)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package spaserver
+
+import (
+	"expvar"
+	"runtime"
+	"time"
+)
+
+// expvar で公開する実行時の情報（memstats と cmdline は expvar パッケージが公開する）
+func init() {
+	expvar.Publish("goroutines", expvar.Func(func() interface{} {
+		return runtime.NumGoroutine()
+	}))
+	expvar.Publish("spa_server", expvar.Func(func() interface{} {
+		vars := map[string]interface{}{
+			"version":        version,
+			"uptime_seconds": int64(time.Since(processStartTime).Seconds()),
+		}
+		if m := expvarMetrics.Load(); m != nil {
+			vars["requests_in_flight"] = m.inFlight.Value()
+			vars["proxy_errors"] = m.proxyErrors.Value()
+			vars["proxy_open_connections"] = m.proxyConns.Value()
+			vars["upstream_up"] = m.upstreamUp.Value()
+		}
+		return vars
+	}))
+}
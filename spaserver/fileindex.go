@@ -0,0 +1,206 @@
+package spaserver
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+)
+
+// 配信ファイルの索引
+// 配信ディレクトリの内容をメモリに読み込み、リクエストごとのシンボリックリンクの解決と os.Stat の代わりに
+// マップを引いてファイルの有無を判定する。配信ディレクトリの変更を検知できる場合（WATCH_DIST_DIR または開発モード）のみ使い、
+// 変更時に作り直す
+
+// staticEntry は URL のパスに対応するファイルの情報
+type staticEntry struct {
+	exists   bool
+	dir      bool
+	hasIndex bool
+	// シンボリックリンクで DIST_DIR の外を指す
+	outside bool
+}
+
+// statStaticPath はファイルシステムを参照して URL のパスに対応するファイルを調べる
+func statStaticPath(distDir, urlPath string) (string, staticEntry) {
+	filePath, ok := resolveStaticPath(distDir, urlPath)
+	if !ok {
+		return filePath, staticEntry{exists: true, outside: true}
+	}
+	info, err := os.Stat(filePath)
+	if os.IsNotExist(err) {
+		return filePath, staticEntry{}
+	}
+	// 読めない場合は http.FileServer にエラーを返させる
+	if err != nil {
+		return filePath, staticEntry{exists: true}
+	}
+	return filePath, staticEntry{exists: true, dir: info.IsDir(), hasIndex: info.IsDir() && hasIndexFile(filePath)}
+}
+
+// fileIndex は配信ディレクトリ内の URL のパスとファイルの情報
+type fileIndex struct {
+	entries map[string]staticEntry
+}
+
+// buildFileIndex は distDir の内容を読み込む
+// シンボリックリンクは辿り、DIST_DIR の外を指すものは outside として記録する
+// 読めないディレクトリがある場合は、その配下が欠けた索引を使わないようにエラーを返す
+func buildFileIndex(distDir string) (*fileIndex, error) {
+	root, err := filepath.EvalSymlinks(distDir)
+	if err != nil {
+		return nil, err
+	}
+	ix := &fileIndex{entries: map[string]staticEntry{"/": {exists: true, dir: true}}}
+	if err := ix.scan(root, root, "/", map[string]bool{root: true}); err != nil {
+		return nil, err
+	}
+	return ix, nil
+}
+
+func (ix *fileIndex) scan(root, dir, urlPath string, visited map[string]bool) error {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		filePath := filepath.Join(dir, f.Name())
+		childPath := path.Join(urlPath, f.Name())
+		if f.Type()&os.ModeSymlink != 0 {
+			realPath, err := filepath.EvalSymlinks(filePath)
+			if err != nil {
+				// リンク切れは存在しないファイルと同じく扱う
+				continue
+			}
+			if !withinDir(root, realPath) {
+				ix.entries[childPath] = staticEntry{exists: true, outside: true}
+				continue
+			}
+			filePath = realPath
+		}
+		info, err := os.Stat(filePath)
+		if err != nil {
+			continue
+		}
+		if !info.IsDir() {
+			ix.entries[childPath] = staticEntry{exists: true}
+			if f.Name() == "index.html" {
+				parent := ix.entries[urlPath]
+				parent.hasIndex = true
+				ix.entries[urlPath] = parent
+			}
+			continue
+		}
+		ix.entries[childPath] = staticEntry{exists: true, dir: true}
+		// シンボリックリンクの循環を辿らない
+		if !visited[filePath] {
+			visited[filePath] = true
+			err := ix.scan(root, filePath, childPath, visited)
+			delete(visited, filePath)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lookup は URL のパスに対応するファイルの情報を返す
+func (ix *fileIndex) lookup(urlPath string) staticEntry {
+	p := path.Clean("/" + urlPath)
+	if e, ok := ix.entries[p]; ok {
+		return e
+	}
+	// DIST_DIR の外を指すディレクトリの配下は配信しない
+	for p != "/" {
+		p = path.Dir(p)
+		if e, ok := ix.entries[p]; ok {
+			return staticEntry{exists: e.outside, outside: e.outside}
+		}
+	}
+	return staticEntry{}
+}
+
+// fileIndexes は配信ディレクトリ（リリースやカナリア版を含む）ごとの索引
+// 索引はロックの外で作り、できあがってから差し替える。作っている間のリクエストはファイルシステムを参照する
+type fileIndexes struct {
+	mu sync.Mutex
+	// 作れなかった配信ディレクトリは nil を記録し、次の変更の通知まで作り直さない
+	indexes map[string]*fileIndex
+	// 作っている途中の配信ディレクトリ（同じ配信ディレクトリを同時に読み込まない）
+	building map[string]bool
+	// clear のたびに増やし、それより前に読み込み始めた索引を使わない
+	generation uint64
+}
+
+func newFileIndexes() *fileIndexes {
+	return &fileIndexes{indexes: map[string]*fileIndex{}, building: map[string]bool{}}
+}
+
+// get は distDir の索引を返す
+// まだない場合は読み込みを始めて nil を返す（作れない場合も nil）
+func (c *fileIndexes) get(distDir string) *fileIndex {
+	c.mu.Lock()
+	ix, ok := c.indexes[distDir]
+	start := !ok && !c.building[distDir]
+	if start {
+		c.building[distDir] = true
+	}
+	generation := c.generation
+	c.mu.Unlock()
+	if start {
+		go c.build(distDir, generation)
+	}
+	return ix
+}
+
+// load は distDir の索引を読み込み終わるまで待って返す（起動時に使う）
+func (c *fileIndexes) load(distDir string) *fileIndex {
+	c.mu.Lock()
+	if ix, ok := c.indexes[distDir]; ok || c.building[distDir] {
+		c.mu.Unlock()
+		return ix
+	}
+	c.building[distDir] = true
+	generation := c.generation
+	c.mu.Unlock()
+	return c.build(distDir, generation)
+}
+
+// build は distDir の索引を作って記録する
+// 読み込み中に clear された場合は、変更を反映していない可能性があるため記録しない
+func (c *fileIndexes) build(distDir string, generation uint64) *fileIndex {
+	ix, err := buildFileIndex(distDir)
+	if err != nil {
+		warnf("Indexing %s: %v (looking up files on disk until the next change)", distDir, err)
+		ix = nil
+	} else {
+		debugf("Indexed %s: %d entries", distDir, len(ix.entries))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.building, distDir)
+	if c.generation == generation {
+		c.indexes[distDir] = ix
+	}
+	return ix
+}
+
+// clear は索引を破棄する（次のリクエストで作り直す）
+func (c *fileIndexes) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.indexes = map[string]*fileIndex{}
+	c.generation++
+}
+
+// lookupStatic は URL のパスに対応するファイルパスとファイルの情報を返す
+// 索引がある場合はファイルシステムを参照しない
+func (s *server) lookupStatic(distDir, urlPath string) (string, staticEntry) {
+	if s.files != nil {
+		if ix := s.files.get(distDir); ix != nil {
+			return filepath.Join(distDir, filepath.FromSlash(path.Clean("/"+urlPath))), ix.lookup(urlPath)
+		}
+	}
+	return statStaticPath(distDir, urlPath)
+}
@@ -0,0 +1,190 @@
+package spaserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileIndex(t *testing.T) {
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644)
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+	os.MkdirAll(filepath.Join(dir, "assets"), 0755)
+	os.WriteFile(filepath.Join(dir, "assets", "app.js"), []byte("app"), 0644)
+	os.MkdirAll(filepath.Join(dir, "docs"), 0755)
+	os.WriteFile(filepath.Join(dir, "docs", "index.html"), []byte("docs"), 0644)
+	if err := os.Symlink(outside, filepath.Join(dir, "linked")); err != nil {
+		t.Skip(err)
+	}
+	os.Symlink(filepath.Join(dir, "assets"), filepath.Join(dir, "static"))
+	os.Symlink(dir, filepath.Join(dir, "assets", "loop"))
+
+	ix, err := buildFileIndex(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		path     string
+		expected staticEntry
+	}{
+		{"ルート", "/", staticEntry{exists: true, dir: true, hasIndex: true}},
+		{"ファイル", "/assets/app.js", staticEntry{exists: true}},
+		{"index.html のないディレクトリ", "/assets", staticEntry{exists: true, dir: true}},
+		{"index.html のあるディレクトリ", "/docs/", staticEntry{exists: true, dir: true, hasIndex: true}},
+		{"存在しないパス", "/users/1", staticEntry{}},
+		{"DIST_DIR 内へのシンボリックリンク", "/static/app.js", staticEntry{exists: true}},
+		{"DIST_DIR の外へのシンボリックリンク", "/linked", staticEntry{exists: true, outside: true}},
+		{"DIST_DIR の外のディレクトリの配下", "/linked/secret.txt", staticEntry{exists: true, outside: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ix.lookup(tt.path); got != tt.expected {
+				t.Errorf("期待される情報 %+v, 実際の情報 %+v", tt.expected, got)
+			}
+			if _, got := statStaticPath(dir, tt.path); got != tt.expected {
+				t.Errorf("ファイルシステムを参照した場合と異なります: %+v, %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFileIndexInvalidate(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+	os.WriteFile(filepath.Join(dir, "robots.txt"), []byte("User-agent: *"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.WatchDistDir = true
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	get := func(path string) string {
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		return rr.Body.String()
+	}
+	if body := get("/robots.txt"); body != "User-agent: *" {
+		t.Fatalf("期待されるボディ %q, 実際のボディ %q", "User-agent: *", body)
+	}
+
+	// 索引にないパスはファイルシステムを参照せずに index.html を返し、変更の通知後は作り直した索引を使う
+	s.files.get(s.distDir()).entries = map[string]staticEntry{}
+	if body := get("/robots.txt"); body != "SPA" {
+		t.Errorf("索引にないパスはファイルシステムを参照するべきではありません: %q", body)
+	}
+	s.invalidate()
+	if body := get("/robots.txt"); body != "User-agent: *" {
+		t.Errorf("変更の通知後はファイルを返すべきです: %q", body)
+	}
+}
+
+func TestFileIndexesBuild(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+	c := newFileIndexes()
+
+	// まだない索引はロックの外で読み込み、その間は nil を返す（ファイルシステムを参照させる）
+	if ix := c.get(dir); ix != nil {
+		t.Fatal("読み込み中は nil を返す必要があります")
+	}
+	deadline := time.Now().Add(time.Second)
+	for c.get(dir) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("索引が作られませんでした")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// 読み込み中に変更が通知された場合は、読み込んだ索引を使わない
+	c.clear()
+	c.mu.Lock()
+	c.building[dir] = true
+	generation := c.generation
+	c.mu.Unlock()
+	c.clear()
+	c.build(dir, generation)
+	c.mu.Lock()
+	_, ok := c.indexes[dir]
+	building := c.building[dir]
+	c.mu.Unlock()
+	if ok || building {
+		t.Errorf("変更の通知より前に読み込み始めた索引を記録するべきではありません")
+	}
+	if ix := c.load(dir); ix == nil || !ix.lookup("/index.html").exists {
+		t.Errorf("起動時は読み込み終わるまで待つ必要があります: %+v", ix)
+	}
+}
+
+func TestFileIndexUnreadableDir(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root では読めないディレクトリを作れない")
+	}
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+	locked := filepath.Join(dir, "locked")
+	os.MkdirAll(locked, 0755)
+	os.Chmod(locked, 0)
+	defer os.Chmod(locked, 0755)
+
+	if _, err := buildFileIndex(dir); err == nil {
+		t.Error("読めないディレクトリがある場合はエラーになる必要があります")
+	}
+	// 作れなかった索引は使わず、次の変更の通知まで作り直さない
+	c := newFileIndexes()
+	if ix := c.load(dir); ix != nil {
+		t.Errorf("一部を読めなかった索引を使うべきではありません")
+	}
+	c.mu.Lock()
+	_, ok := c.indexes[dir]
+	c.mu.Unlock()
+	if !ok {
+		t.Error("作れなかったことを記録する必要があります")
+	}
+}
+
+func BenchmarkServeStatic(b *testing.B) {
+	dir := b.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("<!doctype html><div id=app></div>"), 0644)
+	os.MkdirAll(filepath.Join(dir, "assets", "chunks"), 0755)
+	for i := 0; i < 200; i++ {
+		os.WriteFile(filepath.Join(dir, "assets", "chunks", fmt.Sprintf("chunk-%d.js", i)), []byte("export{}"), 0644)
+	}
+	os.WriteFile(filepath.Join(dir, "assets", "app.js"), []byte("console.log(1)"), 0644)
+
+	for _, indexed := range []bool{false, true} {
+		cfg, err := LoadConfig("")
+		if err != nil {
+			b.Fatal(err)
+		}
+		cfg.DistDir = dir
+		cfg.WatchDistDir = indexed
+		s, err := newServer(cfg)
+		if err != nil {
+			b.Fatal(err)
+		}
+		name := "stat"
+		if indexed {
+			name = "index"
+		}
+		for _, p := range []string{"/users/42/settings", "/assets/app.js"} {
+			b.Run(name+p, func(b *testing.B) {
+				req := httptest.NewRequest(http.MethodGet, p, nil)
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					s.ServeHTTP(httptest.NewRecorder(), req)
+				}
+			})
+		}
+		s.Close()
+	}
+}
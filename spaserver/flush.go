@@ -0,0 +1,162 @@
+package spaserver
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// プロキシしたレスポンスのフラッシュ
+// 通常はレスポンスライターのバッファが一杯になるまでクライアントに送られないため、
+// PROXY_FLUSH_INTERVALS で指定したパスと PROXY_STREAM_CONTENT_TYPES の Content-Type は一定間隔または書き込みごとに送る
+
+// flushInterval はプロキシパスのパターンごとのフラッシュ間隔（負の値は書き込みごと）
+type flushInterval struct {
+	pattern  string
+	interval time.Duration
+}
+
+// parseFlushIntervals は "パターン=時間" の一覧を解析する（時間に -1 を指定した場合は書き込みごと）
+func parseFlushIntervals(entries []string) ([]flushInterval, error) {
+	var intervals []flushInterval
+	for _, entry := range entries {
+		pattern, value, ok := strings.Cut(entry, "=")
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("invalid entry %q (use path=duration or path=-1)", entry)
+		}
+		interval := time.Duration(-1)
+		if value != "-1" {
+			var err error
+			if interval, err = time.ParseDuration(value); err != nil || interval < 0 {
+				return nil, fmt.Errorf("invalid duration in %q", entry)
+			}
+		}
+		intervals = append(intervals, flushInterval{pattern: pattern, interval: interval})
+	}
+	return intervals, nil
+}
+
+// flushIntervalFor はパスに適用するフラッシュ間隔を返す（0 はバッファが一杯になるまで送らない）
+func (s *server) flushIntervalFor(path string) time.Duration {
+	for _, f := range s.flushIntervals {
+		if matchProxyPath([]string{f.pattern}, path) {
+			return f.interval
+		}
+	}
+	return 0
+}
+
+// matchContentType は Content-Type が一覧のいずれかに一致するかを判定する（text/* のような指定もできる）
+func matchContentType(types []string, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range types {
+		if prefix, ok := strings.CutSuffix(t, "/*"); ok {
+			if strings.HasPrefix(mediaType, prefix+"/") {
+				return true
+			}
+		} else if strings.EqualFold(mediaType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// flushWriter は書き込んだレスポンスを一定間隔または書き込みごとにクライアントに送る
+type flushWriter struct {
+	http.ResponseWriter
+	interval time.Duration
+	types    []string
+
+	mu sync.Mutex
+	// レスポンスヘッダーを確認済みか、書き込みごとに送るか
+	decided   bool
+	immediate bool
+	pending   bool
+	stopped   bool
+	timer     *time.Timer
+}
+
+// newFlushWriter はフラッシュの設定がない場合は nil を返す
+func newFlushWriter(w http.ResponseWriter, interval time.Duration, types []string) *flushWriter {
+	if interval == 0 && len(types) == 0 {
+		return nil
+	}
+	return &flushWriter{ResponseWriter: w, interval: interval, types: types}
+}
+
+// decide はレスポンスヘッダーから書き込みごとに送るかを決める（呼び出し側で mu をロックする）
+func (f *flushWriter) decide() {
+	if f.decided {
+		return
+	}
+	f.decided = true
+	f.immediate = f.interval < 0 || matchContentType(f.types, f.Header().Get("Content-Type"))
+}
+
+func (f *flushWriter) WriteHeader(code int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if code >= 200 {
+		f.decide()
+	}
+	f.ResponseWriter.WriteHeader(code)
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.decide()
+	n, err := f.ResponseWriter.Write(p)
+	if err != nil {
+		return n, err
+	}
+	switch {
+	case f.immediate:
+		f.flush()
+	case f.interval > 0 && !f.pending:
+		f.pending = true
+		f.timer = time.AfterFunc(f.interval, f.delayedFlush)
+	}
+	return n, nil
+}
+
+// delayedFlush は前回の書き込みから interval が経過したときに送る
+func (f *flushWriter) delayedFlush() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pending = false
+	if !f.stopped {
+		f.flush()
+	}
+}
+
+func (f *flushWriter) Flush() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.flush()
+}
+
+// flush はクライアントに送る（呼び出し側で mu をロックする）
+func (f *flushWriter) flush() {
+	http.NewResponseController(f.ResponseWriter).Flush()
+}
+
+func (f *flushWriter) Unwrap() http.ResponseWriter {
+	return f.ResponseWriter
+}
+
+// stop はハンドラーが戻った後にフラッシュしないようタイマーを止める
+func (f *flushWriter) stop() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stopped = true
+	if f.timer != nil {
+		f.timer.Stop()
+	}
+}
@@ -0,0 +1,90 @@
+package spaserver
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFlushInterval(t *testing.T) {
+	// Content-Length 付きのレスポンスを2回に分けて書き込むバックエンド
+	release := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "10")
+		if r.URL.Path == "/feed" {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+		}
+		w.Write([]byte("hello"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.Write([]byte("world"))
+	}))
+	defer backend.Close()
+	defer close(release)
+
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Proxy.URL = backend.URL
+	cfg.Proxy.Paths = []string{"/stream", "/tick", "/feed"}
+	cfg.Proxy.FlushIntervals = []string{"/stream=-1", "/tick=10ms"}
+	cfg.Proxy.StreamContentTypes = []string{"application/x-ndjson"}
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	front := httptest.NewServer(s)
+	defer front.Close()
+
+	for _, path := range []string{"/stream", "/tick", "/feed"} {
+		t.Run(path, func(t *testing.T) {
+			// 残りが書き込まれる前に最初の部分が届く
+			read := make(chan string, 1)
+			go func() {
+				resp, err := http.Get(front.URL + path)
+				if err != nil {
+					read <- err.Error()
+					return
+				}
+				defer resp.Body.Close()
+				buf := make([]byte, 5)
+				io.ReadFull(resp.Body, buf)
+				read <- string(buf)
+			}()
+			select {
+			case got := <-read:
+				if got != "hello" {
+					t.Errorf("期待されるボディ %q, 実際のボディ %q", "hello", got)
+				}
+			case <-time.After(2 * time.Second):
+				t.Error("レスポンスがフラッシュされていません")
+			}
+		})
+	}
+}
+
+func TestParseFlushIntervals(t *testing.T) {
+	intervals, err := parseFlushIntervals([]string{"/sse=-1", "/export=100ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if intervals[0].interval != -1 || intervals[1].interval != 100*time.Millisecond {
+		t.Errorf("フラッシュ間隔が正しく解析されていません: %v", intervals)
+	}
+	for _, entry := range []string{"/sse", "/sse=fast", "/sse=-2s"} {
+		if _, err := parseFlushIntervals([]string{entry}); err == nil {
+			t.Errorf("%q はエラーになるべきです", entry)
+		}
+	}
+	if !matchContentType([]string{"text/*"}, "text/plain; charset=utf-8") || matchContentType([]string{"application/x-ndjson"}, "application/json") {
+		t.Error("Content-Type の判定が正しくありません")
+	}
+}
@@ -0,0 +1,78 @@
+package spaserver
+
+import (
+	"fmt"
+	"net"
+	"net/http/httputil"
+	"strings"
+)
+
+// プロキシ先に送る転送ヘッダー（X-Forwarded-For・X-Forwarded-Host・X-Forwarded-Proto）
+// PROXY_TRUSTED_PROXIES の接続元から届いた転送ヘッダーだけを引き継ぎ、それ以外の接続元のものは破棄して作り直す
+
+// defaultTrustedProxies はロードバランサーなどが置かれるプライベートアドレスとループバックアドレス
+var defaultTrustedProxies = []string{"127.0.0.0/8", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "::1/128", "fc00::/7"}
+
+// parseTrustedProxies は IP アドレスまたは CIDR の一覧を解析する
+func parseTrustedProxies(entries []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", entry)
+			}
+			bits := 8 * len(ip.To16())
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", entry)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// isTrustedProxy は接続元のアドレス（RemoteAddr）が信頼するプロキシかを判定する
+func isTrustedProxy(trusted []*net.IPNet, remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// setForwarded はプロキシ先へのリクエストに転送ヘッダーを設定する
+// Rewrite に渡される時点で Forwarded と X-Forwarded-* は取り除かれているため、信頼する接続元の場合のみ元のヘッダーを戻す
+func setForwarded(pr *httputil.ProxyRequest, trusted []*net.IPNet) {
+	if !isTrustedProxy(trusted, pr.In.RemoteAddr) {
+		// 信頼しない接続元が付けたクライアントの情報は偽装されている可能性がある
+		pr.Out.Header.Del("X-Real-Ip")
+		pr.SetXForwarded()
+		return
+	}
+	if xff := pr.In.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		pr.Out.Header["X-Forwarded-For"] = xff
+	}
+	pr.SetXForwarded()
+	// 手前のプロキシが受け付けたホスト名とスキームを引き継ぐ
+	for _, name := range []string{"Forwarded", "X-Forwarded-Host", "X-Forwarded-Proto"} {
+		if v := pr.In.Header.Values(name); len(v) > 0 {
+			pr.Out.Header[name] = v
+		}
+	}
+}
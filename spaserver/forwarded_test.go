@@ -0,0 +1,145 @@
+package spaserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProxyForwardedHeaders(t *testing.T) {
+	// プロキシ先は受け取ったヘッダーとパスを返す
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Connection", "X-Internal")
+		w.Header().Set("X-Internal", "secret")
+		json.NewEncoder(w).Encode(map[string]string{
+			"host":      r.Host,
+			"path":      r.URL.Path,
+			"xff":       r.Header.Get("X-Forwarded-For"),
+			"xfh":       r.Header.Get("X-Forwarded-Host"),
+			"xfp":       r.Header.Get("X-Forwarded-Proto"),
+			"forwarded": r.Header.Get("Forwarded"),
+			"realIP":    r.Header.Get("X-Real-Ip"),
+			"hop":       r.Header.Get("X-Hop") + r.Header.Get("Keep-Alive"),
+		})
+	}))
+	defer backend.Close()
+
+	trusted, err := parseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy, err := newProxy(backend.URL+"/base", protocolAuto, trusted, newServerMetrics())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		expected   map[string]string
+	}{
+		{
+			name:       "信頼しない接続元の転送ヘッダーは破棄する",
+			remoteAddr: "203.0.113.9:5000",
+			expected: map[string]string{
+				"host": "app.example.com", "path": "/base/api/items",
+				"xff": "203.0.113.9", "xfh": "app.example.com", "xfp": "http",
+				"forwarded": "", "realIP": "", "hop": "",
+			},
+		},
+		{
+			name:       "信頼するプロキシの転送ヘッダーは引き継ぐ",
+			remoteAddr: "10.1.2.3:5000",
+			expected: map[string]string{
+				"host": "app.example.com", "path": "/base/api/items",
+				"xff": "198.51.100.7, 10.1.2.3", "xfh": "www.example.com", "xfp": "https",
+				"forwarded": "for=198.51.100.7", "realIP": "198.51.100.7", "hop": "",
+			},
+		},
+		{
+			name:       "単一の IP アドレスの指定",
+			remoteAddr: "192.168.1.1:5000",
+			expected: map[string]string{
+				"host": "app.example.com", "path": "/base/api/items",
+				"xff": "198.51.100.7, 192.168.1.1", "xfh": "www.example.com", "xfp": "https",
+				"forwarded": "for=198.51.100.7", "realIP": "198.51.100.7", "hop": "",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://app.example.com/api/items", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-For", "198.51.100.7")
+			req.Header.Set("X-Forwarded-Host", "www.example.com")
+			req.Header.Set("X-Forwarded-Proto", "https")
+			req.Header.Set("Forwarded", "for=198.51.100.7")
+			req.Header.Set("X-Real-Ip", "198.51.100.7")
+			// Connection で指定したヘッダーは接続ごとのヘッダーとして転送しない
+			req.Header.Set("Connection", "X-Hop")
+			req.Header.Set("X-Hop", "1")
+			req.Header.Set("Keep-Alive", "timeout=5")
+			rr := httptest.NewRecorder()
+			proxy.ServeHTTP(rr, req)
+
+			var got map[string]string
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			for key, want := range tt.expected {
+				if got[key] != want {
+					t.Errorf("%s: 期待される値 %q, 実際の値 %q", key, want, got[key])
+				}
+			}
+			if rr.Header().Get("X-Internal") != "" || rr.Header().Get("Connection") != "" {
+				t.Errorf("レスポンスの接続ごとのヘッダーが転送されています: %v", rr.Header())
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	if _, err := parseTrustedProxies(defaultTrustedProxies); err != nil {
+		t.Errorf("デフォルトの信頼するプロキシがエラーになりました: %v", err)
+	}
+	for _, entry := range []string{"10.0.0.0/33", "proxy.local"} {
+		if _, err := parseTrustedProxies([]string{entry}); err == nil {
+			t.Errorf("%q はエラーになるべきです", entry)
+		}
+	}
+}
+
+func TestResolveClientIP(t *testing.T) {
+	trusted, err := parseTrustedProxies(defaultTrustedProxies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		expected     string
+	}{
+		{name: "転送ヘッダーがない場合は接続元", remoteAddr: "203.0.113.7:1234", expected: "203.0.113.7"},
+		{name: "IPv6 の接続元はポートを取り除く", remoteAddr: "[2001:db8::1]:1234", expected: "2001:db8::1"},
+		{name: "信頼しない接続元の X-Forwarded-For は無視する", remoteAddr: "203.0.113.7:1234", forwardedFor: []string{"198.51.100.1"}, expected: "203.0.113.7"},
+		{name: "信頼するプロキシからは X-Forwarded-For の最後のアドレス", remoteAddr: "10.0.0.5:1234", forwardedFor: []string{"198.51.100.1, 203.0.113.7"}, expected: "203.0.113.7"},
+		{name: "信頼するプロキシのアドレスは飛ばす", remoteAddr: "10.0.0.5:1234", forwardedFor: []string{"198.51.100.1, 203.0.113.7, 10.0.0.9"}, expected: "203.0.113.7"},
+		{name: "複数のヘッダーは続けて読む", remoteAddr: "10.0.0.5:1234", forwardedFor: []string{"198.51.100.1", "203.0.113.7"}, expected: "203.0.113.7"},
+		{name: "IP アドレスでない値の手前で止まる", remoteAddr: "10.0.0.5:1234", forwardedFor: []string{"unknown, 10.0.0.9"}, expected: "10.0.0.9"},
+		{name: "信頼するプロキシの X-Forwarded-For がない場合は接続元", remoteAddr: "10.0.0.5:1234", expected: "10.0.0.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwardedFor {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if ip := getClientIP(withClientIP(r, trusted)); ip != tt.expected {
+				t.Errorf("期待されるクライアントIP %q, 実際のクライアントIP %q", tt.expected, ip)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package spaserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// GraphQL のリクエストの記録
+// GRAPHQL_PATHS に一致するプロキシパスへのリクエストから操作名（とクエリのハッシュ）を取り出し、
+// アクセスログとメトリクスに含める
+
+// maxGraphQLBody は操作名を取り出すために読み込むリクエストボディの上限（超える場合は解析しない）
+const maxGraphQLBody = 1 << 20
+
+// maxGraphQLOperations はメトリクスのラベルに使う操作名の種類の上限（超えた分は other にまとめる）
+const maxGraphQLOperations = 200
+
+// graphQLInfo はリクエストから取り出した GraphQL の操作
+type graphQLInfo struct {
+	// 操作名（バッチの場合はカンマ区切り、名前がない場合は anonymous）
+	operation string
+	// クエリの SHA-256（Automatic Persisted Queries のハッシュと同じ）
+	hash string
+}
+
+type graphQLKey struct{}
+
+// graphQLFrom はリクエストのコンテキストから GraphQL の操作の記録先を取得する（記録しない場合は nil）
+func graphQLFrom(ctx context.Context) *graphQLInfo {
+	info, _ := ctx.Value(graphQLKey{}).(*graphQLInfo)
+	return info
+}
+
+// graphQLLogger は GraphQL の操作をアクセスログとメトリクスに記録する
+type graphQLLogger struct {
+	paths     []string
+	queryHash bool
+}
+
+func newGraphQLLogger(cfg GraphQLConfig) *graphQLLogger {
+	if len(cfg.Paths) == 0 {
+		return nil
+	}
+	return &graphQLLogger{paths: cfg.Paths, queryHash: cfg.QueryHash}
+}
+
+// Wrap は GraphQL の操作の記録先をコンテキストに追加する
+// アクセスログとメトリクスより外側に置き、内側の serveProxy で記録した操作を参照できるようにする
+func (g *graphQLLogger) Wrap(next http.Handler) http.Handler {
+	if g == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), graphQLKey{}, &graphQLInfo{})))
+	})
+}
+
+// record はプロキシするリクエストが GRAPHQL_PATHS に一致する場合に操作を記録する
+func (g *graphQLLogger) record(r *http.Request) {
+	if g == nil || !matchProxyPath(g.paths, r.URL.Path) {
+		return
+	}
+	info := graphQLFrom(r.Context())
+	if info == nil {
+		return
+	}
+	queries := readGraphQLQueries(r)
+	if len(queries) == 0 {
+		return
+	}
+	var names, hashes []string
+	for _, q := range queries {
+		names = append(names, q.operationName())
+		if g.queryHash {
+			hashes = append(hashes, q.hash())
+		}
+	}
+	info.operation = strings.Join(names, ",")
+	info.hash = strings.Join(hashes, ",")
+}
+
+// graphQLQuery は GraphQL のリクエスト1件分
+type graphQLQuery struct {
+	Query         string `json:"query"`
+	OperationName string `json:"operationName"`
+	Extensions    struct {
+		PersistedQuery struct {
+			Sha256Hash string `json:"sha256Hash"`
+		} `json:"persistedQuery"`
+	} `json:"extensions"`
+}
+
+// readGraphQLQueries はリクエストから GraphQL のリクエストを読み込む（読み込んだボディは元に戻す）
+func readGraphQLQueries(r *http.Request) []graphQLQuery {
+	if r.Method == http.MethodGet {
+		q := r.URL.Query()
+		query := graphQLQuery{Query: q.Get("query"), OperationName: q.Get("operationName")}
+		if ext := q.Get("extensions"); ext != "" {
+			json.Unmarshal([]byte(ext), &query.Extensions)
+		}
+		if query.Query == "" && query.Extensions.PersistedQuery.Sha256Hash == "" {
+			return nil
+		}
+		return []graphQLQuery{query}
+	}
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength > maxGraphQLBody {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxGraphQLBody+1))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil || len(body) > maxGraphQLBody {
+		return nil
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/graphql" {
+		return []graphQLQuery{{Query: string(body)}}
+	}
+	body = bytes.TrimSpace(body)
+	// 配列はバッチリクエスト
+	if len(body) > 0 && body[0] == '[' {
+		var batch []graphQLQuery
+		if json.Unmarshal(body, &batch) != nil {
+			return nil
+		}
+		return batch
+	}
+	var query graphQLQuery
+	if json.Unmarshal(body, &query) != nil {
+		return nil
+	}
+	return []graphQLQuery{query}
+}
+
+var graphQLOperationPattern = regexp.MustCompile(`\b(?:query|mutation|subscription)\s+([_A-Za-z][_0-9A-Za-z]*)`)
+
+// operationName は操作名を返す（operationName がない場合はクエリの最初の操作の名前）
+func (q graphQLQuery) operationName() string {
+	if q.OperationName != "" {
+		return q.OperationName
+	}
+	if m := graphQLOperationPattern.FindStringSubmatch(q.Query); m != nil {
+		return m[1]
+	}
+	return "anonymous"
+}
+
+// hash はクエリの SHA-256 を返す（Persisted Query でクエリがない場合は送られてきたハッシュ）
+func (q graphQLQuery) hash() string {
+	if q.Query == "" {
+		return q.Extensions.PersistedQuery.Sha256Hash
+	}
+	sum := sha256.Sum256([]byte(q.Query))
+	return hex.EncodeToString(sum[:])
+}
+
+var graphQLNamePattern = regexp.MustCompile(`^[_A-Za-z][_0-9A-Za-z]*(,[_A-Za-z][_0-9A-Za-z]*)*$`)
+
+var graphQLOperations = struct {
+	sync.Mutex
+	seen map[string]bool
+}{seen: map[string]bool{}}
+
+// graphQLMetricLabel はラベルの種類が増えすぎないよう、操作名を上限まで記録し、それ以降の新しい名前を other にまとめる
+func graphQLMetricLabel(operation string) string {
+	if !graphQLNamePattern.MatchString(operation) {
+		return "other"
+	}
+	graphQLOperations.Lock()
+	defer graphQLOperations.Unlock()
+	if graphQLOperations.seen[operation] {
+		return operation
+	}
+	if len(graphQLOperations.seen) >= maxGraphQLOperations {
+		return "other"
+	}
+	graphQLOperations.seen[operation] = true
+	return operation
+}
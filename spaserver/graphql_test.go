@@ -0,0 +1,147 @@
+package spaserver
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestGraphQLOperation(t *testing.T) {
+	const query = "query GetUser($id: ID!) { user(id: $id) { name } }"
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		target      string
+		operation   string
+		hash        string
+	}{
+		{
+			name:      "operationName",
+			method:    "POST",
+			body:      `{"query":"query A { a } query B { b }","operationName":"B"}`,
+			operation: "B",
+		},
+		{
+			name:      "クエリの操作名",
+			method:    "POST",
+			body:      `{"query":"` + query + `"}`,
+			operation: "GetUser",
+			hash:      "2bf8962b6aa91bd7e9f400a05d0b39e73a1471ad009032178e84cb951f0b0955",
+		},
+		{
+			name:      "名前のない操作",
+			method:    "POST",
+			body:      `{"query":"{ me { name } }"}`,
+			operation: "anonymous",
+		},
+		{
+			name:      "バッチ",
+			method:    "POST",
+			body:      `[{"query":"mutation Save { save }"},{"operationName":"Load","query":"query Load { load }"}]`,
+			operation: "Save,Load",
+		},
+		{
+			name:        "application/graphql",
+			method:      "POST",
+			contentType: "application/graphql",
+			body:        "subscription OnMessage { message }",
+			operation:   "OnMessage",
+		},
+		{
+			name:      "GET",
+			method:    "GET",
+			target:    "/query?" + url.Values{"query": {query}, "operationName": {"GetUser"}}.Encode(),
+			operation: "GetUser",
+		},
+		{
+			name:      "Persisted Query",
+			method:    "GET",
+			target:    "/query?" + url.Values{"operationName": {"GetUser"}, "extensions": {`{"persistedQuery":{"version":1,"sha256Hash":"abc123"}}`}}.Encode(),
+			operation: "GetUser",
+			hash:      "abc123",
+		},
+		{
+			name:   "JSON でないボディ",
+			method: "POST",
+			body:   "not json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := tt.target
+			if target == "" {
+				target = "/query"
+			}
+			req := httptest.NewRequest(tt.method, target, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			var names, hashes []string
+			for _, q := range readGraphQLQueries(req) {
+				names = append(names, q.operationName())
+				hashes = append(hashes, q.hash())
+			}
+			if got := strings.Join(names, ","); got != tt.operation {
+				t.Errorf("期待される操作名 %q, 実際の操作名 %q", tt.operation, got)
+			}
+			if tt.hash != "" && strings.Join(hashes, ",") != tt.hash {
+				t.Errorf("期待されるハッシュ %q, 実際のハッシュ %q", tt.hash, hashes)
+			}
+			// 読み込んだボディはプロキシ先にそのまま渡す
+			if body, _ := io.ReadAll(req.Body); string(body) != tt.body {
+				t.Errorf("ボディが元に戻されていません: %q", body)
+			}
+		})
+	}
+}
+
+func TestGraphQLAccessLog(t *testing.T) {
+	g := newGraphQLLogger(GraphQLConfig{Paths: []string{"/query"}, QueryHash: true})
+	l, err := newAccessLogger(LogConfig{AccessFormat: accessLogCommon})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	l.logger = log.New(&buf, "", 0)
+
+	m := newServerMetrics()
+	handler := g.Wrap(m.Wrap(l.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.record(r)
+		io.Copy(io.Discard, r.Body)
+	}))))
+
+	req := httptest.NewRequest("POST", "/query", strings.NewReader(`{"query":"query ListOrders { orders { id } }"}`))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	line := buf.String()
+	if !strings.Contains(line, `graphql="ListOrders" query_hash="`) {
+		t.Errorf("アクセスログに操作名が含まれていません: %s", line)
+	}
+	if got := m.graphQLRequests.Value("ListOrders", "200"); got != 1 {
+		t.Errorf("期待されるリクエスト数 1, 実際のリクエスト数 %v", got)
+	}
+
+	// GRAPHQL_PATHS に一致しないパスは記録しない
+	buf.Reset()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/api/orders", strings.NewReader(`{"query":"query ListOrders { orders { id } }"}`)))
+	if strings.Contains(buf.String(), "graphql=") {
+		t.Errorf("GRAPHQL_PATHS 以外のパスの操作名が記録されています: %s", buf.String())
+	}
+}
+
+func TestGraphQLMetricLabel(t *testing.T) {
+	if got := graphQLMetricLabel(`GetUser"}`); got != "other" {
+		t.Errorf("不正な操作名は other にまとめるべきです: %q", got)
+	}
+	if got := graphQLMetricLabel("GetUser"); got != "GetUser" {
+		t.Errorf("期待されるラベル %q, 実際のラベル %q", "GetUser", got)
+	}
+}
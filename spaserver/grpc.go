@@ -0,0 +1,216 @@
+package spaserver
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// gRPC のプロキシ
+// GRPC_PATHS に一致する gRPC のリクエストを HTTP/2 のまま GRPC_URL（省略時は PROXY_URL）に転送する
+// GRPC_WEB を有効にすると、ブラウザの gRPC-Web のリクエストを gRPC に変換して転送する
+
+// gRPC のステータスコード
+const (
+	grpcCanceled         = 1
+	grpcDeadlineExceeded = 4
+	grpcUnavailable      = 14
+)
+
+// grpcProxy は gRPC のリクエストをプロキシ先に転送する
+type grpcProxy struct {
+	paths  []string
+	web    bool
+	proxy  http.Handler
+	target proxyTarget
+}
+
+// newGRPCProxy は gRPC のプロキシを作成する（GRPC_PATHS がない場合は nil）
+func (s *server) newGRPCProxy(cfg GRPCConfig) (*grpcProxy, error) {
+	if len(cfg.Paths) == 0 {
+		return nil, nil
+	}
+	target := cfg.URL
+	if target == "" {
+		target = s.cfg.Proxy.URL
+	}
+	// gRPC は HTTP/2 が必要なので、http のプロキシ先にも h2c で接続する
+	proxy, err := s.newUpstream(target, protocolH2C)
+	if err != nil {
+		return nil, err
+	}
+	proxy.ErrorHandler = s.serveGRPCError
+	g := &grpcProxy{paths: cfg.Paths, web: cfg.Web, proxy: proxy}
+	g.target = proxyTarget{url: target, handler: http.HandlerFunc(g.serve)}
+	return g, nil
+}
+
+// isGRPCWeb は Content-Type が gRPC-Web かを判定する
+func isGRPCWeb(contentType string) bool {
+	return strings.HasPrefix(contentType, "application/grpc-web")
+}
+
+// match はリクエストが GRPC_PATHS に一致する gRPC（または gRPC-Web）のリクエストかを判定する
+func (g *grpcProxy) match(r *http.Request) bool {
+	contentType := r.Header.Get("Content-Type")
+	if r.Method != http.MethodPost || !strings.HasPrefix(contentType, "application/grpc") {
+		return false
+	}
+	if isGRPCWeb(contentType) && !g.web {
+		return false
+	}
+	return matchProxyPath(g.paths, r.URL.Path)
+}
+
+// serve は gRPC のリクエストを転送する（gRPC-Web の場合は変換する）
+func (g *grpcProxy) serve(w http.ResponseWriter, r *http.Request) {
+	contentType := r.Header.Get("Content-Type")
+	if !isGRPCWeb(contentType) {
+		g.proxy.ServeHTTP(w, r)
+		return
+	}
+
+	// application/grpc-web[-text][+proto] を application/grpc[+proto] に変換する
+	suffix := strings.TrimPrefix(contentType, "application/grpc-web")
+	text := strings.HasPrefix(suffix, "-text")
+	suffix = strings.TrimPrefix(suffix, "-text")
+	r = r.Clone(r.Context())
+	r.Header.Set("Content-Type", "application/grpc"+suffix)
+	r.Header.Set("Te", "trailers")
+	if text {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{base64.NewDecoder(base64.StdEncoding, r.Body), r.Body}
+		r.ContentLength = -1
+		r.Header.Del("Content-Length")
+	}
+
+	gw := &grpcWebWriter{w: w, header: make(http.Header), text: text}
+	g.proxy.ServeHTTP(gw, r)
+	gw.finish()
+}
+
+// serveGRPCError はプロキシ先に接続できない場合に gRPC のエラーを返す（Trailers-Only のレスポンス）
+func (s *server) serveGRPCError(w http.ResponseWriter, r *http.Request, err error) {
+	if isLostHedge(r.Context()) {
+		return
+	}
+	code, message := grpcUnavailable, "upstream unavailable"
+	switch {
+	case isProxyTimeout(r.Context(), err):
+		code, message = grpcDeadlineExceeded, "upstream timeout"
+		warnf("gRPC proxy timeout: %s", r.URL.Path)
+	case errors.Is(err, context.Canceled):
+		code, message = grpcCanceled, "request canceled"
+	default:
+		errorf("gRPC proxy error: %v", err)
+	}
+	s.state.metrics.proxyErrors.Add(1)
+	recordProxyError(r.Context(), err)
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", url.PathEscape(message))
+	w.WriteHeader(http.StatusOK)
+}
+
+// grpcWebWriter は gRPC のレスポンスを gRPC-Web に変換する
+// トレーラーはボディ末尾のトレーラーフレームとして送る（ブラウザは HTTP のトレーラーを読めないため）
+type grpcWebWriter struct {
+	w           http.ResponseWriter
+	header      http.Header
+	text        bool
+	wroteHeader bool
+}
+
+func (gw *grpcWebWriter) Header() http.Header {
+	return gw.header
+}
+
+func (gw *grpcWebWriter) WriteHeader(code int) {
+	if gw.wroteHeader {
+		return
+	}
+	gw.wroteHeader = true
+	h := gw.w.Header()
+	for k, v := range gw.header {
+		if k == "Trailer" || k == "Content-Length" || strings.HasPrefix(k, http.TrailerPrefix) {
+			continue
+		}
+		h[k] = v
+	}
+	if contentType := gw.header.Get("Content-Type"); strings.HasPrefix(contentType, "application/grpc") {
+		webType := "application/grpc-web"
+		if gw.text {
+			webType += "-text"
+		}
+		h.Set("Content-Type", webType+strings.TrimPrefix(contentType, "application/grpc"))
+	}
+	gw.w.WriteHeader(code)
+}
+
+func (gw *grpcWebWriter) Write(b []byte) (int, error) {
+	if !gw.wroteHeader {
+		gw.WriteHeader(http.StatusOK)
+	}
+	if !gw.text {
+		return gw.w.Write(b)
+	}
+	// gRPC-Web のテキスト形式は書き込みごとに base64 で符号化する
+	if _, err := io.WriteString(gw.w, base64.StdEncoding.EncodeToString(b)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (gw *grpcWebWriter) Flush() {
+	http.NewResponseController(gw.w).Flush()
+}
+
+// finish はプロキシ先から受け取ったトレーラーをトレーラーフレームとして書き込む
+func (gw *grpcWebWriter) finish() {
+	if !gw.wroteHeader {
+		gw.WriteHeader(http.StatusOK)
+	}
+	trailers := map[string][]string{}
+	for _, names := range gw.header["Trailer"] {
+		for _, name := range strings.Split(names, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if v, ok := gw.header[name]; ok {
+				trailers[name] = v
+			}
+		}
+	}
+	for k, v := range gw.header {
+		if name, ok := strings.CutPrefix(k, http.TrailerPrefix); ok {
+			trailers[http.CanonicalHeaderKey(name)] = v
+		}
+	}
+	// Trailers-Only のレスポンスはステータスがヘッダーに含まれている
+	if len(trailers) == 0 {
+		return
+	}
+	names := make([]string, 0, len(trailers))
+	for name := range trailers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var block strings.Builder
+	for _, name := range names {
+		for _, v := range trailers[name] {
+			fmt.Fprintf(&block, "%s: %s\r\n", strings.ToLower(name), v)
+		}
+	}
+	frame := make([]byte, 5, 5+block.Len())
+	frame[0] = 0x80
+	binary.BigEndian.PutUint32(frame[1:], uint32(block.Len()))
+	gw.Write(append(frame, block.String()...))
+}
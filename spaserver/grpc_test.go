@@ -0,0 +1,160 @@
+package spaserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// grpcFrame は gRPC のメッセージフレームを作る
+func grpcFrame(msg string) []byte {
+	return append([]byte{0, 0, 0, 0, byte(len(msg))}, msg...)
+}
+
+// newGRPCBackend はリクエストのメッセージをそのまま返す gRPC サーバーを作成する
+func newGRPCBackend(t *testing.T) *httptest.Server {
+	return httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || r.Header.Get("Content-Type") != "application/grpc+proto" || r.Header.Get("Te") != "trailers" {
+			t.Errorf("gRPC のリクエストではありません: %s %s te=%s", r.Proto, r.Header.Get("Content-Type"), r.Header.Get("Te"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/grpc+proto")
+		w.Write(body)
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", "OK")
+	}), &http2.Server{}))
+}
+
+func newGRPCTestServer(t *testing.T, backendURL string) *server {
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Proxy.URL = "http://127.0.0.1:1"
+	cfg.GRPC.URL = backendURL
+	cfg.GRPC.Paths = []string{"/echo.Echo/"}
+	cfg.GRPC.Web = true
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestGRPCProxy(t *testing.T) {
+	backend := newGRPCBackend(t)
+	defer backend.Close()
+	front := httptest.NewServer(newGRPCTestServer(t, backend.URL))
+	defer front.Close()
+
+	// h2c で接続する gRPC クライアント
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	req, _ := http.NewRequest("POST", front.URL+"/echo.Echo/Say", bytes.NewReader(grpcFrame("hello")))
+	req.Header.Set("Content-Type", "application/grpc+proto")
+	req.Header.Set("Te", "trailers")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !bytes.Equal(body, grpcFrame("hello")) {
+		t.Errorf("期待されるボディ %q, 実際のボディ %q", grpcFrame("hello"), body)
+	}
+	if resp.Trailer.Get("Grpc-Status") != "0" {
+		t.Errorf("トレーラーが転送されていません: %v", resp.Trailer)
+	}
+}
+
+func TestGRPCWebProxy(t *testing.T) {
+	backend := newGRPCBackend(t)
+	defer backend.Close()
+	s := newGRPCTestServer(t, backend.URL)
+	trailer := "grpc-message: OK\r\ngrpc-status: 0\r\n"
+	trailerFrame := append([]byte{0x80, 0, 0, 0, byte(len(trailer))}, trailer...)
+
+	tests := []struct {
+		name        string
+		contentType string
+		encode      func([]byte) string
+		decode      func(string) []byte
+	}{
+		{"バイナリ形式", "application/grpc-web+proto",
+			func(b []byte) string { return string(b) },
+			func(s string) []byte { return []byte(s) }},
+		{"テキスト形式", "application/grpc-web-text+proto",
+			base64.StdEncoding.EncodeToString,
+			func(s string) []byte {
+				// 書き込みごとに符号化されたチャンクを復号する
+				var out []byte
+				for len(s) > 0 {
+					end := strings.Index(s, "=")
+					for end >= 0 && end+1 < len(s) && s[end+1] == '=' {
+						end++
+					}
+					if end < 0 {
+						end = len(s) - 1
+					}
+					chunk, err := base64.StdEncoding.DecodeString(s[:end+1])
+					if err != nil {
+						t.Fatal(err)
+					}
+					out, s = append(out, chunk...), s[end+1:]
+				}
+				return out
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/echo.Echo/Say", strings.NewReader(tt.encode(grpcFrame("hello"))))
+			req.Header.Set("Content-Type", tt.contentType)
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, req)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("期待されるステータスコード %d, 実際のステータスコード %d", http.StatusOK, rr.Code)
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != tt.contentType {
+				t.Errorf("期待される Content-Type %s, 実際の Content-Type %s", tt.contentType, ct)
+			}
+			expected := append(grpcFrame("hello"), trailerFrame...)
+			if body := tt.decode(rr.Body.String()); !bytes.Equal(body, expected) {
+				t.Errorf("期待されるボディ %q, 実際のボディ %q", expected, body)
+			}
+		})
+	}
+}
+
+func TestGRPCProxyUnavailable(t *testing.T) {
+	s := newGRPCTestServer(t, "http://127.0.0.1:1")
+	req := httptest.NewRequest("POST", "/echo.Echo/Say", bytes.NewReader(grpcFrame("hello")))
+	req.Header.Set("Content-Type", "application/grpc")
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || rr.Header().Get("Grpc-Status") != "14" {
+		t.Errorf("UNAVAILABLE を返すべきです: %d grpc-status=%s", rr.Code, rr.Header().Get("Grpc-Status"))
+	}
+
+	// gRPC 以外のリクエストは静的ファイルとして扱う
+	rr = httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest("GET", "/echo.Echo/Say", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "SPA" {
+		t.Errorf("gRPC 以外のリクエストは index.html を返すべきです: %d %q", rr.Code, rr.Body.String())
+	}
+}
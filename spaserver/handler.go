@@ -0,0 +1,783 @@
+package spaserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// server はSPAの配信とプロキシを行うハンドラー
+type server struct {
+	cfg Config
+	// 設定の再読み込みの前後で引き継ぐ状態
+	state *serverState
+	// 作成したリバースプロキシ（終了時にアイドル接続を閉じる）
+	proxies []*httputil.ReverseProxy
+	// 転送ヘッダーを引き継ぐ接続元
+	trustedProxies []*net.IPNet
+	// プロキシ先のホスト名を定期的に名前解決する resolver
+	resolvers []*upstreamResolver
+	mock      *mockAPI
+	// プロキシパスへのリクエストを処理するハンドラー（記録・再生を含む）
+	upstream http.Handler
+	// 条件式による振り分けルールと PROXY_PATHS の各項目
+	routes     []*proxyRoute
+	proxyRules *proxyRuleSet
+	grpc       *grpcProxy
+	graphQL    *graphQLLogger
+	bodyBuffer *bodyBuffer
+	compressor *compressor
+	cors       *corsPolicy
+	// プロキシ先 URL ごとのハンドラー
+	upstreams map[string]http.Handler
+	chaos     *chaosInjector
+	health    *healthChecker
+	dist      *distRoot
+	releases  *releaseManager
+	canary    *canary
+	watcher   *dirWatcher
+	live      *liveReload
+	images    *imageResizer
+	minifier  *htmlMinifier
+	preload   *preloader
+	manifest  *manifestLoader
+	// index.html の ETag
+	indexETags etagCache
+	files      *fileIndexes
+	stats      *statsRecorder
+	dashboard  *dashboard
+	alerter    *alerter
+	sentry     *sentryReporter
+	// handlerSwitch から受け付けた処理中のリクエスト（差し替え後に閉じるまで待つ）
+	requests   requestTracker
+	audit      *auditLogger
+	indexFiles *indexFileCache
+	admin      http.Handler
+
+	// ミドルウェアを含むハンドラー
+	handler http.Handler
+	// IP アドレスの確認後・プロキシ・静的ファイルの各段階のハンドラー（追加のミドルウェアを含む）
+	routed  http.Handler
+	proxied http.Handler
+	static  http.Handler
+
+	// プロキシパスごとのリクエストボディの上限・タイムアウト・フラッシュ間隔・取り除くヘッダーとクッキー
+	bodyLimits     []bodyLimit
+	proxyTimeouts  []proxyTimeout
+	flushIntervals []flushInterval
+	stripHeaders   []stripRule
+	stripCookies   []stripRule
+	// パスごとに受け付けるメソッド
+	pathMethods []pathMethods
+	// MAINTENANCE_PAGE の内容（未設定の場合は nil）
+	maintenancePage []byte
+	// RATE_LIMIT と RATE_LIMIT_PATHS（未設定の場合は nil）
+	rateLimits *rateLimiter
+
+	// 配信ファイルの変更時に呼ばれるキャッシュ無効化処理
+	invalidateMu sync.Mutex
+	invalidators []func()
+}
+
+func newServer(cfg Config, opts ...Option) (_ *server, err error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	s := &server{cfg: cfg, state: o.state}
+	if s.state == nil {
+		s.state = newServerState()
+	}
+	// 途中で失敗した場合は開始したバックグラウンド処理を停止する
+	defer func() {
+		if err != nil {
+			s.Close()
+		}
+	}()
+
+	if s.trustedProxies, err = parseTrustedProxies(cfg.Proxy.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("PROXY_TRUSTED_PROXIES: %w", err)
+	}
+	if err := s.state.ipRules.load(cfg.IPRulesFile); err != nil {
+		return nil, fmt.Errorf("IP_RULES_FILE: %w", err)
+	}
+
+	// 記録・再生
+	if cfg.Proxy.ReplayDir != "" {
+		if err := checkDir(cfg.Proxy.ReplayDir); err != nil {
+			return nil, fmt.Errorf("PROXY_REPLAY_DIR: %w", err)
+		}
+	}
+	if cfg.Proxy.RecordDir != "" && cfg.Proxy.ReplayDir == "" {
+		if err := os.MkdirAll(cfg.Proxy.RecordDir, 0755); err != nil {
+			return nil, fmt.Errorf("PROXY_RECORD_DIR: %w", err)
+		}
+	}
+
+	// プロキシの設定
+	if len(cfg.Proxy.Upstreams) > 0 {
+		// 重みを付けた複数のプロキシ先
+		if s.upstream, err = s.newUpstreamPool(cfg.Proxy.Upstreams); err != nil {
+			return nil, fmt.Errorf("PROXY_UPSTREAMS: %w", err)
+		}
+	} else if cfg.Proxy.URL != "" || cfg.Proxy.ReplayDir != "" {
+		if s.upstream, err = s.upstreamFor(cfg.Proxy.URL); err != nil {
+			return nil, fmt.Errorf("parsing proxy URL: %w", err)
+		}
+	}
+	if cfg.Proxy.URL != "" {
+		// プロキシ先のヘルスチェック
+		if cfg.Health.UpstreamPath != "" || cfg.Health.CheckUpstream {
+			path := cfg.Health.UpstreamPath
+			if path == "" {
+				path = "/"
+			}
+			// 名前解決した接続先を使うようにプロキシと同じトランスポートでチェックする
+			var transport http.RoundTripper
+			if len(s.proxies) > 0 {
+				transport = s.proxies[0].Transport
+			}
+			health, err := newHealthChecker(stripDiscoveryScheme(cfg.Proxy.URL), path, cfg.Health.UpstreamInterval, cfg.Health.UpstreamTimeout, transport, s.state.metrics)
+			if err != nil {
+				return nil, fmt.Errorf("configuring upstream health check: %w", err)
+			}
+			s.health = health
+		}
+	}
+	if s.routes, err = s.parseRoutes(cfg.Proxy.Routes); err != nil {
+		return nil, fmt.Errorf("PROXY_ROUTES: %w", err)
+	}
+	if s.proxyRules, err = s.parseProxyRules(cfg.Proxy.Paths); err != nil {
+		return nil, fmt.Errorf("PROXY_PATHS: %w", err)
+	}
+	if s.grpc, err = s.newGRPCProxy(cfg.GRPC); err != nil {
+		return nil, fmt.Errorf("GRPC_URL: %w", err)
+	}
+
+	if cfg.Proxy.MockDir != "" {
+		if err := checkDir(cfg.Proxy.MockDir); err != nil {
+			return nil, fmt.Errorf("MOCK_DIR: %w", err)
+		}
+		s.mock = &mockAPI{dir: cfg.Proxy.MockDir}
+	}
+
+	s.chaos = newChaosInjector(cfg.Chaos)
+	if s.maintenancePage, err = loadMaintenancePage(cfg.Maintenance); err != nil {
+		return nil, err
+	}
+
+	if s.rateLimits, err = newRateLimiter(cfg.RateLimit); err != nil {
+		return nil, err
+	}
+	s.state.rateLimits = s.rateLimits.reuse(s.state.rateLimits)
+	if s.bodyLimits, err = parseBodyLimits(cfg.Proxy.MaxBodyBytes); err != nil {
+		return nil, fmt.Errorf("PROXY_MAX_BODY_BYTES: %w", err)
+	}
+	if s.proxyTimeouts, err = parseProxyTimeouts(cfg.Proxy.Timeouts); err != nil {
+		return nil, fmt.Errorf("PROXY_TIMEOUTS: %w", err)
+	}
+	if s.flushIntervals, err = parseFlushIntervals(cfg.Proxy.FlushIntervals); err != nil {
+		return nil, fmt.Errorf("PROXY_FLUSH_INTERVALS: %w", err)
+	}
+	if s.pathMethods, err = parsePathMethods(cfg.PathMethods); err != nil {
+		return nil, fmt.Errorf("PATH_METHODS: %w", err)
+	}
+	if s.stripHeaders, err = parseStripRules(cfg.Proxy.StripHeaders); err != nil {
+		return nil, fmt.Errorf("PROXY_STRIP_HEADERS: %w", err)
+	}
+	if s.stripCookies, err = parseStripRules(cfg.Proxy.StripCookies); err != nil {
+		return nil, fmt.Errorf("PROXY_STRIP_COOKIES: %w", err)
+	}
+
+	// リリース管理の設定
+	if cfg.Releases.Dir != "" {
+		releases, err := newReleaseManager(cfg.Releases.Dir, cfg.Releases.Keep)
+		if err != nil {
+			return nil, err
+		}
+		s.releases = releases
+		s.onInvalidate(func() {
+			if err := releases.Refresh(); err != nil {
+				errorf("Error scanning releases: %v", err)
+			}
+		})
+	} else if cfg.DistDir == "" {
+		return nil, errors.New("DIST_DIR is not defined (set it in .env or use --dist)")
+	} else if _, err := os.Stat(cfg.DistDir); os.IsNotExist(err) {
+		// 指定されたディレクトリが存在するか確認
+		return nil, fmt.Errorf("directory %s does not exist", cfg.DistDir)
+	} else {
+		s.dist = newDistRoot(cfg.DistDir, cfg.WatchDistDir)
+	}
+	if cfg.Canary.Dir != "" {
+		if _, err := os.Stat(cfg.Canary.Dir); os.IsNotExist(err) {
+			return nil, fmt.Errorf("directory %s does not exist", cfg.Canary.Dir)
+		}
+		s.canary = newCanary(cfg, newDistRoot(cfg.Canary.Dir, cfg.WatchDistDir), s.state.operations)
+	}
+
+	// プラグインの読み込み
+	plugins := o.plugins
+	for _, path := range cfg.Plugins {
+		p, err := loadPlugin(path)
+		if err != nil {
+			return nil, fmt.Errorf("loading plugin: %w", err)
+		}
+		infof("Loaded plugin %s", path)
+		plugins = append(plugins, p)
+	}
+
+	accessLog, err := newAccessLogger(cfg.Log)
+	if err != nil {
+		return nil, err
+	}
+	if s.audit, err = newAuditLogger(cfg.Log); err != nil {
+		return nil, fmt.Errorf("AUDIT_LOG_FILE: %w", err)
+	}
+	s.stats = newStatsRecorder(cfg.Stats, s.state.stats)
+	if s.sentry, err = newSentryReporter(cfg.Sentry, cfg.Log.AnonymizeIPs); err != nil {
+		return nil, fmt.Errorf("SENTRY_DSN: %w", err)
+	}
+	s.admin = newAdminHandler(cfg, s)
+	s.graphQL = newGraphQLLogger(cfg.GraphQL)
+	s.bodyBuffer = newBodyBuffer(cfg.Proxy)
+	s.compressor = newCompressor(cfg.Proxy)
+	s.cors = newCORSPolicy(cfg.CORS)
+	s.handler = o.wrap(MiddlewareOuter, s.graphQL.Wrap(s.state.metrics.Wrap(accessLog.Wrap(s.audit.Wrap(s.stats.Wrap(s.sentry.Wrap(newSlowLogger(cfg.Log).Wrap(newRequestDumper(cfg.Dump).Wrap(http.HandlerFunc(s.serve))))))))))
+	if s.grpc != nil {
+		// TLS なしでも gRPC のクライアントが HTTP/2（h2c）で接続できるようにする
+		s.handler = h2c.NewHandler(s.handler, &http2.Server{})
+	}
+	s.routed = o.wrap(MiddlewareAfterAccessControl, wrapPlugins(plugins, http.HandlerFunc(s.route)))
+	s.proxied = o.wrap(MiddlewareProxy, http.HandlerFunc(s.serveProxy))
+	s.static = o.wrap(MiddlewareStatic, http.HandlerFunc(s.serveApp))
+
+	// 画像のリサイズ
+	if cfg.Images.Resize {
+		if s.images, err = newImageResizer(cfg.Images, s.distDir, s.state.metrics); err != nil {
+			return nil, fmt.Errorf("IMAGE_RESIZE: %w", err)
+		}
+		s.onInvalidate(s.images.cache.clear)
+	}
+
+	// アセットマニフェストと index.html のエントリーのプリロード
+	if cfg.AssetManifest != "" {
+		s.manifest = &manifestLoader{name: cfg.AssetManifest}
+		s.manifest.load(s.distDir())
+	}
+	if cfg.PreloadLinks {
+		s.preload = &preloader{manifest: s.manifest}
+		s.preload.links(filepath.Join(s.distDir(), "index.html"))
+	}
+
+	// HTML の最小化
+	if cfg.MinifyHTML {
+		s.minifier = newHTMLMinifier(s.state.metrics)
+		s.onInvalidate(s.minifier.cache.clear)
+	}
+
+	// 開発モードでは変更時にブラウザーを再読み込みする
+	// 接続中のブラウザーは設定を読み込み直した後のサーバーに引き継ぐ
+	if cfg.Dev.Enabled {
+		if s.state.live == nil {
+			s.state.live = newLiveReload()
+		}
+		s.live = s.state.live
+		s.onInvalidate(s.live.Reload)
+	} else {
+		s.state.live = nil
+	}
+
+	// index.html のメモリ上のコピー
+	s.indexFiles = newIndexFileCache(cfg.WatchDistDir || cfg.Dev.Enabled)
+	s.onInvalidate(s.indexFiles.clear)
+
+	// 配信ディレクトリの監視
+	if cfg.WatchDistDir || cfg.Dev.Enabled {
+		// 変更を検知できる場合のみ配信ファイルの索引を使う
+		s.files = newFileIndexes()
+		s.files.load(s.distDir())
+		s.onInvalidate(s.files.clear)
+		if err := s.watch(); err != nil {
+			return nil, fmt.Errorf("watching dist directory: %w", err)
+		}
+	}
+
+	// アクセス統計の読み込みと定期的な保存
+	s.stats.start()
+	// エラーの急増の通知
+	s.alerter = newAlerter(cfg.Alert, s.state)
+	s.alerter.start()
+
+	return s, nil
+}
+
+// upstreamFor はプロキシ先へのハンドラーを返す（同じ URL には同じハンドラーを使う）
+// PROXY_REPLAY_DIR の場合は記録したレスポンスを返す
+func (s *server) upstreamFor(target string) (http.Handler, error) {
+	if h, ok := s.upstreams[target]; ok {
+		return h, nil
+	}
+	var h http.Handler
+	if s.cfg.Proxy.ReplayDir != "" {
+		h = &trafficReplayer{dir: s.cfg.Proxy.ReplayDir}
+	} else {
+		proxy, err := s.newUpstream(target, s.cfg.Proxy.Protocol)
+		if err != nil {
+			return nil, err
+		}
+		h = proxy
+		if s.cfg.Proxy.RecordDir != "" {
+			h = (&trafficRecorder{dir: s.cfg.Proxy.RecordDir}).Wrap(h)
+		}
+	}
+	if s.upstreams == nil {
+		s.upstreams = map[string]http.Handler{}
+	}
+	s.upstreams[target] = h
+	return h, nil
+}
+
+// newUpstream はプロキシ先へのリバースプロキシを作成し、終了時に閉じるよう登録する
+func (s *server) newUpstream(target, protocol string) (*httputil.ReverseProxy, error) {
+	proxy, err := newProxy(target, protocol, s.trustedProxies, s.state.metrics)
+	if err != nil {
+		return nil, err
+	}
+	proxy.Transport.(*upstreamTransport).configurePool(s.cfg.Proxy)
+	s.proxies = append(s.proxies, proxy)
+	// ホスト名の定期的な再解決（サービスディスカバリーの場合は常に行う）
+	if s.cfg.Proxy.ResolveInterval > 0 || isDiscoveryURL(target) {
+		resolver, err := newUpstreamResolver(target, s.cfg.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		if resolver != nil {
+			resolver.attach(proxy.Transport.(*upstreamTransport))
+			resolver.start()
+			s.resolvers = append(s.resolvers, resolver)
+		}
+	}
+	return proxy, nil
+}
+
+// Close はバックグラウンド処理を停止し、プロキシ先へのアイドル接続を閉じる（io.Closer を満たすため error を返すが、常に nil）
+func (s *server) Close() error {
+	s.closeResources(true)
+	return nil
+}
+
+// retire は設定の読み込み直しで next に差し替えたサーバーを、処理中のリクエストが終わってから閉じる
+// Sentry への送信を待つため、reloadMu の外で呼ぶ
+func (s *server) retire(next *server) {
+	// 管理画面は接続し直すと next の値を表示する
+	s.dashboard.Close()
+	if !s.requests.drain(s.cfg.ShutdownTimeout) {
+		warnf("In-flight requests on the previous configuration did not finish within the shutdown timeout (%s), closing it", s.cfg.ShutdownTimeout)
+	}
+	s.closeResources(s.live != next.live)
+}
+
+// closeResources はバックグラウンド処理とプロキシ先への接続を閉じる
+// closeLive が false の場合は、次のサーバーに引き継いだライブリロードの接続を閉じない
+func (s *server) closeResources(closeLive bool) {
+	for _, resolver := range s.resolvers {
+		resolver.Close()
+	}
+	for _, proxy := range s.proxies {
+		if transport, ok := proxy.Transport.(*upstreamTransport); ok {
+			transport.CloseIdleConnections()
+		}
+	}
+	if s.health != nil {
+		s.health.Close()
+	}
+	if s.watcher != nil {
+		s.watcher.Close()
+	}
+	if s.releases != nil {
+		s.releases.Close()
+	}
+	if s.live != nil && closeLive {
+		s.live.Close()
+	}
+	s.stats.Close()
+	s.dashboard.Close()
+	s.alerter.Close()
+	s.sentry.Close()
+}
+
+// watch は配信ディレクトリの監視を開始する
+// シンボリックリンクの場合はリンク先に加えてリンクのあるディレクトリも監視し、切り替えを検知する
+func (s *server) watch() error {
+	var roots []*distRoot
+	if s.dist != nil {
+		roots = append(roots, s.dist)
+	}
+	if s.canary != nil {
+		roots = append(roots, s.canary.root)
+	}
+	s.onInvalidate(func() {
+		for _, root := range roots {
+			if root.Refresh() {
+				if err := s.watcher.AddTree(root.Resolve()); err != nil {
+					errorf("Error watching %s: %v", root.Resolve(), err)
+				}
+			}
+		}
+	})
+
+	var dirs []string
+	if s.releases != nil {
+		dirs = append(dirs, s.cfg.Releases.Dir)
+	}
+	for _, root := range roots {
+		dirs = append(dirs, root.Resolve())
+	}
+	watcher, err := newDirWatcher(dirs, s.invalidate)
+	if err != nil {
+		return err
+	}
+	s.watcher = watcher
+	for _, root := range roots {
+		if root.Resolve() != root.path {
+			if err := watcher.Add(filepath.Dir(root.path)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// onInvalidate は配信ファイルの変更時に呼ばれる処理を登録する
+func (s *server) onInvalidate(fn func()) {
+	s.invalidateMu.Lock()
+	defer s.invalidateMu.Unlock()
+	s.invalidators = append(s.invalidators, fn)
+}
+
+// invalidate は配信ファイルの変更に伴いキャッシュを無効化する
+func (s *server) invalidate() {
+	infof("Dist directory changed, invalidating caches")
+	s.invalidateMu.Lock()
+	fns := append([]func(){}, s.invalidators...)
+	s.invalidateMu.Unlock()
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+// distDir は配信するディレクトリを返す
+func (s *server) distDir() string {
+	if s.releases != nil {
+		return s.releases.Dir()
+	}
+	return s.dist.Resolve()
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, withClientIP(r, s.trustedProxies))
+}
+
+// serve はヘルスチェックとIPアドレスの確認を行い、許可されたリクエストを route に渡す
+func (s *server) serve(w http.ResponseWriter, r *http.Request) {
+	var timing *requestTiming
+	if s.cfg.ServerTiming {
+		sw, tr := withServerTiming(w, r)
+		w, r, timing = sw, tr, sw.timing
+	}
+
+	// URL の長さの確認とパスの正規化（パスの照合より先に処理する）
+	if !s.normalizeRequest(w, r) {
+		return
+	}
+
+	// ヘルスチェック（オーケストレーターからのアクセスのためIPアドレスの制限より先に処理する）
+	if s.cfg.Health.Endpoints {
+		switch r.URL.Path {
+		case "/healthz":
+			serveHealthz(w, r)
+			return
+		case "/readyz":
+			s.serveReadyz(w, r)
+			return
+		}
+	}
+
+	// クライアントIPアドレスを取得
+	clientIP := getClientIP(r)
+
+	// 管理 API で拒否したIPの確認
+	if s.state.ipRules.denied(clientIP) {
+		warnf("Forbidden: client IP %s is denied (X-Forwarded-For: %q, RemoteAddr: %s)", clientIP, r.Header.Get("X-Forwarded-For"), r.RemoteAddr)
+		s.blockRequest(r, "denied by admin API")
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	// 許可されたIPの確認
+	if !s.state.ipRules.allowed(s.cfg.AllowRemoteIPs, clientIP) {
+		// ログ出力
+		warnf("Forbidden: client IP %s (X-Forwarded-For: %q, RemoteAddr: %s)", clientIP, r.Header.Get("X-Forwarded-For"), r.RemoteAddr)
+		s.blockRequest(r, "ALLOW_REMOTE_IPS")
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if timing != nil {
+		timing.markIPFiltered()
+	}
+	if !s.checkRateLimit(w, r, clientIP) {
+		return
+	}
+	release, ok := s.acquireConn(w, r, clientIP)
+	if !ok {
+		return
+	}
+	defer release()
+	leave, ok := s.enterQueue(w, r)
+	if !ok {
+		return
+	}
+	defer leave()
+	if s.serveMaintenance(w, r) {
+		return
+	}
+	s.routed.ServeHTTP(w, r)
+}
+
+// route は開発・管理用のパスを処理し、プロキシまたは静的ファイルの配信に振り分ける
+func (s *server) route(w http.ResponseWriter, r *http.Request) {
+	if s.live != nil && r.URL.Path == liveReloadPath {
+		s.live.ServeHTTP(w, r)
+		return
+	}
+
+	if s.cfg.VersionEndpoint && r.URL.Path == "/__version" {
+		serveVersion(w, r)
+		return
+	}
+
+	if s.stats != nil && s.cfg.Stats.Endpoint && r.URL.Path == statsPath {
+		s.state.stats.ServeHTTP(w, r)
+		return
+	}
+
+	if s.images != nil && r.URL.Path == imageResizePath {
+		s.images.ServeHTTP(w, r)
+		return
+	}
+
+	// スキャナーなどからのブロック対象のパス
+	if !s.blockPath(w, r) {
+		return
+	}
+
+	// 受け付けるメソッドの確認
+	if !allowMethod(w, r, s.allowedMethodsFor(r.URL.Path)) {
+		return
+	}
+
+	// リクエストボディの上限
+	if !limitBody(w, r, s.bodyLimitFor(r.URL.Path)) {
+		return
+	}
+
+	// gRPC・振り分けルール・プロキシパスのチェック
+	if s.grpc != nil && s.grpc.match(r) {
+		s.proxied.ServeHTTP(w, r.WithContext(withProxyTarget(r.Context(), s.grpc.target)))
+		return
+	}
+	if route := s.matchRoute(r); route != nil {
+		debugf("Route matched: %s", route.rule)
+		s.proxied.ServeHTTP(w, r.WithContext(withProxyTarget(r.Context(), route.target)))
+		return
+	}
+	if rule := s.matchProxyRule(r); rule != nil {
+		s.proxied.ServeHTTP(w, r.WithContext(withProxyTarget(r.Context(), rule.target)))
+		return
+	}
+	s.static.ServeHTTP(w, r)
+}
+
+// serveProxy はプロキシパスへのリクエストをモックまたはプロキシ先で処理する
+// 振り分けルールに一致した場合はそのプロキシ先、それ以外は PROXY_URL を使う
+func (s *server) serveProxy(w http.ResponseWriter, r *http.Request) {
+	if t := timingFrom(r.Context()); t != nil {
+		t.markRouted()
+	}
+	setRouteClass(r.Context(), routeProxy)
+	target := proxyTarget{url: s.cfg.Proxy.URL, handler: s.upstream}
+	if t, ok := proxyTargetFrom(r.Context()); ok {
+		target = t
+	}
+	s.graphQL.record(r)
+	// プリフライトリクエストにはプロキシ先に転送せずに応答する
+	w, done := s.cors.serve(w, r)
+	if done {
+		return
+	}
+	if s.chaos != nil && !s.chaos.inject(w, r) {
+		return
+	}
+	// フィクスチャがあればバックエンドの代わりに返す
+	if s.mock != nil && s.mock.serve(w, r) {
+		return
+	}
+	if target.handler == nil {
+		debugf("Proxy path matched but no proxy is configured: %s", r.URL.Path)
+		http.NotFound(w, r)
+		return
+	}
+	s.stripRequest(r)
+	// gRPC はストリーミングのためバッファリングしない
+	if s.grpc == nil || !s.grpc.match(r) {
+		cleanup, ok := s.bodyBuffer.buffer(w, r)
+		defer cleanup()
+		if !ok {
+			return
+		}
+	}
+	pool, _ := target.handler.(*upstreamPool)
+	if pool != nil {
+		target = pool.pick(w, r)
+	}
+	debugf("Proxying request: %s %s to %s", r.Method, r.URL.Path, target.url)
+	if fw := newFlushWriter(w, s.flushIntervalFor(r.URL.Path), s.cfg.Proxy.StreamContentTypes); fw != nil {
+		defer fw.stop()
+		w = fw
+	}
+	if cw := s.compressor.wrap(w, r); cw != nil {
+		defer cw.close()
+		w = cw
+	}
+	if timeout := s.proxyTimeoutFor(r.URL.Path); timeout > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+	if timing := timingFrom(r.Context()); timing != nil {
+		r = r.WithContext(timing.traceUpstream(r.Context(), target.url))
+		defer timing.finishUpstream()
+	}
+	if s.cfg.Proxy.HedgeDelay > 0 && isHedgeable(r) {
+		backup := target
+		if pool != nil {
+			backup = pool.alternate(target)
+		}
+		serveHedged(w, r, s.cfg.Proxy.HedgeDelay, target, backup, s.state.metrics)
+		return
+	}
+	target.handler.ServeHTTP(w, r)
+}
+
+// serveApp は振り分け先（通常版またはカナリア版）の静的ファイルを返す
+func (s *server) serveApp(w http.ResponseWriter, r *http.Request) {
+	if t := timingFrom(r.Context()); t != nil {
+		t.markRouted()
+	}
+	setRouteClass(r.Context(), routeStatic)
+	if !allowMethod(w, r, staticMethods) {
+		return
+	}
+	distDir := s.distDir()
+	if s.canary != nil && s.canary.variant(w, r) == variantCanary {
+		distDir = s.canary.root.Resolve()
+	}
+	s.serveStatic(w, r, distDir)
+}
+
+// serveStatic は静的ファイルを返し、存在しない場合は index.html を返す
+func (s *server) serveStatic(w http.ResponseWriter, r *http.Request, distDir string) {
+	// 開発モードではキャッシュさせず、HTML にライブリロードのクライアントを挿入する
+	if s.live != nil {
+		r.Header.Del("If-Modified-Since")
+		r.Header.Del("If-None-Match")
+		w.Header().Set("Cache-Control", "no-store")
+		injector := &scriptInjector{ResponseWriter: w}
+		defer injector.finish()
+		w = injector
+	}
+
+	// 隠しファイルは配信しない
+	if !s.cfg.ServeHiddenFiles && isHiddenPath(r.URL.Path) {
+		debugf("Hidden file requested: %s", escapeLogValue(r.URL.Path))
+		http.NotFound(w, r)
+		return
+	}
+
+	// ファイルパスを確認（DIST_DIR の外を指す場合は配信しない）
+	filePath, entry := s.lookupStatic(distDir, r.URL.Path)
+	if entry.outside {
+		warnf("Path outside of dist directory: %s (RemoteAddr: %s)", escapeLogValue(r.URL.Path), r.RemoteAddr)
+		http.NotFound(w, r)
+		return
+	}
+
+	// ファイルが存在しない場合と、一覧を表示しない設定で index.html のないディレクトリの場合は index.html を返す
+	if !entry.exists || (entry.dir && !s.cfg.DirectoryListing && !entry.hasIndex) {
+		debugf("File not found, serving index.html: %s (dist %s)", r.URL.Path, distDir)
+		s.serveIndex(w, r, distDir)
+		return
+	}
+	// Accept に応じて AVIF や WebP の画像に差し替える
+	if len(s.cfg.ImageFormats) > 0 && isConvertibleImage(r.URL.Path) {
+		w.Header().Add("Vary", "Accept")
+		if urlPath, ok := s.imageVariant(r, distDir); ok {
+			debugf("Serving image variant: %s", urlPath)
+			r = withURLPath(r, urlPath)
+		}
+	}
+	// 静的ファイルを提供
+	debugf("Serving file: %s", filePath)
+	switch r.URL.Path {
+	case "/":
+		s.serveIndex(w, r, distDir)
+		return
+	case "/index.html":
+		// http.FileServer が / にリダイレクトする
+		if s.live == nil {
+			w.Header().Set("Cache-Control", indexCacheControl)
+		}
+	}
+	// マニフェストにあるハッシュ付きのファイルは変更されないため長期間キャッシュさせる
+	if s.manifest != nil {
+		if m := s.manifest.load(distDir); m != nil && m.assets[r.URL.Path] {
+			w.Header().Set("Cache-Control", immutableCacheControl)
+		}
+	}
+	if s.minifier != nil {
+		if htmlPath, ok := htmlFilePath(filePath, r.URL.Path, entry.dir); ok && s.minifier.serve(w, r, htmlPath) {
+			return
+		}
+	}
+	http.FileServer(http.Dir(distDir)).ServeHTTP(w, r)
+}
+
+// serveIndex はルートと存在しないパスへのリクエストに index.html を返す
+func (s *server) serveIndex(w http.ResponseWriter, r *http.Request, distDir string) {
+	setRouteClass(r.Context(), routeIndex)
+	indexPath := filepath.Join(distDir, "index.html")
+	s.setIndexHeaders(w, r, indexPath)
+	if s.minifier != nil && s.minifier.serve(w, r, indexPath) {
+		return
+	}
+	if s.indexFiles.serve(w, r, indexPath) {
+		return
+	}
+	http.ServeFile(w, r, indexPath)
+}
+
+// hasIndexFile はディレクトリに index.html があるかを判定する
+func hasIndexFile(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, "index.html"))
+	return err == nil
+}
@@ -0,0 +1,153 @@
+package spaserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// healthChecker はプロキシ先のヘルスチェックを定期的に行う
+type healthChecker struct {
+	target   string
+	client   *http.Client
+	interval time.Duration
+	metrics  *serverMetrics
+
+	mu      sync.RWMutex
+	checked bool
+	err     error
+
+	stop chan struct{}
+}
+
+// newHealthChecker はヘルスチェックを開始する（transport が nil の場合は http.DefaultTransport を使う）
+func newHealthChecker(proxyURL, path string, interval, timeout time.Duration, transport http.RoundTripper, m *serverMetrics) (*healthChecker, error) {
+	base, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	target, err := base.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &healthChecker{
+		target:   target.String(),
+		client:   &http.Client{Timeout: timeout, Transport: transport},
+		interval: interval,
+		metrics:  m,
+		stop:     make(chan struct{}),
+	}
+	go c.run()
+	return c, nil
+}
+
+func (c *healthChecker) run() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		c.check()
+		select {
+		case <-ticker.C:
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// check はプロキシ先にリクエストし、5xx 以外の応答があれば正常とみなす
+func (c *healthChecker) check() {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-c.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	defer cancel()
+
+	var err error
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, c.target, nil)
+	resp, err := c.client.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			err = fmt.Errorf("upstream returned %s", resp.Status)
+		}
+	}
+
+	c.mu.Lock()
+	first := !c.checked
+	wasHealthy := c.checked && c.err == nil
+	c.checked = true
+	c.err = err
+	c.mu.Unlock()
+
+	// 状態が変わったときだけ info/warn で出力する
+	switch {
+	case err != nil && (wasHealthy || first):
+		warnf("Upstream health check failed: %v", err)
+	case err != nil:
+		debugf("Upstream health check failed: %v", err)
+	case !wasHealthy:
+		infof("Upstream is healthy: %s", c.target)
+	}
+	up := 0.0
+	if err == nil {
+		up = 1
+	}
+	c.metrics.upstreamUp.Set(up)
+}
+
+// Healthy はプロキシ先が正常かどうかを返す（初回のチェック前はエラー）
+func (c *healthChecker) Healthy() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.checked {
+		return fmt.Errorf("upstream health not checked yet")
+	}
+	return c.err
+}
+
+// Close はヘルスチェックを停止する
+func (c *healthChecker) Close() {
+	close(c.stop)
+}
+
+// serveHealthz は生存確認（プロセスが応答できれば常に 200）
+func serveHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// serveReadyz は配信ディレクトリとプロキシ先の状態を確認し、すべて正常なら 200、そうでなければ 503 を返す
+func (s *server) serveReadyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{}
+	ready := true
+	report := func(name string, err error) {
+		if err != nil {
+			checks[name] = err.Error()
+			ready = false
+		} else {
+			checks[name] = "ok"
+		}
+	}
+
+	if s.cfg.Health.CheckDist {
+		_, err := os.Stat(filepath.Join(s.distDir(), "index.html"))
+		report("dist_dir", err)
+	}
+	if s.cfg.Health.CheckUpstream && s.health != nil {
+		report("upstream", s.health.Healthy())
+	}
+
+	status, code := "ok", http.StatusOK
+	if !ready {
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, map[string]interface{}{"status": status, "checks": checks})
+}
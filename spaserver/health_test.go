@@ -0,0 +1,74 @@
+package spaserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadyz(t *testing.T) {
+	var upstreamStatus atomic.Int32
+	upstreamStatus.Store(http.StatusOK)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(upstreamStatus.Load()))
+	}))
+	defer backend.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.AllowRemoteIPs = []string{"10.0.0.1"}
+	cfg.Proxy.URL = backend.URL
+	cfg.Health.CheckUpstream = true
+	cfg.Health.UpstreamPath = "/health"
+	cfg.Health.UpstreamInterval = 20 * time.Millisecond
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// 許可リストにないIPからでもヘルスチェックにはアクセスできる
+	get := func(path string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = "192.168.0.1:1234"
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	waitFor := func(path string, expected int) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for get(path) != expected {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s のステータスコードが %d になりませんでした", path, expected)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	if code := get("/healthz"); code != http.StatusOK {
+		t.Errorf("/healthz は常に 200 を返すべきです。実際: %d", code)
+	}
+	waitFor("/readyz", http.StatusOK)
+
+	// プロキシ先が異常になると ready ではなくなる
+	upstreamStatus.Store(http.StatusServiceUnavailable)
+	waitFor("/readyz", http.StatusServiceUnavailable)
+	if code := get("/healthz"); code != http.StatusOK {
+		t.Errorf("/healthz はプロキシ先の状態に影響されるべきではありません。実際: %d", code)
+	}
+
+	// 回復すると再び ready になる
+	upstreamStatus.Store(http.StatusOK)
+	waitFor("/readyz", http.StatusOK)
+
+	// index.html がなくなると ready ではなくなる
+	os.Remove(dir + "/index.html")
+	waitFor("/readyz", http.StatusServiceUnavailable)
+}
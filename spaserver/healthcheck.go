@@ -0,0 +1,76 @@
+package spaserver
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// healthcheck サブコマンド
+// spa-server healthcheck は同じ設定で起動したサーバーの /healthz を最初の公開用リスナー経由で確認し、
+// 200 なら 0、それ以外は 1 で終了する。Docker の HEALTHCHECK でイメージに curl や wget を入れずに済むようにする
+
+// healthcheckTimeout は /healthz の応答を待つ時間
+const healthcheckTimeout = 5 * time.Second
+
+// runHealthcheck は /healthz を確認して結果を表示し、終了コードを返す
+func runHealthcheck(cfg Config) int {
+	if err := checkHealth(cfg); err != nil {
+		fmt.Printf("Unhealthy: %v\n", err)
+		return 1
+	}
+	fmt.Println("OK")
+	return 0
+}
+
+// checkHealth は最初の公開用リスナーの /healthz に GET リクエストを送る
+func checkHealth(cfg Config) error {
+	transport := &http.Transport{DisableKeepAlives: true}
+	scheme, host := "http", ""
+	addr := cfg.PublicAddrs()[0]
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		host = "localhost"
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}
+	} else {
+		h, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return err
+		}
+		host = net.JoinHostPort(loopbackFor(h), port)
+	}
+	if cfg.Dev.TLS {
+		// 開発用の証明書は検証しない
+		scheme = "https"
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	client := &http.Client{Transport: transport, Timeout: healthcheckTimeout}
+	resp, err := client.Get(scheme + "://" + host + "/healthz")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("/healthz returned %s", resp.Status)
+	}
+	return nil
+}
+
+// loopbackFor は待ち受けるアドレスに接続するためのアドレスを返す（全てのインターフェースの場合はループバック）
+func loopbackFor(host string) string {
+	ip := net.ParseIP(host)
+	switch {
+	case host == "" || (ip != nil && ip.Equal(net.IPv4zero)):
+		return "127.0.0.1"
+	case ip != nil && ip.Equal(net.IPv6unspecified):
+		return "::1"
+	}
+	return host
+}
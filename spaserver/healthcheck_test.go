@@ -0,0 +1,57 @@
+package spaserver
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckHealth(t *testing.T) {
+	cfg := testConfig(t)
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			t.Errorf("期待されるパス /healthz, 実際のパス %s", r.URL.Path)
+		}
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	// 全てのインターフェースで待ち受ける設定はループバックに接続する
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	cfg.BindAddr, cfg.Port = "", port
+	if err := checkHealth(cfg); err != nil {
+		t.Errorf("正常な場合はエラーになるべきではありません: %v", err)
+	}
+
+	status = http.StatusServiceUnavailable
+	if err := checkHealth(cfg); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("503 の場合はエラーになるべきです: %v", err)
+	}
+
+	ts.Close()
+	if err := checkHealth(cfg); err == nil {
+		t.Error("接続できない場合はエラーになるべきです")
+	}
+}
+
+func TestCheckHealthUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spa.sock")
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skip(err)
+	}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(serveHealthz))
+	ts.Listener = ln
+	ts.Start()
+	defer ts.Close()
+
+	cfg := testConfig(t)
+	cfg.Listen = []string{"unix:" + path}
+	if err := checkHealth(cfg); err != nil {
+		t.Errorf("unix ソケットで待ち受ける場合もエラーになるべきではありません: %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package spaserver
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ヘッジリクエスト
+// 冪等な GET・HEAD のプロキシが PROXY_HEDGE_DELAY を過ぎても応答しない場合に2回目のリクエストを送り、
+// 先にレスポンスヘッダーが返ってきた方をクライアントに返す（遅い方は取り消す）
+
+// isHedgeable はリクエストをヘッジできるかを判定する（ボディがなく、プロトコルの切り替えでない GET・HEAD）
+func isHedgeable(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if r.Body != nil && r.Body != http.NoBody {
+		return false
+	}
+	return r.Header.Get("Upgrade") == ""
+}
+
+// hedgeRace は同じリクエストの複数の試行のうち、最初に応答した試行を決める
+type hedgeRace struct {
+	w      http.ResponseWriter
+	winner atomic.Pointer[hedgeAttempt]
+}
+
+// hedgeAttempt は1回分の試行
+type hedgeAttempt struct {
+	race   *hedgeRace
+	header http.Header
+	cancel context.CancelFunc
+}
+
+type hedgeAttemptKey struct{}
+
+// isLostHedge は負けたために取り消した試行のリクエストかを判定する（エラーとして記録しない）
+func isLostHedge(ctx context.Context) bool {
+	a, ok := ctx.Value(hedgeAttemptKey{}).(*hedgeAttempt)
+	return ok && a.race.winner.Load() != nil && a.race.winner.Load() != a
+}
+
+// serveHedged は primary にプロキシし、delay を過ぎても応答がなければ backup にも同じリクエストを送る（m に回数を記録する）
+func serveHedged(w http.ResponseWriter, r *http.Request, delay time.Duration, primary, backup proxyTarget, m *serverMetrics) {
+	race := &hedgeRace{w: w}
+	var wg sync.WaitGroup
+	var attempts []*hedgeAttempt
+	done := make(chan *hedgeAttempt, 2)
+	start := func(target proxyTarget) {
+		ctx, cancel := context.WithCancel(r.Context())
+		a := &hedgeAttempt{race: race, header: make(http.Header), cancel: cancel}
+		attempts = append(attempts, a)
+		req := r.WithContext(context.WithValue(ctx, hedgeAttemptKey{}, a))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			target.handler.ServeHTTP(&hedgeWriter{attempt: a}, req)
+			done <- a
+		}()
+	}
+	defer func() {
+		// 負けた試行を取り消し、終了を待つ
+		for _, a := range attempts {
+			a.cancel()
+		}
+		wg.Wait()
+	}()
+
+	start(primary)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	pending := 1
+	for {
+		select {
+		case a := <-done:
+			pending--
+			if race.winner.Load() == a || pending == 0 {
+				return
+			}
+		case <-timer.C:
+			// 応答が始まっていなければ2回目を送る
+			if race.winner.Load() == nil {
+				debugf("Hedging request: %s %s to %s", r.Method, r.URL.Path, backup.url)
+				m.proxyHedges.Add(1)
+				start(backup)
+				pending++
+			}
+		}
+	}
+}
+
+// hedgeWriter は試行のレスポンスを書き込む
+// 最初にレスポンスヘッダーを書き込んだ試行だけがクライアントに書き込み、ほかの試行の書き込みは捨てる
+type hedgeWriter struct {
+	attempt *hedgeAttempt
+	won     bool
+}
+
+func (hw *hedgeWriter) Header() http.Header {
+	if hw.won {
+		return hw.attempt.race.w.Header()
+	}
+	return hw.attempt.header
+}
+
+func (hw *hedgeWriter) WriteHeader(code int) {
+	// 1xx の中間レスポンスでは勝敗を決めない
+	if code < 200 {
+		if hw.won {
+			hw.attempt.race.w.WriteHeader(code)
+		}
+		return
+	}
+	if hw.won || !hw.attempt.race.winner.CompareAndSwap(nil, hw.attempt) {
+		return
+	}
+	hw.won = true
+	w := hw.attempt.race.w
+	for k, v := range hw.attempt.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(code)
+}
+
+func (hw *hedgeWriter) Write(b []byte) (int, error) {
+	if !hw.won {
+		hw.WriteHeader(http.StatusOK)
+		if !hw.won {
+			return len(b), nil
+		}
+	}
+	return hw.attempt.race.w.Write(b)
+}
+
+func (hw *hedgeWriter) Flush() {
+	if hw.won {
+		http.NewResponseController(hw.attempt.race.w).Flush()
+	}
+}
@@ -0,0 +1,92 @@
+package spaserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedgedRequests(t *testing.T) {
+	// 最初のリクエストだけ遅いバックエンド
+	var calls atomic.Int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			select {
+			case <-time.After(2 * time.Second):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		w.Header().Set("X-Attempt", "fast")
+		w.Write([]byte("OK"))
+	}))
+	defer slow.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Proxy.URL = slow.URL
+	cfg.Proxy.Paths = []string{"/api"}
+	cfg.Proxy.HedgeDelay = 50 * time.Millisecond
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	start := time.Now()
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest("GET", "/api/items", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "OK" || rr.Header().Get("X-Attempt") != "fast" {
+		t.Errorf("2回目のリクエストの応答が返されていません: %d %q", rr.Code, rr.Body.String())
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("遅いリクエストを待っています: %v", elapsed)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("期待されるリクエスト数 2, 実際のリクエスト数 %d", calls.Load())
+	}
+
+	// POST はヘッジしない
+	calls.Store(1)
+	rr = httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest("POST", "/api/items", nil))
+	if calls.Load() != 2 {
+		t.Errorf("POST はヘッジするべきではありません: %d", calls.Load())
+	}
+}
+
+func TestHedgedRequestsFastResponse(t *testing.T) {
+	var calls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte("OK"))
+	}))
+	defer backend.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Proxy.URL = backend.URL
+	cfg.Proxy.Paths = []string{"/api"}
+	cfg.Proxy.HedgeDelay = time.Second
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest("GET", "/api/items", nil))
+	if rr.Code != http.StatusOK || rr.Body.String() != "OK" {
+		t.Errorf("期待されるステータスコード %d, 実際のステータスコード %d", http.StatusOK, rr.Code)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("遅延を超えない場合はヘッジするべきではありません: %d", calls.Load())
+	}
+}
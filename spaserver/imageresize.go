@@ -0,0 +1,310 @@
+package spaserver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/sync/singleflight"
+)
+
+// 画像のリサイズ
+// /__img?src=/images/x.jpg&w=400 で DIST_DIR 内の JPEG・PNG を指定した幅に縮小して返す。
+// 縮小した画像は元のファイルの更新日時とサイズをキーにメモリ（と IMAGE_RESIZE_CACHE_DIR）にキャッシュする。
+// 幅は許可リストの値か IMAGE_RESIZE_WIDTH_STEP の倍数に限り、同じ画像の同時のリサイズは1回にまとめ、
+// デコードを同時に行う数を CPU の数までにして、クライアントが大量のリサイズでサーバーを占有できないようにする
+
+const imageResizePath = "/__img"
+
+// maxImagePixels はデコードする画像の最大ピクセル数（巨大な画像によるメモリ不足を防ぐ）
+const maxImagePixels = 50_000_000
+
+// imageDecodeSlots は同時にデコード・リサイズする画像の数の上限
+// CPU を使う処理のため、ハンドラーがいくつあってもプロセス全体で CPU の数までにする
+var imageDecodeSlots = make(chan struct{}, runtime.GOMAXPROCS(0))
+
+// imageResizer は /__img を処理する
+type imageResizer struct {
+	cfg     ImagesConfig
+	widths  []int
+	distDir func() string
+	cache   *byteCache
+	disk    *imageDiskCache
+	metrics *serverMetrics
+	// 同じ画像・幅のリサイズをまとめる
+	group singleflight.Group
+}
+
+// resizedImage は resized の結果
+type resizedImage struct {
+	data []byte
+	hit  bool
+}
+
+// parseImageWidths は許可する幅の一覧を解析する
+func parseImageWidths(entries []string, maxWidth int) ([]int, error) {
+	var widths []int
+	for _, entry := range entries {
+		w, err := strconv.Atoi(entry)
+		if err != nil || w <= 0 || w > maxWidth {
+			return nil, fmt.Errorf("invalid width %q (use 1-%d)", entry, maxWidth)
+		}
+		widths = append(widths, w)
+	}
+	return widths, nil
+}
+
+func newImageResizer(cfg ImagesConfig, distDir func() string, m *serverMetrics) (*imageResizer, error) {
+	widths, err := parseImageWidths(cfg.Widths, cfg.MaxWidth)
+	if err != nil {
+		return nil, err
+	}
+	ir := &imageResizer{cfg: cfg, widths: widths, distDir: distDir, cache: newByteCache(int64(cfg.CacheBytes)), metrics: m}
+	if cfg.CacheDir != "" {
+		if ir.disk, err = newImageDiskCache(cfg.CacheDir, int64(cfg.CacheDirBytes)); err != nil {
+			return nil, err
+		}
+	}
+	return ir, nil
+}
+
+// resizeWidth は要求された幅からリサイズする幅を返す（許可されていない場合は false）
+// IMAGE_RESIZE_WIDTHS がない場合は IMAGE_RESIZE_WIDTH_STEP の倍数に切り上げる
+func (ir *imageResizer) resizeWidth(w int) (int, bool) {
+	if len(ir.widths) == 0 {
+		if w <= 0 || w > ir.cfg.MaxWidth {
+			return 0, false
+		}
+		step := ir.cfg.WidthStep
+		return min(ir.cfg.MaxWidth, (w+step-1)/step*step), true
+	}
+	for _, allowed := range ir.widths {
+		if w == allowed {
+			return w, true
+		}
+	}
+	return 0, false
+}
+
+func (ir *imageResizer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, staticMethods) {
+		return
+	}
+	src := r.URL.Query().Get("src")
+	requested, err := strconv.Atoi(r.URL.Query().Get("w"))
+	width, ok := ir.resizeWidth(requested)
+	if err != nil || !ok {
+		http.Error(w, "Bad Request: invalid width", http.StatusBadRequest)
+		return
+	}
+	ext := strings.ToLower(filepath.Ext(src))
+	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" {
+		http.Error(w, "Bad Request: unsupported image type", http.StatusBadRequest)
+		return
+	}
+	// 静的ファイルと同じく DIST_DIR の外と隠しファイルは参照しない
+	filePath, ok := resolveStaticPath(ir.distDir(), src)
+	if !ok || isHiddenPath(src) {
+		http.NotFound(w, r)
+		return
+	}
+	info, err := os.Stat(filePath)
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%d|%d|%d", filePath, info.Size(), info.ModTime().UnixNano(), width, ir.cfg.Quality)))
+	key := hex.EncodeToString(sum[:])
+	data, hit, err := ir.resized(key, filePath, ext, width)
+	if err != nil {
+		warnf("Resizing image %s: %v", escapeLogValue(src), err)
+		http.Error(w, "Unprocessable Entity", http.StatusUnprocessableEntity)
+		return
+	}
+	setCacheStatus(w, ir.metrics, "image", hit)
+	w.Header().Set("Content-Type", http.DetectContentType(data))
+	w.Header().Set("ETag", `"`+key[:32]+`"`)
+	http.ServeContent(w, r, "", info.ModTime(), bytes.NewReader(data))
+}
+
+// resized はキャッシュまたはリサイズした画像と、キャッシュから返したかを返す
+// 同じキーのリクエストが同時に届いた場合はリサイズを1回だけ行い、結果を共有する
+func (ir *imageResizer) resized(key, filePath, ext string, width int) ([]byte, bool, error) {
+	if data, ok := ir.cache.get(key); ok {
+		return data, true, nil
+	}
+	v, err, _ := ir.group.Do(key, func() (interface{}, error) {
+		if ir.disk != nil {
+			if data, ok := ir.disk.get(key + ext); ok {
+				ir.cache.put(key, data)
+				return resizedImage{data: data, hit: true}, nil
+			}
+		}
+
+		imageDecodeSlots <- struct{}{}
+		data, err := resizeImage(filePath, width, ir.cfg.Quality)
+		<-imageDecodeSlots
+		if err != nil {
+			return nil, err
+		}
+		ir.cache.put(key, data)
+		if ir.disk != nil {
+			ir.disk.put(key+ext, data)
+		}
+		return resizedImage{data: data}, nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	img := v.(resizedImage)
+	return img.data, img.hit, nil
+}
+
+// resizeImage は画像を指定した幅に縮小してエンコードする（元の幅以下の場合はそのまま返す）
+func resizeImage(filePath string, width, quality int) ([]byte, error) {
+	raw, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return nil, fmt.Errorf("image too large (%dx%d)", config.Width, config.Height)
+	}
+	if width >= config.Width {
+		return raw, nil
+	}
+	src, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	height := max(1, config.Height*width/config.Width)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+
+	var buf bytes.Buffer
+	if format == "png" {
+		err = png.Encode(&buf, dst)
+	} else {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: quality})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// imageDiskCache は IMAGE_RESIZE_CACHE_DIR に置くリサイズした画像のキャッシュ
+// 合計サイズが上限を超えると、最近使われていないファイル（更新日時の古いもの）から削除する
+type imageDiskCache struct {
+	dir string
+	max int64
+
+	mu   sync.Mutex
+	size int64
+}
+
+func newImageDiskCache(dir string, max int64) (*imageDiskCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	c := &imageDiskCache{dir: dir, max: max}
+	for _, f := range c.files() {
+		c.size += f.Size()
+	}
+	return c, nil
+}
+
+// files はキャッシュのファイルを返す（書き込み途中の一時ファイルを除く）
+func (c *imageDiskCache) files() []os.FileInfo {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		warnf("Reading image cache: %v", err)
+		return nil
+	}
+	var files []os.FileInfo
+	for _, e := range entries {
+		if e.IsDir() || strings.HasSuffix(e.Name(), ".tmp") {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			files = append(files, info)
+		}
+	}
+	return files
+}
+
+// get はキャッシュしたファイルを読み込み、最近使われたものとして更新日時を変える
+func (c *imageDiskCache) get(name string) ([]byte, bool) {
+	path := filepath.Join(c.dir, name)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return data, true
+}
+
+// put はファイルを書き込み、上限を超えた場合は古いファイルを削除する
+func (c *imageDiskCache) put(name string, data []byte) {
+	// 書き込み途中のファイルを読まないよう一時ファイルから置き換える
+	path := filepath.Join(c.dir, name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		warnf("Caching resized image: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		warnf("Caching resized image: %v", err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size += int64(len(data))
+	if c.max > 0 && c.size > c.max {
+		c.evict()
+	}
+}
+
+// evict は合計サイズが上限の 9 割以下になるまで古いファイルを削除する（削除のたびにディレクトリを読まないよう余裕を持たせる）
+func (c *imageDiskCache) evict() {
+	files := c.files()
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().Before(files[j].ModTime()) })
+	var size int64
+	for _, f := range files {
+		size += f.Size()
+	}
+	removed := 0
+	for _, f := range files {
+		if size <= c.max*9/10 {
+			break
+		}
+		if err := os.Remove(filepath.Join(c.dir, f.Name())); err != nil && !os.IsNotExist(err) {
+			warnf("Removing cached image: %v", err)
+			continue
+		}
+		size -= f.Size()
+		removed++
+	}
+	c.size = size
+	debugf("Removed %d images from %s (IMAGE_RESIZE_CACHE_DIR_BYTES %d)", removed, c.dir, c.max)
+}
@@ -0,0 +1,192 @@
+package spaserver
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestImageResize(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+	os.MkdirAll(filepath.Join(dir, "images"), 0755)
+	img := image.NewRGBA(image.Rect(0, 0, 800, 600))
+	for x := 0; x < 800; x++ {
+		img.Set(x, 0, color.RGBA{R: 255, A: 255})
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	os.WriteFile(filepath.Join(dir, "images", "photo.png"), buf.Bytes(), 0644)
+
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Images.Resize = true
+	cfg.Images.Widths = []string{"400", "1200"}
+	cfg.Images.CacheDir = t.TempDir()
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		name          string
+		url           string
+		expectedCode  int
+		expectedWidth int
+	}{
+		{"縮小する", "/__img?src=/images/photo.png&w=400", http.StatusOK, 400},
+		{"拡大はしない", "/__img?src=/images/photo.png&w=1200", http.StatusOK, 800},
+		{"許可されていない幅", "/__img?src=/images/photo.png&w=300", http.StatusBadRequest, 0},
+		{"画像以外", "/__img?src=/index.html&w=400", http.StatusBadRequest, 0},
+		{"存在しない画像", "/__img?src=/images/none.png&w=400", http.StatusNotFound, 0},
+		{"DIST_DIR の外", "/__img?src=/../photo.png&w=400", http.StatusNotFound, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, httptest.NewRequest("GET", tt.url, nil))
+			if rr.Code != tt.expectedCode {
+				t.Fatalf("期待されるステータスコード %d, 実際のステータスコード %d", tt.expectedCode, rr.Code)
+			}
+			if tt.expectedWidth == 0 {
+				return
+			}
+			config, err := png.DecodeConfig(rr.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Width != tt.expectedWidth || config.Height != tt.expectedWidth*3/4 {
+				t.Errorf("期待されるサイズ %dx%d, 実際のサイズ %dx%d", tt.expectedWidth, tt.expectedWidth*3/4, config.Width, config.Height)
+			}
+		})
+	}
+
+	// ディスクにもキャッシュする
+	entries, _ := os.ReadDir(cfg.Images.CacheDir)
+	if len(entries) != 2 {
+		t.Errorf("期待されるキャッシュファイル数 2, 実際のキャッシュファイル数 %d", len(entries))
+	}
+}
+
+func TestByteCache(t *testing.T) {
+	c := newByteCache(10)
+	c.put("a", []byte("12345"))
+	c.put("b", []byte("12345"))
+	c.get("a")
+	c.put("c", []byte("12345"))
+	if _, ok := c.get("b"); ok {
+		t.Error("最も古い値が削除されていません")
+	}
+	if _, ok := c.get("a"); !ok {
+		t.Error("最近使った値が削除されています")
+	}
+	c.put("d", []byte("12345678901"))
+	if _, ok := c.get("d"); ok {
+		t.Error("上限より大きい値はキャッシュされないべきです")
+	}
+}
+
+func TestImageResizeWidth(t *testing.T) {
+	ir := &imageResizer{cfg: ImagesConfig{MaxWidth: 2048, WidthStep: 100}}
+	tests := []struct {
+		requested int
+		expected  int
+		ok        bool
+	}{
+		{400, 400, true},
+		{401, 500, true},
+		{1, 100, true},
+		{2001, 2048, true},
+		{2049, 0, false},
+		{0, 0, false},
+	}
+	for _, tt := range tests {
+		if width, ok := ir.resizeWidth(tt.requested); width != tt.expected || ok != tt.ok {
+			t.Errorf("%d: 期待される幅 %d (%v), 実際の幅 %d (%v)", tt.requested, tt.expected, tt.ok, width, ok)
+		}
+	}
+
+	// 許可リストがある場合は一致する幅だけ
+	ir.widths = []int{320, 640}
+	if _, ok := ir.resizeWidth(400); ok {
+		t.Error("許可リストにない幅は拒否されるべきです")
+	}
+	if width, ok := ir.resizeWidth(640); !ok || width != 640 {
+		t.Errorf("期待される幅 640, 実際の幅 %d (%v)", width, ok)
+	}
+}
+
+func TestImageResizeConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	img := image.NewRGBA(image.Rect(0, 0, 800, 600))
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	os.WriteFile(filepath.Join(dir, "photo.png"), buf.Bytes(), 0644)
+
+	cacheDir := t.TempDir()
+	ir, err := newImageResizer(ImagesConfig{MaxWidth: 2048, WidthStep: 100, Quality: 85, CacheBytes: 1 << 20, CacheDir: cacheDir}, func() string { return dir }, newServerMetrics())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 同時に届いた同じ画像・幅（切り上げると同じ幅）のリクエストは同じ結果を返す
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rr := httptest.NewRecorder()
+			ir.ServeHTTP(rr, httptest.NewRequest("GET", fmt.Sprintf("/__img?src=/photo.png&w=%d", 391+i), nil))
+			if rr.Code != http.StatusOK {
+				t.Errorf("期待されるステータスコード %d, 実際のステータスコード %d", http.StatusOK, rr.Code)
+			}
+		}(i)
+	}
+	wg.Wait()
+	entries, _ := os.ReadDir(cacheDir)
+	if len(entries) != 1 {
+		t.Errorf("期待されるキャッシュファイル数 1, 実際のキャッシュファイル数 %d", len(entries))
+	}
+}
+
+func TestImageDiskCacheEviction(t *testing.T) {
+	dir := t.TempDir()
+	c, err := newImageDiskCache(dir, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := bytes.Repeat([]byte("x"), 40)
+	c.put("a.png", data)
+	c.put("b.png", data)
+	// a の方が古いが、読み込むと最近使われたものになる
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(dir, "a.png"), old, old)
+	os.Chtimes(filepath.Join(dir, "b.png"), old.Add(time.Minute), old.Add(time.Minute))
+	if _, ok := c.get("a.png"); !ok {
+		t.Fatal("キャッシュしたファイルを読み込めません")
+	}
+
+	c.put("c.png", data)
+	for name, expected := range map[string]bool{"a.png": true, "b.png": false, "c.png": true} {
+		if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) != expected {
+			t.Errorf("%s: 期待される有無 %v, 実際のエラー %v", name, expected, err)
+		}
+	}
+	if c.size != 80 {
+		t.Errorf("期待される合計サイズ 80, 実際の合計サイズ %d", c.size)
+	}
+
+	// 起動時に既存のファイルのサイズを数える
+	if c, _ := newImageDiskCache(dir, 100); c.size != 80 {
+		t.Errorf("期待される合計サイズ 80, 実際の合計サイズ %d", c.size)
+	}
+}
@@ -0,0 +1,76 @@
+package spaserver
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// 画像形式のネゴシエーション
+// photo.jpg へのリクエストで、同じディレクトリに photo.avif や photo.webp があり
+// Accept ヘッダーがその形式を受け付ける場合は IMAGE_FORMATS の順に優先して差し替える
+
+// imageExtensions は差し替えの対象とする画像の拡張子
+var imageExtensions = []string{".jpg", ".jpeg", ".png", ".gif"}
+
+// isConvertibleImage は差し替えの対象となる画像かを判定する
+func isConvertibleImage(urlPath string) bool {
+	ext := strings.ToLower(filepath.Ext(urlPath))
+	for _, e := range imageExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsImage は Accept ヘッダーが画像の形式を明示的に受け付けるかを判定する
+// image/* や */* は対応していないブラウザーも送るため対象外
+func acceptsImage(accept, format string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(name), "image/"+format) {
+			continue
+		}
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil && f <= 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// imageVariant は Accept に応じて配信する画像の URL のパスを返す（差し替えない場合は false）
+func (s *server) imageVariant(r *http.Request, distDir string) (string, bool) {
+	accept := r.Header.Get("Accept")
+	base := strings.TrimSuffix(r.URL.Path, filepath.Ext(r.URL.Path))
+	for _, format := range s.cfg.ImageFormats {
+		if !acceptsImage(accept, format) {
+			continue
+		}
+		urlPath := base + "." + format
+		filePath, ok := resolveStaticPath(distDir, urlPath)
+		if !ok {
+			continue
+		}
+		if info, err := os.Stat(filePath); err == nil && !info.IsDir() {
+			return urlPath, true
+		}
+	}
+	return "", false
+}
+
+// withURLPath は URL のパスを差し替えたリクエストを返す
+func withURLPath(r *http.Request, urlPath string) *http.Request {
+	r2 := new(http.Request)
+	*r2 = *r
+	u := *r.URL
+	u.Path = urlPath
+	u.RawPath = ""
+	r2.URL = &u
+	return r2
+}
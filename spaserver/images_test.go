@@ -0,0 +1,56 @@
+package spaserver
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestImageVariants(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+	os.WriteFile(dir+"/photo.jpg", []byte("jpeg"), 0644)
+	os.WriteFile(dir+"/photo.webp", []byte("webp"), 0644)
+	os.WriteFile(dir+"/photo.avif", []byte("avif"), 0644)
+	os.WriteFile(dir+"/logo.png", []byte("png"), 0644)
+	os.WriteFile(dir+"/logo.webp", []byte("webp"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.ImageFormats = []string{"avif", "webp"}
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		name                string
+		path                string
+		accept              string
+		expected            string
+		expectedContentType string
+	}{
+		{"AVIF を優先する", "/photo.jpg", "image/avif,image/webp,image/apng,*/*;q=0.8", "avif", "image/avif"},
+		{"WebP のみ受け付ける", "/photo.jpg", "image/webp,*/*", "webp", "image/webp"},
+		{"AVIF がなければ WebP", "/logo.png", "image/avif,image/webp", "webp", "image/webp"},
+		{"q=0 は受け付けない", "/photo.jpg", "image/avif;q=0,image/webp;q=0", "jpeg", "image/jpeg"},
+		{"ワイルドカードでは差し替えない", "/photo.jpg", "image/*,*/*", "jpeg", "image/jpeg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set("Accept", tt.accept)
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, req)
+			if rr.Body.String() != tt.expected {
+				t.Errorf("期待されるボディ %s, 実際のボディ %s", tt.expected, rr.Body.String())
+			}
+			if got := rr.Header().Get("Content-Type"); got != tt.expectedContentType {
+				t.Errorf("期待される Content-Type %s, 実際の Content-Type %s", tt.expectedContentType, got)
+			}
+			if got := rr.Header().Get("Vary"); got != "Accept" {
+				t.Errorf("期待される Vary Accept, 実際の Vary %q", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package spaserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// index.html の条件付きリクエスト
+// index.html は毎回再検証させ（Cache-Control: no-cache）、内容から求めた ETag で If-None-Match に 304 を返す。
+// クライアントサイドのルートを再読み込みするたびに index.html 全体を送らずに済む
+
+// indexCacheControl は index.html に付ける Cache-Control
+const indexCacheControl = "no-cache"
+
+// etagCache はファイルの ETag を更新日時とサイズが変わるまでキャッシュする
+type etagCache struct {
+	mu      sync.Mutex
+	entries map[string]etagEntry
+}
+
+type etagEntry struct {
+	modTime time.Time
+	size    int64
+	etag    string
+}
+
+// etag はファイルの内容から求めた ETag を返す（読めない場合は空文字列）
+func (c *etagCache) etag(filePath string) string {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return ""
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[filePath]; ok && e.modTime.Equal(info.ModTime()) && e.size == info.Size() {
+		return e.etag
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return ""
+	}
+	etag := `"` + hex.EncodeToString(h.Sum(nil))[:32] + `"`
+	if c.entries == nil {
+		c.entries = map[string]etagEntry{}
+	}
+	c.entries[filePath] = etagEntry{modTime: info.ModTime(), size: info.Size(), etag: etag}
+	return etag
+}
+
+// setIndexHeaders は index.html のレスポンスに Cache-Control・ETag・プリロードのヘッダーを付ける
+func (s *server) setIndexHeaders(w http.ResponseWriter, r *http.Request, indexPath string) {
+	// 開発モードでは Cache-Control: no-store のまま ETag も付けない
+	if s.live != nil {
+		s.preloadIndex(w, r, indexPath)
+		return
+	}
+	w.Header().Set("Cache-Control", indexCacheControl)
+	if etag := s.indexETags.etag(indexPath); etag != "" {
+		// 最小化すると内容が変わるため区別する
+		if s.minifier != nil {
+			etag = etag[:len(etag)-1] + `-min"`
+		}
+		w.Header().Set("ETag", etag)
+	}
+	s.preloadIndex(w, r, indexPath)
+}
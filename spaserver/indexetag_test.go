@@ -0,0 +1,63 @@
+package spaserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIndexETag(t *testing.T) {
+	dir := t.TempDir()
+	indexPath := filepath.Join(dir, "index.html")
+	os.WriteFile(indexPath, []byte("SPA v1"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	get := func(path, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, req)
+		return rr
+	}
+
+	first := get("/users/1", "")
+	etag := first.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("ETag がありません")
+	}
+	if got := first.Header().Get("Cache-Control"); got != indexCacheControl {
+		t.Errorf("期待される Cache-Control %q, 実際の Cache-Control %q", indexCacheControl, got)
+	}
+	if first.Header().Get("Last-Modified") == "" {
+		t.Error("Last-Modified がありません")
+	}
+
+	// 別のルートでも同じ index.html なので 304 を返す
+	for _, path := range []string{"/settings", "/"} {
+		if rr := get(path, etag); rr.Code != http.StatusNotModified {
+			t.Errorf("%s: 期待されるステータスコード %d, 実際のステータスコード %d", path, http.StatusNotModified, rr.Code)
+		}
+	}
+
+	// 変更後は新しい ETag で全体を返す
+	os.WriteFile(indexPath, []byte("SPA v2"), 0644)
+	os.Chtimes(indexPath, time.Now().Add(time.Second), time.Now().Add(time.Second))
+	rr := get("/users/1", etag)
+	if rr.Code != http.StatusOK || rr.Body.String() != "SPA v2" {
+		t.Errorf("変更後の index.html が返されていません: %d %q", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("ETag") == etag {
+		t.Error("変更後も ETag が同じです")
+	}
+}
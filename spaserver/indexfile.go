@@ -0,0 +1,101 @@
+package spaserver
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// index.html のメモリ上のコピー
+// クライアントサイドのルートへのリクエストごとに index.html を読み直さず、メモリ上のコピーを返す。
+// 変更を検知できる場合は変更の通知で破棄し、それ以外は更新日時とサイズが変わったら読み直す。
+// 同時に届いたリクエストでは1回だけ読み込む
+
+// indexFile は読み込んだ index.html
+type indexFile struct {
+	modTime time.Time
+	size    int64
+	data    []byte
+}
+
+// indexFileCache は配信ディレクトリごとの index.html を保持する
+type indexFileCache struct {
+	// 配信ディレクトリの変更を検知できる（os.Stat で確認しなくてよい）
+	watched bool
+
+	group singleflight.Group
+	mu    sync.RWMutex
+	files map[string]*indexFile
+	// 破棄した回数（読み込み中に破棄された古い内容を保持しないため）
+	generation uint64
+}
+
+func newIndexFileCache(watched bool) *indexFileCache {
+	return &indexFileCache{watched: watched, files: map[string]*indexFile{}}
+}
+
+// load は indexPath の内容を返す
+func (c *indexFileCache) load(indexPath string) (*indexFile, error) {
+	c.mu.RLock()
+	f, ok := c.files[indexPath]
+	generation := c.generation
+	c.mu.RUnlock()
+	if ok && c.watched {
+		return f, nil
+	}
+	if ok {
+		if info, err := os.Stat(indexPath); err == nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+			return f, nil
+		}
+	}
+	v, err, _ := c.group.Do(indexPath, func() (interface{}, error) {
+		file, err := os.Open(indexPath)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if _, err := buf.ReadFrom(file); err != nil {
+			return nil, err
+		}
+		f := &indexFile{modTime: info.ModTime(), size: info.Size(), data: buf.Bytes()}
+		c.mu.Lock()
+		if c.generation == generation {
+			c.files[indexPath] = f
+		}
+		c.mu.Unlock()
+		debugf("Loaded %s into memory (%d bytes)", indexPath, len(f.data))
+		return f, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*indexFile), nil
+}
+
+// clear は読み込んだ index.html を破棄する
+func (c *indexFileCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.files = map[string]*indexFile{}
+	c.generation++
+}
+
+// serve は index.html をメモリ上のコピーから返す（読み込めない場合は何もせず false を返す）
+func (c *indexFileCache) serve(w http.ResponseWriter, r *http.Request, indexPath string) bool {
+	f, err := c.load(indexPath)
+	if err != nil {
+		return false
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	http.ServeContent(w, r, indexPath, f.modTime, bytes.NewReader(f.data))
+	return true
+}
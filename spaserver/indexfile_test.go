@@ -0,0 +1,92 @@
+package spaserver
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIndexFileCache(t *testing.T) {
+	dir := t.TempDir()
+	indexPath := filepath.Join(dir, "index.html")
+	os.WriteFile(indexPath, []byte("v1"), 0644)
+	update := func(content string) {
+		os.WriteFile(indexPath, []byte(content), 0644)
+		later := time.Now().Add(time.Minute)
+		os.Chtimes(indexPath, later, later)
+	}
+
+	t.Run("変更を検知できない場合は更新日時で読み直す", func(t *testing.T) {
+		c := newIndexFileCache(false)
+		if f, err := c.load(indexPath); err != nil || string(f.data) != "v1" {
+			t.Fatalf("読み込めません: %v", err)
+		}
+		update("v2")
+		if f, _ := c.load(indexPath); string(f.data) != "v2" {
+			t.Errorf("期待される内容 %q, 実際の内容 %q", "v2", f.data)
+		}
+	})
+
+	t.Run("変更を検知できる場合は通知まで使い回す", func(t *testing.T) {
+		os.WriteFile(indexPath, []byte("v1"), 0644)
+		c := newIndexFileCache(true)
+		c.load(indexPath)
+		update("v2")
+		if f, _ := c.load(indexPath); string(f.data) != "v1" {
+			t.Errorf("通知までは読み直すべきではありません: %q", f.data)
+		}
+		c.clear()
+		if f, _ := c.load(indexPath); string(f.data) != "v2" {
+			t.Errorf("期待される内容 %q, 実際の内容 %q", "v2", f.data)
+		}
+	})
+
+	t.Run("同時に読み込んでも同じ内容を返す", func(t *testing.T) {
+		c := newIndexFileCache(true)
+		var wg sync.WaitGroup
+		results := make([]*indexFile, 20)
+		for i := range results {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				results[i], _ = c.load(indexPath)
+			}(i)
+		}
+		wg.Wait()
+		first, _ := c.load(indexPath)
+		for _, f := range results {
+			if f == nil || string(f.data) != string(first.data) {
+				t.Fatalf("同じ内容を返すべきです: %v", f)
+			}
+		}
+	})
+}
+
+func TestIndexFileServe(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, path := range []string{"/", "/users/1"} {
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Body.String() != "SPA" {
+			t.Errorf("%s: 期待されるボディ %q, 実際のボディ %q", path, "SPA", rr.Body.String())
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+			t.Errorf("%s: 期待される Content-Type %q, 実際の Content-Type %q", path, "text/html; charset=utf-8", ct)
+		}
+	}
+	if _, ok := s.indexFiles.files[filepath.Join(dir, "index.html")]; !ok {
+		t.Error("index.html がメモリに読み込まれていません")
+	}
+}
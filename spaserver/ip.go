@@ -0,0 +1,92 @@
+package spaserver
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// クライアントIPアドレス
+// 接続元（RemoteAddr）が PROXY_TRUSTED_PROXIES の場合だけ X-Forwarded-For を使い、右から順に信頼しないアドレスを探す。
+// それ以外の接続元の X-Forwarded-For は偽装できるため無視する。リクエストごとに一度だけ求めてコンテキストに入れる
+
+// clientIPKey はクライアントIPアドレスのコンテキストキー
+type clientIPKey struct{}
+
+// withClientIP はクライアントIPアドレスを求めてリクエストのコンテキストに入れる
+func withClientIP(r *http.Request, trusted []*net.IPNet) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), clientIPKey{}, resolveClientIP(r, trusted)))
+}
+
+// getClientIP はクライアントIPアドレスを返す（withClientIP を通っていない場合は接続元のアドレス）
+func getClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return peerIP(r.RemoteAddr)
+}
+
+// peerIP は RemoteAddr からポートを取り除く（IPv6 の [] も取り除く）
+func peerIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+// resolveClientIP は信頼するプロキシを経由した場合は X-Forwarded-For から、それ以外は接続元からクライアントIPを求める
+func resolveClientIP(r *http.Request, trusted []*net.IPNet) string {
+	ip := peerIP(r.RemoteAddr)
+	if !isTrustedProxy(trusted, r.RemoteAddr) {
+		return ip
+	}
+	// 右側ほど近いプロキシが追加したアドレス。信頼するプロキシを飛ばし、最初の信頼しないアドレスをクライアントとする
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !isTrustedProxy(trusted, hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// isAllowedIP は許可リストにクライアントIPが含まれるかを確認する（リストが空なら全て許可）
+func isAllowedIP(allowedIPs []string, clientIP string) bool {
+	if len(allowedIPs) == 0 {
+		return true
+	}
+	for _, allowedIP := range allowedIPs {
+		// 完全一致または前方一致をチェック
+		if allowedIP == clientIP || strings.HasPrefix(clientIP, allowedIP) {
+			return true
+		}
+	}
+	return false
+}
+
+// anonymizeIP は IPv4 の最後のオクテット、IPv6 の下位 80 ビットを 0 にする（IPアドレスでない値はそのまま返す）
+func anonymizeIP(ip string) string {
+	parsed := net.ParseIP(strings.Trim(ip, "[]"))
+	if parsed == nil {
+		return ip
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
+
+// logClientIP はログと統計に記録するクライアントIPアドレスを返す
+func logClientIP(r *http.Request, anonymize bool) string {
+	if anonymize {
+		return anonymizeIP(getClientIP(r))
+	}
+	return getClientIP(r)
+}
@@ -0,0 +1,225 @@
+package spaserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 実行中の IP アドレスの許可・拒否
+// 管理用インターフェースの /__ips で、再起動せずに許可リスト（ALLOW_REMOTE_IPS に追加）と拒否リストを変更する（ADMIN_TOKEN が必要）。
+// IP_RULES_FILE を設定した場合は変更のたびに保存し、起動時に読み込む。
+// リストはサーバーの状態（serverState）に持ち、設定を読み込み直しても消えない
+
+const ipRulesPath = "/__ips"
+
+// ipRule は管理 API で追加した IP アドレス（完全一致）または CIDR
+type ipRule struct {
+	IP    string    `json:"ip"`
+	Added time.Time `json:"added"`
+}
+
+// ipRuleSet は保存・出力する許可リストと拒否リスト
+type ipRuleSet struct {
+	Allow []ipRule `json:"allow"`
+	Deny  []ipRule `json:"deny"`
+}
+
+// ipRuleList は実行中に変更できる許可リストと拒否リスト
+type ipRuleList struct {
+	mu    sync.RWMutex
+	rules ipRuleSet
+	// 読み込んだ IP_RULES_FILE（再読み込みのたびに読み直さない）
+	file   string
+	loaded bool
+}
+
+// load は保存したファイルからリストを読み込む（同じファイルは一度だけ）
+func (l *ipRuleList) load(file string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if file == "" || (l.loaded && l.file == file) {
+		l.file = file
+		return nil
+	}
+	var rules ipRuleSet
+	data, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &rules); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		for _, rule := range append(rules.Allow, rules.Deny...) {
+			if _, err := parseIPRule(rule.IP); err != nil {
+				return fmt.Errorf("%s: %w", file, err)
+			}
+		}
+		infof("Loaded %d allowed and %d denied IPs from %s", len(rules.Allow), len(rules.Deny), file)
+	}
+	l.rules = rules
+	l.file = file
+	l.loaded = true
+	return nil
+}
+
+// save はリストを IP_RULES_FILE に保存する（書き込み途中のファイルを読まないよう一時ファイルから置き換える）
+func (l *ipRuleList) save() error {
+	if l.file == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(l.rules, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := l.file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.file)
+}
+
+// list は現在のリストのコピーを返す
+func (l *ipRuleList) list() ipRuleSet {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return ipRuleSet{
+		Allow: append([]ipRule{}, l.rules.Allow...),
+		Deny:  append([]ipRule{}, l.rules.Deny...),
+	}
+}
+
+// entries は種類（allow または deny）に対応するリストを返す
+func (l *ipRuleList) entries(kind string) *[]ipRule {
+	if kind == "allow" {
+		return &l.rules.Allow
+	}
+	return &l.rules.Deny
+}
+
+// add はリストに追加する（既にある場合は false）
+func (l *ipRuleList) add(kind, ip string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entries := l.entries(kind)
+	for _, rule := range *entries {
+		if rule.IP == ip {
+			return false, nil
+		}
+	}
+	*entries = append(*entries, ipRule{IP: ip, Added: time.Now()})
+	return true, l.save()
+}
+
+// remove はリストから取り除く（ない場合は false）
+func (l *ipRuleList) remove(kind, ip string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entries := l.entries(kind)
+	for i, rule := range *entries {
+		if rule.IP == ip {
+			*entries = append((*entries)[:i:i], (*entries)[i+1:]...)
+			return true, l.save()
+		}
+	}
+	return false, nil
+}
+
+// denied はクライアントIPが拒否リストに含まれるかを確認する
+func (l *ipRuleList) denied(clientIP string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return matchIPRule(l.rules.Deny, clientIP)
+}
+
+// allowed は ALLOW_REMOTE_IPS と許可リストのどちらかにクライアントIPが含まれるかを確認する（両方空なら全て許可）
+func (l *ipRuleList) allowed(allowedIPs []string, clientIP string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if len(allowedIPs) == 0 && len(l.rules.Allow) == 0 {
+		return true
+	}
+	return (len(allowedIPs) > 0 && isAllowedIP(allowedIPs, clientIP)) || matchIPRule(l.rules.Allow, clientIP)
+}
+
+// parseIPRule は IP アドレスまたは CIDR を解析する（IP アドレスはそのアドレスだけに一致する）
+func parseIPRule(rule string) (*net.IPNet, error) {
+	nets, err := parseTrustedProxies([]string{rule})
+	if err != nil {
+		return nil, err
+	}
+	return nets[0], nil
+}
+
+func matchIPRule(rules []ipRule, clientIP string) bool {
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	for _, rule := range rules {
+		if n, err := parseIPRule(rule.IP); err == nil && n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// serveIPRules は GET でリストを返し、/__ips/allow と /__ips/deny への POST（追加）と DELETE（削除）で変更する
+func (s *server) serveIPRules(w http.ResponseWriter, r *http.Request) {
+	ipRules := s.state.ipRules
+	if r.URL.Path == ipRulesPath {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeJSON(w, http.StatusOK, ipRules.list())
+		return
+	}
+
+	kind := strings.TrimPrefix(r.URL.Path, ipRulesPath+"/")
+	if kind != "allow" && kind != "deny" {
+		http.NotFound(w, r)
+		return
+	}
+	ip := r.URL.Query().Get("ip")
+	if _, err := parseIPRule(ip); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("ip: %q is not an IP address or CIDR", ip)})
+		return
+	}
+
+	var changed bool
+	var err error
+	switch r.Method {
+	case http.MethodPost:
+		changed, err = ipRules.add(kind, ip)
+	case http.MethodDelete:
+		changed, err = ipRules.remove(kind, ip)
+		if err == nil && !changed {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("%s is not in the %s list", ip, kind)})
+			return
+		}
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		// メモリ上のリストは変更済み（次の変更時に保存を再試行する）
+		errorf("Saving IP rules: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "changed in memory but could not be saved: " + err.Error()})
+		return
+	}
+	if changed {
+		if r.Method == http.MethodPost {
+			infof("Admin API: added %s to the %s list", ip, kind)
+		} else {
+			infof("Admin API: removed %s from the %s list", ip, kind)
+		}
+	}
+	writeJSON(w, http.StatusOK, ipRules.list())
+}
@@ -0,0 +1,198 @@
+package spaserver
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIPRules(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+	rulesFile := filepath.Join(t.TempDir(), "ip-rules.json")
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.IPRulesFile = rulesFile
+	cfg.Admin.Token = "secret"
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := func(ip string, forwardedFor ...string) int {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = net.JoinHostPort(ip, "1234")
+		for _, v := range forwardedFor {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, r)
+		return rr.Code
+	}
+	admin := func(method, path string) int {
+		r := httptest.NewRequest(method, path, nil)
+		r.Header.Set("Authorization", "Bearer secret")
+		rr := httptest.NewRecorder()
+		s.admin.ServeHTTP(rr, r)
+		return rr.Code
+	}
+
+	if code := admin("POST", "/__ips/deny?ip=203.0.113.0/24"); code != http.StatusOK {
+		t.Fatalf("期待されるステータスコード %d, 実際のステータスコード %d", http.StatusOK, code)
+	}
+	admin("POST", "/__ips/deny?ip=198.51.100.1")
+	for _, tc := range []struct {
+		name         string
+		ip           string
+		forwardedFor string
+		expected     int
+	}{
+		{"CIDR に含まれるIP", "203.0.113.9", "", http.StatusForbidden},
+		{"拒否したIP", "198.51.100.1", "", http.StatusForbidden},
+		{"拒否したIPで始まる別のIP", "198.51.100.10", "", http.StatusOK},
+		{"X-Forwarded-For を偽装した拒否したIP", "198.51.100.1", "192.0.2.99", http.StatusForbidden},
+		{"信頼するプロキシ経由の拒否したIP", "10.0.0.5", "198.51.100.1", http.StatusForbidden},
+		{"IPv6 のIP", "2001:db8::1", "", http.StatusOK},
+	} {
+		var forwardedFor []string
+		if tc.forwardedFor != "" {
+			forwardedFor = append(forwardedFor, tc.forwardedFor)
+		}
+		if code := status(tc.ip, forwardedFor...); code != tc.expected {
+			t.Errorf("%s: 期待されるステータスコード %d, 実際のステータスコード %d", tc.name, tc.expected, code)
+		}
+	}
+
+	// 許可リストに追加すると、それ以外のIPは拒否する
+	admin("POST", "/__ips/allow?ip=192.0.2.1")
+	if code := status("198.51.100.2"); code != http.StatusForbidden {
+		t.Errorf("許可リストにないIP: 期待されるステータスコード %d, 実際のステータスコード %d", http.StatusForbidden, code)
+	}
+	if code := status("192.0.2.1"); code != http.StatusOK {
+		t.Errorf("許可リストのIP: 期待されるステータスコード %d, 実際のステータスコード %d", http.StatusOK, code)
+	}
+
+	for _, tc := range []struct {
+		method, path string
+		expected     int
+	}{
+		{"POST", "/__ips/deny?ip=10.0.0.", http.StatusBadRequest},
+		{"POST", "/__ips/deny?ip=10.0.0.0/33", http.StatusBadRequest},
+		{"POST", "/__ips/deny", http.StatusBadRequest},
+		{"POST", "/__ips/other?ip=10.0.0.1", http.StatusNotFound},
+		{"DELETE", "/__ips/allow?ip=10.0.0.1", http.StatusNotFound},
+		{"PUT", "/__ips/allow?ip=10.0.0.1", http.StatusMethodNotAllowed},
+		{"POST", "/__ips", http.StatusMethodNotAllowed},
+	} {
+		if code := admin(tc.method, tc.path); code != tc.expected {
+			t.Errorf("%s %s: 期待されるステータスコード %d, 実際のステータスコード %d", tc.method, tc.path, tc.expected, code)
+		}
+	}
+
+	// 再起動後もファイルから読み込む
+	s.Close()
+	s, err = newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	r := httptest.NewRequest("GET", "/__ips", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	rr := httptest.NewRecorder()
+	s.admin.ServeHTTP(rr, r)
+	var got ipRuleSet
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Allow) != 1 || got.Allow[0].IP != "192.0.2.1" || len(got.Deny) != 2 || got.Deny[0].IP != "203.0.113.0/24" {
+		t.Errorf("保存したリストが読み込まれていません: %+v", got)
+	}
+
+	if code := admin("DELETE", "/__ips/allow?ip=192.0.2.1"); code != http.StatusOK {
+		t.Fatalf("期待されるステータスコード %d, 実際のステータスコード %d", http.StatusOK, code)
+	}
+	if code := status("198.51.100.2"); code != http.StatusOK {
+		t.Errorf("許可リストを空にした後: 期待されるステータスコード %d, 実際のステータスコード %d", http.StatusOK, code)
+	}
+}
+
+func TestIPRulesFileInvalid(t *testing.T) {
+	rulesFile := filepath.Join(t.TempDir(), "ip-rules.json")
+	os.WriteFile(rulesFile, []byte(`{"deny":[{"ip":"10.0.0."}]}`), 0600)
+	if err := (&ipRuleList{}).load(rulesFile); err == nil {
+		t.Error("不正な IP アドレスを含むファイルはエラーにするべきです")
+	}
+}
+
+func TestIPRulesWithoutAdminToken(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.DistDir = t.TempDir()
+	cfg.Admin.Token = ""
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// ADMIN_TOKEN がない場合は参照だけできる
+	for _, tc := range []struct {
+		method, path string
+		expected     int
+	}{
+		{"GET", "/__ips", http.StatusOK},
+		{"POST", "/__ips/deny?ip=203.0.113.7", http.StatusForbidden},
+		{"DELETE", "/__ips/deny?ip=203.0.113.7", http.StatusForbidden},
+	} {
+		rr := httptest.NewRecorder()
+		s.admin.ServeHTTP(rr, httptest.NewRequest(tc.method, tc.path, nil))
+		if rr.Code != tc.expected {
+			t.Errorf("%s %s: 期待されるステータスコード %d, 実際のステータスコード %d", tc.method, tc.path, tc.expected, rr.Code)
+		}
+	}
+	if rules := s.state.ipRules.list(); len(rules.Deny) != 0 {
+		t.Errorf("拒否リストが変更されています: %+v", rules.Deny)
+	}
+}
+
+func TestIPRulesPerHandler(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+	rulesDir := t.TempDir()
+	os.WriteFile(filepath.Join(rulesDir, "a.json"), []byte(`{"deny":[{"ip":"203.0.113.1"}]}`), 0600)
+	os.WriteFile(filepath.Join(rulesDir, "b.json"), []byte(`{"deny":[{"ip":"198.51.100.1"}]}`), 0600)
+
+	// 同じプロセスで IP_RULES_FILE の異なるハンドラーを作成しても、拒否リストは混ざらない
+	handlers := map[string]Handler{}
+	for _, name := range []string{"a", "b"} {
+		cfg := testConfig(t)
+		cfg.DistDir = dir
+		cfg.IPRulesFile = filepath.Join(rulesDir, name+".json")
+		h, err := New(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer h.Close()
+		handlers[name] = h
+	}
+	for _, tc := range []struct {
+		handler, ip string
+		expected    int
+	}{
+		{"a", "203.0.113.1", http.StatusForbidden},
+		{"a", "198.51.100.1", http.StatusOK},
+		{"b", "203.0.113.1", http.StatusOK},
+		{"b", "198.51.100.1", http.StatusForbidden},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = net.JoinHostPort(tc.ip, "1234")
+		rr := httptest.NewRecorder()
+		handlers[tc.handler].ServeHTTP(rr, r)
+		if rr.Code != tc.expected {
+			t.Errorf("ハンドラー %s の %s: 期待されるステータスコード %d, 実際のステータスコード %d", tc.handler, tc.ip, tc.expected, rr.Code)
+		}
+	}
+}
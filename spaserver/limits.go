@@ -0,0 +1,63 @@
+package spaserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// bodyLimit はプロキシパスのパターンごとのリクエストボディの上限
+type bodyLimit struct {
+	pattern string
+	limit   int64
+}
+
+// parseBodyLimits は "パターン=バイト数" の一覧を解析する
+func parseBodyLimits(entries []string) ([]bodyLimit, error) {
+	var limits []bodyLimit
+	for _, entry := range entries {
+		pattern, value, ok := strings.Cut(entry, "=")
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("invalid entry %q (use path=bytes)", entry)
+		}
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid size in %q", entry)
+		}
+		limits = append(limits, bodyLimit{pattern: pattern, limit: limit})
+	}
+	return limits, nil
+}
+
+// bodyLimitFor はパスに適用するリクエストボディの上限を返す（0 は無制限）
+func (s *server) bodyLimitFor(path string) int64 {
+	for _, l := range s.bodyLimits {
+		if matchProxyPath([]string{l.pattern}, path) {
+			return l.limit
+		}
+	}
+	return int64(s.cfg.Limits.MaxBodyBytes)
+}
+
+// limitBody はリクエストボディの上限を設定する
+// Content-Length が上限を超えている場合は 413 を返して false を返す
+func limitBody(w http.ResponseWriter, r *http.Request, limit int64) bool {
+	if limit <= 0 {
+		return true
+	}
+	if r.ContentLength > limit {
+		debugf("Request body too large: %s %s (%d bytes)", r.Method, r.URL.Path, r.ContentLength)
+		http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+		return false
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	return true
+}
+
+// isBodyTooLarge はリクエストボディの読み込みが上限で打ち切られたかを判定する
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
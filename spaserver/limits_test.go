@@ -0,0 +1,77 @@
+package spaserver
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRequestBodyLimits(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return
+		}
+		w.Write(body)
+	}))
+	defer backend.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Proxy.URL = backend.URL
+	cfg.Proxy.Paths = []string{"/api", "/upload"}
+	cfg.Proxy.MaxBodyBytes = []string{"/upload=100"}
+	cfg.Limits.MaxBodyBytes = 10
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		size     int
+		chunked  bool
+		expected int
+	}{
+		{"上限以下", "/api/items", 10, false, http.StatusOK},
+		{"全体の上限を超える", "/api/items", 11, false, http.StatusRequestEntityTooLarge},
+		{"パスごとの上限以下", "/upload/file", 100, false, http.StatusOK},
+		{"パスごとの上限を超える", "/upload/file", 101, false, http.StatusRequestEntityTooLarge},
+		{"Content-Length なしで上限を超える", "/upload/file", 200, true, http.StatusRequestEntityTooLarge},
+		{"静的ファイルにも全体の上限を適用", "/index.html", 11, false, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(strings.Repeat("x", tt.size)))
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, req)
+			if rr.Code != tt.expected {
+				t.Errorf("期待されるステータスコード %d, 実際のステータスコード %d", tt.expected, rr.Code)
+			}
+		})
+	}
+}
+
+func TestParseBodyLimits(t *testing.T) {
+	limits, err := parseBodyLimits([]string{"/upload=1048576", "/api/*/files=0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(limits) != 2 || limits[0].limit != 1048576 || limits[1].pattern != "/api/*/files" {
+		t.Errorf("解析結果が正しくありません: %+v", limits)
+	}
+	for _, entry := range []string{"/upload", "=10", "/upload=-1", "/upload=10MB"} {
+		if _, err := parseBodyLimits([]string{entry}); err == nil {
+			t.Errorf("%q はエラーになるべきです", entry)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package spaserver
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// inheritFDsEnv は親プロセスから引き継いだリスナーの名前（ファイルディスクリプタ 3 から順に並ぶ）
+const inheritFDsEnv = "SPA_INHERIT_FDS"
+
+// listeners は開いたリスナーと起動した HTTP サーバーの一覧
+type listeners struct {
+	// unix ドメインソケットのパーミッション
+	SocketMode os.FileMode
+	// リクエストヘッダーの上限（0 の場合は net/http のデフォルト）
+	MaxHeaderBytes int
+	// キープアライブの接続を閉じるまでのアイドル時間（0 の場合は閉じない）
+	IdleTimeout time.Duration
+
+	mu        sync.Mutex
+	inherited map[string]net.Listener // 親プロセスから引き継いだリスナー（未使用のもの）
+	activated map[string]net.Listener // systemd のソケットアクティベーションで渡されたリスナー（未使用のもの）
+	upgraded  bool                    // アップグレードで親プロセスから起動された
+	opened    []namedListener
+	servers   []*http.Server
+}
+
+type namedListener struct {
+	name string
+	ln   net.Listener
+}
+
+// newListeners は親プロセスから引き継いだリスナーや systemd から渡されたリスナーがあれば読み込む
+func newListeners() (*listeners, error) {
+	l := &listeners{}
+	activated, err := systemdListeners()
+	if err != nil {
+		return nil, fmt.Errorf("socket activation: %w", err)
+	}
+	l.activated = activated
+	if names := os.Getenv(inheritFDsEnv); names != "" {
+		os.Unsetenv(inheritFDsEnv)
+		inherited, err := listenersFromFDs(strings.Split(names, ","), 3)
+		if err != nil {
+			return nil, fmt.Errorf("inheriting listeners: %w", err)
+		}
+		l.inherited = inherited
+		l.upgraded = true
+	}
+	return l, nil
+}
+
+// systemdListeners は systemd のソケットアクティベーション（LISTEN_FDS）で渡されたリスナーを読み込む
+// FileDescriptorName= が public・tls・admin・metrics（public-2 のような番号付きも可）のものはその名前、それ以外は先頭から public として扱う
+func systemdListeners() (map[string]net.Listener, error) {
+	pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	count, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	fdNames := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if pid != os.Getpid() || count <= 0 {
+		return nil, nil
+	}
+
+	names, err := systemdListenerNames(count, fdNames)
+	if err != nil {
+		return nil, err
+	}
+	return listenersFromFDs(names, 3)
+}
+
+// systemdListenerNames は LISTEN_FDNAMES からリスナーの名前を決める
+func systemdListenerNames(count int, fdNames []string) ([]string, error) {
+	names := make([]string, count)
+	used := map[string]bool{}
+	for i := range names {
+		if i < len(fdNames) && isListenerName(fdNames[i]) && !used[fdNames[i]] {
+			names[i] = fdNames[i]
+			used[fdNames[i]] = true
+		}
+	}
+	for i := range names {
+		if names[i] == "" && !used["public"] {
+			names[i] = "public"
+			used["public"] = true
+		} else if names[i] == "" {
+			return nil, fmt.Errorf("unexpected socket %d (set FileDescriptorName= to public, tls, admin or metrics)", i)
+		}
+	}
+	return names, nil
+}
+
+func isListenerName(name string) bool {
+	if kind, n, ok := strings.Cut(name, "-"); ok {
+		if i, err := strconv.Atoi(n); err != nil || i < 2 {
+			return false
+		}
+		name = kind
+	}
+	return name == "public" || name == "tls" || name == "admin" || name == "metrics"
+}
+
+// listenersFromFDs は firstFD から順に names のリスナーとして読み込む
+func listenersFromFDs(names []string, firstFD int) (map[string]net.Listener, error) {
+	result := map[string]net.Listener{}
+	for i, name := range names {
+		f := os.NewFile(uintptr(firstFD+i), name)
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, ln := range result {
+				ln.Close()
+			}
+			return nil, fmt.Errorf("%s (fd %d): %w", name, firstFD+i, err)
+		}
+		result[name] = ln
+	}
+	return result, nil
+}
+
+// Listen は name のリスナーを開く
+// 同じアドレスのリスナーを親プロセスから引き継いでいる場合はそれを使う
+func (l *listeners) Listen(name, addr string) (net.Listener, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// systemd から渡されたソケットはアドレスの設定より優先する
+	if ln, ok := l.activated[name]; ok {
+		delete(l.activated, name)
+		infof("Using socket from systemd for %s listener (%s)", name, ln.Addr())
+		l.opened = append(l.opened, namedListener{name: name, ln: ln})
+		return ln, nil
+	}
+
+	ln, ok := l.inherited[name]
+	if ok {
+		delete(l.inherited, name)
+		if addrMatches(ln.Addr(), addr) {
+			debugf("Using inherited listener %s on %s", name, ln.Addr())
+		} else {
+			ln.Close()
+			ok = false
+		}
+	}
+	if !ok {
+		var err error
+		if ln, err = l.listen(addr); err != nil {
+			return nil, err
+		}
+	}
+	l.opened = append(l.opened, namedListener{name: name, ln: ln})
+	return ln, nil
+}
+
+// listen は addr（host:port または unix:/path）で待ち受ける
+func (l *listeners) listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	// 前回の起動で残ったソケットファイルを削除する
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if l.SocketMode != 0 {
+		if err := os.Chmod(path, l.SocketMode); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+	return ln, nil
+}
+
+// Upgraded はアップグレードで親プロセスからリスナーを引き継いで起動されたかを返す
+func (l *listeners) Upgraded() bool {
+	return l.upgraded
+}
+
+// Activated は name のソケットが systemd から渡されているかを返す
+func (l *listeners) Activated(name string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.activated[name]
+	return ok
+}
+
+// Ready はリスナーの準備が終わったことを示す
+// 使われなかった引き継ぎリスナーを閉じ、アップグレード中であれば親プロセスに終了を指示する
+func (l *listeners) Ready() {
+	l.mu.Lock()
+	for _, ln := range l.inherited {
+		ln.Close()
+	}
+	for name, ln := range l.activated {
+		warnf("Socket from systemd for %s listener is not used", name)
+		ln.Close()
+	}
+	l.inherited = nil
+	l.activated = nil
+	l.mu.Unlock()
+	notifyUpgradeParent()
+}
+
+// Serve は ln で HTTP サーバーを開始する（終了するまでブロックする）
+// Shutdown による終了の場合は nil を返す
+func (l *listeners) Serve(ln net.Listener, handler http.Handler) error {
+	return l.serve(&http.Server{Handler: handler}, ln)
+}
+
+// ServeTLS は ln で HTTPS サーバーを開始する（終了するまでブロックする）
+func (l *listeners) ServeTLS(ln net.Listener, handler http.Handler, config *tls.Config) error {
+	return l.serve(&http.Server{Handler: handler, TLSConfig: config}, ln)
+}
+
+func (l *listeners) serve(srv *http.Server, ln net.Listener) error {
+	srv.MaxHeaderBytes = l.MaxHeaderBytes
+	srv.IdleTimeout = l.IdleTimeout
+	l.mu.Lock()
+	l.servers = append(l.servers, srv)
+	l.mu.Unlock()
+
+	var err error
+	if srv.TLSConfig != nil {
+		err = srv.ServeTLS(ln, "", "")
+	} else {
+		err = srv.Serve(ln)
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// listenerName は同じ種類の i 番目のリスナーの名前を返す（public, public-2, ...）
+func listenerName(kind string, i int) string {
+	if i == 0 {
+		return kind
+	}
+	return kind + "-" + strconv.Itoa(i+1)
+}
+
+// addrMatches はリスナーのアドレスが設定のアドレスと一致するかを判定する
+func addrMatches(a net.Addr, addr string) bool {
+	if unix, ok := a.(*net.UnixAddr); ok {
+		path, ok := strings.CutPrefix(addr, "unix:")
+		return ok && unix.Name == path
+	}
+	tcp, ok := a.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	want, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil || want.Port != tcp.Port {
+		return false
+	}
+	if want.IP == nil || want.IP.IsUnspecified() {
+		return tcp.IP.IsUnspecified()
+	}
+	return want.IP.Equal(tcp.IP)
+}
+
+// parseFileMode は 8 進数のパーミッション（0660 など）を解析する
+func parseFileMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid permissions %q", s)
+	}
+	return os.FileMode(mode), nil
+}
@@ -0,0 +1,142 @@
+package spaserver
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestListenInherited(t *testing.T) {
+	parent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer parent.Close()
+	f, err := parent.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inherited, err := listenersFromFDs([]string{"public"}, int(f.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &listeners{inherited: inherited}
+
+	// 同じアドレスのリスナーは引き継いだものを使う
+	ln, err := l.Listen("public", parent.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if ln.Addr().String() != parent.Addr().String() {
+		t.Errorf("引き継いだリスナーが使われていません: %s", ln.Addr())
+	}
+	l.Ready()
+}
+
+func TestAddrMatches(t *testing.T) {
+	tests := []struct {
+		listen   string
+		addr     string
+		expected bool
+	}{
+		{"127.0.0.1:8080", "127.0.0.1:8080", true},
+		{"127.0.0.1:8080", "127.0.0.1:8081", false},
+		{"127.0.0.1:8080", ":8080", false},
+		{"0.0.0.0:8080", ":8080", true},
+		{"0.0.0.0:8080", "127.0.0.1:8080", false},
+	}
+	for _, tt := range tests {
+		a, err := net.ResolveTCPAddr("tcp", tt.listen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := addrMatches(a, tt.addr); got != tt.expected {
+			t.Errorf("addrMatches(%s, %q) = %v, 期待値 %v", tt.listen, tt.addr, got, tt.expected)
+		}
+	}
+}
+
+func TestSystemdListenerNames(t *testing.T) {
+	tests := []struct {
+		count    int
+		fdNames  string
+		expected []string
+		err      bool
+	}{
+		{1, "spa-server.socket", []string{"public"}, false},
+		{2, "admin:spa-server.socket", []string{"admin", "public"}, false},
+		{3, "public:admin:metrics", []string{"public", "admin", "metrics"}, false},
+		{2, "", []string{"public", ""}, true},
+	}
+	for _, tt := range tests {
+		names, err := systemdListenerNames(tt.count, strings.Split(tt.fdNames, ":"))
+		if tt.err {
+			if err == nil {
+				t.Errorf("LISTEN_FDNAMES=%q: エラーになるべきです", tt.fdNames)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("LISTEN_FDNAMES=%q: %v", tt.fdNames, err)
+			continue
+		}
+		if strings.Join(names, ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("LISTEN_FDNAMES=%q: 期待値 %v, 実際の値 %v", tt.fdNames, tt.expected, names)
+		}
+	}
+}
+
+func TestListenUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spa.sock")
+	// 前回の起動で残ったソケットファイル
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	l := &listeners{SocketMode: 0600}
+	ln, err := l.Listen("public", "unix:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go l.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer l.Shutdown(context.Background())
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("期待されるパーミッション 0600, 実際のパーミッション %o", info.Mode().Perm())
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get("http://unix/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "ok" {
+		t.Errorf("期待されるボディ ok, 実際のボディ %s", body)
+	}
+
+	if !addrMatches(ln.Addr(), "unix:"+path) {
+		t.Error("同じソケットのアドレスが一致しません")
+	}
+}
@@ -0,0 +1,192 @@
+package spaserver
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// liveReloadPath はライブリロード用の WebSocket のパス
+const liveReloadPath = "/__livereload"
+
+// liveReloadScript は配信する HTML に挿入するクライアント
+// 変更の通知を受け取るか、切断後に再接続できた時点（サーバーの再起動）でページを再読み込みする
+const liveReloadScript = `<script>(function(){var u=(location.protocol==="https:"?"wss://":"ws://")+location.host+"` + liveReloadPath + `",r=false;` +
+	`function c(){var ws=new WebSocket(u);ws.onopen=function(){if(r)location.reload()};ws.onmessage=function(){location.reload()};` +
+	`ws.onclose=function(){r=true;setTimeout(c,1000)}}c()})();</script>`
+
+// websocketGUID は Sec-WebSocket-Accept の計算に使う固定値（RFC 6455）
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// liveReload は接続中のブラウザーに配信ファイルの変更を通知する
+type liveReload struct {
+	mu      sync.Mutex
+	clients map[chan struct{}]bool
+	closed  chan struct{}
+}
+
+func newLiveReload() *liveReload {
+	return &liveReload{clients: map[chan struct{}]bool{}, closed: make(chan struct{})}
+}
+
+// Reload は接続中のブラウザーに再読み込みを指示する
+func (lr *liveReload) Reload() {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	if len(lr.clients) > 0 {
+		infof("Reloading %d browser(s)", len(lr.clients))
+	}
+	for ch := range lr.clients {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Close は接続中のブラウザーとの接続を閉じる
+func (lr *liveReload) Close() {
+	close(lr.closed)
+}
+
+// ServeHTTP は WebSocket 接続を受け付け、変更があれば reload を送信する
+func (lr *liveReload) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || key == "" {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		errorf("Live reload: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		return
+	}
+
+	ch := make(chan struct{}, 1)
+	lr.mu.Lock()
+	lr.clients[ch] = true
+	lr.mu.Unlock()
+	defer func() {
+		lr.mu.Lock()
+		delete(lr.clients, ch)
+		lr.mu.Unlock()
+	}()
+
+	// ブラウザーが切断するまでフレームを読み捨てる
+	disconnected := make(chan struct{})
+	go func() {
+		readWebsocketUntilClose(rw.Reader)
+		close(disconnected)
+	}()
+
+	select {
+	case <-ch:
+		writeWebsocketFrame(rw.Writer, 0x1, []byte("reload"))
+	case <-disconnected:
+	case <-lr.closed:
+	}
+	writeWebsocketFrame(rw.Writer, 0x8, nil)
+}
+
+// readWebsocketUntilClose はクローズフレームを受け取るか接続が切れるまでフレームを読む
+func readWebsocketUntilClose(r *bufio.Reader) {
+	for {
+		var header [2]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return
+		}
+		opcode := header[0] & 0x0f
+		length := uint64(header[1] & 0x7f)
+		switch length {
+		case 126:
+			var ext [2]byte
+			if _, err := io.ReadFull(r, ext[:]); err != nil {
+				return
+			}
+			length = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := io.ReadFull(r, ext[:]); err != nil {
+				return
+			}
+			length = binary.BigEndian.Uint64(ext[:])
+		}
+		if header[1]&0x80 != 0 {
+			length += 4 // マスクキー
+		}
+		if _, err := io.CopyN(io.Discard, r, int64(length)); err != nil || opcode == 0x8 {
+			return
+		}
+	}
+}
+
+// writeWebsocketFrame はサーバーからのフレーム（マスクなし、125 バイト以下）を送信する
+func writeWebsocketFrame(w *bufio.Writer, opcode byte, payload []byte) error {
+	w.WriteByte(0x80 | opcode)
+	w.WriteByte(byte(len(payload)))
+	w.Write(payload)
+	return w.Flush()
+}
+
+// scriptInjector は HTML のレスポンスにライブリロードのクライアントを挿入する ResponseWriter
+type scriptInjector struct {
+	http.ResponseWriter
+	html        bool
+	wroteHeader bool
+	buf         bytes.Buffer
+}
+
+func (si *scriptInjector) WriteHeader(status int) {
+	if status < 200 {
+		si.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if si.wroteHeader {
+		return
+	}
+	si.wroteHeader = true
+	if status == http.StatusOK && strings.HasPrefix(si.Header().Get("Content-Type"), "text/html") {
+		si.html = true
+		si.Header().Del("Content-Length")
+	}
+	si.ResponseWriter.WriteHeader(status)
+}
+
+func (si *scriptInjector) Write(b []byte) (int, error) {
+	if !si.wroteHeader {
+		si.WriteHeader(http.StatusOK)
+	}
+	if si.html {
+		return si.buf.Write(b)
+	}
+	return si.ResponseWriter.Write(b)
+}
+
+// finish はバッファーした HTML に </body> の直前（ない場合は末尾）でクライアントを挿入して送信する
+func (si *scriptInjector) finish() {
+	if !si.html {
+		return
+	}
+	html := si.buf.Bytes()
+	i := bytes.LastIndex(bytes.ToLower(html), []byte("</body>"))
+	if i < 0 {
+		i = len(html)
+	}
+	si.ResponseWriter.Write(html[:i])
+	io.WriteString(si.ResponseWriter, liveReloadScript)
+	si.ResponseWriter.Write(html[i:])
+}
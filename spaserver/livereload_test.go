@@ -0,0 +1,94 @@
+package spaserver
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newDevServer(t *testing.T) (*server, string) {
+	t.Helper()
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html><body><div id=app></div></body></html>"), 0644)
+	os.WriteFile(filepath.Join(dir, "app.js"), []byte("console.log(1)"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Dev.Enabled = true
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, dir
+}
+
+func TestLiveReloadInjection(t *testing.T) {
+	s, _ := newDevServer(t)
+
+	for _, path := range []string{"/", "/some/route"} {
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		body := rr.Body.String()
+		if !strings.Contains(body, liveReloadScript+"</body>") {
+			t.Errorf("%s: </body> の直前にクライアントが挿入されていません: %s", path, body)
+		}
+		if rr.Header().Get("Content-Length") != "" {
+			t.Errorf("%s: 挿入前の Content-Length が残っています", path)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest("GET", "/app.js", nil))
+	if rr.Body.String() != "console.log(1)" {
+		t.Errorf("HTML 以外は変更されるべきではありません: %s", rr.Body.String())
+	}
+	if rr.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("開発モードではキャッシュさせるべきではありません: %s", rr.Header().Get("Cache-Control"))
+	}
+}
+
+func TestLiveReloadNotifiesOnChange(t *testing.T) {
+	s, dir := newDevServer(t)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(ts.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "GET "+liveReloadPath+" HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("期待されるステータスコード 101, 実際のステータスコード %d", resp.StatusCode)
+	}
+	// RFC 6455 の例の値
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Sec-WebSocket-Accept が正しくありません: %s", accept)
+	}
+
+	// 接続の登録を待ってからファイルを変更する
+	time.Sleep(100 * time.Millisecond)
+	os.WriteFile(filepath.Join(dir, "app.js"), []byte("console.log(2)"), 0644)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	frame := make([]byte, 8)
+	if _, err := io.ReadFull(br, frame); err != nil {
+		t.Fatalf("reload が通知されません: %v", err)
+	}
+	if frame[0] != 0x81 || string(frame[2:]) != "reload" {
+		t.Errorf("reload のテキストフレームではありません: %q", frame)
+	}
+}
@@ -0,0 +1,161 @@
+package spaserver
+
+import (
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// ログファイルはプロセス全体で共有し、設定の再読み込み時も同じファイルに同じ Logger で書き込む
+var (
+	logFilesMu sync.Mutex
+	logFiles   = map[string]*rotatingFile{}
+)
+
+// rotatingFile はサイズと時間間隔でローテーションするログファイル
+// lumberjack.Logger の設定は古いログの削除を行うゴルーチンが読むため、変更する場合は新しい Logger に差し替える
+type rotatingFile struct {
+	path string
+
+	mu       sync.RWMutex
+	logger   *lumberjack.Logger
+	settings logFileSettings
+
+	interval time.Duration
+	stop     chan struct{}
+}
+
+// logFileSettings は lumberjack.Logger に渡すローテーションの設定
+type logFileSettings struct {
+	maxSize    int
+	maxBackups int
+	maxAge     int
+	compress   bool
+}
+
+func newLogFileSettings(cfg LogConfig) logFileSettings {
+	return logFileSettings{maxSize: cfg.MaxSizeMB, maxBackups: cfg.MaxBackups, maxAge: cfg.MaxAgeDays, compress: cfg.Compress}
+}
+
+// newLumberjack は設定から lumberjack.Logger を作成する
+func newLumberjack(path string, settings logFileSettings) *lumberjack.Logger {
+	return &lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    settings.maxSize,
+		MaxBackups: settings.maxBackups,
+		MaxAge:     settings.maxAge,
+		Compress:   settings.compress,
+		LocalTime:  true,
+	}
+}
+
+// openLogFile はログファイルの Writer を返す（同じパスの場合は使い回し、設定が変わった場合は Logger を差し替える）
+func openLogFile(path string, cfg LogConfig) io.Writer {
+	logFilesMu.Lock()
+	defer logFilesMu.Unlock()
+
+	settings := newLogFileSettings(cfg)
+	f, ok := logFiles[path]
+	if !ok {
+		f = &rotatingFile{path: path, logger: newLumberjack(path, settings), settings: settings}
+		logFiles[path] = f
+	} else {
+		f.update(settings)
+	}
+
+	if f.interval != cfg.RotateInterval {
+		if f.stop != nil {
+			close(f.stop)
+			f.stop = nil
+		}
+		f.interval = cfg.RotateInterval
+		if f.interval > 0 {
+			f.stop = make(chan struct{})
+			go f.rotateEvery(f.interval, f.stop)
+		}
+	}
+	return f
+}
+
+// update は設定が変わった場合に Logger を差し替え、古い Logger のファイルを閉じる
+func (f *rotatingFile) update(settings logFileSettings) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.settings == settings {
+		return
+	}
+	old := f.logger
+	f.logger, f.settings = newLumberjack(f.path, settings), settings
+	if err := old.Close(); err != nil {
+		errorf("Error closing %s: %v", f.path, err)
+	}
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.logger.Write(p)
+}
+
+// Rotate は現在のファイルを退避して新しいファイルに切り替える
+func (f *rotatingFile) Rotate() error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.logger.Rotate()
+}
+
+func (f *rotatingFile) rotateEvery(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := f.Rotate(); err != nil {
+				errorf("Error rotating %s: %v", f.path, err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// setupLogging はログレベルとエラーログ（標準の log パッケージ）の出力先を設定する
+func setupLogging(cfg LogConfig) error {
+	level, err := parseLogLevel(cfg.Level)
+	if err != nil {
+		return err
+	}
+	currentLogLevel.Store(int32(level))
+	switch {
+	case cfg.SyslogAddr != "":
+		w, err := openSyslog(cfg, syslogMsgError)
+		if err != nil {
+			return err
+		}
+		// 時刻は syslog のヘッダーに含める
+		log.SetFlags(log.Lshortfile)
+		log.SetOutput(w)
+		return nil
+	case cfg.ErrorFile == "":
+		log.SetOutput(os.Stderr)
+	default:
+		log.SetOutput(openLogFile(cfg.ErrorFile, cfg))
+	}
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	return nil
+}
+
+// accessLogOutput はアクセスログの出力先を返す
+func accessLogOutput(cfg LogConfig) (io.Writer, error) {
+	switch {
+	case cfg.SyslogAddr != "":
+		return openSyslog(cfg, syslogMsgAccess)
+	case cfg.AccessFile == "":
+		return os.Stdout, nil
+	}
+	return openLogFile(cfg.AccessFile, cfg), nil
+}
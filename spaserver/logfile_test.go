@@ -0,0 +1,88 @@
+package spaserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAccessLogFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	cfg := LogConfig{AccessFormat: accessLogCommon, AccessFile: path, MaxSizeMB: 1}
+
+	// 設定の再読み込みで再作成されても同じファイルに追記される
+	for i := 0; i < 2; i++ {
+		l, err := newAccessLogger(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler := l.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}
+	if openLogFile(path, cfg) != openLogFile(path, cfg) {
+		t.Error("同じパスのログファイルは共有されるべきです")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "\"GET / HTTP/1.1\" 200"); n != 2 {
+		t.Errorf("アクセスログがファイルに出力されていません: %q", data)
+	}
+}
+
+func TestLogRotateInterval(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "error.log")
+	w := openLogFile(path, LogConfig{MaxSizeMB: 1, RotateInterval: 50 * time.Millisecond})
+	w.Write([]byte("before rotation\n"))
+	defer openLogFile(path, LogConfig{MaxSizeMB: 1})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		entries, _ := os.ReadDir(dir)
+		if len(entries) >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("一定間隔でローテーションされていません")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestLogFileSettingsChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	w := openLogFile(path, LogConfig{MaxSizeMB: 1})
+
+	// 書き込み中に設定を変えても同じファイルに書き続ける（go test -race で確認する）
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			fmt.Fprintf(w, "line %d\n", i)
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		if got := openLogFile(path, LogConfig{MaxSizeMB: 1, MaxBackups: i, Compress: i%2 == 0}); got != w {
+			t.Fatal("同じパスのログファイルは使い回されるべきです")
+		}
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 100 {
+		t.Errorf("期待される行数 100, 実際の行数 %d", lines)
+	}
+}
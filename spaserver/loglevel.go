@@ -0,0 +1,63 @@
+package spaserver
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// logLevel はログの出力レベル
+type logLevel int32
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var levelNames = map[logLevel]string{
+	levelDebug: "DEBUG",
+	levelInfo:  "INFO",
+	levelWarn:  "WARN",
+	levelError: "ERROR",
+}
+
+// currentLogLevel は出力するログの最低レベル
+var currentLogLevel atomic.Int32
+
+func init() {
+	currentLogLevel.Store(int32(levelInfo))
+}
+
+func parseLogLevel(s string) (logLevel, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return levelDebug, nil
+	case "info", "":
+		return levelInfo, nil
+	case "warn", "warning":
+		return levelWarn, nil
+	case "error":
+		return levelError, nil
+	}
+	return levelInfo, fmt.Errorf("unknown log level %q", s)
+}
+
+func logEnabled(level logLevel) bool {
+	return int32(level) >= currentLogLevel.Load()
+}
+
+func logf(level logLevel, format string, args ...interface{}) {
+	if !logEnabled(level) {
+		return
+	}
+	// 呼び出し元のファイル名と行番号を出力する
+	log.Output(3, levelNames[level]+" "+fmt.Sprintf(format, args...))
+}
+
+func debugf(format string, args ...interface{}) { logf(levelDebug, format, args...) }
+func infof(format string, args ...interface{})  { logf(levelInfo, format, args...) }
+func warnf(format string, args ...interface{})  { logf(levelWarn, format, args...) }
+func errorf(format string, args ...interface{}) { logf(levelError, format, args...) }
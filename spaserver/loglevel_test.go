@@ -0,0 +1,55 @@
+package spaserver
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLogLevel(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	defer currentLogLevel.Store(int32(levelInfo))
+
+	tests := []struct {
+		level    string
+		expected []string
+	}{
+		{level: "debug", expected: []string{"DEBUG d", "INFO i", "WARN w", "ERROR e"}},
+		{level: "info", expected: []string{"INFO i", "WARN w", "ERROR e"}},
+		{level: "warn", expected: []string{"WARN w", "ERROR e"}},
+		{level: "error", expected: []string{"ERROR e"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			level, err := parseLogLevel(tt.level)
+			if err != nil {
+				t.Fatal(err)
+			}
+			currentLogLevel.Store(int32(level))
+			buf.Reset()
+
+			debugf("d")
+			infof("i")
+			warnf("w")
+			errorf("e")
+
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			if len(lines) != len(tt.expected) {
+				t.Fatalf("出力されたログの数が期待と異なります: %q", lines)
+			}
+			for i, expected := range tt.expected {
+				if !strings.HasSuffix(lines[i], expected) {
+					t.Errorf("期待されるログ %q, 実際のログ %q", expected, lines[i])
+				}
+			}
+		})
+	}
+
+	if _, err := parseLogLevel("verbose"); err == nil {
+		t.Error("未知のログレベルはエラーになるべきです")
+	}
+}
@@ -0,0 +1,282 @@
+package spaserver
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Main は spa-server コマンドの処理を行う（cmd/spa-server から呼ばれる）
+func Main() {
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	// サブコマンド（spa-server validate ...）
+	args := os.Args[1:]
+	command := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	configFile := flag.String("config", "", "path to YAML configuration file, or a Consul KV or etcd key (consul+http://host:8500/key, etcd+http://host:2379/key)")
+	check := flag.Bool("check", false, "validate the configuration and exit (same as the validate subcommand)")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration and exit (same as the print-config subcommand)")
+	printFormat := flag.String("print-format", "yaml", "output format of --print-config: yaml or json")
+	showVersion := flag.Bool("version", false, "print version information and exit")
+	flags := bindFlags(flag.CommandLine)
+	flag.CommandLine.Parse(args)
+
+	if command == "version" || *showVersion {
+		fmt.Println(getVersionInfo())
+		return
+	}
+
+	// 設定の読み込み（設定ファイル < 環境変数 < コマンドラインフラグ）
+	source := newConfigSource(*configFile, flags)
+	cfg, err := source.Load()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch {
+	case command == "validate" || *check:
+		os.Exit(runValidate(cfg))
+	case command == "healthcheck":
+		os.Exit(runHealthcheck(cfg))
+	case command == "print-config" || *printConfig:
+		data, err := formatConfig(cfg, *printFormat)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(data)
+		return
+	case command != "":
+		fmt.Printf("Error: unknown command %q\n", command)
+		os.Exit(2)
+	}
+	if cfg.Preflight {
+		waitingForDist := cfg.DistWait > 0 && distReady(cfg) != nil
+		warnings, err := preflight(cfg, waitingForDist)
+		for _, w := range warnings {
+			warnf("Startup check: %v", w)
+		}
+		if err != nil {
+			printErrors("Startup checks failed (set PREFLIGHT=false to skip):", err)
+			os.Exit(1)
+		}
+	}
+	if err := setupLogging(cfg.Log); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := setupStatsd(cfg.Statsd); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := setupTLS(cfg.TLS, cfg.Dev.TLS); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	infof("%s", getVersionInfo())
+	if data, err := formatConfig(cfg, "json"); err == nil {
+		infof("Effective configuration: %s", compactJSON(data))
+	}
+	if cfg.Proxy.URL != "" {
+		infof("Proxy URL configured: %s", cfg.Proxy.URL)
+	}
+	if len(cfg.Proxy.Upstreams) > 0 {
+		infof("Proxy upstreams configured: %v", cfg.Proxy.Upstreams)
+	}
+	infof("Proxy paths configured: %v", cfg.Proxy.Paths)
+
+	handler := &handlerSwitch{}
+	if err := distReady(cfg); err != nil && cfg.DistWait > 0 {
+		// 配信ディレクトリが現れるまで 503 を返して待つ
+		warnf("Waiting up to %s for the dist directory: %v", cfg.DistWait, err)
+		starting := newStartingServer(cfg, err)
+		handler.current.Store(starting)
+		go waitForDist(cfg, handler, starting)
+	} else {
+		srv, err := newServer(cfg)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		handler.current.Store(srv)
+	}
+	go reloadOnSignal(source, handler)
+	go renewVaultSecrets(source, handler)
+	go watchRemoteConfig(source, handler)
+
+	// AWS Lambda ではリスナーを開かずに Runtime API から呼び出しを受け取る
+	if api := os.Getenv(lambdaRuntimeAPIEnv); api != "" {
+		infof("Serving AWS Lambda invocations")
+		if err := runLambda(api, handler); err != nil {
+			errorf("Lambda runtime API error: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// リスナーを開く（アップグレード時は親プロセスから引き継ぐ）
+	servers, err := newListeners()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if servers.SocketMode, err = parseFileMode(cfg.SocketMode); err != nil {
+		fmt.Printf("Error: LISTEN_SOCKET_MODE: %v\n", err)
+		os.Exit(1)
+	}
+	servers.MaxHeaderBytes = cfg.Limits.MaxHeaderBytes
+	servers.IdleTimeout = cfg.IdleTimeout
+	var public, secure []net.Listener
+	for i, addr := range cfg.PublicAddrs() {
+		ln, err := servers.Listen(listenerName("public", i), addr)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		public = append(public, ln)
+	}
+	tlsAddrs := cfg.TLS.Listen
+	if len(tlsAddrs) == 0 && servers.Activated("tls") {
+		tlsAddrs = []string{""}
+	}
+	for i, addr := range tlsAddrs {
+		ln, err := servers.Listen(listenerName("tls", i), addr)
+		if err != nil {
+			fmt.Printf("Error: TLS listener: %v\n", err)
+			os.Exit(1)
+		}
+		secure = append(secure, ln)
+	}
+	var adminLn, metricsLn net.Listener
+	if cfg.Admin.Addr != "" || servers.Activated("admin") {
+		if adminLn, err = servers.Listen("admin", cfg.Admin.Addr); err != nil {
+			fmt.Printf("Error: admin interface: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if cfg.Metrics.Addr != "" || servers.Activated("metrics") {
+		if metricsLn, err = servers.Listen("metrics", cfg.Metrics.Addr); err != nil {
+			fmt.Printf("Error: metrics listener: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	servers.Ready()
+
+	// SIGTERM で処理中のリクエストを待ってから終了する
+	done := make(chan struct{})
+	go func() {
+		shutdownOnSignal(servers, handler)
+		close(done)
+	}()
+	// SIGUSR2 で新しいバイナリにリスナーを引き継ぐ
+	go upgradeOnSignal(servers, source)
+
+	// 管理用インターフェースの起動
+	if adminLn != nil {
+		if cfg.Admin.Token == "" && !isLoopbackListener(adminLn.Addr()) {
+			warnf("Admin interface on %s is reachable from other hosts without ADMIN_TOKEN (changes such as IP rules, maintenance mode and rollbacks are refused)", adminLn.Addr())
+		}
+		go func() {
+			infof("Admin interface on %s", adminLn.Addr())
+			if err := servers.Serve(adminLn, handler.Admin()); err != nil {
+				errorf("Admin interface error: %v", err)
+			}
+		}()
+	}
+
+	// メトリクス専用リスナーの起動
+	if metricsLn != nil {
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle(cfg.Metrics.Path, handler.state().metrics)
+			infof("Metrics on %s%s", metricsLn.Addr(), cfg.Metrics.Path)
+			if err := servers.Serve(metricsLn, mux); err != nil {
+				errorf("Metrics listener error: %v", err)
+			}
+		}()
+	}
+
+	// 開発用の証明書で公開用リスナーも HTTPS にする
+	if cfg.Dev.TLS {
+		secure, public = append(secure, public...), nil
+	}
+
+	// サーバー起動（いずれかの公開用リスナーが失敗した場合は終了する）
+	errs := make(chan error, len(public)+len(secure))
+	for _, ln := range public {
+		infof("Serving on %s", ln.Addr())
+		go func(ln net.Listener) {
+			if err := servers.Serve(ln, handler); err != nil {
+				errs <- err
+			}
+		}(ln)
+	}
+	tlsConfig := newTLSConfig()
+	for _, ln := range secure {
+		infof("Serving HTTPS on %s", ln.Addr())
+		go func(ln net.Listener) {
+			if err := servers.ServeTLS(ln, handler, tlsConfig); err != nil {
+				errs <- err
+			}
+		}(ln)
+	}
+
+	// 開発モードではブラウザーで開く（アップグレードで起動された場合は除く）
+	if cfg.Dev.Open && !servers.Upgraded() {
+		ln, https := publicOrSecure(public, secure)
+		if url := browserURL(ln.Addr(), https); url != "" {
+			infof("Opening %s", url)
+			if err := openBrowser(url); err != nil {
+				warnf("Error opening browser: %v", err)
+			}
+		}
+	}
+
+	select {
+	case err := <-errs:
+		errorf("Server error: %v", err)
+		os.Exit(1)
+	case <-done:
+	}
+}
+
+// publicOrSecure はブラウザーで開くリスナーを返す（平文のリスナーを優先する）
+func publicOrSecure(public, secure []net.Listener) (net.Listener, bool) {
+	if len(public) > 0 {
+		return public[0], false
+	}
+	return secure[0], true
+}
+
+// runValidate は設定を検証して結果を表示し、終了コードを返す
+func runValidate(cfg Config) int {
+	if err := cfg.Validate(); err != nil {
+		printErrors("Configuration is invalid:", err)
+		return 1
+	}
+	fmt.Println("Configuration OK")
+	return 0
+}
+
+// printErrors はまとめたエラーを1行ずつ表示する
+func printErrors(title string, err error) {
+	fmt.Println(title)
+	for _, line := range strings.Split(err.Error(), "\n") {
+		fmt.Println("  -", line)
+	}
+}
+
+// isLoopbackListener はリスナーがループバックアドレスまたは unix ソケットで待ち受けているかを確認する
+func isLoopbackListener(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	return !ok || tcp.IP.IsLoopback()
+}
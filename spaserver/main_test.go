@@ -1,102 +1,39 @@
-package main
+package spaserver
 
 import (
 	"log"
 	"net/http"
 	"net/http/httptest"
-	"net/http/httputil"
-	"net/url"
 	"os"
-	"path/filepath"
 	"strings"
 	"testing"
 )
 
-func createHandler(distDir string) http.Handler {
-	mux := http.NewServeMux()
-	fileServer := http.FileServer(http.Dir(distDir))
-	proxyURL := os.Getenv("PROXY_URL")
-
-	// プロキシの設定
-	var proxy *httputil.ReverseProxy
-	if proxyURL != "" {
-		target, err := url.Parse(proxyURL)
-		if err != nil {
-			log.Printf("Error parsing proxy URL: %v\n", err)
-		} else {
-			proxy = httputil.NewSingleHostReverseProxy(target)
-			proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-				log.Printf("Proxy error: %v\n", err)
-				http.Error(w, "Bad Gateway", http.StatusBadGateway)
-			}
-		}
+// testConfig は環境変数から読み込んだテスト用の設定を返す
+func testConfig(t *testing.T) Config {
+	t.Helper()
+	cfg, err := LoadConfig("")
+	if err != nil {
+		t.Fatal(err)
 	}
+	cfg.WatchDistDir = false
+	return cfg
+}
 
-	// プロキシパスの設定
-	proxyPaths := os.Getenv("PROXY_PATHS")
-	var paths []string
-	if proxyPaths != "" {
-		paths = strings.Split(proxyPaths, ",")
-		for i := range paths {
-			paths[i] = strings.TrimSpace(paths[i])
-		}
-	} else {
-		// デフォルトは/query
-		paths = []string{"/query"}
+func createHandler(distDir string) http.Handler {
+	cfg, err := LoadConfig("")
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
 	}
-
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		// プロキシパスのチェック
-		shouldProxy := false
-		for _, pattern := range paths {
-			// ワイルドカードパターンのチェック
-			if strings.Contains(pattern, "*") {
-				// パターンをプレフィックスとサフィックスに分割
-				parts := strings.SplitN(pattern, "*", 2)
-				if len(parts) == 2 {
-					prefix := parts[0]
-					suffix := parts[1]
-					if strings.HasPrefix(r.URL.Path, prefix) && strings.HasSuffix(r.URL.Path, suffix) {
-						shouldProxy = true
-						break
-					}
-				}
-			} else {
-				// 通常のプレフィックスマッチ
-				if strings.HasPrefix(r.URL.Path, pattern) {
-					shouldProxy = true
-					break
-				}
-			}
-		}
-
-		if shouldProxy {
-			if proxy != nil {
-				log.Printf("Proxying request: %s %s\n", r.Method, r.URL.Path)
-				proxy.ServeHTTP(w, r)
-			} else {
-				http.NotFound(w, r)
-			}
-			return
-		}
-
-		// 既存のSPA処理
-		filePath := filepath.Join(distDir, r.URL.Path)
-		if _, err := os.Stat(filePath); os.IsNotExist(err) {
-			w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
-			http.ServeFile(w, r, filepath.Join(distDir, "index.html"))
-		} else {
-			if r.URL.Path == "/" || r.URL.Path == "/index.html" {
-				w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
-			}
-			fileServer.ServeHTTP(w, r)
-		}
-	})
-
-	return mux
+	cfg.DistDir = distDir
+	cfg.WatchDistDir = false
+	s, err := newServer(cfg)
+	if err != nil {
+		log.Fatalf("Error creating server: %v", err)
+	}
+	return s
 }
 
-
 func TestProxyEndpoint(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -383,4 +320,44 @@ func TestMultipleProxyPaths(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestDirectoryListing(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+	os.MkdirAll(dir+"/assets", 0755)
+	os.WriteFile(dir+"/assets/app.js", []byte("app"), 0644)
+	os.MkdirAll(dir+"/docs", 0755)
+	os.WriteFile(dir+"/docs/index.html", []byte("docs"), 0644)
+
+	tests := []struct {
+		name     string
+		listing  bool
+		path     string
+		expected string
+	}{
+		{"一覧を表示せず index.html を返す", false, "/assets/", "SPA"},
+		{"index.html のあるディレクトリ", false, "/docs/", "docs"},
+		{"設定すると一覧を表示する", true, "/assets/", "app.js"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.DistDir = dir
+			cfg.DirectoryListing = tt.listing
+			s, err := newServer(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+			if rr.Code != http.StatusOK {
+				t.Errorf("期待されるステータスコード %d, 実際のステータスコード %d", http.StatusOK, rr.Code)
+			}
+			if !strings.Contains(rr.Body.String(), tt.expected) {
+				t.Errorf("ボディに %s が含まれていません: %s", tt.expected, rr.Body.String())
+			}
+		})
+	}
+}
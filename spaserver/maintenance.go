@@ -0,0 +1,47 @@
+package spaserver
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// メンテナンスモード
+// 有効な間は、ヘルスチェックを除くすべてのリクエストに 503 とメンテナンス画面（MAINTENANCE_PAGE）を返す。
+// IPアドレスの制限の後に判定するので、許可されていないクライアントには引き続き 403 を返す
+
+const maintenanceBody = "Service Unavailable: under maintenance\n"
+
+// loadMaintenancePage はメンテナンス画面のファイルを読み込む（未設定の場合は nil）
+func loadMaintenancePage(cfg MaintenanceConfig) ([]byte, error) {
+	if cfg.Page == "" {
+		return nil, nil
+	}
+	page, err := os.ReadFile(cfg.Page)
+	if err != nil {
+		return nil, fmt.Errorf("MAINTENANCE_PAGE: %w", err)
+	}
+	return page, nil
+}
+
+// serveMaintenance はメンテナンスモードが有効な場合に 503 を返し、true を返す
+func (s *server) serveMaintenance(w http.ResponseWriter, r *http.Request) bool {
+	if !s.state.operations.maintenance(s.cfg.Maintenance.Enabled) {
+		return false
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if s.cfg.Maintenance.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(s.cfg.Maintenance.RetryAfter.Seconds())))
+	}
+	if s.maintenancePage == nil {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, maintenanceBody)
+		return true
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write(s.maintenancePage)
+	return true
+}
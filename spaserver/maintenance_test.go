@@ -0,0 +1,58 @@
+package spaserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMaintenance(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+	page := filepath.Join(t.TempDir(), "maintenance.html")
+	os.WriteFile(page, []byte("<h1>Back soon</h1>"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Health.Endpoints = true
+	cfg.Maintenance.Enabled = true
+	cfg.Maintenance.Page = page
+	cfg.Maintenance.RetryAfter = 5 * time.Minute
+	cfg.Admin.Token = "secret"
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest("GET", "/users/1", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("期待されるステータスコード %d, 実際のステータスコード %d", http.StatusServiceUnavailable, rr.Code)
+	}
+	if rr.Body.String() != "<h1>Back soon</h1>" || rr.Header().Get("Retry-After") != "300" {
+		t.Errorf("メンテナンス画面が正しくありません: %q, Retry-After: %q", rr.Body.String(), rr.Header().Get("Retry-After"))
+	}
+
+	rr = httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest("GET", "/healthz", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("ヘルスチェックはメンテナンス中も 200 を返すべきです: %d", rr.Code)
+	}
+
+	// 管理 API で無効にする
+	r := httptest.NewRequest("DELETE", maintenancePath, nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	rr = httptest.NewRecorder()
+	s.admin.ServeHTTP(rr, r)
+	if rr.Code != http.StatusOK || rr.Body.String() != "{\"enabled\":false}\n" {
+		t.Fatalf("メンテナンスモードを無効にできません: %d %s", rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest("GET", "/users/1", nil))
+	if rr.Body.String() != "SPA" {
+		t.Errorf("無効にした後は通常どおり配信するべきです: %d %q", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,218 @@
+package spaserver
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// アセットマニフェスト
+// ビルドが出力する manifest.json（Vite の .vite/manifest.json、webpack や Create React App の asset-manifest.json）から
+// ハッシュ付きのファイルとエントリーを読み込み、プリロードの Link ヘッダー・immutable なキャッシュ・ウォームアップに使う
+
+// immutableCacheControl はハッシュ付きのファイルに付ける Cache-Control
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// assetManifest はマニフェストから求めたエントリーとハッシュ付きのファイル（URL のパス）
+type assetManifest struct {
+	entries []string
+	assets  map[string]bool
+	// エントリーが ES モジュールか（Vite）
+	modules bool
+}
+
+// viteChunk は Vite のマニフェストの項目
+type viteChunk struct {
+	File    string   `json:"file"`
+	IsEntry bool     `json:"isEntry"`
+	CSS     []string `json:"css"`
+	Assets  []string `json:"assets"`
+	Imports []string `json:"imports"`
+}
+
+// parseAssetManifest は Vite または webpack のマニフェストを解析する
+func parseAssetManifest(data []byte) (*assetManifest, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	m := &assetManifest{assets: map[string]bool{}}
+
+	// Create React App / webpack-assets-manifest: {"files": {...}, "entrypoints": [...]}
+	if files, ok := raw["files"]; ok {
+		var named map[string]string
+		if err := json.Unmarshal(files, &named); err != nil {
+			return nil, err
+		}
+		for _, file := range named {
+			m.addAsset(file)
+		}
+		var entries []string
+		if err := json.Unmarshal(raw["entrypoints"], &entries); err == nil {
+			for _, file := range entries {
+				m.addEntry(file)
+			}
+		}
+		return m, nil
+	}
+
+	// Vite: {"src/main.ts": {"file": "assets/main-abc.js", "isEntry": true, ...}}
+	chunks := map[string]viteChunk{}
+	var plain map[string]string
+	for key, value := range raw {
+		var chunk viteChunk
+		if err := json.Unmarshal(value, &chunk); err != nil || chunk.File == "" {
+			// webpack-manifest-plugin: {"main.js": "/static/main.abc.js"}（エントリーは判別できない）
+			var file string
+			if err := json.Unmarshal(value, &file); err != nil {
+				return nil, errors.New("unsupported manifest format")
+			}
+			if plain == nil {
+				plain = map[string]string{}
+			}
+			plain[key] = file
+			continue
+		}
+		chunks[key] = chunk
+	}
+	for _, file := range plain {
+		m.addAsset(file)
+	}
+	keys := make([]string, 0, len(chunks))
+	for key, chunk := range chunks {
+		keys = append(keys, key)
+		m.addAsset(chunk.File)
+		for _, file := range append(append([]string{}, chunk.CSS...), chunk.Assets...) {
+			m.addAsset(file)
+		}
+	}
+	// 出力を安定させるためキーの順に処理する
+	sort.Strings(keys)
+	seen := map[string]bool{}
+	var visit func(key string)
+	visit = func(key string) {
+		chunk, ok := chunks[key]
+		if !ok || seen[key] {
+			return
+		}
+		seen[key] = true
+		m.addEntry(chunk.File)
+		for _, css := range chunk.CSS {
+			m.addEntry(css)
+		}
+		for _, imported := range chunk.Imports {
+			visit(imported)
+		}
+	}
+	for _, key := range keys {
+		if chunks[key].IsEntry {
+			visit(key)
+		}
+	}
+	m.modules = len(chunks) > 0
+	return m, nil
+}
+
+// assetURL はマニフェストのファイル名を URL のパスにする
+func assetURL(file string) string {
+	if strings.Contains(file, "://") {
+		return ""
+	}
+	return path.Clean("/" + file)
+}
+
+func (m *assetManifest) addAsset(file string) {
+	if url := assetURL(file); url != "" {
+		m.assets[url] = true
+	}
+}
+
+func (m *assetManifest) addEntry(file string) {
+	url := assetURL(file)
+	if url == "" {
+		return
+	}
+	if slices.Contains(m.entries, url) {
+		return
+	}
+	m.entries = append(m.entries, url)
+	m.assets[url] = true
+}
+
+// preloadLinks はエントリーのファイルの Link ヘッダーの値を返す
+func (m *assetManifest) preloadLinks() []string {
+	var links []string
+	for _, url := range m.entries {
+		switch path.Ext(url) {
+		case ".js", ".mjs":
+			if m.modules {
+				links = append(links, "<"+url+">; rel=modulepreload")
+			} else {
+				links = append(links, "<"+url+">; rel=preload; as=script")
+			}
+		case ".css":
+			links = append(links, "<"+url+">; rel=preload; as=style")
+		}
+	}
+	return links
+}
+
+// manifestLoader は DIST_DIR のマニフェストをファイルの更新日時ごとにキャッシュする
+type manifestLoader struct {
+	name string
+
+	mu       sync.Mutex
+	path     string
+	modTime  time.Time
+	manifest *assetManifest
+}
+
+// load は distDir のマニフェストを返す（読み込めない場合は nil）
+func (l *manifestLoader) load(distDir string) *assetManifest {
+	manifestPath := filepath.Join(distDir, filepath.FromSlash(l.name))
+	info, err := os.Stat(manifestPath)
+	if err != nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.path == manifestPath && l.modTime.Equal(info.ModTime()) {
+		return l.manifest
+	}
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil
+	}
+	manifest, err := parseAssetManifest(data)
+	if err != nil {
+		warnf("Reading asset manifest %s: %v", manifestPath, err)
+		manifest = nil
+	} else {
+		infof("Loaded asset manifest %s: %d entry files, %d assets", manifestPath, len(manifest.entries), len(manifest.assets))
+		go warmUp(distDir, manifest.entries)
+	}
+	l.path, l.modTime, l.manifest = manifestPath, info.ModTime(), manifest
+	return l.manifest
+}
+
+// warmUp はエントリーのファイルを読み込み、最初のリクエストの前に OS のページキャッシュに載せる
+func warmUp(distDir string, entries []string) {
+	for _, url := range entries {
+		filePath, ok := resolveStaticPath(distDir, url)
+		if !ok {
+			continue
+		}
+		if f, err := os.Open(filePath); err == nil {
+			io.Copy(io.Discard, f)
+			f.Close()
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package spaserver
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testViteManifest = `{
+  "index.html": {"file": "assets/index-4f2a.js", "src": "index.html", "isEntry": true, "imports": ["_vendor-77c1.js"], "css": ["assets/index-9c1d.css"]},
+  "_vendor-77c1.js": {"file": "assets/vendor-77c1.js"},
+  "src/pages/About.vue": {"file": "assets/About-1b2c.js", "isDynamicEntry": true, "assets": ["assets/logo-5e6f.svg"]}
+}`
+
+func TestParseAssetManifest(t *testing.T) {
+	tests := []struct {
+		name          string
+		manifest      string
+		expectedLinks string
+		asset         string
+	}{
+		{"Vite", testViteManifest, "</assets/index-4f2a.js>; rel=modulepreload, </assets/index-9c1d.css>; rel=preload; as=style, </assets/vendor-77c1.js>; rel=modulepreload", "/assets/logo-5e6f.svg"},
+		{"Create React App", `{"files": {"main.js": "/static/js/main.1a2b.js", "main.css": "/static/css/main.3c4d.css", "index.html": "/index.html"}, "entrypoints": ["static/css/main.3c4d.css", "static/js/main.1a2b.js"]}`, "</static/css/main.3c4d.css>; rel=preload; as=style, </static/js/main.1a2b.js>; rel=preload; as=script", "/static/js/main.1a2b.js"},
+		{"webpack-manifest-plugin", `{"main.js": "/dist/main.8e9f.js"}`, "", "/dist/main.8e9f.js"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := parseAssetManifest([]byte(tt.manifest))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(m.preloadLinks(), ", "); got != tt.expectedLinks {
+				t.Errorf("期待される Link %q, 実際の Link %q", tt.expectedLinks, got)
+			}
+			if !m.assets[tt.asset] {
+				t.Errorf("%s がハッシュ付きのファイルに含まれていません", tt.asset)
+			}
+		})
+	}
+
+	if _, err := parseAssetManifest([]byte(`{"main": 1}`)); err == nil {
+		t.Error("対応していない形式はエラーになるべきです")
+	}
+}
+
+func TestAssetManifest(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte(`<script src="/ignored.js"></script>`), 0644)
+	os.MkdirAll(filepath.Join(dir, ".vite"), 0755)
+	os.WriteFile(filepath.Join(dir, ".vite", "manifest.json"), []byte(testViteManifest), 0644)
+	os.MkdirAll(filepath.Join(dir, "assets"), 0755)
+	os.WriteFile(filepath.Join(dir, "assets", "index-4f2a.js"), []byte("app"), 0644)
+	os.WriteFile(filepath.Join(dir, "favicon.ico"), []byte("icon"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.AssetManifest = ".vite/manifest.json"
+	cfg.PreloadLinks = true
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		name                 string
+		path                 string
+		expectedCacheControl string
+		expectedLink         string
+	}{
+		{"ハッシュ付きのファイル", "/assets/index-4f2a.js", immutableCacheControl, ""},
+		{"マニフェストにないファイル", "/favicon.ico", "", ""},
+		{"マニフェストのエントリーをプリロードする", "/", indexCacheControl, "</assets/index-4f2a.js>; rel=modulepreload, </assets/index-9c1d.css>; rel=preload; as=style, </assets/vendor-77c1.js>; rel=modulepreload"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+			if got := rr.Header().Get("Cache-Control"); got != tt.expectedCacheControl {
+				t.Errorf("期待される Cache-Control %q, 実際の Cache-Control %q", tt.expectedCacheControl, got)
+			}
+			if got := rr.Header().Get("Link"); got != tt.expectedLink {
+				t.Errorf("期待される Link %q, 実際の Link %q", tt.expectedLink, got)
+			}
+		})
+	}
+}
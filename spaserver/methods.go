@@ -0,0 +1,55 @@
+package spaserver
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// 受け付ける HTTP メソッド
+// ALLOWED_METHODS と PATH_METHODS（パターン=メソッド|メソッド）に含まれないメソッドは 405 を返す。
+// TRACE と TRACK は設定に関わらず受け付けない
+
+// staticMethods は静的ファイルの配信で受け付けるメソッド
+var staticMethods = []string{http.MethodGet, http.MethodHead}
+
+// pathMethods はパスのパターンごとに受け付けるメソッド
+type pathMethods struct {
+	pattern string
+	methods []string
+}
+
+// parsePathMethods は "パターン=メソッド|メソッド" の一覧を解析する
+func parsePathMethods(entries []string) ([]pathMethods, error) {
+	var rules []pathMethods
+	for _, entry := range entries {
+		pattern, value, ok := strings.Cut(entry, "=")
+		if !ok || pattern == "" || !isMethodList(value) {
+			return nil, fmt.Errorf("invalid entry %q (use path=GET|POST)", entry)
+		}
+		rules = append(rules, pathMethods{pattern: pattern, methods: strings.Split(value, "|")})
+	}
+	return rules, nil
+}
+
+// allowedMethodsFor はパスで受け付けるメソッドを返す（PATH_METHODS に一致しない場合は ALLOWED_METHODS）
+func (s *server) allowedMethodsFor(path string) []string {
+	for _, rule := range s.pathMethods {
+		if matchProxyPath([]string{rule.pattern}, path) {
+			return rule.methods
+		}
+	}
+	return s.cfg.AllowedMethods
+}
+
+// allowMethod はメソッドを受け付けない場合に 405 を返して false を返す
+func allowMethod(w http.ResponseWriter, r *http.Request, methods []string) bool {
+	if r.Method != "TRACE" && r.Method != "TRACK" && (len(methods) == 0 || slices.Contains(methods, r.Method)) {
+		return true
+	}
+	debugf("Method not allowed: %s %s", metricMethod(r.Method), escapeLogValue(r.URL.Path))
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	return false
+}
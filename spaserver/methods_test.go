@@ -0,0 +1,59 @@
+package spaserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestAllowedMethods(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("backend"))
+	}))
+	defer backend.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Proxy.URL = backend.URL
+	cfg.Proxy.Paths = []string{"/api"}
+	cfg.PathMethods = []string{"/api/reports=GET|HEAD"}
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		expectedCode  int
+		expectedAllow string
+	}{
+		{"プロキシは POST を受け付ける", "POST", "/api/items", http.StatusOK, ""},
+		{"TRACE は常に拒否する", "TRACE", "/api/items", http.StatusMethodNotAllowed, "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS"},
+		{"一覧にないメソッドは拒否する", "PROPFIND", "/api/items", http.StatusMethodNotAllowed, "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS"},
+		{"パスごとの設定を優先する", "POST", "/api/reports", http.StatusMethodNotAllowed, "GET, HEAD"},
+		{"静的ファイルは GET を受け付ける", "GET", "/about", http.StatusOK, ""},
+		{"静的ファイルは POST を拒否する", "POST", "/about", http.StatusMethodNotAllowed, "GET, HEAD"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+			if rr.Code != tt.expectedCode {
+				t.Errorf("期待されるステータスコード %d, 実際のステータスコード %d", tt.expectedCode, rr.Code)
+			}
+			if got := rr.Header().Get("Allow"); got != tt.expectedAllow {
+				t.Errorf("期待される Allow %q, 実際の Allow %q", tt.expectedAllow, got)
+			}
+		})
+	}
+
+	if _, err := parsePathMethods([]string{"/api=get"}); err == nil {
+		t.Error("小文字のメソッドはエラーになるべきです")
+	}
+}
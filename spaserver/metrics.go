@@ -0,0 +1,276 @@
+package spaserver
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prometheus のテキスト形式で出力するメトリクス
+// レジストリはサーバーの状態（serverState）に持ち、設定を読み込み直しても値をリセットしない
+
+// defaultBuckets はレイテンシのヒストグラムのバケット（秒）
+var defaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+var processStartTime = time.Now()
+
+// serverMetrics はサーバーが記録するメトリクス
+type serverMetrics struct {
+	requests        *metricVec
+	requestDuration *metricVec
+	classDuration   *metricVec
+	inFlight        *metricVec
+	proxyErrors     *metricVec
+	proxyHedges     *metricVec
+	proxyConns      *metricVec
+	upstreamUp      *metricVec
+	graphQLRequests *metricVec
+	graphQLDuration *metricVec
+	blockedRequests *metricVec
+	cacheRequests   *metricVec
+	rateLimited     *metricVec
+	queued          *metricVec
+	queueRejected   *metricVec
+}
+
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{
+		requests:        newCounterVec("spa_http_requests_total", "Total number of HTTP requests.", "method", "code"),
+		requestDuration: newHistogramVec("spa_http_request_duration_seconds", "HTTP request latency in seconds.", defaultBuckets),
+		classDuration:   newHistogramVec("spa_http_request_class_duration_seconds", "HTTP request latency in seconds by route class and status class.", defaultBuckets, "class", "status"),
+		inFlight:        newGaugeVec("spa_http_requests_in_flight", "Number of HTTP requests being served."),
+		proxyErrors:     newCounterVec("spa_proxy_errors_total", "Total number of failed proxy requests."),
+		proxyHedges:     newCounterVec("spa_proxy_hedged_requests_total", "Total number of hedged proxy requests."),
+		proxyConns:      newGaugeVec("spa_proxy_open_connections", "Number of open connections to the upstream."),
+		upstreamUp:      newGaugeVec("spa_upstream_up", "Whether the last upstream health check succeeded."),
+		graphQLRequests: newCounterVec("spa_graphql_requests_total", "Total number of GraphQL requests.", "operation", "code"),
+		graphQLDuration: newHistogramVec("spa_graphql_request_duration_seconds", "GraphQL request latency in seconds.", defaultBuckets, "operation"),
+		blockedRequests: newCounterVec("spa_blocked_requests_total", "Total number of requests to blocked paths.", "pattern"),
+		cacheRequests:   newCounterVec("spa_cache_requests_total", "Total number of responses served from or added to a cache.", "cache", "status"),
+		rateLimited:     newCounterVec("spa_rate_limited_requests_total", "Total number of requests rejected by a rate limit.", "limit"),
+		queued:          newGaugeVec("spa_http_requests_queued", "Number of requests waiting for MAX_CONCURRENT_REQUESTS."),
+		queueRejected:   newCounterVec("spa_http_requests_queue_rejected_total", "Total number of requests rejected because the request queue was full or timed out.", "reason"),
+	}
+}
+
+// Wrap はハンドラーにリクエストのメトリクスの記録を追加する
+func (m *serverMetrics) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		m.inFlight.Add(1)
+		defer m.inFlight.Add(-1)
+
+		r, class := withRouteClass(r)
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		elapsed := time.Since(start).Seconds()
+		m.requests.Add(1, metricMethod(r.Method), strconv.Itoa(rec.Status()))
+		m.requestDuration.Observe(elapsed)
+		m.classDuration.Observe(elapsed, class.name, statusClass(rec.Status()))
+		if info := graphQLFrom(r.Context()); info != nil && info.operation != "" {
+			operation := graphQLMetricLabel(info.operation)
+			m.graphQLRequests.Add(1, operation, strconv.Itoa(rec.Status()))
+			m.graphQLDuration.Observe(elapsed, operation)
+		}
+	})
+}
+
+// ServeHTTP はメトリクスを Prometheus のテキスト形式で返す
+func (m *serverMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, v := range []*metricVec{m.requests, m.requestDuration, m.classDuration, m.inFlight, m.proxyErrors, m.proxyHedges, m.proxyConns, m.upstreamUp, m.graphQLRequests, m.graphQLDuration, m.blockedRequests, m.cacheRequests, m.rateLimited, m.queued, m.queueRejected} {
+		v.write(w)
+	}
+	writeRuntimeMetrics(w)
+}
+
+// metricMethod はラベルの種類が増えすぎないよう、標準以外のメソッドを OTHER にまとめる
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
+
+func writeRuntimeMetrics(w io.Writer) {
+	fmt.Fprintf(w, "# HELP go_goroutines Number of goroutines that currently exist.\n# TYPE go_goroutines gauge\ngo_goroutines %d\n", runtime.NumGoroutine())
+	fmt.Fprintf(w, "# HELP process_start_time_seconds Start time of the process since unix epoch in seconds.\n# TYPE process_start_time_seconds gauge\nprocess_start_time_seconds %d\n", processStartTime.Unix())
+}
+
+// metricVec はラベルの組み合わせごとの値を持つカウンター・ゲージ・ヒストグラム
+type metricVec struct {
+	name    string
+	help    string
+	kind    string // counter, gauge, histogram
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	values map[string]*metricValue
+}
+
+type metricValue struct {
+	labelValues []string
+	value       float64  // カウンター・ゲージの値
+	counts      []uint64 // ヒストグラムのバケットごとの件数
+	count       uint64
+	sum         float64
+}
+
+func newCounterVec(name, help string, labels ...string) *metricVec {
+	return &metricVec{name: name, help: help, kind: "counter", labels: labels, values: map[string]*metricValue{}}
+}
+
+func newGaugeVec(name, help string, labels ...string) *metricVec {
+	return &metricVec{name: name, help: help, kind: "gauge", labels: labels, values: map[string]*metricValue{}}
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *metricVec {
+	return &metricVec{name: name, help: help, kind: "histogram", labels: labels, buckets: buckets, values: map[string]*metricValue{}}
+}
+
+// get はラベルの値に対応する値を返す（呼び出し側で mu をロックする）
+func (v *metricVec) get(labelValues []string) *metricValue {
+	key := strings.Join(labelValues, "\xff")
+	mv, ok := v.values[key]
+	if !ok {
+		mv = &metricValue{labelValues: append([]string(nil), labelValues...)}
+		if v.kind == "histogram" {
+			mv.counts = make([]uint64, len(v.buckets))
+		}
+		v.values[key] = mv
+	}
+	return mv
+}
+
+// Add はカウンター・ゲージに値を加算する
+func (v *metricVec) Add(delta float64, labelValues ...string) {
+	v.mu.Lock()
+	mv := v.get(labelValues)
+	mv.value += delta
+	value := mv.value
+	v.mu.Unlock()
+
+	// statsd にはカウンターは増分、ゲージは現在の値を送信する
+	if v.kind == "counter" {
+		value = delta
+	}
+	v.emit(value, labelValues)
+}
+
+// Set はゲージの値を設定する
+func (v *metricVec) Set(value float64, labelValues ...string) {
+	v.mu.Lock()
+	v.get(labelValues).value = value
+	v.mu.Unlock()
+	v.emit(value, labelValues)
+}
+
+// Observe はヒストグラムに値を記録する
+func (v *metricVec) Observe(value float64, labelValues ...string) {
+	v.mu.Lock()
+	mv := v.get(labelValues)
+	for i, upper := range v.buckets {
+		if value <= upper {
+			mv.counts[i]++
+		}
+	}
+	mv.count++
+	mv.sum += value
+	v.mu.Unlock()
+	v.emit(value, labelValues)
+}
+
+// emit は statsd が設定されている場合に値を送信する
+func (v *metricVec) emit(value float64, labelValues []string) {
+	if c := currentStatsd.Load(); c != nil {
+		c.emit(v, value, labelValues)
+	}
+}
+
+// metricSample はラベルの組み合わせごとの値
+type metricSample struct {
+	labelValues []string
+	value       float64
+}
+
+// samples はカウンター・ゲージのラベルの組み合わせごとの現在の値を返す
+func (v *metricVec) samples() []metricSample {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	samples := make([]metricSample, 0, len(v.values))
+	for _, mv := range v.values {
+		samples = append(samples, metricSample{labelValues: mv.labelValues, value: mv.value})
+	}
+	return samples
+}
+
+// Value はカウンター・ゲージの現在の値を返す（記録されていない場合は 0）
+func (v *metricVec) Value(labelValues ...string) float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if mv, ok := v.values[strings.Join(labelValues, "\xff")]; ok {
+		return mv.value
+	}
+	return 0
+}
+
+func (v *metricVec) write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.kind)
+	keys := make([]string, 0, len(v.values))
+	for key := range v.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		mv := v.values[key]
+		if v.kind != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", v.name, formatLabels(v.labels, mv.labelValues, "", ""), formatFloat(mv.value))
+			continue
+		}
+		for i, upper := range v.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, formatLabels(v.labels, mv.labelValues, "le", formatFloat(upper)), mv.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, formatLabels(v.labels, mv.labelValues, "le", "+Inf"), mv.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.name, formatLabels(v.labels, mv.labelValues, "", ""), formatFloat(mv.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", v.name, formatLabels(v.labels, mv.labelValues, "", ""), mv.count)
+	}
+}
+
+// formatLabels は {name="value",...} 形式のラベルを作成する（extraName はヒストグラムの le 用）
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	var pairs []string
+	for i, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", name, values[i]))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", extraName, extraValue))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
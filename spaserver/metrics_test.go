@@ -0,0 +1,44 @@
+package spaserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	m := newServerMetrics()
+	handler := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	for _, path := range []string{"/", "/", "/missing"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("BREW", "/", nil))
+	m.proxyErrors.Add(1)
+
+	rr := httptest.NewRecorder()
+	m.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	body := rr.Body.String()
+
+	for _, expected := range []string{
+		`# TYPE spa_http_requests_total counter`,
+		`spa_http_requests_total{method="GET",code="200"} 2`,
+		`spa_http_requests_total{method="GET",code="404"} 1`,
+		`spa_http_requests_total{method="OTHER",code="200"} 1`,
+		`spa_http_request_duration_seconds_bucket{le="+Inf"} 4`,
+		`spa_http_request_duration_seconds_count 4`,
+		`spa_http_requests_in_flight 0`,
+		`spa_proxy_errors_total 1`,
+		`go_goroutines `,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("メトリクスに %q が含まれていません:\n%s", expected, body)
+		}
+	}
+}
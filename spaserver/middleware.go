@@ -0,0 +1,50 @@
+package spaserver
+
+import "net/http"
+
+// Middleware はハンドラーを包んで処理を追加する
+type Middleware func(http.Handler) http.Handler
+
+// MiddlewarePoint はミドルウェアを挿入する位置
+type MiddlewarePoint int
+
+const (
+	// MiddlewareOuter はすべての処理の外側（メトリクス・アクセスログより前）
+	MiddlewareOuter MiddlewarePoint = iota
+	// MiddlewareAfterAccessControl はヘルスチェックと IP アドレスの確認の後
+	MiddlewareAfterAccessControl
+	// MiddlewareProxy はプロキシパスへのリクエスト（モックと記録・再生を含む）
+	MiddlewareProxy
+	// MiddlewareStatic は静的ファイルと index.html の配信
+	MiddlewareStatic
+)
+
+// Option は New の追加の設定
+type Option func(*options)
+
+type options struct {
+	middleware map[MiddlewarePoint][]Middleware
+	plugins    []Plugin
+	// 設定の再読み込みで引き継ぐ状態（nil の場合は新しく作成する）
+	state *serverState
+}
+
+// WithMiddleware は指定した位置にミドルウェアを挿入する
+// 同じ位置に複数指定した場合は先に指定したものが外側になる
+func WithMiddleware(point MiddlewarePoint, middleware ...Middleware) Option {
+	return func(o *options) {
+		if o.middleware == nil {
+			o.middleware = map[MiddlewarePoint][]Middleware{}
+		}
+		o.middleware[point] = append(o.middleware[point], middleware...)
+	}
+}
+
+// wrap は指定した位置のミドルウェアで h を包む
+func (o *options) wrap(point MiddlewarePoint, h http.Handler) http.Handler {
+	chain := o.middleware[point]
+	for i := len(chain) - 1; i >= 0; i-- {
+		h = chain[i](h)
+	}
+	return h
+}
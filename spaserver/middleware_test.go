@@ -0,0 +1,67 @@
+package spaserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWithMiddleware(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("backend"))
+	}))
+	defer backend.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Proxy.URL = backend.URL
+	cfg.Proxy.Paths = []string{"/api"}
+	cfg.AllowRemoteIPs = []string{"192.0.2.1"}
+
+	// 通過したミドルウェアを X-Trace ヘッダーに記録する
+	trace := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("X-Trace", name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	handler, err := New(cfg,
+		WithMiddleware(MiddlewareOuter, trace("outer1"), trace("outer2")),
+		WithMiddleware(MiddlewareAfterAccessControl, trace("routed")),
+		WithMiddleware(MiddlewareProxy, trace("proxy")),
+		WithMiddleware(MiddlewareStatic, trace("static")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handler.Close()
+
+	tests := []struct {
+		name          string
+		path          string
+		remoteAddr    string
+		expectedTrace string
+	}{
+		{"プロキシ", "/api/users", "192.0.2.1:1234", "outer1,outer2,routed,proxy"},
+		{"静的ファイル", "/users/1", "192.0.2.1:1234", "outer1,outer2,routed,static"},
+		{"拒否されたIP", "/users/1", "198.51.100.1:1234", "outer1,outer2"},
+		{"ヘルスチェック", "/healthz", "198.51.100.1:1234", "outer1,outer2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.RemoteAddr = tt.remoteAddr
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if trace := strings.Join(rr.Header().Values("X-Trace"), ","); trace != tt.expectedTrace {
+				t.Errorf("期待される順序 %q, 実際の順序 %q", tt.expectedTrace, trace)
+			}
+		})
+	}
+}
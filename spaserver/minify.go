@@ -0,0 +1,145 @@
+package spaserver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// HTML の最小化
+// MINIFY_HTML が有効な場合、配信する HTML からコメントを取り除き連続する空白を1文字にまとめる。
+// 表示が変わらないよう pre・textarea の中と script・style の内容はそのまま残す。
+// 最小化した結果はファイルの更新日時とサイズをキーにメモリにキャッシュする
+
+// htmlCacheBytes は最小化した HTML のキャッシュの上限
+const htmlCacheBytes = 16 << 20
+
+// htmlMinifier は最小化した HTML を返す
+type htmlMinifier struct {
+	cache   *byteCache
+	metrics *serverMetrics
+}
+
+func newHTMLMinifier(m *serverMetrics) *htmlMinifier {
+	return &htmlMinifier{cache: newByteCache(htmlCacheBytes), metrics: m}
+}
+
+// serve は HTML ファイルを最小化して返す（ファイルを読めない場合は何もせず false を返す）
+func (m *htmlMinifier) serve(w http.ResponseWriter, r *http.Request, filePath string) bool {
+	info, err := os.Stat(filePath)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%d", filePath, info.Size(), info.ModTime().UnixNano())))
+	key := hex.EncodeToString(sum[:])
+	data, hit := m.cache.get(key)
+	if !hit {
+		raw, err := os.ReadFile(filePath)
+		if err != nil {
+			return false
+		}
+		data = minifyHTML(raw)
+		m.cache.put(key, data)
+	}
+	setCacheStatus(w, m.metrics, "html", hit)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	http.ServeContent(w, r, filePath, info.ModTime(), bytes.NewReader(data))
+	return true
+}
+
+// htmlFilePath は最小化して返す HTML ファイルのパスを返す
+// /index.html へのリクエストは http.FileServer が / にリダイレクトするため対象外
+func htmlFilePath(filePath, urlPath string, dir bool) (string, bool) {
+	if dir {
+		return filepath.Join(filePath, "index.html"), strings.HasSuffix(urlPath, "/")
+	}
+	ext := strings.ToLower(filepath.Ext(filePath))
+	return filePath, (ext == ".html" || ext == ".htm") && !strings.HasSuffix(urlPath, "/index.html")
+}
+
+// minifyHTML は HTML のコメントと余分な空白を取り除く
+func minifyHTML(src []byte) []byte {
+	var out bytes.Buffer
+	out.Grow(len(src))
+	z := html.NewTokenizer(bytes.NewReader(src))
+	// 空白を残す要素の深さと、コメントを挟んで続くテキスト
+	preserve := 0
+	var text strings.Builder
+	flushText := func() {
+		out.WriteString(collapseSpace(text.String()))
+		text.Reset()
+	}
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				// 解析できない場合は元のまま返す
+				return src
+			}
+			flushText()
+			return bytes.TrimSpace(out.Bytes())
+		}
+		raw := z.Raw()
+		switch tt {
+		case html.CommentToken:
+			// 条件付きコメントは残す
+			if bytes.HasPrefix(raw, []byte("<!--[if")) || bytes.HasPrefix(raw, []byte("<!--<![endif]")) {
+				flushText()
+				out.Write(raw)
+			}
+			continue
+		case html.TextToken:
+			if preserve == 0 {
+				text.Write(raw)
+				continue
+			}
+		case html.StartTagToken, html.EndTagToken:
+			name, _ := z.TagName()
+			if tag := string(name); tag == "pre" || tag == "textarea" || tag == "script" || tag == "style" {
+				if tt == html.StartTagToken {
+					preserve++
+				} else if preserve > 0 {
+					preserve--
+				}
+			}
+		}
+		flushText()
+		out.Write(raw)
+	}
+}
+
+// collapseSpace は連続する空白を1文字（改行を含む場合は改行）にまとめる
+func collapseSpace(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	space, newline := false, false
+	flush := func() {
+		if newline {
+			b.WriteByte('\n')
+		} else if space {
+			b.WriteByte(' ')
+		}
+		space, newline = false, false
+	}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case ' ', '\t', '\r', '\f':
+			space = true
+		case '\n':
+			newline = true
+		default:
+			flush()
+			b.WriteByte(c)
+		}
+	}
+	flush()
+	return b.String()
+}
@@ -0,0 +1,64 @@
+package spaserver
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMinifyHTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		html     string
+		expected string
+	}{
+		{"コメントを取り除く", "<p>a<!-- note -->b</p>", "<p>ab</p>"},
+		{"空白をまとめる", "<ul>\n    <li>a   b</li>\n    <li>c</li>\n</ul>\n", "<ul>\n<li>a b</li>\n<li>c</li>\n</ul>"},
+		{"pre の中は残す", "<pre>  a\n\n  b</pre>", "<pre>  a\n\n  b</pre>"},
+		{"script の内容は残す", "<script>\n  var a  =  1;\n</script>", "<script>\n  var a  =  1;\n</script>"},
+		{"条件付きコメントは残す", "<!--[if IE]><p>IE</p><![endif]-->", "<!--[if IE]><p>IE</p><![endif]-->"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(minifyHTML([]byte(tt.html))); got != tt.expected {
+				t.Errorf("期待される HTML %q, 実際の HTML %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMinifyHTMLServe(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html>\n  <!-- build 42 -->\n  <body>SPA</body>\n</html>\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "about.html"), []byte("<p>  about  </p>"), 0644)
+	os.WriteFile(filepath.Join(dir, "app.js"), []byte("var a  =  1;"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.MinifyHTML = true
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{"ルート", "/", "<html>\n<body>SPA</body>\n</html>"},
+		{"index.html へのフォールバック", "/users/1", "<html>\n<body>SPA</body>\n</html>"},
+		{"HTML ファイル", "/about.html", "<p> about </p>"},
+		{"HTML 以外はそのまま", "/app.js", "var a  =  1;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+			if rr.Body.String() != tt.expected {
+				t.Errorf("期待されるボディ %q, 実際のボディ %q", tt.expected, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package spaserver
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// mockAPI はプロキシパスへのリクエストに MOCK_DIR のフィクスチャを返す
+// /api/users への GET は api/users.GET.json、なければ api/users.json を返す
+type mockAPI struct {
+	dir string
+}
+
+// fixture はリクエストに対応するフィクスチャのファイルパスを返す（ない場合は空）
+func (m *mockAPI) fixture(method, urlPath string) string {
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	name := strings.TrimSuffix(path.Clean("/"+urlPath), "/")
+	if name == "" {
+		name = "/index"
+	}
+	base := filepath.Join(m.dir, filepath.FromSlash(name))
+	for _, file := range []string{base + "." + strings.ToUpper(method) + ".json", base + ".json"} {
+		if info, err := os.Stat(file); err == nil && info.Mode().IsRegular() {
+			return file
+		}
+	}
+	return ""
+}
+
+// serve はフィクスチャがあれば返して true を返す
+func (m *mockAPI) serve(w http.ResponseWriter, r *http.Request) bool {
+	file := m.fixture(r.Method, r.URL.Path)
+	if file == "" {
+		return false
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		errorf("Error reading fixture %s: %v", file, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return true
+	}
+	debugf("Serving fixture: %s %s -> %s", r.Method, r.URL.Path, file)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(data)
+	return true
+}
@@ -0,0 +1,65 @@
+package spaserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMockAPI(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("backend"))
+	}))
+	defer backend.Close()
+
+	mockDir := t.TempDir()
+	os.MkdirAll(filepath.Join(mockDir, "api", "users"), 0755)
+	os.WriteFile(filepath.Join(mockDir, "api", "users.json"), []byte(`[{"id":1}]`), 0644)
+	os.WriteFile(filepath.Join(mockDir, "api", "users.POST.json"), []byte(`{"id":2}`), 0644)
+	os.WriteFile(filepath.Join(mockDir, "api", "users", "1.json"), []byte(`{"id":1}`), 0644)
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+
+	tests := []struct {
+		name     string
+		proxyURL string
+		method   string
+		path     string
+		expected string
+		status   int
+	}{
+		{"メソッドのないフィクスチャ", "", "GET", "/api/users", `[{"id":1}]`, http.StatusOK},
+		{"メソッドごとのフィクスチャ", "", "POST", "/api/users", `{"id":2}`, http.StatusOK},
+		{"末尾のスラッシュ", "", "GET", "/api/users/", `[{"id":1}]`, http.StatusOK},
+		{"サブパス", "", "DELETE", "/api/users/1", `{"id":1}`, http.StatusOK},
+		{"ディレクトリの外は参照しない", "", "GET", "/api/../../etc/passwd", "", http.StatusNotFound},
+		{"フィクスチャがなくプロキシもない", "", "GET", "/api/posts", "", http.StatusNotFound},
+		{"フィクスチャがなければプロキシする", backend.URL, "GET", "/api/posts", "backend", http.StatusOK},
+		{"フィクスチャはプロキシより優先する", backend.URL, "GET", "/api/users", `[{"id":1}]`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.DistDir = dir
+			cfg.Proxy.URL = tt.proxyURL
+			cfg.Proxy.Paths = []string{"/api"}
+			cfg.Proxy.MockDir = mockDir
+			// パスの正規化に頼らずにディレクトリの外を参照しないことを確認する
+			cfg.NormalizePaths = false
+			s, err := newServer(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+			if rr.Code != tt.status {
+				t.Errorf("期待されるステータスコード %d, 実際のステータスコード %d", tt.status, rr.Code)
+			}
+			if tt.status == http.StatusOK && rr.Body.String() != tt.expected {
+				t.Errorf("期待されるボディ %s, 実際のボディ %s", tt.expected, rr.Body.String())
+			}
+		})
+	}
+}
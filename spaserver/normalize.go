@@ -0,0 +1,59 @@
+package spaserver
+
+import (
+	"net/http"
+	"strings"
+)
+
+// リクエストの正規化
+// ルーティングやパスの照合より前に重複したスラッシュとドットセグメントを取り除き、
+// "//query" や "/static/../query" のようなパスでプロキシパスや制限をすり抜けられないようにする。
+// Content-Length と Transfer-Encoding の両方を持つリクエストと長すぎる URL は拒否する
+
+// normalizeRequest はリクエストを検査してパスを正規化する
+// 拒否した場合はエラーを返して false を返す
+func (s *server) normalizeRequest(w http.ResponseWriter, r *http.Request) bool {
+	if max := s.cfg.Limits.MaxURLBytes; max > 0 && len(r.RequestURI) > max {
+		debugf("URI too long: %s (%d bytes)", metricMethod(r.Method), len(r.RequestURI))
+		http.Error(w, "URI Too Long", http.StatusRequestURITooLong)
+		return false
+	}
+	// Go の HTTP/1.1 サーバーは chunked のリクエストから Content-Length を取り除くため、
+	// 両方が残っているのは他の経路から届いた曖昧なリクエスト
+	if len(r.TransferEncoding) > 0 && len(r.Header.Values("Content-Length")) > 0 {
+		warnf("Bad request: both Content-Length and Transfer-Encoding (RemoteAddr: %s)", r.RemoteAddr)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return false
+	}
+	if s.cfg.NormalizePaths && strings.HasPrefix(r.URL.Path, "/") {
+		r.URL.Path = cleanPath(r.URL.Path)
+		if r.URL.RawPath != "" {
+			// エンコードされたパスが正規化後のパスと一致しなければ URL.EscapedPath が Path から作り直す
+			r.URL.RawPath = cleanPath(r.URL.RawPath)
+		}
+	}
+	return true
+}
+
+// cleanPath は重複したスラッシュと "." ".." のセグメントを取り除く（末尾のスラッシュは残す）
+func cleanPath(p string) string {
+	segments := strings.Split(p, "/")
+	cleaned := make([]string, 0, len(segments))
+	for _, seg := range segments {
+		switch seg {
+		case "", ".":
+		case "..":
+			if len(cleaned) > 0 {
+				cleaned = cleaned[:len(cleaned)-1]
+			}
+		default:
+			cleaned = append(cleaned, seg)
+		}
+	}
+	out := "/" + strings.Join(cleaned, "/")
+	last := segments[len(segments)-1]
+	if len(cleaned) > 0 && (last == "" || last == "." || last == "..") {
+		out += "/"
+	}
+	return out
+}
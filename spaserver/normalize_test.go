@@ -0,0 +1,85 @@
+package spaserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCleanPath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/", "/"},
+		{"//query", "/query"},
+		{"/static/../query", "/query"},
+		{"/./api//items/", "/api/items/"},
+		{"/../../etc/passwd", "/etc/passwd"},
+		{"/api/items/..", "/api/"},
+		{"/a%2Fb/./c", "/a%2Fb/c"},
+	}
+	for _, tt := range tests {
+		if got := cleanPath(tt.path); got != tt.expected {
+			t.Errorf("%s: 期待されるパス %s, 実際のパス %s", tt.path, tt.expected, got)
+		}
+	}
+}
+
+func TestNormalizeRequest(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "backend %s", r.URL.EscapedPath())
+	}))
+	defer backend.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Proxy.URL = backend.URL
+	cfg.Proxy.Paths = []string{"/query"}
+	cfg.Limits.MaxURLBytes = 64
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		name         string
+		path         string
+		expectedCode int
+		expected     string
+	}{
+		{"重複したスラッシュ", "//query", http.StatusOK, "backend /query"},
+		{"ドットセグメント", "/static/../query", http.StatusOK, "backend /query"},
+		{"エンコードされたスラッシュは残す", "/query/a%2Fb//c", http.StatusOK, "backend /query/a%2Fb/c"},
+		{"長すぎる URL", "/" + strings.Repeat("a", 64), http.StatusRequestURITooLong, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+			if rr.Code != tt.expectedCode {
+				t.Errorf("期待されるステータスコード %d, 実際のステータスコード %d", tt.expectedCode, rr.Code)
+			}
+			if tt.expected != "" && rr.Body.String() != tt.expected {
+				t.Errorf("期待されるボディ %s, 実際のボディ %s", tt.expected, rr.Body.String())
+			}
+		})
+	}
+
+	t.Run("Content-Length と Transfer-Encoding の両方", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/query", strings.NewReader("0\r\n\r\n"))
+		req.TransferEncoding = []string{"chunked"}
+		req.Header.Set("Content-Length", "5")
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("期待されるステータスコード %d, 実際のステータスコード %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
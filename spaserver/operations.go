@@ -0,0 +1,195 @@
+package spaserver
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// 運用操作の管理 API
+// 再デプロイせずに、メンテナンスモードの切り替え（/__maintenance）、カナリア版の割合の変更（/__canary）、
+// PROXY_UPSTREAMS のプロキシ先の切り離し（/__upstreams/drain）を行う。
+// 変更はサーバーの状態（serverState）に持つため設定の再読み込みでは消えず、再起動すると設定の値に戻る
+
+const (
+	maintenancePath = "/__maintenance"
+	canaryPath      = "/__canary"
+	upstreamsPath   = "/__upstreams"
+)
+
+// runtimeOperations は管理 API で変更した値（nil の場合は設定の値を使う）
+type runtimeOperations struct {
+	mu            sync.RWMutex
+	maintenanceOn *bool
+	canaryPercent *float64
+	drained       map[string]bool
+}
+
+// maintenance はメンテナンスモードが有効かを返す
+func (o *runtimeOperations) maintenance(configured bool) bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if o.maintenanceOn != nil {
+		return *o.maintenanceOn
+	}
+	return configured
+}
+
+func (o *runtimeOperations) setMaintenance(enabled bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.maintenanceOn = &enabled
+}
+
+// canary はカナリア版を割り当てる新しい訪問者の割合を返す
+func (o *runtimeOperations) canary(configured float64) float64 {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if o.canaryPercent != nil {
+		return *o.canaryPercent
+	}
+	return configured
+}
+
+func (o *runtimeOperations) setCanary(percent float64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.canaryPercent = &percent
+}
+
+// isDrained はプロキシ先が切り離されているかを返す
+func (o *runtimeOperations) isDrained(url string) bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.drained[url]
+}
+
+func (o *runtimeOperations) setDrained(url string, drained bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.drained == nil {
+		o.drained = map[string]bool{}
+	}
+	if drained {
+		o.drained[url] = true
+	} else {
+		delete(o.drained, url)
+	}
+}
+
+// registerOperations は運用操作のエンドポイントを管理用インターフェースに登録する
+// 変更には ADMIN_TOKEN が必要（設定されていない場合は参照だけできる）
+func (s *server) registerOperations(mux *http.ServeMux) {
+	token := s.cfg.Admin.Token
+	mux.HandleFunc(maintenancePath, requireTokenForChanges(token, s.serveMaintenanceAPI))
+	if s.canary != nil {
+		mux.HandleFunc(canaryPath, requireTokenForChanges(token, s.serveCanaryAPI))
+	}
+	if pool, ok := s.upstream.(*upstreamPool); ok {
+		mux.HandleFunc(upstreamsPath, requireTokenForChanges(token, pool.serveUpstreams))
+		mux.HandleFunc(upstreamsPath+"/drain", requireTokenForChanges(token, pool.serveDrain))
+	}
+}
+
+// serveMaintenanceAPI は POST でメンテナンスモードを有効にし、DELETE で無効にする
+func (s *server) serveMaintenanceAPI(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodDelete:
+		enabled := r.Method == http.MethodPost
+		s.state.operations.setMaintenance(enabled)
+		if enabled {
+			warnf("Admin API: maintenance mode enabled")
+		} else {
+			infof("Admin API: maintenance mode disabled")
+		}
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"enabled": s.state.operations.maintenance(s.cfg.Maintenance.Enabled)})
+}
+
+// serveCanaryAPI は POST /__canary?percent=N でカナリア版の割合を変更する
+func (s *server) serveCanaryAPI(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		percent, err := strconv.ParseFloat(r.URL.Query().Get("percent"), 64)
+		if err != nil || percent < 0 || percent > 100 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "percent: must be between 0 and 100"})
+			return
+		}
+		s.state.operations.setCanary(percent)
+		infof("Admin API: canary percentage set to %g", percent)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]float64{"percent": s.state.operations.canary(s.cfg.Canary.Percent)})
+}
+
+// upstreamStatus は管理 API で返すプロキシ先の状態
+type upstreamStatus struct {
+	URL     string `json:"url"`
+	Weight  int    `json:"weight"`
+	Drained bool   `json:"drained"`
+}
+
+func (p *upstreamPool) status() []upstreamStatus {
+	var list []upstreamStatus
+	for _, t := range p.targets {
+		list = append(list, upstreamStatus{URL: t.url, Weight: t.weight, Drained: p.ops.isDrained(t.url)})
+	}
+	return list
+}
+
+// serveUpstreams はプロキシ先の一覧を返す
+func (p *upstreamPool) serveUpstreams(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, p.status())
+}
+
+// serveDrain は POST でプロキシ先を切り離し（新しいリクエストを送らない）、DELETE で戻す
+// 処理中のリクエストはそのまま完了させる
+func (p *upstreamPool) serveDrain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	url := r.URL.Query().Get("url")
+	var target *poolTarget
+	for _, t := range p.targets {
+		if t.url == url {
+			target = t
+		}
+	}
+	if target == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("url: %q is not in PROXY_UPSTREAMS", url)})
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		// すべてのプロキシ先を切り離すことはできない
+		available := 0
+		for _, t := range p.targets {
+			if t != target && t.weight > 0 && !p.ops.isDrained(t.url) {
+				available++
+			}
+		}
+		if available == 0 {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": "cannot drain the last available upstream"})
+			return
+		}
+		p.ops.setDrained(url, true)
+		warnf("Admin API: draining upstream %s", url)
+	} else {
+		p.ops.setDrained(url, false)
+		infof("Admin API: upstream %s back in rotation", url)
+	}
+	writeJSON(w, http.StatusOK, p.status())
+}
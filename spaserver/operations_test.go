@@ -0,0 +1,139 @@
+package spaserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCanaryAPI(t *testing.T) {
+	stableDir, canaryDir := t.TempDir(), t.TempDir()
+	os.WriteFile(filepath.Join(stableDir, "index.html"), []byte("stable"), 0644)
+	os.WriteFile(filepath.Join(canaryDir, "index.html"), []byte("canary"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = stableDir
+	cfg.Canary.Dir = canaryDir
+	cfg.Admin.Token = "secret"
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for path, expected := range map[string]int{
+		canaryPath + "?percent=101": http.StatusBadRequest,
+		canaryPath + "?percent=x":   http.StatusBadRequest,
+		canaryPath + "?percent=100": http.StatusOK,
+	} {
+		r := httptest.NewRequest("POST", path, nil)
+		r.Header.Set("Authorization", "Bearer secret")
+		rr := httptest.NewRecorder()
+		s.admin.ServeHTTP(rr, r)
+		if rr.Code != expected {
+			t.Errorf("%s: 期待されるステータスコード %d, 実際のステータスコード %d", path, expected, rr.Code)
+		}
+	}
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Body.String() != "canary" {
+		t.Errorf("変更した割合でカナリア版を返すべきです: %q", rr.Body.String())
+	}
+}
+
+func TestDrainUpstream(t *testing.T) {
+	newBackend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+	}
+	v1, v2 := newBackend("v1"), newBackend("v2")
+	defer v1.Close()
+	defer v2.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Proxy.Paths = []string{"/api"}
+	cfg.Proxy.Upstreams = []string{v1.URL, v2.URL}
+	cfg.Admin.Token = "secret"
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	admin := func(method, path string) int {
+		r := httptest.NewRequest(method, path, nil)
+		r.Header.Set("Authorization", "Bearer secret")
+		rr := httptest.NewRecorder()
+		s.admin.ServeHTTP(rr, r)
+		return rr.Code
+	}
+	counts := func() map[string]int {
+		counts := map[string]int{}
+		for i := 0; i < 4; i++ {
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, httptest.NewRequest("GET", "/api/items", nil))
+			counts[rr.Body.String()]++
+		}
+		return counts
+	}
+
+	if code := admin("POST", upstreamsPath+"/drain?url="+v1.URL); code != http.StatusOK {
+		t.Fatalf("期待されるステータスコード %d, 実際のステータスコード %d", http.StatusOK, code)
+	}
+	if got := counts(); got["v2"] != 4 {
+		t.Errorf("切り離したプロキシ先に振り分けられています: %v", got)
+	}
+	if code := admin("POST", upstreamsPath+"/drain?url="+v2.URL); code != http.StatusConflict {
+		t.Errorf("最後のプロキシ先: 期待されるステータスコード %d, 実際のステータスコード %d", http.StatusConflict, code)
+	}
+	if code := admin("POST", upstreamsPath+"/drain?url=http://unknown:8080"); code != http.StatusNotFound {
+		t.Errorf("不明なプロキシ先: 期待されるステータスコード %d, 実際のステータスコード %d", http.StatusNotFound, code)
+	}
+
+	admin("DELETE", upstreamsPath+"/drain?url="+v1.URL)
+	if got := counts(); got["v1"] != 2 || got["v2"] != 2 {
+		t.Errorf("戻したプロキシ先に振り分けられていません: %v", got)
+	}
+}
+
+func TestOperationsWithoutAdminToken(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.DistDir = t.TempDir()
+	cfg.Canary.Dir = t.TempDir()
+	cfg.Proxy.Paths = []string{"/api"}
+	cfg.Proxy.Upstreams = []string{"http://127.0.0.1:8081", "http://127.0.0.1:8082"}
+	cfg.Admin.Token = ""
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// ADMIN_TOKEN がない場合は参照だけできる
+	for _, tc := range []struct {
+		method, path string
+		expected     int
+	}{
+		{"GET", maintenancePath, http.StatusOK},
+		{"POST", maintenancePath, http.StatusForbidden},
+		{"DELETE", maintenancePath, http.StatusForbidden},
+		{"GET", canaryPath, http.StatusOK},
+		{"POST", canaryPath + "?percent=100", http.StatusForbidden},
+		{"GET", upstreamsPath, http.StatusOK},
+		{"POST", upstreamsPath + "/drain?url=http://127.0.0.1:8081", http.StatusForbidden},
+	} {
+		rr := httptest.NewRecorder()
+		s.admin.ServeHTTP(rr, httptest.NewRequest(tc.method, tc.path, nil))
+		if rr.Code != tc.expected {
+			t.Errorf("%s %s: 期待されるステータスコード %d, 実際のステータスコード %d", tc.method, tc.path, tc.expected, rr.Code)
+		}
+	}
+	if s.state.operations.maintenance(false) {
+		t.Error("メンテナンスモードが変更されています")
+	}
+}
@@ -0,0 +1,110 @@
+package spaserver
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Plugin はリクエストとレスポンスに処理を追加するプラグイン
+// PLUGINS で読み込む Go プラグインは、このインターフェースを実装した変数 Plugin をエクスポートする
+type Plugin interface {
+	// OnRequest はリクエストの処理前に呼ばれる。レスポンスを書き込んだ場合は false を返して処理を打ち切る
+	OnRequest(w http.ResponseWriter, r *http.Request) bool
+	// OnResponse はレスポンスヘッダーの送信直前に呼ばれ、ヘッダーを変更できる
+	OnResponse(r *http.Request, status int, header http.Header)
+}
+
+// errPluginsUnsupported は Go プラグインを読み込めないバイナリで PLUGINS を指定した場合のエラー
+var errPluginsUnsupported = errors.New("this binary cannot load Go plugins; build spa-server with CGO_ENABLED=1 on Linux, macOS or FreeBSD (make build-cgo or docker build --build-arg CGO_ENABLED=1)")
+
+// WithPlugin はプラグインを追加する（PLUGINS で読み込むプラグインより先に呼ばれる）
+func WithPlugin(plugins ...Plugin) Option {
+	return func(o *options) {
+		o.plugins = append(o.plugins, plugins...)
+	}
+}
+
+// pluginHandler はプラグインの OnRequest と OnResponse を呼ぶ
+type pluginHandler struct {
+	plugins []Plugin
+	next    http.Handler
+}
+
+// wrapPlugins はプラグインがない場合は next をそのまま返す
+func wrapPlugins(plugins []Plugin, next http.Handler) http.Handler {
+	if len(plugins) == 0 {
+		return next
+	}
+	return &pluginHandler{plugins: plugins, next: next}
+}
+
+func (h *pluginHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, p := range h.plugins {
+		if !p.OnRequest(w, r) {
+			return
+		}
+	}
+	pw := &pluginResponseWriter{ResponseWriter: w, plugins: h.plugins, r: r}
+	h.next.ServeHTTP(pw, r)
+	// 何も書き込まれなかった場合も OnResponse を呼ぶ
+	if !pw.wroteHeader && !pw.hijacked {
+		pw.WriteHeader(http.StatusOK)
+	}
+}
+
+// pluginResponseWriter はレスポンスヘッダーの送信前にプラグインの OnResponse を呼ぶ
+type pluginResponseWriter struct {
+	http.ResponseWriter
+	plugins     []Plugin
+	r           *http.Request
+	wroteHeader bool
+	hijacked    bool
+}
+
+func (pw *pluginResponseWriter) WriteHeader(status int) {
+	if !pw.wroteHeader && status >= 200 {
+		pw.wroteHeader = true
+		for _, p := range pw.plugins {
+			p.OnResponse(pw.r, status, pw.Header())
+		}
+	}
+	pw.ResponseWriter.WriteHeader(status)
+}
+
+func (pw *pluginResponseWriter) Write(b []byte) (int, error) {
+	if !pw.wroteHeader {
+		pw.WriteHeader(http.StatusOK)
+	}
+	return pw.ResponseWriter.Write(b)
+}
+
+// Flush はストリーミングレスポンスのために元の ResponseWriter の Flush を呼ぶ
+func (pw *pluginResponseWriter) Flush() {
+	if !pw.wroteHeader {
+		pw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := pw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack は WebSocket などのプロトコル切り替えのために接続を引き渡す
+func (pw *pluginResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := pw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("hijack not supported")
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		pw.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap は http.ResponseController から元の ResponseWriter を参照できるようにする
+func (pw *pluginResponseWriter) Unwrap() http.ResponseWriter {
+	return pw.ResponseWriter
+}
@@ -0,0 +1,30 @@
+//go:build cgo && (linux || darwin || freebsd)
+
+package spaserver
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// pluginsSupported は PLUGINS で Go プラグインを読み込めるかどうか
+const pluginsSupported = true
+
+// loadPlugin は Go プラグイン（-buildmode=plugin でビルドした .so）を読み込む
+func loadPlugin(path string) (Plugin, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup("Plugin")
+	if err != nil {
+		return nil, err
+	}
+	switch v := sym.(type) {
+	case Plugin:
+		return v, nil
+	case *Plugin:
+		return *v, nil
+	}
+	return nil, fmt.Errorf("%s: Plugin (%T) does not implement spaserver.Plugin", path, sym)
+}
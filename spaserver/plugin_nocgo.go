@@ -0,0 +1,10 @@
+//go:build !cgo || !(linux || darwin || freebsd)
+
+package spaserver
+
+// cgo を無効にしてビルドした場合（make build や Docker イメージの既定）と Linux・macOS・FreeBSD 以外では Go プラグインを読み込めない
+const pluginsSupported = false
+
+func loadPlugin(path string) (Plugin, error) {
+	return nil, errPluginsUnsupported
+}
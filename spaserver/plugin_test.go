@@ -0,0 +1,100 @@
+package spaserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tokenPlugin は X-Token ヘッダーのないリクエストを拒否し、レスポンスにヘッダーを追加する
+type tokenPlugin struct{}
+
+func (tokenPlugin) OnRequest(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("X-Token") != "secret" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func (tokenPlugin) OnResponse(r *http.Request, status int, header http.Header) {
+	header.Set("X-Plugin-Status", http.StatusText(status))
+}
+
+func TestWithPlugin(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	handler, err := New(cfg, WithPlugin(tokenPlugin{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handler.Close()
+
+	tests := []struct {
+		name           string
+		path           string
+		token          string
+		expectedStatus int
+		expectedHeader string
+	}{
+		{"トークンあり", "/users/1", "secret", http.StatusOK, "OK"},
+		{"存在しないファイル", "/missing.js", "secret", http.StatusOK, "OK"},
+		{"トークンなし", "/users/1", "", http.StatusUnauthorized, ""},
+		{"ヘルスチェックは対象外", "/healthz", "", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("X-Token", tt.token)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("期待されるステータスコード %d, 実際のステータスコード %d", tt.expectedStatus, rr.Code)
+			}
+			if got := rr.Header().Get("X-Plugin-Status"); got != tt.expectedHeader {
+				t.Errorf("期待されるヘッダー %q, 実際のヘッダー %q", tt.expectedHeader, got)
+			}
+		})
+	}
+}
+
+func TestLoadPluginError(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.so")
+	os.WriteFile(invalid, []byte("not a plugin"), 0644)
+
+	for _, path := range []string{filepath.Join(dir, "missing.so"), invalid} {
+		if _, err := loadPlugin(path); err == nil {
+			t.Errorf("%s: エラーになる必要があります", path)
+		}
+	}
+
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Plugins = []string{invalid}
+	if _, err := newServer(cfg); err == nil {
+		t.Error("読み込めないプラグインでエラーになる必要があります")
+	}
+}
+
+func TestValidatePluginsUnsupported(t *testing.T) {
+	if pluginsSupported {
+		t.Skip("Go プラグインを読み込めるバイナリでは確認しない（CGO_ENABLED=0 で実行する）")
+	}
+	cfg := testConfig(t)
+	cfg.Plugins = []string{"a.so", "b.so"}
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("cgo を無効にしたバイナリで PLUGINS を指定した場合はエラーになる必要があります")
+	}
+	if got := strings.Count(err.Error(), "PLUGINS:"); got != 1 {
+		t.Errorf("PLUGINS のエラーを1回だけ返す必要があります: %v", err)
+	}
+}
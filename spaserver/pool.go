@@ -0,0 +1,168 @@
+package spaserver
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// upstreamPool は重みに応じてリクエストを複数のプロキシ先に振り分ける
+// 重みの比率を保ちつつ同じプロキシ先が連続しにくいよう、重み付きラウンドロビン（nginx 方式）で選ぶ
+type upstreamPool struct {
+	targets []*poolTarget
+	// 同じクライアントを同じプロキシ先に固定するクッキー（空の場合は固定しない）
+	cookie string
+	// 管理 API で切り離したプロキシ先
+	ops *runtimeOperations
+
+	mu sync.Mutex
+}
+
+// poolTarget は振り分け先のプロキシ先と重み
+type poolTarget struct {
+	proxyTarget
+	// クッキーに保存する識別子（設定の順番を変えても変わらないよう URL から作る）
+	id      string
+	weight  int
+	current int
+}
+
+// poolEntry は PROXY_UPSTREAMS の項目
+type poolEntry struct {
+	url    string
+	weight int
+}
+
+// parseUpstreams は "URL[=重み]" の一覧を解析する（重みの省略時は 1）
+func parseUpstreams(entries []string) ([]poolEntry, error) {
+	var pool []poolEntry
+	total := 0
+	for _, entry := range entries {
+		e := poolEntry{url: entry, weight: 1}
+		if i := strings.LastIndexByte(entry, '='); i >= 0 {
+			weight, err := strconv.Atoi(entry[i+1:])
+			if err != nil || weight < 0 {
+				return nil, fmt.Errorf("invalid weight in %q (use URL=weight)", entry)
+			}
+			e.url, e.weight = entry[:i], weight
+		}
+		if err := checkProxyURL(e.url); err != nil {
+			return nil, err
+		}
+		pool = append(pool, e)
+		total += e.weight
+	}
+	if len(pool) > 0 && total == 0 {
+		return nil, fmt.Errorf("at least one upstream must have a positive weight")
+	}
+	return pool, nil
+}
+
+// newUpstreamPool は PROXY_UPSTREAMS からプロキシ先の集合を作成する
+func (s *server) newUpstreamPool(entries []string) (*upstreamPool, error) {
+	parsed, err := parseUpstreams(entries)
+	if err != nil {
+		return nil, err
+	}
+	pool := &upstreamPool{cookie: s.cfg.Proxy.AffinityCookie, ops: s.state.operations}
+	for _, e := range parsed {
+		handler, err := s.upstreamFor(e.url)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", e.url, err)
+		}
+		h := fnv.New32a()
+		h.Write([]byte(e.url))
+		pool.targets = append(pool.targets, &poolTarget{
+			proxyTarget: proxyTarget{url: e.url, handler: handler},
+			id:          hex.EncodeToString(h.Sum(nil)),
+			weight:      e.weight,
+		})
+	}
+	return pool, nil
+}
+
+// pick はリクエストのプロキシ先を選ぶ
+// クッキーで固定されたプロキシ先があればそれを使い、なければ選んだプロキシ先をクッキーで固定する
+func (p *upstreamPool) pick(w http.ResponseWriter, r *http.Request) proxyTarget {
+	if p.cookie == "" {
+		return p.next().proxyTarget
+	}
+	if cookie, err := r.Cookie(p.cookie); err == nil {
+		for _, t := range p.targets {
+			// 重みを 0 にしたプロキシ先と管理 API で切り離したプロキシ先からは外す
+			if t.id == cookie.Value && t.weight > 0 && !p.ops.isDrained(t.url) {
+				return t.proxyTarget
+			}
+		}
+	}
+	t := p.next()
+	http.SetCookie(w, &http.Cookie{
+		Name:     p.cookie,
+		Value:    t.id,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return t.proxyTarget
+}
+
+// alternate はヘッジリクエストを送る、target 以外のプロキシ先を選ぶ
+// クッキーで固定している場合やほかに候補がない場合は target をそのまま返す
+func (p *upstreamPool) alternate(target proxyTarget) proxyTarget {
+	if p.cookie != "" {
+		return target
+	}
+	for range p.targets {
+		if t := p.next(); t.url != target.url {
+			return t.proxyTarget
+		}
+	}
+	return target
+}
+
+// weights は管理 API で切り離したプロキシ先の重みを 0 にした重みを返す
+// 設定の再読み込みなどで残りのプロキシ先がすべて切り離されている場合は、切り離しを無視する
+func (p *upstreamPool) weights() []int {
+	weights := make([]int, len(p.targets))
+	total := 0
+	for i, t := range p.targets {
+		if !p.ops.isDrained(t.url) {
+			weights[i] = t.weight
+			total += t.weight
+		}
+	}
+	if total == 0 {
+		for i, t := range p.targets {
+			weights[i] = t.weight
+		}
+	}
+	return weights
+}
+
+// next は重み付きラウンドロビンで次のプロキシ先を選ぶ
+func (p *upstreamPool) next() *poolTarget {
+	weights := p.weights()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var best *poolTarget
+	total := 0
+	for i, t := range p.targets {
+		t.current += weights[i]
+		total += weights[i]
+		if best == nil || t.current > best.current {
+			best = t
+		}
+	}
+	best.current -= total
+	return best
+}
+
+// ServeHTTP は選んだプロキシ先にリクエストを渡す
+// 通常は serveProxy がプロキシ先を選んでから呼ぶので、ここを通るのは直接呼ばれた場合のみ
+func (p *upstreamPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.pick(w, r).handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,120 @@
+package spaserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestUpstreamPool(t *testing.T) {
+	newBackend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+	}
+	v1, v2 := newBackend("v1"), newBackend("v2")
+	defer v1.Close()
+	defer v2.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Proxy.Paths = []string{"/api"}
+	cfg.Proxy.Upstreams = []string{v1.URL + "=3", v2.URL + "=1"}
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	counts := map[string]int{}
+	for i := 0; i < 8; i++ {
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, httptest.NewRequest("GET", "/api/items", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("期待されるステータスコード %d, 実際のステータスコード %d", http.StatusOK, rr.Code)
+		}
+		counts[rr.Body.String()]++
+	}
+	if counts["v1"] != 6 || counts["v2"] != 2 {
+		t.Errorf("重みの比率で振り分けられていません: %v", counts)
+	}
+}
+
+func TestParseUpstreams(t *testing.T) {
+	pool, err := parseUpstreams([]string{"http://api-v1:8080=90", "http://api-v2:8080=0", "http://api-v3:8080"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pool) != 3 || pool[0].url != "http://api-v1:8080" || pool[0].weight != 90 || pool[1].weight != 0 || pool[2].weight != 1 {
+		t.Errorf("解析結果が正しくありません: %+v", pool)
+	}
+	for _, entries := range [][]string{
+		{"http://api:8080=-1"},
+		{"http://api:8080=ten"},
+		{"api:8080=10"},
+		{"http://api-v1:8080=0", "http://api-v2:8080=0"},
+	} {
+		if _, err := parseUpstreams(entries); err == nil {
+			t.Errorf("%q はエラーになるべきです", entries)
+		}
+	}
+}
+
+func TestUpstreamPoolAffinityCookie(t *testing.T) {
+	newBackend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+	}
+	v1, v2 := newBackend("v1"), newBackend("v2")
+	defer v1.Close()
+	defer v2.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Proxy.Paths = []string{"/api"}
+	cfg.Proxy.Upstreams = []string{v1.URL, v2.URL}
+	cfg.Proxy.AffinityCookie = "spa_upstream"
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// 最初のリクエストでプロキシ先を固定するクッキーが設定される
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest("GET", "/api/items", nil))
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "spa_upstream" {
+		t.Fatalf("クッキーが設定されていません: %v", cookies)
+	}
+	first := rr.Body.String()
+
+	// クッキーがあれば常に同じプロキシ先に振り分けられる
+	for i := 0; i < 4; i++ {
+		req := httptest.NewRequest("GET", "/api/items", nil)
+		req.AddCookie(cookies[0])
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, req)
+		if rr.Body.String() != first {
+			t.Errorf("期待されるプロキシ先 %s, 実際のプロキシ先 %s", first, rr.Body.String())
+		}
+		if len(rr.Result().Cookies()) != 0 {
+			t.Error("固定済みのクライアントにクッキーを設定し直すべきではありません")
+		}
+	}
+
+	// 知らない値のクッキーは選び直す
+	req := httptest.NewRequest("GET", "/api/items", nil)
+	req.AddCookie(&http.Cookie{Name: "spa_upstream", Value: "unknown"})
+	rr = httptest.NewRecorder()
+	s.ServeHTTP(rr, req)
+	if len(rr.Result().Cookies()) != 1 {
+		t.Error("不明なクッキーの場合はプロキシ先を選び直すべきです")
+	}
+}
@@ -0,0 +1,150 @@
+package spaserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// 起動時の事前確認
+// PREFLIGHT（既定で有効）の場合、リスナーを開く前に設定の検証（TLS 証明書の読み込みやパスのパターンを含む）に加えて、
+// index.html が読めて HTML として解析できることを確認し、問題をすべてまとめて表示して終了する。
+// 最初のリクエストで初めて設定の誤りに気付くことがないようにする。プロキシ先のホスト名の名前解決は、
+// 後から起動するサービスや一時的な DNS の障害で失敗することがあるため、警告を表示するだけで終了しない
+
+// preflightTimeout はプロキシ先の名前解決を待つ時間
+const preflightTimeout = 5 * time.Second
+
+// preflightLookupHost と preflightLookupSRV はプロキシ先の名前解決（テストで差し替える）
+var (
+	preflightLookupHost = net.DefaultResolver.LookupHost
+	preflightLookupSRV  = net.DefaultResolver.LookupSRV
+)
+
+// preflight は起動時の確認を行い、プロキシ先の名前解決の警告と、その他の問題をすべてまとめたエラーを返す
+// 配信ディレクトリを DIST_DIR_WAIT で待つ場合（waitingForDist）は配信ディレクトリの確認を省く
+func preflight(cfg Config, waitingForDist bool) (warnings []error, err error) {
+	var errs []error
+	distChecked := !waitingForDist
+	if err := cfg.Validate(); err != nil {
+		for _, err := range unwrapErrors(err) {
+			if isDistError(err) {
+				// 配信ディレクトリがない場合は index.html を確認しない
+				distChecked = false
+				if waitingForDist {
+					continue
+				}
+			}
+			errs = append(errs, err)
+		}
+	}
+	if distChecked {
+		for _, dir := range []string{servedDir(cfg), cfg.Canary.Dir} {
+			if dir == "" {
+				continue
+			}
+			if err := checkIndexHTML(filepath.Join(dir, "index.html")); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+	defer cancel()
+	if err := resolveUpstream(ctx, cfg.Proxy.URL); err != nil {
+		warnings = append(warnings, fmt.Errorf("PROXY_URL: %v", err))
+	}
+	if err := resolveUpstream(ctx, cfg.GRPC.URL); err != nil {
+		warnings = append(warnings, fmt.Errorf("GRPC_URL: %v", err))
+	}
+	if pool, err := parseUpstreams(cfg.Proxy.Upstreams); err == nil {
+		for _, e := range pool {
+			if err := resolveUpstream(ctx, e.url); err != nil {
+				warnings = append(warnings, fmt.Errorf("PROXY_UPSTREAMS: %v", err))
+			}
+		}
+	}
+	return warnings, errors.Join(errs...)
+}
+
+// unwrapErrors は errors.Join でまとめたエラーを1つずつに分ける
+func unwrapErrors(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
+
+// isDistError は配信ディレクトリについての検証エラーかを返す
+func isDistError(err error) bool {
+	msg := err.Error()
+	return strings.HasPrefix(msg, "DIST_DIR:") || strings.HasPrefix(msg, "RELEASES_DIR:")
+}
+
+// servedDir は起動時に配信するディレクトリを返す（RELEASES_DIR の場合は最新のリリース）
+func servedDir(cfg Config) string {
+	if cfg.Releases.Dir == "" {
+		return cfg.DistDir
+	}
+	releases, err := listReleases(cfg.Releases.Dir)
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(cfg.Releases.Dir, releases[len(releases)-1].ID)
+}
+
+// checkIndexHTML は index.html が読めて、空でない HTML として解析できることを確認する
+func checkIndexHTML(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("index.html: %v", err)
+	}
+	switch {
+	case len(bytes.TrimSpace(data)) == 0:
+		return fmt.Errorf("index.html: %s is empty", path)
+	case !utf8.Valid(data):
+		return fmt.Errorf("index.html: %s is not valid UTF-8", path)
+	}
+	if _, err := html.Parse(bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("index.html: parsing %s: %v", path, err)
+	}
+	return nil
+}
+
+// resolveUpstream はプロキシ先のホスト名を名前解決できることを確認する
+// IP アドレスと、Consul・Kubernetes で探すプロキシ先（起動時にまだ登録されていないことがある）は確認しない
+func resolveUpstream(ctx context.Context, raw string) error {
+	if raw == "" {
+		return nil
+	}
+	kind, rest := splitDiscoveryScheme(raw)
+	u, err := url.Parse(rest)
+	if err != nil {
+		// URL の誤りは設定の検証で報告する
+		return nil
+	}
+	host := u.Hostname()
+	switch {
+	case host == "" || net.ParseIP(host) != nil:
+		return nil
+	case kind == "srv":
+		if _, _, err := preflightLookupSRV(ctx, "", "", host); err != nil {
+			return fmt.Errorf("resolving SRV record %s: %v", host, err)
+		}
+	case kind == "":
+		if _, err := preflightLookupHost(ctx, host); err != nil {
+			return fmt.Errorf("resolving %s: %v", host, err)
+		}
+	}
+	return nil
+}
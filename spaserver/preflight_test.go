@@ -0,0 +1,124 @@
+package spaserver
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPreflight(t *testing.T) {
+	defer func(lookup func(context.Context, string) ([]string, error)) { preflightLookupHost = lookup }(preflightLookupHost)
+	preflightLookupHost = func(ctx context.Context, host string) ([]string, error) {
+		if host == "backend" {
+			return []string{"10.0.0.2"}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("<!doctype html><div id=app></div>"), 0644)
+	empty := t.TempDir()
+	os.WriteFile(filepath.Join(empty, "index.html"), []byte("\n"), 0644)
+
+	tests := []struct {
+		name           string
+		modify         func(cfg *Config)
+		waitingForDist bool
+		expectedErr    []string
+		// 名前解決の失敗は警告にとどめる
+		expectedWarnings []string
+	}{
+		{
+			name:   "問題がない場合はエラーにならない",
+			modify: func(cfg *Config) {},
+		},
+		{
+			name: "IP アドレスのプロキシ先は名前解決しない",
+			modify: func(cfg *Config) {
+				cfg.Proxy.URL = "http://127.0.0.1:8081"
+			},
+		},
+		{
+			name: "空の index.html はエラー、名前解決できないプロキシ先は警告になる",
+			modify: func(cfg *Config) {
+				cfg.DistDir = empty
+				cfg.Proxy.URL = "http://api.internal:8081"
+				cfg.GRPC.URL = "http://grpc.internal:9090"
+			},
+			expectedErr:      []string{"index.html"},
+			expectedWarnings: []string{"PROXY_URL", "api.internal", "GRPC_URL", "grpc.internal"},
+		},
+		{
+			name: "名前解決できないプロキシ先だけの場合は起動できる",
+			modify: func(cfg *Config) {
+				cfg.Proxy.URL = "http://api.internal:8081"
+			},
+			expectedWarnings: []string{"PROXY_URL", "api.internal"},
+		},
+		{
+			name: "重み付きのプロキシ先も名前解決する",
+			modify: func(cfg *Config) {
+				cfg.Proxy.URL = ""
+				cfg.Proxy.Upstreams = []string{"http://backend:8080=90", "http://api-v2:8080=10"}
+			},
+			expectedWarnings: []string{"PROXY_UPSTREAMS", "api-v2"},
+		},
+		{
+			name: "TLS 証明書を読み込めない場合はエラーになる",
+			modify: func(cfg *Config) {
+				cfg.TLS.CertFile = filepath.Join(dir, "missing.crt")
+				cfg.TLS.KeyFile = filepath.Join(dir, "missing.key")
+			},
+			expectedErr: []string{"TLS"},
+		},
+		{
+			name: "DIST_DIR_WAIT で待つ場合は配信ディレクトリを確認しない",
+			modify: func(cfg *Config) {
+				cfg.DistDir = filepath.Join(dir, "missing")
+				cfg.DistWait = time.Minute
+			},
+			waitingForDist: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.DistDir = dir
+			cfg.Proxy.URL = "http://backend:8081"
+			tt.modify(&cfg)
+
+			warnings, err := preflight(cfg, tt.waitingForDist)
+			joined := errors.Join(warnings...)
+			if len(tt.expectedWarnings) == 0 && joined != nil {
+				t.Errorf("警告になるべきではありません: %v", joined)
+			}
+			for _, expected := range tt.expectedWarnings {
+				if joined == nil || !strings.Contains(joined.Error(), expected) {
+					t.Errorf("警告に %q が含まれていません: %v", expected, joined)
+				}
+			}
+			if err != nil && strings.Contains(err.Error(), "resolving") {
+				t.Errorf("名前解決の失敗はエラーにするべきではありません: %v", err)
+			}
+			if len(tt.expectedErr) == 0 {
+				if err != nil {
+					t.Errorf("エラーになるべきではありません: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("エラーになるべきです")
+			}
+			for _, expected := range tt.expectedErr {
+				if !strings.Contains(err.Error(), expected) {
+					t.Errorf("エラーに %q が含まれていません: %v", expected, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package spaserver
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// Link ヘッダーによるプリロード
+// index.html のエントリーの script と stylesheet を解析し、index.html のレスポンスに
+// Link: </assets/index.js>; rel=modulepreload のようなヘッダーを付けて、HTML の解析前に取得を始めさせる
+
+// preloader は index.html から求めた Link ヘッダーの値をファイルの更新日時ごとにキャッシュする
+type preloader struct {
+	// ASSET_MANIFEST が設定されている場合はマニフェストのエントリーを使う
+	manifest *manifestLoader
+
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	cached  []string
+}
+
+// links は index.html のプリロードする Link ヘッダーの値を返す
+func (p *preloader) links(indexPath string) []string {
+	if p.manifest != nil {
+		if m := p.manifest.load(filepath.Dir(indexPath)); m != nil {
+			return m.preloadLinks()
+		}
+	}
+	info, err := os.Stat(indexPath)
+	if err != nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.path == indexPath && p.modTime.Equal(info.ModTime()) {
+		return p.cached
+	}
+	f, err := os.Open(indexPath)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	p.path, p.modTime, p.cached = indexPath, info.ModTime(), parsePreloadLinks(f)
+	debugf("Preload links for %s: %v", indexPath, p.cached)
+	return p.cached
+}
+
+// setHeader は index.html のレスポンスに Link ヘッダーを追加する（追加した場合は true を返す）
+func (p *preloader) setHeader(h http.Header, indexPath string) bool {
+	links := p.links(indexPath)
+	if len(links) == 0 {
+		return false
+	}
+	h.Add("Link", strings.Join(links, ", "))
+	return true
+}
+
+// preloadIndex は index.html のレスポンスに Link ヘッダーを付け、EARLY_HINTS が有効な場合は同じヘッダーで 103 Early Hints を送る
+// 1xx の中間レスポンスを正しく扱えない古いクライアントやプロキシがあるため、Early Hints は HTTP/2 と TLS の接続に限る
+func (s *server) preloadIndex(w http.ResponseWriter, r *http.Request, indexPath string) {
+	if s.preload == nil || !s.preload.setHeader(w.Header(), indexPath) {
+		return
+	}
+	if s.cfg.EarlyHints && (r.ProtoMajor >= 2 || r.TLS != nil) {
+		w.WriteHeader(http.StatusEarlyHints)
+	}
+}
+
+// parsePreloadLinks は HTML の script と stylesheet から Link ヘッダーの値を作る
+// 他のオリジンのファイルと相対パスは対象外
+func parsePreloadLinks(r io.Reader) []string {
+	var links []string
+	z := html.NewTokenizer(r)
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return links
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		name, hasAttr := z.TagName()
+		attrs := map[string]string{}
+		for hasAttr {
+			var key, val []byte
+			key, val, hasAttr = z.TagAttr()
+			attrs[string(key)] = string(val)
+		}
+		var url, params string
+		switch string(name) {
+		case "script":
+			url = attrs["src"]
+			if attrs["type"] == "module" {
+				params = "rel=modulepreload"
+			} else {
+				params = "rel=preload; as=script"
+			}
+		case "link":
+			url = attrs["href"]
+			switch strings.ToLower(attrs["rel"]) {
+			case "stylesheet":
+				params = "rel=preload; as=style"
+			case "modulepreload":
+				params = "rel=modulepreload"
+			default:
+				continue
+			}
+		default:
+			continue
+		}
+		if !strings.HasPrefix(url, "/") || strings.HasPrefix(url, "//") || strings.ContainsAny(url, "<>, ") {
+			continue
+		}
+		if _, ok := attrs["crossorigin"]; ok {
+			params += "; crossorigin"
+		}
+		link := "<" + url + ">; " + params
+		if !slices.Contains(links, link) {
+			links = append(links, link)
+		}
+	}
+}
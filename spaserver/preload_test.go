@@ -0,0 +1,131 @@
+package spaserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParsePreloadLinks(t *testing.T) {
+	page := `<!doctype html>
+<html>
+<head>
+  <script type="module" crossorigin src="/assets/index-abc.js"></script>
+  <link rel="modulepreload" href="/assets/vendor-def.js">
+  <link rel="stylesheet" href="/assets/index-123.css">
+  <link rel="icon" href="/favicon.ico">
+  <link rel="stylesheet" href="https://fonts.example.com/css">
+  <script src="/legacy.js"></script>
+  <script src="relative.js"></script>
+</head>
+<body><div id="app"></div></body>
+</html>`
+	expected := []string{
+		"</assets/index-abc.js>; rel=modulepreload; crossorigin",
+		"</assets/vendor-def.js>; rel=modulepreload",
+		"</assets/index-123.css>; rel=preload; as=style",
+		"</legacy.js>; rel=preload; as=script",
+	}
+	links := parsePreloadLinks(strings.NewReader(page))
+	if strings.Join(links, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("期待される Link %v, 実際の Link %v", expected, links)
+	}
+}
+
+func TestPreloadLinks(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte(`<script type="module" src="/assets/app.js"></script>`), 0644)
+	os.WriteFile(filepath.Join(dir, "app.css"), []byte("body{}"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.PreloadLinks = true
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{"ルート", "/", "</assets/app.js>; rel=modulepreload"},
+		{"index.html へのフォールバック", "/users/1", "</assets/app.js>; rel=modulepreload"},
+		{"静的ファイルには付けない", "/app.css", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+			if got := rr.Header().Get("Link"); got != tt.expected {
+				t.Errorf("期待される Link %q, 実際の Link %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestEarlyHints(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte(`<script type="module" src="/assets/app.js"></script>`), 0644)
+
+	for _, tls := range []bool{true, false} {
+		t.Run(fmt.Sprintf("TLS=%v", tls), func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.DistDir = dir
+			cfg.PreloadLinks = true
+			cfg.EarlyHints = true
+			s, err := newServer(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			var ts *httptest.Server
+			if tls {
+				ts = httptest.NewTLSServer(s)
+			} else {
+				ts = httptest.NewServer(s)
+			}
+			defer ts.Close()
+
+			var hints []string
+			trace := &httptrace.ClientTrace{
+				Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+					if code == http.StatusEarlyHints {
+						hints = append(hints, header.Get("Link"))
+					}
+					return nil
+				},
+			}
+			req, _ := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), "GET", ts.URL+"/users/1", nil)
+			resp, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("期待されるステータスコード %d, 実際のステータスコード %d", http.StatusOK, resp.StatusCode)
+			}
+			expected := 0
+			if tls {
+				expected = 1
+			}
+			if len(hints) != expected {
+				t.Fatalf("期待される Early Hints の数 %d, 実際の数 %d", expected, len(hints))
+			}
+			if tls && hints[0] != "</assets/app.js>; rel=modulepreload" {
+				t.Errorf("期待される Link </assets/app.js>; rel=modulepreload, 実際の Link %q", hints[0])
+			}
+			if got := resp.Header.Get("Link"); got != "</assets/app.js>; rel=modulepreload" {
+				t.Errorf("最終レスポンスに Link がありません: %q", got)
+			}
+		})
+	}
+}
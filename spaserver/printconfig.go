@@ -0,0 +1,70 @@
+package spaserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "REDACTED"
+
+// redact は secret タグの付いた項目と URL に含まれるパスワードを伏せた設定を返す
+func (c Config) redact() Config {
+	// スライスを共有しないようにコピーする
+	var out Config
+	data, _ := yaml.Marshal(c)
+	yaml.Unmarshal(data, &out)
+
+	walkFields(reflect.ValueOf(&out).Elem(), func(field reflect.Value, tag reflect.StructTag) {
+		if field.Kind() != reflect.String || field.String() == "" {
+			return
+		}
+		if tag.Get("secret") == "true" {
+			field.SetString(redacted)
+			return
+		}
+		if u, err := url.Parse(field.String()); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), redacted)
+				field.SetString(u.String())
+			}
+		}
+	})
+	return out
+}
+
+// formatConfig は秘密情報を伏せた設定を YAML または JSON で出力する
+func formatConfig(c Config, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.redact()); err != nil {
+		return nil, err
+	}
+	data := buf.Bytes()
+	switch format {
+	case "yaml", "":
+		return data, nil
+	case "json":
+		var v interface{}
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+		return json.MarshalIndent(v, "", "  ")
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// compactJSON はログ出力用に JSON を1行にする
+func compactJSON(data []byte) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return string(data)
+	}
+	return buf.String()
+}
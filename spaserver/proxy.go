@@ -0,0 +1,193 @@
+package spaserver
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// newProxy はプロキシ先URLからリバースプロキシを作成する
+// srv+http:// などの場合の接続先は upstreamResolver がサービスディスカバリーで決める
+// protocol はプロキシ先との通信方法（PROXY_PROTOCOL）、trusted は転送ヘッダーを引き継ぐ接続元（PROXY_TRUSTED_PROXIES）
+// エラーとプロキシ先への接続数は m に記録する
+func newProxy(proxyURL, protocol string, trusted []*net.IPNet, m *serverMetrics) (*httputil.ReverseProxy, error) {
+	target, err := url.Parse(stripDiscoveryScheme(proxyURL))
+	if err != nil {
+		return nil, err
+	}
+	proxy := &httputil.ReverseProxy{
+		// 接続ごとのヘッダー（Connection で指定されたものを含む）は ReverseProxy が往復とも取り除く
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			// Host ヘッダーはクライアントが送ったものをそのまま渡す
+			pr.Out.Host = pr.In.Host
+			setForwarded(pr, trusted)
+		},
+		Transport: newProxyTransport(protocol, m),
+	}
+	// エラーハンドラーを設定
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		// ヘッジリクエストで負けて取り消した試行
+		if isLostHedge(r.Context()) {
+			return
+		}
+		if isBodyTooLarge(err) {
+			http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if isProxyTimeout(r.Context(), err) {
+			warnf("Proxy timeout: %s %s", r.Method, r.URL.Path)
+			m.proxyErrors.Add(1)
+			recordProxyError(r.Context(), err)
+			http.Error(w, "Gateway Timeout", http.StatusGatewayTimeout)
+			return
+		}
+		errorf("Proxy error: %v", err)
+		m.proxyErrors.Add(1)
+		recordProxyError(r.Context(), err)
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+	}
+	return proxy, nil
+}
+
+// プロキシ先との通信方法
+const (
+	// https は ALPN で HTTP/2 を使い、http は HTTP/1.1 を使う
+	protocolAuto = "auto"
+	// http も HTTP/2（h2c）を使う
+	protocolH2C = "h2c"
+	// 常に HTTP/1.1 を使う
+	protocolHTTP1 = "http1"
+)
+
+// upstreamTransport はプロキシ先へのトランスポート
+// h2c の場合は http のリクエストを HTTP/2 のトランスポートで送る
+type upstreamTransport struct {
+	*http.Transport
+	h2c *http2.Transport
+}
+
+// newProxyTransport はプロキシ先への接続数を m に記録するトランスポートを作成する
+func newProxyTransport(protocol string, m *serverMetrics) *upstreamTransport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		m.proxyConns.Add(1)
+		return &countedConn{Conn: conn, metrics: m}, nil
+	}
+	t := &upstreamTransport{Transport: transport}
+	switch protocol {
+	case protocolH2C:
+		t.h2c = &http2.Transport{
+			AllowHTTP: true,
+			// TLS を使わずに接続する（DialContext は名前解決の設定後のものを使う）
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return t.Transport.DialContext(ctx, network, addr)
+			},
+		}
+	case protocolHTTP1:
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return t
+}
+
+// configurePool はプロキシ先への接続の再利用の設定を反映する
+func (t *upstreamTransport) configurePool(cfg ProxyConfig) {
+	t.MaxIdleConns = cfg.MaxIdleConns
+	t.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	t.MaxConnsPerHost = cfg.MaxConnsPerHost
+	t.IdleConnTimeout = cfg.IdleConnTimeout
+	if t.h2c != nil {
+		t.h2c.IdleConnTimeout = cfg.IdleConnTimeout
+	}
+}
+
+// RoundTrip は h2c の場合、プロトコルの切り替え（WebSocket など）以外の http のリクエストを HTTP/2 で送る
+func (t *upstreamTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if t.h2c != nil && r.URL.Scheme == "http" && r.Header.Get("Upgrade") == "" {
+		return t.h2c.RoundTrip(r)
+	}
+	return t.Transport.RoundTrip(r)
+}
+
+// CloseIdleConnections はアイドル接続を閉じる
+func (t *upstreamTransport) CloseIdleConnections() {
+	t.Transport.CloseIdleConnections()
+	if t.h2c != nil {
+		t.h2c.CloseIdleConnections()
+	}
+}
+
+// countedConn は Close 時に接続数を減らす
+type countedConn struct {
+	net.Conn
+	metrics *serverMetrics
+	once    sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() { c.metrics.proxyConns.Add(-1) })
+	return c.Conn.Close()
+}
+
+// matchProxyPath はパスがプロキシ対象のパターンに一致するかを判定する
+func matchProxyPath(paths []string, path string) bool {
+	for _, pattern := range paths {
+		// 正規表現パターンのチェック
+		if strings.HasPrefix(pattern, "^") {
+			if re := compilePathRegexp(pattern); re != nil && re.MatchString(path) {
+				return true
+			}
+			continue
+		}
+		// ワイルドカードパターンのチェック
+		if strings.Contains(pattern, "*") {
+			// パターンをプレフィックスとサフィックスに分割
+			parts := strings.SplitN(pattern, "*", 2)
+			if len(parts) == 2 {
+				prefix := parts[0]
+				suffix := parts[1]
+				if strings.HasPrefix(path, prefix) && strings.HasSuffix(path, suffix) {
+					return true
+				}
+			}
+		} else {
+			// 通常のプレフィックスマッチ
+			if strings.HasPrefix(path, pattern) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pathRegexps はコンパイル済みの正規表現パターン（不正なパターンは nil）
+var pathRegexps sync.Map
+
+// compilePathRegexp は正規表現パターンをコンパイルする（結果は再利用する）
+func compilePathRegexp(pattern string) *regexp.Regexp {
+	if re, ok := pathRegexps.Load(pattern); ok {
+		return re.(*regexp.Regexp)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		warnf("Invalid path pattern %q: %v", pattern, err)
+		re = nil
+	}
+	pathRegexps.Store(pattern, re)
+	return re
+}
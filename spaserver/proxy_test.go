@@ -0,0 +1,116 @@
+package spaserver
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func TestProxyProtocol(t *testing.T) {
+	proto := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strconv.Itoa(r.ProtoMajor)))
+	})
+	plain := httptest.NewServer(h2c.NewHandler(proto, &http2.Server{}))
+	defer plain.Close()
+	secure := httptest.NewUnstartedServer(proto)
+	secure.EnableHTTP2 = true
+	secure.StartTLS()
+	defer secure.Close()
+
+	tests := []struct {
+		name     string
+		protocol string
+		target   string
+		expected string
+	}{
+		{"auto は http で HTTP/1.1 を使う", protocolAuto, plain.URL, "1"},
+		{"auto は https で HTTP/2 を使う", protocolAuto, secure.URL, "2"},
+		{"h2c は http でも HTTP/2 を使う", protocolH2C, plain.URL, "2"},
+		{"http1 は https でも HTTP/1.1 を使う", protocolHTTP1, secure.URL, "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy, err := newProxy(tt.target, tt.protocol, nil, newServerMetrics())
+			if err != nil {
+				t.Fatal(err)
+			}
+			transport := proxy.Transport.(*upstreamTransport)
+			transport.TLSClientConfig = &tls.Config{RootCAs: secure.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs}
+			defer transport.CloseIdleConnections()
+
+			rr := httptest.NewRecorder()
+			proxy.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("期待されるステータスコード %d, 実際のステータスコード %d", http.StatusOK, rr.Code)
+			}
+			if rr.Body.String() != tt.expected {
+				t.Errorf("期待される HTTP のバージョン %s, 実際のバージョン %s", tt.expected, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestProxyConnectionPool(t *testing.T) {
+	var mu sync.Mutex
+	conns := 0
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("OK"))
+	}))
+	backend.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	backend.Start()
+	defer backend.Close()
+
+	cfg := testConfig(t)
+	cfg.DistDir = t.TempDir()
+	cfg.Proxy.URL = backend.URL
+	cfg.Proxy.Paths = []string{"/api"}
+	cfg.Proxy.MaxIdleConnsPerHost = 8
+	cfg.Proxy.MaxConnsPerHost = 1
+	cfg.Proxy.IdleConnTimeout = time.Minute
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	transport := s.proxies[0].Transport.(*upstreamTransport)
+	if transport.MaxIdleConnsPerHost != 8 || transport.MaxConnsPerHost != 1 || transport.IdleConnTimeout != time.Minute {
+		t.Errorf("接続の設定が反映されていません: idle_per_host=%d max_per_host=%d idle_timeout=%s",
+			transport.MaxIdleConnsPerHost, transport.MaxConnsPerHost, transport.IdleConnTimeout)
+	}
+
+	// 同時のリクエストも PROXY_MAX_CONNS_PER_HOST を超えて接続しない
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, httptest.NewRequest("GET", "/api/items", nil))
+			if rr.Code != http.StatusOK {
+				t.Errorf("期待されるステータスコード %d, 実際のステータスコード %d", http.StatusOK, rr.Code)
+			}
+		}()
+	}
+	wg.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	if conns != 1 {
+		t.Errorf("期待される接続数 1, 実際の接続数 %d", conns)
+	}
+}
@@ -0,0 +1,227 @@
+package spaserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"strings"
+)
+
+// proxyRule は PROXY_PATHS の1項目
+//
+//	/api                                パスのプレフィックス（PROXY_URL に転送）
+//	/videos/*.mp4                       ワイルドカード
+//	api.example.com/* http://api:8080   ホスト名の指定と項目ごとのプロキシ先
+//	POST /graphql                       メソッドの指定（GET|POST のように複数指定できる）
+//	/?preview=1 http://preview:8080     クエリパラメーターの指定（値を省略した場合は存在のみ確認）
+//	^/api/v[0-9]+/                      ^ で始まるパターンは正規表現
+//	!/api/docs                          除外（一致したリクエストは他の項目に関わらずプロキシしない）
+type proxyRule struct {
+	entry string
+	// 除外の項目
+	exclude bool
+	// 空の場合はすべてのメソッド
+	methods []string
+	// 空の場合はすべてのホスト（*.example.com のようにサブドメインも指定できる）
+	host    string
+	pattern string
+	// パターンが正規表現の場合
+	regex *regexp.Regexp
+	// 一致する必要があるクエリパラメーター
+	query url.Values
+	// 空の場合は PROXY_URL
+	upstream string
+	target   proxyTarget
+}
+
+// parseProxyRule は "[メソッド] [!][ホスト名]パス[?クエリ] [プロキシ先]" の形式の項目を解析する
+func parseProxyRule(entry string) (*proxyRule, error) {
+	fields := strings.Fields(entry)
+	rule := &proxyRule{entry: entry}
+	if len(fields) > 0 && isMethodList(fields[0]) {
+		rule.methods = strings.Split(fields[0], "|")
+		fields = fields[1:]
+	}
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, fmt.Errorf("%q: expected \"[METHOD] [!][host]/path[?query] [upstream URL]\"", entry)
+	}
+	rule.pattern = fields[0]
+	if pattern, ok := strings.CutPrefix(rule.pattern, "!"); ok {
+		if len(fields) == 2 {
+			return nil, fmt.Errorf("%q: an exclusion cannot have an upstream", entry)
+		}
+		rule.exclude, rule.pattern = true, pattern
+	}
+	if strings.HasPrefix(rule.pattern, "^") {
+		// 正規表現（ホスト名とクエリパラメーターは指定できない）
+		regex, err := regexp.Compile(rule.pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", entry, err)
+		}
+		rule.regex = regex
+	} else if !strings.HasPrefix(rule.pattern, "/") {
+		host, path, ok := strings.Cut(rule.pattern, "/")
+		if !ok || host == "" {
+			return nil, fmt.Errorf("%q: must start with / or a host name followed by /", entry)
+		}
+		rule.host, rule.pattern = strings.ToLower(host), "/"+path
+	}
+	if pattern, rawQuery, ok := strings.Cut(rule.pattern, "?"); ok && rule.regex == nil {
+		query, err := url.ParseQuery(rawQuery)
+		if err != nil || len(query) == 0 {
+			return nil, fmt.Errorf("%q: invalid query parameters", entry)
+		}
+		rule.pattern, rule.query = pattern, query
+	}
+	if rule.regex == nil && strings.Count(rule.pattern, "*") > 1 {
+		return nil, fmt.Errorf("%q: may contain at most one * in the path", entry)
+	}
+	if len(fields) == 2 {
+		rule.upstream = fields[1]
+		if err := checkProxyURL(rule.upstream); err != nil {
+			return nil, fmt.Errorf("%q: %w", entry, err)
+		}
+	}
+	return rule, nil
+}
+
+// isMethodList は GET|POST のような大文字のメソッド名の並びかを判定する
+func isMethodList(s string) bool {
+	for _, method := range strings.Split(s, "|") {
+		if method == "" || strings.TrimFunc(method, func(c rune) bool { return c >= 'A' && c <= 'Z' }) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// match はリクエストのメソッド・ホスト名・パスが項目に一致するかを判定する
+func (rule *proxyRule) match(r *http.Request) bool {
+	if len(rule.methods) > 0 && !rule.allowsMethod(r.Method) {
+		return false
+	}
+	if rule.host != "" && !matchHost(rule.host, requestHost(r)) {
+		return false
+	}
+	if len(rule.query) > 0 && !rule.matchQuery(r.URL.Query()) {
+		return false
+	}
+	if rule.regex != nil {
+		return rule.regex.MatchString(r.URL.Path)
+	}
+	return matchProxyPath([]string{rule.pattern}, r.URL.Path)
+}
+
+// matchQuery は指定したクエリパラメーターがすべて含まれるかを判定する
+func (rule *proxyRule) matchQuery(query url.Values) bool {
+	for key, values := range rule.query {
+		actual, ok := query[key]
+		if !ok {
+			return false
+		}
+		for _, v := range values {
+			if v != "" && !slices.Contains(actual, v) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// allowsMethod はメソッドが指定に含まれるかを判定する（HEAD は GET として扱う）
+func (rule *proxyRule) allowsMethod(method string) bool {
+	if method == http.MethodHead && slices.Contains(rule.methods, http.MethodGet) {
+		return true
+	}
+	return slices.Contains(rule.methods, method)
+}
+
+// matchHost はホスト名がパターンに一致するかを判定する（*.example.com はサブドメインに一致）
+func matchHost(pattern, host string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
+
+// parseProxyRules は PROXY_PATHS を解析し、項目ごとのプロキシ先を作成する
+func (s *server) parseProxyRules(entries []string) (*proxyRuleSet, error) {
+	var rules []*proxyRule
+	for _, entry := range entries {
+		rule, err := parseProxyRule(entry)
+		if err != nil {
+			return nil, err
+		}
+		rule.target = proxyTarget{url: s.cfg.Proxy.URL, handler: s.upstream}
+		if rule.upstream != "" {
+			handler, err := s.upstreamFor(rule.upstream)
+			if err != nil {
+				return nil, fmt.Errorf("%q: %w", entry, err)
+			}
+			rule.target = proxyTarget{url: rule.upstream, handler: handler}
+		}
+		rules = append(rules, rule)
+	}
+	return newProxyRuleSet(rules), nil
+}
+
+// proxyRuleSet は PROXY_PATHS の項目をパスのプレフィックスで索引したもの
+type proxyRuleSet struct {
+	rules []*proxyRule
+	index radixTree
+}
+
+func newProxyRuleSet(rules []*proxyRule) *proxyRuleSet {
+	set := &proxyRuleSet{rules: rules}
+	for i, rule := range rules {
+		// ワイルドカードより前の部分（正規表現の場合は先頭の固定文字列）で索引する
+		prefix, _, _ := strings.Cut(rule.pattern, "*")
+		if rule.regex != nil {
+			prefix = regexLiteralPrefix(rule.pattern)
+		}
+		set.index.insert(prefix, i)
+	}
+	return set
+}
+
+// match は最初に一致した項目を返す（項目の順序を優先する）
+// 除外の項目に一致した場合は nil を返す
+func (set *proxyRuleSet) match(r *http.Request) *proxyRule {
+	first, excluded := -1, false
+	set.index.walk(r.URL.Path, func(i int) {
+		rule := set.rules[i]
+		if rule.exclude {
+			excluded = excluded || rule.match(r)
+		} else if (first < 0 || i < first) && rule.match(r) {
+			first = i
+		}
+	})
+	if first < 0 || excluded {
+		return nil
+	}
+	return set.rules[first]
+}
+
+// matchProxyRule は最初に一致した PROXY_PATHS の項目を返す
+func (s *server) matchProxyRule(r *http.Request) *proxyRule {
+	return s.proxyRules.match(r)
+}
+
+// regexLiteralPrefix は ^ で始まる正規表現に一致する文字列が必ず持つ先頭の固定文字列を返す
+func regexLiteralPrefix(pattern string) string {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return ""
+	}
+	re = re.Simplify()
+	if re.Op != syntax.OpConcat || len(re.Sub) < 2 || re.Sub[0].Op != syntax.OpBeginText {
+		return ""
+	}
+	if lit := re.Sub[1]; lit.Op == syntax.OpLiteral && lit.Flags&syntax.FoldCase == 0 {
+		return string(lit.Rune)
+	}
+	return ""
+}
@@ -0,0 +1,261 @@
+package spaserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseProxyRule(t *testing.T) {
+	tests := []struct {
+		entry            string
+		expectedMethods  []string
+		expectedHost     string
+		expectedPattern  string
+		expectedUpstream string
+	}{
+		{"/api", nil, "", "/api", ""},
+		{"POST /graphql", []string{"POST"}, "", "/graphql", ""},
+		{"GET|HEAD example.com/api http://api:8080", []string{"GET", "HEAD"}, "example.com", "/api", "http://api:8080"},
+		{"/videos/*.mp4", nil, "", "/videos/*.mp4", ""},
+		{"API.example.com/* http://api:8080", nil, "api.example.com", "/*", "http://api:8080"},
+		{"*.example.com/api", nil, "*.example.com", "/api", ""},
+	}
+	for _, tt := range tests {
+		rule, err := parseProxyRule(tt.entry)
+		if err != nil {
+			t.Errorf("%s: %v", tt.entry, err)
+			continue
+		}
+		if !reflect.DeepEqual(rule.methods, tt.expectedMethods) {
+			t.Errorf("%s: 期待されるメソッド %v, 実際のメソッド %v", tt.entry, tt.expectedMethods, rule.methods)
+		}
+		if rule.host != tt.expectedHost || rule.pattern != tt.expectedPattern || rule.upstream != tt.expectedUpstream {
+			t.Errorf("%s: 期待される結果 %q %q %q, 実際の結果 %q %q %q", tt.entry,
+				tt.expectedHost, tt.expectedPattern, tt.expectedUpstream, rule.host, rule.pattern, rule.upstream)
+		}
+	}
+
+	for _, entry := range []string{"api", "^/api/(", "/api/*/*.json", "/api backend:8080", "/api http://a:1 http://b:2", "POST", "post /graphql", "/api?", "/api?a=%zz", "!/api http://a:1"} {
+		if _, err := parseProxyRule(entry); err == nil {
+			t.Errorf("%s: エラーになる必要があります", entry)
+		}
+	}
+}
+
+func TestMatchHost(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		host     string
+		expected bool
+	}{
+		{"example.com", "example.com", true},
+		{"example.com", "api.example.com", false},
+		{"*.example.com", "api.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"*.example.com", "badexample.com", false},
+	}
+	for _, tt := range tests {
+		if got := matchHost(tt.pattern, tt.host); got != tt.expected {
+			t.Errorf("%s %s: 期待される結果 %v, 実際の結果 %v", tt.pattern, tt.host, tt.expected, got)
+		}
+	}
+}
+
+func TestHostProxyRules(t *testing.T) {
+	newBackend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name + " " + r.URL.Path))
+		}))
+	}
+	api, legacy := newBackend("api"), newBackend("legacy")
+	defer api.Close()
+	defer legacy.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Proxy.URL = legacy.URL
+	cfg.Proxy.Paths = []string{"api.example.com/* " + api.URL, "example.com/api/"}
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		name         string
+		url          string
+		expectedBody string
+	}{
+		{"API 用のホスト", "http://api.example.com/users", "api /users"},
+		{"ポート付きのホスト", "http://api.example.com:8080/users", "api /users"},
+		{"パスで振り分け", "http://example.com/api/users", "legacy /api/users"},
+		{"一致しないパス", "http://example.com/users", "SPA"},
+		{"一致しないホスト", "http://www.example.com/api/users", "SPA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, httptest.NewRequest("GET", tt.url, nil))
+			if rr.Body.String() != tt.expectedBody {
+				t.Errorf("期待されるレスポンス %q, 実際のレスポンス %q", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestProxyRuleMethods(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend", "1")
+	}))
+	defer backend.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Proxy.URL = backend.URL
+	cfg.Proxy.Paths = []string{"POST /graphql", "GET /api"}
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		method   string
+		path     string
+		expected bool
+	}{
+		{"POST", "/graphql", true},
+		{"GET", "/graphql", false},
+		{"GET", "/api/users", true},
+		{"HEAD", "/api/users", true},
+		{"DELETE", "/api/users", false},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, httptest.NewRequest(tt.method, tt.path, nil))
+		if proxied := rr.Header().Get("X-Backend") != ""; proxied != tt.expected {
+			t.Errorf("%s %s: プロキシされるか 期待 %v, 実際 %v", tt.method, tt.path, tt.expected, proxied)
+		}
+	}
+}
+
+func TestProxyRuleQuery(t *testing.T) {
+	newBackend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+	}
+	stable, preview := newBackend("stable"), newBackend("preview")
+	defer stable.Close()
+	defer preview.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Proxy.URL = stable.URL
+	cfg.Proxy.Paths = []string{"/?preview=1 " + preview.URL, "/api?draft " + preview.URL, "/api"}
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		url          string
+		expectedBody string
+	}{
+		{"/articles/1?preview=1", "preview"},
+		{"/articles/1?preview=0", "SPA"},
+		{"/articles/1?lang=ja&preview=1", "preview"},
+		{"/api/posts?draft", "preview"},
+		{"/api/posts?draft=yes", "preview"},
+		{"/api/posts", "stable"},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, httptest.NewRequest("GET", tt.url, nil))
+		if rr.Body.String() != tt.expectedBody {
+			t.Errorf("%s: 期待されるレスポンス %q, 実際のレスポンス %q", tt.url, tt.expectedBody, rr.Body.String())
+		}
+	}
+}
+
+func TestRegexProxyRule(t *testing.T) {
+	tests := []struct {
+		entry    string
+		path     string
+		expected bool
+	}{
+		{"^/api/v[0-9]+/", "/api/v2/users", true},
+		{"^/api/v[0-9]+/", "/api/vx/users", false},
+		{"^/api/v[0-9]+/", "/static/api/v2/", false},
+		{"^/(users|teams)/[0-9]+$", "/users/12", true},
+		{"^/(users|teams)/[0-9]+$", "/users/12/edit", false},
+		{"^/export/.*\\.csv$", "/export/2024.csv", true},
+		{"POST ^/graphql/?$", "/graphql/", true},
+	}
+	for _, tt := range tests {
+		set := newTestProxyRuleSet(t, tt.entry)
+		method := "GET"
+		if strings.HasPrefix(tt.entry, "POST ") {
+			method = "POST"
+		}
+		if matched := set.match(httptest.NewRequest(method, tt.path, nil)) != nil; matched != tt.expected {
+			t.Errorf("%s %s: 期待される結果 %v, 実際の結果 %v", tt.entry, tt.path, tt.expected, matched)
+		}
+		if matched := matchProxyPath([]string{strings.TrimPrefix(tt.entry, "POST ")}, tt.path); matched != tt.expected {
+			t.Errorf("matchProxyPath %s %s: 期待される結果 %v, 実際の結果 %v", tt.entry, tt.path, tt.expected, matched)
+		}
+	}
+}
+
+func TestRegexLiteralPrefix(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		expected string
+	}{
+		{"^/api/v[0-9]+/", "/api/v"},
+		{"^/export/.*\\.csv$", "/export/"},
+		{"^/(users|teams)/", "/"},
+		{"^/a|/b", ""},
+		{"^(?i)/api", ""},
+		{"^[a-z]", ""},
+	}
+	for _, tt := range tests {
+		if prefix := regexLiteralPrefix(tt.pattern); prefix != tt.expected {
+			t.Errorf("%s: 期待されるプレフィックス %q, 実際のプレフィックス %q", tt.pattern, tt.expected, prefix)
+		}
+	}
+}
+
+func TestProxyRuleExclusions(t *testing.T) {
+	set := newTestProxyRuleSet(t, "/api", "!/api/docs", "GET !/api/export", "!^/api/v[0-9]+/openapi\\.json$")
+
+	tests := []struct {
+		method   string
+		path     string
+		expected bool
+	}{
+		{"GET", "/api/users", true},
+		{"GET", "/api/docs", false},
+		{"GET", "/api/docs/index.html", false},
+		{"GET", "/api/export", false},
+		{"POST", "/api/export", true},
+		{"GET", "/api/v2/openapi.json", false},
+		{"GET", "/api/v2/users", true},
+	}
+	for _, tt := range tests {
+		if matched := set.match(httptest.NewRequest(tt.method, tt.path, nil)) != nil; matched != tt.expected {
+			t.Errorf("%s %s: プロキシされるか 期待 %v, 実際 %v", tt.method, tt.path, tt.expected, matched)
+		}
+	}
+}
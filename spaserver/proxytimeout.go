@@ -0,0 +1,47 @@
+package spaserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// proxyTimeout はプロキシパスのパターンごとのタイムアウト
+type proxyTimeout struct {
+	pattern string
+	timeout time.Duration
+}
+
+// parseProxyTimeouts は "パターン=時間" の一覧を解析する
+func parseProxyTimeouts(entries []string) ([]proxyTimeout, error) {
+	var timeouts []proxyTimeout
+	for _, entry := range entries {
+		pattern, value, ok := strings.Cut(entry, "=")
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("invalid entry %q (use path=duration)", entry)
+		}
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout < 0 {
+			return nil, fmt.Errorf("invalid duration in %q", entry)
+		}
+		timeouts = append(timeouts, proxyTimeout{pattern: pattern, timeout: timeout})
+	}
+	return timeouts, nil
+}
+
+// proxyTimeoutFor はパスに適用するプロキシのタイムアウトを返す（0 は無制限）
+func (s *server) proxyTimeoutFor(path string) time.Duration {
+	for _, t := range s.proxyTimeouts {
+		if matchProxyPath([]string{t.pattern}, path) {
+			return t.timeout
+		}
+	}
+	return s.cfg.Proxy.Timeout
+}
+
+// isProxyTimeout はプロキシ先への要求がタイムアウトで打ち切られたかを判定する
+func isProxyTimeout(ctx context.Context, err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded)
+}
@@ -0,0 +1,67 @@
+package spaserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestProxyTimeouts(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+			w.Write([]byte("OK"))
+		case <-r.Context().Done():
+		}
+	}))
+	defer backend.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Proxy.URL = backend.URL
+	cfg.Proxy.Paths = []string{"/api", "/export"}
+	cfg.Proxy.Timeout = 50 * time.Millisecond
+	cfg.Proxy.Timeouts = []string{"/export=5s"}
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		name     string
+		path     string
+		expected int
+	}{
+		{"全体のタイムアウトを超える", "/api/items", http.StatusGatewayTimeout},
+		{"パスごとのタイムアウト以内", "/export/csv", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+			if rr.Code != tt.expected {
+				t.Errorf("期待されるステータスコード %d, 実際のステータスコード %d", tt.expected, rr.Code)
+			}
+		})
+	}
+}
+
+func TestParseProxyTimeouts(t *testing.T) {
+	timeouts, err := parseProxyTimeouts([]string{"/api=5s", "/export/*=2m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(timeouts) != 2 || timeouts[0].timeout != 5*time.Second || timeouts[1].pattern != "/export/*" {
+		t.Errorf("解析結果が正しくありません: %+v", timeouts)
+	}
+	for _, entry := range []string{"/api", "=5s", "/api=-1s", "/api=5"} {
+		if _, err := parseProxyTimeouts([]string{entry}); err == nil {
+			t.Errorf("%q はエラーになるべきです", entry)
+		}
+	}
+}
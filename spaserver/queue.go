@@ -0,0 +1,119 @@
+package spaserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 同時処理数の制限と待ち行列
+// MAX_CONCURRENT_REQUESTS を超えたリクエストは REQUEST_QUEUE_SIZE 件まで到着順に待たせ、
+// REQUEST_QUEUE_TIMEOUT までに処理を始められない場合や待ち行列がいっぱいの場合に 503 を返す。
+// 短いアクセスの集中はすぐにエラーにせず吸収し、待たせる数に上限を設けてメモリが増え続けないようにする
+
+const serverBusyBody = "Service Unavailable: server busy\n"
+
+var (
+	errQueueFull    = errors.New("queue full")
+	errQueueTimeout = errors.New("queue timeout")
+)
+
+// concurrencyLimiter は同時に処理するリクエスト数を制限し、超えた分を到着順に待たせる
+type concurrencyLimiter struct {
+	mu      sync.Mutex
+	active  int
+	waiters []chan struct{}
+}
+
+// acquire は処理を始められるまで待つ（待てない場合は errQueueFull、時間切れの場合は errQueueTimeout）
+// 待っている間は queued の値を増やす
+func (c *concurrencyLimiter) acquire(ctx context.Context, queued *metricVec, limit, queueSize int, timeout time.Duration) error {
+	c.mu.Lock()
+	if c.active < limit && len(c.waiters) == 0 {
+		c.active++
+		c.mu.Unlock()
+		return nil
+	}
+	if len(c.waiters) >= queueSize {
+		c.mu.Unlock()
+		return errQueueFull
+	}
+	ready := make(chan struct{})
+	c.waiters = append(c.waiters, ready)
+	c.mu.Unlock()
+	queued.Add(1)
+	defer queued.Add(-1)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-ready:
+		return nil
+	case <-timer.C:
+		err = errQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, w := range c.waiters {
+		if w == ready {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return err
+		}
+	}
+	// 時間切れと同時に順番が来た場合は次のリクエストに譲る
+	c.active--
+	c.grant(limit)
+	return err
+}
+
+// release は処理の終了を記録し、待っているリクエストの処理を始める
+func (c *concurrencyLimiter) release(limit int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.active--
+	c.grant(limit)
+}
+
+func (c *concurrencyLimiter) grant(limit int) {
+	for c.active < limit && len(c.waiters) > 0 {
+		close(c.waiters[0])
+		c.waiters = c.waiters[1:]
+		c.active++
+	}
+}
+
+// enterQueue は同時処理数の上限に達している場合に待ち、待てなかった場合は 503 を返して false を返す
+// true の場合はリクエストの処理後に返された関数を呼ぶ
+func (s *server) enterQueue(w http.ResponseWriter, r *http.Request) (func(), bool) {
+	limits := s.cfg.Limits
+	if limits.MaxConcurrentRequests <= 0 {
+		return func() {}, true
+	}
+	queue := s.state.queue
+	err := queue.acquire(r.Context(), s.state.metrics.queued, limits.MaxConcurrentRequests, limits.QueueSize, limits.QueueTimeout)
+	if err == nil {
+		return func() { queue.release(limits.MaxConcurrentRequests) }, true
+	}
+	switch err {
+	case errQueueFull:
+		s.state.metrics.queueRejected.Add(1, "queue_full")
+	case errQueueTimeout:
+		s.state.metrics.queueRejected.Add(1, "timeout")
+	default:
+		// クライアントが待ちきれずに切断した
+		return nil, false
+	}
+	infof("Server busy: %s %s (%v, MAX_CONCURRENT_REQUESTS %d)", metricMethod(r.Method), escapeLogValue(r.URL.Path), err, limits.MaxConcurrentRequests)
+	w.Header().Set("Retry-After", "1")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	fmt.Fprint(w, serverBusyBody)
+	return nil, false
+}
@@ -0,0 +1,88 @@
+package spaserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRequestQueue(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Limits.MaxConcurrentRequests = 1
+	cfg.Limits.QueueSize = 1
+	cfg.Limits.QueueTimeout = 2 * time.Second
+
+	// /slow は release が閉じられるまで応答を終えない
+	started, release := make(chan struct{}), make(chan struct{})
+	slow := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/slow" {
+				close(started)
+				<-release
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	s, err := newServer(cfg, WithMiddleware(MiddlewareStatic, slow))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	request := func(path string) int {
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		return rr.Code
+	}
+	slowDone := make(chan int)
+	go func() { slowDone <- request("/slow") }()
+	<-started
+
+	// 1件目は待ち行列で待ち、2件目は待ち行列がいっぱいなので 503
+	queuedDone := make(chan int)
+	go func() { queuedDone <- request("/") }()
+	for s.state.metrics.queued.Value() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if code := request("/"); code != http.StatusServiceUnavailable {
+		t.Errorf("期待されるステータスコード %d, 実際のステータスコード %d", http.StatusServiceUnavailable, code)
+	}
+	close(release)
+	<-slowDone
+	if code := <-queuedDone; code != http.StatusOK {
+		t.Errorf("待っていたリクエストが処理されていません: %d", code)
+	}
+	if v := s.state.metrics.queueRejected.Value("queue_full"); v != 1 {
+		t.Errorf("期待される拒否数 1, 実際の拒否数 %g", v)
+	}
+}
+
+func TestConcurrencyLimiterTimeout(t *testing.T) {
+	c := &concurrencyLimiter{}
+	queued := newServerMetrics().queued
+	ctx := context.Background()
+	if err := c.acquire(ctx, queued, 1, 1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.acquire(ctx, queued, 1, 1, 20*time.Millisecond); err != errQueueTimeout {
+		t.Errorf("期待されるエラー %v, 実際のエラー %v", errQueueTimeout, err)
+	}
+	// 切断したクライアントは待ち行列から外れる
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := c.acquire(canceled, queued, 1, 1, time.Second); err != context.Canceled {
+		t.Errorf("期待されるエラー %v, 実際のエラー %v", context.Canceled, err)
+	}
+	c.release(1)
+	if c.active != 0 || len(c.waiters) != 0 {
+		t.Errorf("処理中 %d 件・待機中 %d 件が残っています", c.active, len(c.waiters))
+	}
+}
@@ -0,0 +1,86 @@
+package spaserver
+
+import "strings"
+
+// radixTree はパスのプレフィックスから項目の番号を引く基数木
+// 項目数が多くてもパスの長さに比例する時間で候補を絞り込める
+type radixTree struct {
+	root radixNode
+}
+
+type radixNode struct {
+	// 親からこのノードまでの文字列
+	prefix   string
+	children []*radixNode
+	// このノードまでの文字列をプレフィックスとする項目の番号
+	values []int
+}
+
+// insert はプレフィックスに項目の番号を登録する
+func (t *radixTree) insert(prefix string, value int) {
+	n := &t.root
+	for {
+		if prefix == "" {
+			n.values = append(n.values, value)
+			return
+		}
+		child := n.child(prefix[0])
+		if child == nil {
+			n.children = append(n.children, &radixNode{prefix: prefix, values: []int{value}})
+			return
+		}
+		common := commonPrefixLen(prefix, child.prefix)
+		if common < len(child.prefix) {
+			// 共通部分でノードを分割する
+			split := &radixNode{prefix: child.prefix[:common], children: []*radixNode{child}}
+			n.replaceChild(split)
+			child.prefix = child.prefix[common:]
+			child = split
+		}
+		n, prefix = child, prefix[common:]
+	}
+}
+
+// walk はパスのプレフィックスに登録されたすべての項目の番号を、短いプレフィックスから順に fn に渡す
+func (t *radixTree) walk(path string, fn func(value int)) {
+	n := &t.root
+	for {
+		for _, v := range n.values {
+			fn(v)
+		}
+		if path == "" {
+			return
+		}
+		child := n.child(path[0])
+		if child == nil || !strings.HasPrefix(path, child.prefix) {
+			return
+		}
+		n, path = child, path[len(child.prefix):]
+	}
+}
+
+func (n *radixNode) child(c byte) *radixNode {
+	for _, child := range n.children {
+		if child.prefix[0] == c {
+			return child
+		}
+	}
+	return nil
+}
+
+func (n *radixNode) replaceChild(child *radixNode) {
+	for i, c := range n.children {
+		if c.prefix[0] == child.prefix[0] {
+			n.children[i] = child
+			return
+		}
+	}
+}
+
+func commonPrefixLen(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
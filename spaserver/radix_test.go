@@ -0,0 +1,152 @@
+package spaserver
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRadixTree(t *testing.T) {
+	prefixes := []string{"/api", "/api/v1", "/apps", "/", "/query", "/api", "/a", "/videos/", ""}
+	var tree radixTree
+	for i, prefix := range prefixes {
+		tree.insert(prefix, i)
+	}
+
+	for _, path := range []string{"/api/v1/users", "/apps/1", "/a", "/query", "/videos/a.mp4", "/x", "", "/ap"} {
+		var expected []int
+		for i, prefix := range prefixes {
+			if strings.HasPrefix(path, prefix) {
+				expected = append(expected, i)
+			}
+		}
+		var actual []int
+		tree.walk(path, func(i int) { actual = append(actual, i) })
+		slices.Sort(actual)
+		if !slices.Equal(actual, expected) {
+			t.Errorf("%s: 期待される項目 %v, 実際の項目 %v", path, expected, actual)
+		}
+	}
+}
+
+func TestProxyRuleSetOrder(t *testing.T) {
+	set := newTestProxyRuleSet(t, "/api/v1/*.json", "/api", "/api/v1", "POST /graphql", "example.com/api/v1")
+
+	tests := []struct {
+		method        string
+		url           string
+		expectedEntry string
+	}{
+		{"GET", "/api/v1/users.json", "/api/v1/*.json"},
+		{"GET", "/api/v1/users", "/api"},
+		{"GET", "http://example.com/api/v1/users", "/api"},
+		{"POST", "/graphql", "POST /graphql"},
+		{"GET", "/graphql", ""},
+		{"GET", "/ap", ""},
+	}
+	for _, tt := range tests {
+		rule := set.match(httptest.NewRequest(tt.method, tt.url, nil))
+		entry := ""
+		if rule != nil {
+			entry = rule.entry
+		}
+		if entry != tt.expectedEntry {
+			t.Errorf("%s %s: 期待される項目 %q, 実際の項目 %q", tt.method, tt.url, tt.expectedEntry, entry)
+		}
+	}
+}
+
+// TestProxyRuleSetEquivalence は索引を使った判定が先頭から順に調べる判定と一致することを確認する
+func TestProxyRuleSetEquivalence(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	segments := []string{"api", "v1", "v2", "users", "a", "ab", "static", "x.mp4"}
+	randomPath := func() string {
+		var b strings.Builder
+		for n := random.Intn(4); n >= 0; n-- {
+			b.WriteString("/" + segments[random.Intn(len(segments))])
+		}
+		return b.String()
+	}
+
+	var entries []string
+	for i := 0; i < 40; i++ {
+		entry := randomPath()
+		switch random.Intn(4) {
+		case 0:
+			entry += "/*.mp4"
+		case 1:
+			entry = "GET " + entry
+		case 2:
+			entry = "^" + entry + "(/|$)"
+		case 3:
+			entry = "!" + entry
+		}
+		entries = append(entries, entry)
+	}
+	set := newTestProxyRuleSet(t, entries...)
+
+	for i := 0; i < 2000; i++ {
+		req := httptest.NewRequest([]string{"GET", "POST"}[random.Intn(2)], randomPath(), nil)
+		if actual, expected := set.match(req), matchProxyRuleLinear(set.rules, req); actual != expected {
+			t.Fatalf("%s %s: 先頭から調べた結果 %v, 索引を使った結果 %v", req.Method, req.URL.Path, expected, actual)
+		}
+	}
+}
+
+func newTestProxyRuleSet(t testing.TB, entries ...string) *proxyRuleSet {
+	t.Helper()
+	var rules []*proxyRule
+	for _, entry := range entries {
+		rule, err := parseProxyRule(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, rule)
+	}
+	return newProxyRuleSet(rules)
+}
+
+// matchProxyRuleLinear は項目を先頭から順に調べる（比較用）
+func matchProxyRuleLinear(rules []*proxyRule, r *http.Request) *proxyRule {
+	for _, rule := range rules {
+		if rule.exclude && rule.match(r) {
+			return nil
+		}
+	}
+	for _, rule := range rules {
+		if !rule.exclude && rule.match(r) {
+			return rule
+		}
+	}
+	return nil
+}
+
+func BenchmarkProxyRules(b *testing.B) {
+	for _, n := range []int{5, 50, 500} {
+		var entries []string
+		for i := 0; i < n; i++ {
+			entries = append(entries, fmt.Sprintf("/api/service%d/", i), fmt.Sprintf("/files/%d/*.mp4", i))
+		}
+		set := newTestProxyRuleSet(b, entries...)
+		// 一致しないリクエスト（静的ファイル）と最後の項目に一致するリクエスト
+		requests := []*http.Request{
+			httptest.NewRequest("GET", "/assets/main.js", nil),
+			httptest.NewRequest("GET", fmt.Sprintf("/files/%d/movie.mp4", n-1), nil),
+		}
+
+		b.Run(fmt.Sprintf("linear/%d", n*2), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				matchProxyRuleLinear(set.rules, requests[i%2])
+			}
+		})
+		b.Run(fmt.Sprintf("radix/%d", n*2), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				set.match(requests[i%2])
+			}
+		})
+	}
+}
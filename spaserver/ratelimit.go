@@ -0,0 +1,209 @@
+package spaserver
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// レート制限
+// クライアントIPごとに RATE_LIMIT（すべてのリクエスト）と RATE_LIMIT_PATHS（パスごと）のリクエスト数を数え、
+// 超えた場合は Retry-After を付けて 429 を返す。パスごとの上限はログインなどのエンドポイントへの総当たり対策に使い、
+// 一致したリクエストは RATE_LIMIT にも数える。ヘルスチェックは数えず、IPアドレスの制限の後に判定する
+
+const rateLimitBody = "Too Many Requests\n"
+
+var ratePeriods = map[string]time.Duration{
+	"s": time.Second, "sec": time.Second, "second": time.Second,
+	"m": time.Minute, "min": time.Minute, "minute": time.Minute,
+	"h": time.Hour, "hour": time.Hour,
+}
+
+// rate は period あたりに許可するリクエスト数
+type rate struct {
+	count  int
+	period time.Duration
+}
+
+// parseRate は "5/min" や "100/10s" を解析する
+func parseRate(s string) (rate, error) {
+	count, per, ok := strings.Cut(s, "/")
+	n, err := strconv.Atoi(count)
+	if !ok || err != nil || n <= 0 {
+		return rate{}, fmt.Errorf("invalid rate %q (use requests/period, e.g. 5/min)", s)
+	}
+	period, ok := ratePeriods[per]
+	if !ok {
+		if period, err = time.ParseDuration(per); err != nil || period <= 0 {
+			return rate{}, fmt.Errorf("invalid period in %q (use s, min, h or a duration such as 10s)", s)
+		}
+	}
+	return rate{count: n, period: period}, nil
+}
+
+// rateBucket はクライアントIPごとのトークンバケット（period の間に count 個まで補充する）
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimit は1つの上限とクライアントIPごとのバケット
+type rateLimit struct {
+	// ログとメトリクスに使う名前（RATE_LIMIT またはパスのパターン）
+	name    string
+	pattern string
+	rate    rate
+
+	mu      sync.Mutex
+	buckets map[string]*rateBucket
+	swept   time.Time
+}
+
+func newRateLimit(name, pattern string, r rate) *rateLimit {
+	return &rateLimit{name: name, pattern: pattern, rate: r, buckets: map[string]*rateBucket{}}
+}
+
+// allow は1リクエスト分のトークンを使う。足りない場合は次のトークンが補充されるまでの時間を返す
+func (l *rateLimit) allow(ip string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	perToken := l.rate.period.Seconds() / float64(l.rate.count)
+	b, ok := l.buckets[ip]
+	if !ok {
+		b = &rateBucket{tokens: float64(l.rate.count), last: now}
+		l.buckets[ip] = b
+	}
+	b.tokens = math.Min(float64(l.rate.count), b.tokens+now.Sub(b.last).Seconds()/perToken)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) * perToken * float64(time.Second))
+}
+
+// refund は allow で使ったトークンを戻す
+func (l *rateLimit) refund(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets[ip]; ok {
+		b.tokens = math.Min(float64(l.rate.count), b.tokens+1)
+	}
+}
+
+// sweep は period ごとに補充が終わったバケットを削除する（クライアントIPの数だけメモリが増え続けないように）
+func (l *rateLimit) sweep(now time.Time) {
+	if now.Sub(l.swept) < l.rate.period {
+		return
+	}
+	l.swept = now
+	for ip, b := range l.buckets {
+		if now.Sub(b.last) >= l.rate.period {
+			delete(l.buckets, ip)
+		}
+	}
+}
+
+// rateLimiter は RATE_LIMIT と RATE_LIMIT_PATHS の上限
+type rateLimiter struct {
+	global *rateLimit
+	paths  []*rateLimit
+}
+
+func newRateLimiter(cfg RateLimitConfig) (*rateLimiter, error) {
+	if cfg.Limit == "" && len(cfg.Paths) == 0 {
+		return nil, nil
+	}
+	l := &rateLimiter{}
+	if cfg.Limit != "" {
+		r, err := parseRate(cfg.Limit)
+		if err != nil {
+			return nil, fmt.Errorf("RATE_LIMIT: %w", err)
+		}
+		l.global = newRateLimit("RATE_LIMIT", "", r)
+	}
+	for _, entry := range cfg.Paths {
+		pattern, value, ok := strings.Cut(entry, "=")
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("RATE_LIMIT_PATHS: invalid entry %q (use path=requests/period)", entry)
+		}
+		r, err := parseRate(value)
+		if err != nil {
+			return nil, fmt.Errorf("RATE_LIMIT_PATHS: %w", err)
+		}
+		l.paths = append(l.paths, newRateLimit("RATE_LIMIT_PATHS "+pattern, pattern, r))
+	}
+	return l, nil
+}
+
+// reuse は previous のうち名前と値が同じ上限を使い、クライアントIPごとのバケットを引き継ぐ
+// 設定を読み込み直すたびに上限がリセットされないようにする。使っている上限を返す
+func (l *rateLimiter) reuse(previous map[string]*rateLimit) map[string]*rateLimit {
+	limits := map[string]*rateLimit{}
+	if l == nil {
+		return limits
+	}
+	keep := func(limit *rateLimit) *rateLimit {
+		key := fmt.Sprintf("%s %d/%s", limit.name, limit.rate.count, limit.rate.period)
+		if old, ok := previous[key]; ok {
+			limit = old
+		}
+		limits[key] = limit
+		return limit
+	}
+	if l.global != nil {
+		l.global = keep(l.global)
+	}
+	for i, p := range l.paths {
+		l.paths[i] = keep(p)
+	}
+	return limits
+}
+
+// check はパスの上限（最初に一致したもの）と RATE_LIMIT を確認し、超えた上限と待ち時間を返す
+// RATE_LIMIT で拒否した場合は、パスの上限で使ったトークンを戻す
+func (l *rateLimiter) check(ip, path string, now time.Time) (*rateLimit, time.Duration) {
+	var matched *rateLimit
+	for _, p := range l.paths {
+		if matchProxyPath([]string{p.pattern}, path) {
+			if ok, wait := p.allow(ip, now); !ok {
+				return p, wait
+			}
+			matched = p
+			break
+		}
+	}
+	if l.global != nil {
+		if ok, wait := l.global.allow(ip, now); !ok {
+			if matched != nil {
+				matched.refund(ip)
+			}
+			return l.global, wait
+		}
+	}
+	return nil, 0
+}
+
+// checkRateLimit は上限を超えたクライアントに 429 を返して false を返す
+func (s *server) checkRateLimit(w http.ResponseWriter, r *http.Request, clientIP string) bool {
+	if s.rateLimits == nil {
+		return true
+	}
+	limit, wait := s.rateLimits.check(clientIP, r.URL.Path, time.Now())
+	if limit == nil {
+		return true
+	}
+	s.state.metrics.rateLimited.Add(1, limit.name)
+	s.blockRequest(r, limit.name)
+	infof("Rate limited: %s %s (client IP %s, %s %d/%s)", metricMethod(r.Method), escapeLogValue(r.URL.Path), clientIP, limit.name, limit.rate.count, limit.rate.period)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusTooManyRequests)
+	fmt.Fprint(w, rateLimitBody)
+	return false
+}
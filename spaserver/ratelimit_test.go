@@ -0,0 +1,177 @@
+package spaserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		value       string
+		expected    rate
+		expectedErr bool
+	}{
+		{value: "5/min", expected: rate{count: 5, period: time.Minute}},
+		{value: "100/10s", expected: rate{count: 100, period: 10 * time.Second}},
+		{value: "1000/h", expected: rate{count: 1000, period: time.Hour}},
+		{value: "0/min", expectedErr: true},
+		{value: "5", expectedErr: true},
+		{value: "5/week", expectedErr: true},
+	}
+	for _, tt := range tests {
+		r, err := parseRate(tt.value)
+		if tt.expectedErr {
+			if err == nil {
+				t.Errorf("%s: エラーになるべきです", tt.value)
+			}
+			continue
+		}
+		if err != nil || r != tt.expected {
+			t.Errorf("%s: 期待される値 %+v, 実際の値 %+v (%v)", tt.value, tt.expected, r, err)
+		}
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.RateLimit = RateLimitConfig{Limit: "5/min", Paths: []string{"/login=2/min"}}
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	request := func(path, remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		r.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, r)
+		return rr
+	}
+	// /login は2回まで（拒否したリクエストは RATE_LIMIT に数えない）、全体では5回まで
+	tests := []struct {
+		path     string
+		ip       string
+		expected int
+	}{
+		{"/login", "192.0.2.1:1234", http.StatusOK},
+		{"/login", "192.0.2.1:1234", http.StatusOK},
+		{"/login", "192.0.2.1:1234", http.StatusTooManyRequests},
+		{"/", "192.0.2.1:1234", http.StatusOK},
+		{"/", "192.0.2.1:1234", http.StatusOK},
+		{"/", "192.0.2.1:1234", http.StatusOK},
+		{"/", "192.0.2.1:1234", http.StatusTooManyRequests},
+		{"/login", "192.0.2.2:1234", http.StatusOK},
+		{"/healthz", "192.0.2.1:1234", http.StatusOK},
+	}
+	for i, tt := range tests {
+		rr := request(tt.path, tt.ip)
+		if rr.Code != tt.expected {
+			t.Fatalf("%d: %s %s: 期待されるステータスコード %d, 実際のステータスコード %d", i, tt.ip, tt.path, tt.expected, rr.Code)
+		}
+		if rr.Code == http.StatusTooManyRequests && rr.Header().Get("Retry-After") == "" {
+			t.Errorf("%d: Retry-After が付いていません", i)
+		}
+	}
+	if v := s.state.metrics.rateLimited.Value("RATE_LIMIT_PATHS /login"); v != 1 {
+		t.Errorf("期待される拒否数 1, 実際の拒否数 %g", v)
+	}
+	rr := httptest.NewRecorder()
+	s.admin.ServeHTTP(rr, httptest.NewRequest("GET", cfg.Metrics.Path, nil))
+	if !strings.Contains(rr.Body.String(), `spa_rate_limited_requests_total{limit="RATE_LIMIT"} 1`) {
+		t.Errorf("メトリクスに拒否数が含まれていません: %s", rr.Body.String())
+	}
+}
+
+func TestRateLimitRefill(t *testing.T) {
+	l := newRateLimit("RATE_LIMIT", "", rate{count: 2, period: time.Second})
+	now := time.Now()
+	l.allow("192.0.2.1", now)
+	l.allow("192.0.2.1", now)
+	if ok, wait := l.allow("192.0.2.1", now); ok || wait != 500*time.Millisecond {
+		t.Errorf("期待される待ち時間 500ms, 実際の値 %v %v", ok, wait)
+	}
+	if ok, _ := l.allow("192.0.2.1", now.Add(500*time.Millisecond)); !ok {
+		t.Error("補充されたトークンで許可されるべきです")
+	}
+	// 補充が終わったバケットは削除される
+	l.allow("192.0.2.2", now.Add(2*time.Second))
+	if len(l.buckets) != 1 {
+		t.Errorf("期待されるバケット数 1, 実際のバケット数 %d", len(l.buckets))
+	}
+}
+
+func TestRateLimitRefundPathToken(t *testing.T) {
+	l, err := newRateLimiter(RateLimitConfig{Limit: "1/min", Paths: []string{"/login=2/min"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if limit, _ := l.check("192.0.2.1", "/login", now); limit != nil {
+		t.Fatalf("許可されるべきです: %s", limit.name)
+	}
+	if limit, _ := l.check("192.0.2.1", "/login", now); limit != l.global {
+		t.Fatalf("RATE_LIMIT で拒否されるべきです: %v", limit)
+	}
+	// RATE_LIMIT で拒否したリクエストはパスの上限を使わない
+	if tokens := l.paths[0].buckets["192.0.2.1"].tokens; tokens != 1 {
+		t.Errorf("期待されるパスの残りトークン 1, 実際の値 %g", tokens)
+	}
+}
+
+func TestRateLimitAcrossReload(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.RateLimit = RateLimitConfig{Limit: "1/min", Paths: []string{"/login=1/min"}}
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	request := func(s *server, path string) int {
+		r := httptest.NewRequest("GET", path, nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, r)
+		return rr.Code
+	}
+	if code := request(s, "/login"); code != http.StatusOK {
+		t.Fatalf("期待されるステータスコード %d, 実際のステータスコード %d", http.StatusOK, code)
+	}
+
+	// 上限が同じ間は、設定を読み込み直してもクライアントIPごとの回数を引き継ぐ
+	reloaded, err := newServer(cfg, withState(s.state))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+	if code := request(reloaded, "/login"); code != http.StatusTooManyRequests {
+		t.Errorf("読み込み直した後も上限を超えたリクエストを拒否する必要があります: %d", code)
+	}
+
+	// 値を変えた上限は数え直す
+	cfg.RateLimit.Paths = []string{"/login=2/min"}
+	cfg.RateLimit.Limit = "2/min"
+	changed, err := newServer(cfg, withState(s.state))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer changed.Close()
+	if code := request(changed, "/login"); code != http.StatusOK {
+		t.Errorf("値を変えた上限は数え直す必要があります: %d", code)
+	}
+	if len(s.state.rateLimits) != 2 {
+		t.Errorf("使わなくなった上限が残っています: %v", s.state.rateLimits)
+	}
+}
@@ -0,0 +1,199 @@
+package spaserver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// recordMaxBody は記録するリクエスト・レスポンスのボディの上限（超えた場合は記録しない）
+const recordMaxBody = 10 << 20
+
+// recording は記録したリクエストとレスポンスの組
+type recording struct {
+	Request struct {
+		Method string      `json:"method"`
+		URL    string      `json:"url"`
+		Header http.Header `json:"header"`
+		recordedBody
+	} `json:"request"`
+	Response struct {
+		Status int         `json:"status"`
+		Header http.Header `json:"header"`
+		recordedBody
+	} `json:"response"`
+}
+
+// recordedBody はボディを UTF-8 のテキストならそのまま、それ以外は base64 で保存する
+type recordedBody struct {
+	Body       string `json:"body,omitempty"`
+	BodyBase64 []byte `json:"body_base64,omitempty"`
+}
+
+func newRecordedBody(b []byte) recordedBody {
+	if utf8.Valid(b) {
+		return recordedBody{Body: string(b)}
+	}
+	return recordedBody{BodyBase64: b}
+}
+
+func (b recordedBody) bytes() []byte {
+	if b.BodyBase64 != nil {
+		return b.BodyBase64
+	}
+	return []byte(b.Body)
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// recordingFile はリクエストを記録するファイルのパスを返す
+// ファイル名はメソッドとパス（読みやすさのため）と、URL とボディのハッシュ
+func recordingFile(dir, method, requestURI string, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", method, requestURI)
+	h.Write(body)
+	path, _, _ := strings.Cut(requestURI, "?")
+	name := strings.Trim(unsafeFileChars.ReplaceAllString(path, "_"), "_")
+	if len(name) > 80 {
+		name = name[:80]
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s_%s_%s.json", method, name, hex.EncodeToString(h.Sum(nil))[:16]))
+}
+
+// sensitiveHeaders は記録・ログ出力の際に値を伏せるヘッダー
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// redactHeader は認証情報を含むヘッダーの値を伏せたコピーを返す
+func redactHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for _, key := range sensitiveHeaders {
+		if _, ok := h[key]; ok {
+			h[key] = []string{"REDACTED"}
+		}
+	}
+	return h
+}
+
+// readRequestBody はリクエストボディを読み込み、後続の処理のために戻す
+func readRequestBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// trafficRecorder はプロキシしたリクエストとレスポンスを PROXY_RECORD_DIR に保存する
+type trafficRecorder struct {
+	dir string
+}
+
+// Wrap はプロキシのハンドラーに記録を追加する
+func (rc *trafficRecorder) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := readRequestBody(r)
+		if err != nil {
+			if isBodyTooLarge(err) {
+				http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		rec := &bodyRecorder{responseRecorder: responseRecorder{ResponseWriter: w}}
+		next.ServeHTTP(rec, r)
+		if rec.overflow || len(body) > recordMaxBody {
+			warnf("Not recording %s %s: body exceeds %d bytes", r.Method, r.URL.Path, recordMaxBody)
+			return
+		}
+
+		var entry recording
+		entry.Request.Method = r.Method
+		entry.Request.URL = r.URL.RequestURI()
+		entry.Request.Header = redactHeader(r.Header)
+		entry.Request.recordedBody = newRecordedBody(body)
+		entry.Response.Status = rec.Status()
+		entry.Response.Header = w.Header().Clone()
+		entry.Response.Header.Del("Content-Length")
+		entry.Response.recordedBody = newRecordedBody(rec.body.Bytes())
+		data, err := json.MarshalIndent(entry, "", "  ")
+		if err != nil {
+			errorf("Error recording %s %s: %v", r.Method, r.URL.Path, err)
+			return
+		}
+		file := recordingFile(rc.dir, r.Method, entry.Request.URL, body)
+		if err := os.WriteFile(file, append(data, '\n'), 0644); err != nil {
+			errorf("Error recording %s %s: %v", r.Method, r.URL.Path, err)
+			return
+		}
+		debugf("Recorded %s %s -> %s", r.Method, r.URL.Path, file)
+	})
+}
+
+// bodyRecorder はレスポンスを送信しながらボディを記録する
+type bodyRecorder struct {
+	responseRecorder
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (rec *bodyRecorder) Write(b []byte) (int, error) {
+	if !rec.overflow {
+		if rec.body.Len()+len(b) > recordMaxBody {
+			rec.overflow = true
+			rec.body.Reset()
+		} else {
+			rec.body.Write(b)
+		}
+	}
+	return rec.responseRecorder.Write(b)
+}
+
+// trafficReplayer は PROXY_REPLAY_DIR に記録したレスポンスを返す（バックエンドにはプロキシしない）
+type trafficReplayer struct {
+	dir string
+}
+
+func (rp *trafficReplayer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := readRequestBody(r)
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	file := recordingFile(rp.dir, r.Method, r.URL.RequestURI(), body)
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		warnf("No recording for %s %s", r.Method, r.URL.RequestURI())
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no recording for " + r.Method + " " + r.URL.RequestURI()})
+		return
+	}
+	var entry recording
+	if err == nil {
+		err = json.Unmarshal(data, &entry)
+	}
+	if err != nil {
+		errorf("Error reading recording %s: %v", file, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	debugf("Replaying %s %s <- %s", r.Method, r.URL.Path, file)
+	for key, values := range entry.Response.Header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(entry.Response.Status)
+	w.Write(entry.Response.bytes())
+}
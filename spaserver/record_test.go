@@ -0,0 +1,95 @@
+package spaserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	calls := 0
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Backend", "yes")
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+		}
+		w.Write([]byte(`{"path":"` + r.URL.RequestURI() + `"}`))
+	}))
+	defer backend.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+	recordDir := filepath.Join(t.TempDir(), "recordings")
+
+	requests := []struct {
+		method string
+		target string
+		body   string
+	}{
+		{"GET", "/api/users?page=1", ""},
+		{"GET", "/api/users?page=2", ""},
+		{"POST", "/api/users", `{"name":"a"}`},
+	}
+
+	// 記録
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Proxy.URL = backend.URL
+	cfg.Proxy.Paths = []string{"/api"}
+	cfg.Proxy.RecordDir = recordDir
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recorded []*httptest.ResponseRecorder
+	for _, req := range requests {
+		r := httptest.NewRequest(req.method, req.target, strings.NewReader(req.body))
+		r.Header.Set("Authorization", "Bearer secret")
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, r)
+		recorded = append(recorded, rr)
+	}
+	files, _ := os.ReadDir(recordDir)
+	if len(files) != len(requests) {
+		t.Fatalf("期待される記録数 %d, 実際の記録数 %d", len(requests), len(files))
+	}
+	data, _ := os.ReadFile(filepath.Join(recordDir, files[0].Name()))
+	if strings.Contains(string(data), "secret") {
+		t.Error("Authorization ヘッダーが記録されています")
+	}
+
+	// 再生（バックエンドにはプロキシしない）
+	calls = 0
+	cfg.Proxy.URL = ""
+	cfg.Proxy.RecordDir = ""
+	cfg.Proxy.ReplayDir = recordDir
+	s, err = newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, req := range requests {
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, httptest.NewRequest(req.method, req.target, strings.NewReader(req.body)))
+		if rr.Code != recorded[i].Code || rr.Body.String() != recorded[i].Body.String() {
+			t.Errorf("%s %s: 記録と異なるレスポンス %d %s", req.method, req.target, rr.Code, rr.Body.String())
+		}
+		if rr.Header().Get("X-Backend") != "yes" {
+			t.Errorf("%s %s: ヘッダーが再生されていません", req.method, req.target)
+		}
+	}
+	if calls != 0 {
+		t.Errorf("再生時にバックエンドにアクセスしています: %d 回", calls)
+	}
+
+	// 記録のないリクエスト
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest("POST", "/api/users", strings.NewReader(`{"name":"b"}`)))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("記録のないリクエストは 404 になるべきです: %d", rr.Code)
+	}
+}
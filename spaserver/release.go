@@ -0,0 +1,222 @@
+package spaserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// releaseScanInterval はリリースディレクトリを再スキャンする間隔
+const releaseScanInterval = 5 * time.Second
+
+// rollbackStateFile はロールバック状態を保存するファイル名（RELEASES_DIR 直下）
+const rollbackStateFile = ".rollback.json"
+
+type release struct {
+	ID         string    `json:"id"`
+	DeployedAt time.Time `json:"deployed_at"`
+	Active     bool      `json:"active"`
+}
+
+// rollbackState はロールバックで固定したリリースと、その時点の最新リリース
+type rollbackState struct {
+	To     string `json:"to"`
+	Latest string `json:"latest"`
+}
+
+// releaseManager は RELEASES_DIR 配下のリリースを管理する
+// 通常は最新のリリースを配信し、ロールバック後は新しいリリースが配置されるまで固定する
+type releaseManager struct {
+	dir  string
+	keep int
+
+	mu       sync.RWMutex
+	releases []release // デプロイ日時の古い順
+	active   string
+	pin      rollbackState
+
+	stop chan struct{}
+}
+
+func newReleaseManager(dir string, keep int) (*releaseManager, error) {
+	m := &releaseManager{dir: dir, keep: keep, stop: make(chan struct{})}
+	if data, err := os.ReadFile(filepath.Join(dir, rollbackStateFile)); err == nil {
+		if err := json.Unmarshal(data, &m.pin); err != nil {
+			errorf("Error reading rollback state: %v", err)
+		}
+	}
+	if err := m.Refresh(); err != nil {
+		return nil, err
+	}
+	go m.run()
+	return m, nil
+}
+
+func (m *releaseManager) run() {
+	ticker := time.NewTicker(releaseScanInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.Refresh(); err != nil {
+				errorf("Error scanning releases: %v", err)
+			}
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// Close は定期スキャンを停止する
+func (m *releaseManager) Close() {
+	close(m.stop)
+}
+
+// Dir は現在配信中のリリースディレクトリを返す
+func (m *releaseManager) Dir() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return filepath.Join(m.dir, m.active)
+}
+
+// Releases はリリース一覧（古い順）と配信中のリリースIDを返す
+func (m *releaseManager) Releases() ([]release, string) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	list := make([]release, len(m.releases))
+	for i, r := range m.releases {
+		r.Active = r.ID == m.active
+		list[i] = r
+	}
+	return list, m.active
+}
+
+// Refresh はリリースディレクトリを再スキャンし、配信するリリースを決定する
+func (m *releaseManager) Refresh() error {
+	releases, err := listReleases(m.dir)
+	if err != nil {
+		return err
+	}
+	latest := releases[len(releases)-1].ID
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// ロールバック後に新しいリリースが配置された場合は固定を解除する
+	if m.pin.To != "" && (m.pin.Latest != latest || !containsRelease(releases, m.pin.To)) {
+		infof("Release %s deployed, clearing rollback to %s", latest, m.pin.To)
+		m.pin = rollbackState{}
+		os.Remove(filepath.Join(m.dir, rollbackStateFile))
+	}
+	active := latest
+	if m.pin.To != "" {
+		active = m.pin.To
+	}
+	if active != m.active {
+		infof("Serving release: %s", active)
+		m.active = active
+	}
+	m.releases = m.prune(releases)
+	return nil
+}
+
+// prune は保持数を超えた古いリリースを削除する（配信中のリリースは削除しない）
+func (m *releaseManager) prune(releases []release) []release {
+	if m.keep <= 0 || len(releases) <= m.keep {
+		return releases
+	}
+	excess := len(releases) - m.keep
+	var kept []release
+	for _, r := range releases {
+		if excess > 0 && r.ID != m.active {
+			if err := os.RemoveAll(filepath.Join(m.dir, r.ID)); err != nil {
+				errorf("Error removing release %s: %v", r.ID, err)
+				kept = append(kept, r)
+			} else {
+				infof("Removed old release: %s", r.ID)
+			}
+			excess--
+			continue
+		}
+		kept = append(kept, r)
+	}
+	return kept
+}
+
+// Rollback は指定したリリースに切り替える（to が空の場合は一つ前のリリース）
+func (m *releaseManager) Rollback(to string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if to == "" {
+		for i, r := range m.releases {
+			if r.ID == m.active {
+				if i == 0 {
+					return "", errors.New("no previous release")
+				}
+				to = m.releases[i-1].ID
+				break
+			}
+		}
+	}
+	if !containsRelease(m.releases, to) {
+		return "", fmt.Errorf("release %q not found", to)
+	}
+
+	state := rollbackState{To: to, Latest: m.releases[len(m.releases)-1].ID}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(m.dir, rollbackStateFile), data, 0644); err != nil {
+		return "", err
+	}
+	m.pin = state
+	infof("Rolled back from %s to %s", m.active, to)
+	m.active = to
+	return to, nil
+}
+
+func containsRelease(releases []release, id string) bool {
+	for _, r := range releases {
+		if r.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// listReleases はリリースディレクトリ内のリリースをデプロイ日時の古い順に返す
+func listReleases(dir string) ([]release, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var releases []release
+	for _, e := range entries {
+		// 隠しディレクトリ（状態ファイルやデプロイ途中の一時ディレクトリ）は除外
+		if !e.IsDir() || e.Name()[0] == '.' {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		releases = append(releases, release{ID: e.Name(), DeployedAt: info.ModTime()})
+	}
+	if len(releases) == 0 {
+		return nil, fmt.Errorf("no releases found in %s", dir)
+	}
+	sort.Slice(releases, func(i, j int) bool {
+		if releases[i].DeployedAt.Equal(releases[j].DeployedAt) {
+			return releases[i].ID < releases[j].ID
+		}
+		return releases[i].DeployedAt.Before(releases[j].DeployedAt)
+	})
+	return releases, nil
+}
@@ -0,0 +1,86 @@
+package spaserver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// createRelease はテスト用のリリースディレクトリを作成する
+func createRelease(t *testing.T, dir, id string, deployedAt time.Time) {
+	t.Helper()
+	releaseDir := filepath.Join(dir, id)
+	if err := os.MkdirAll(releaseDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(releaseDir, "index.html"), []byte(id), 0644)
+	if err := os.Chtimes(releaseDir, deployedAt, deployedAt); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReleaseManager(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Now().Add(-time.Hour)
+	createRelease(t, dir, "v1", base)
+	createRelease(t, dir, "v2", base.Add(time.Minute))
+	createRelease(t, dir, "v3", base.Add(2*time.Minute))
+
+	m, err := newReleaseManager(dir, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if got := m.Dir(); got != filepath.Join(dir, "v3") {
+		t.Errorf("最新のリリースが配信されていません。実際: %s", got)
+	}
+
+	// 引数なしのロールバックは一つ前のリリースに戻る
+	if active, err := m.Rollback(""); err != nil || active != "v2" {
+		t.Fatalf("ロールバックに失敗しました: %s, %v", active, err)
+	}
+	if _, err := m.Rollback("v9"); err == nil {
+		t.Error("存在しないリリースへのロールバックはエラーになるべきです")
+	}
+
+	// 再スキャンしてもロールバック状態は維持される
+	if err := m.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Dir(); got != filepath.Join(dir, "v2") {
+		t.Errorf("ロールバック状態が維持されていません。実際: %s", got)
+	}
+
+	// 新しいリリースが配置されるとロールバックは解除される
+	createRelease(t, dir, "v4", base.Add(3*time.Minute))
+	if err := m.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Dir(); got != filepath.Join(dir, "v4") {
+		t.Errorf("新しいリリースが配信されていません。実際: %s", got)
+	}
+}
+
+func TestReleaseManagerPrune(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Now().Add(-time.Hour)
+	for i, id := range []string{"r1", "r2", "r3", "r4"} {
+		createRelease(t, dir, id, base.Add(time.Duration(i)*time.Minute))
+	}
+
+	m, err := newReleaseManager(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	releases, active := m.Releases()
+	if len(releases) != 2 || active != "r4" {
+		t.Fatalf("保持数を超えたリリースが削除されていません: %v", releases)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "r1")); !os.IsNotExist(err) {
+		t.Error("古いリリースディレクトリが削除されていません")
+	}
+}
@@ -0,0 +1,345 @@
+package spaserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// configSource は設定の読み込み元（.env・設定ファイル・コマンドラインフラグ）
+type configSource struct {
+	file  string
+	flags configFlags
+
+	// 起動時点で設定済みの環境変数（.env より優先する）
+	baseEnv map[string]bool
+	// .env から設定した環境変数
+	dotenvKeys map[string]bool
+	// .env を探すディレクトリ（空の場合はカレントディレクトリ）
+	envDir string
+
+	mu sync.Mutex
+	// Vault のリースを更新する時刻（ゼロの場合は更新しない）
+	renewAt time.Time
+	// 使用中の設定の Vault のリースと、読み込んだが使い始めていない設定の Vault のリース
+	leases       *vaultLeases
+	loadedLeases *vaultLeases
+	// 設定を置いた KV ストア（--config が consul+ または etcd+ の場合）と読み込んだ値のバージョン
+	remote  remoteConfig
+	version uint64
+}
+
+// appEnvKey は追加で読み込む .env.<APP_ENV> を選ぶ環境変数
+const appEnvKey = "APP_ENV"
+
+func newConfigSource(file string, flags configFlags) *configSource {
+	c := &configSource{file: file, flags: flags, baseEnv: map[string]bool{}, dotenvKeys: map[string]bool{}}
+	for _, kv := range os.Environ() {
+		c.baseEnv[strings.SplitN(kv, "=", 2)[0]] = true
+	}
+	return c
+}
+
+// Load は .env を読み込み直し、設定を解決する（設定ファイル < 環境変数 < コマンドラインフラグ）
+func (c *configSource) Load() (Config, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// .env ファイルを読み込み、APP_ENV が設定されていれば .env.<APP_ENV> で上書きする
+	env := c.readDotenv(".env")
+	appEnv := env[appEnvKey]
+	if c.baseEnv[appEnvKey] {
+		appEnv = os.Getenv(appEnvKey)
+	}
+	if appEnv != "" {
+		if strings.ContainsAny(appEnv, `/\`) || strings.HasPrefix(appEnv, ".") {
+			warnf("Ignoring APP_ENV %q: not a valid profile name", appEnv)
+		} else {
+			for key, value := range c.readDotenv(".env." + appEnv) {
+				env[key] = value
+			}
+		}
+	}
+	for key := range c.dotenvKeys {
+		if _, ok := env[key]; !ok {
+			os.Unsetenv(key)
+			delete(c.dotenvKeys, key)
+		}
+	}
+	for key, value := range env {
+		if !c.baseEnv[key] {
+			os.Setenv(key, value)
+			c.dotenvKeys[key] = true
+		}
+	}
+
+	cfg, err := c.loadFile()
+	if err != nil {
+		return cfg, err
+	}
+	if err := c.flags.apply(&cfg); err != nil {
+		return cfg, err
+	}
+	leases, err := resolveVaultSecrets(&cfg)
+	if err != nil {
+		return cfg, err
+	}
+	// 起動時の設定はそのまま使い始める。読み込み直した設定は reload で差し替えた後に使用中のリースを入れ替える
+	loaded := &vaultLeases{vault: cfg.Vault, leases: leases}
+	if c.leases == nil {
+		c.leases = loaded
+		c.renewAt = loaded.renewAt()
+	} else {
+		if c.loadedLeases != nil {
+			c.loadedLeases.revoke(c.leases)
+		}
+		c.loadedLeases = loaded
+	}
+	return cfg, nil
+}
+
+// loadFile は設定ファイルまたは KV ストアの設定を読み込む
+func (c *configSource) loadFile() (Config, error) {
+	if !isRemoteConfig(c.file) {
+		return LoadConfig(c.file)
+	}
+	if c.remote == nil {
+		remote, err := newRemoteConfig(c.file)
+		if err != nil {
+			return DefaultConfig(), fmt.Errorf("--config: %w", err)
+		}
+		c.remote = remote
+	}
+	data, version, err := c.remote.get(context.Background())
+	if err != nil {
+		return DefaultConfig(), err
+	}
+	cfg, err := parseConfig(data, c.file)
+	if err == nil {
+		c.version = version
+	}
+	return cfg, err
+}
+
+// remoteVersion は KV ストアから読み込んだ設定のバージョンを返す
+func (c *configSource) remoteVersion() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.version
+}
+
+// vaultRenewAt は Vault のリースを更新する時刻を返す
+func (c *configSource) vaultRenewAt() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.renewAt
+}
+
+func (c *configSource) setVaultRenewAt(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.renewAt = t
+}
+
+// readDotenv は .env 形式のファイルを読み込む（ない場合は空）
+func (c *configSource) readDotenv(name string) map[string]string {
+	env, err := godotenv.Read(filepath.Join(c.envDir, name))
+	if os.IsNotExist(err) {
+		debugf("No %s file found", name)
+	} else if err != nil {
+		warnf("Error loading %s file: %v", name, err)
+	}
+	if env == nil {
+		env = map[string]string{}
+	}
+	return env
+}
+
+// handlerSwitch は設定の再読み込み時に差し替え可能なハンドラー
+// 差し替えるたびに現在のサーバーの状態（serverState）を新しいサーバーに引き継ぐ
+// 差し替えた古いサーバーは、処理中のリクエストが終わってから閉じる
+type handlerSwitch struct {
+	current atomic.Pointer[server]
+	// 処理中のリクエストを待って閉じている古いサーバー
+	retiring sync.WaitGroup
+}
+
+// acquire は現在のサーバーを返し、処理中のリクエストとして数える（requests.end で数え終わる）
+func (h *handlerSwitch) acquire() *server {
+	for {
+		s := h.current.Load()
+		if s.requests.begin() {
+			return s
+		}
+		// 差し替えられた直後の古いサーバーは受け付けないため、新しいサーバーで処理する
+	}
+}
+
+// retire は差し替えた古いサーバーをバックグラウンドで閉じる
+func (h *handlerSwitch) retire(old, next *server) {
+	h.retiring.Add(1)
+	go func() {
+		defer h.retiring.Done()
+		old.retire(next)
+	}()
+}
+
+// state は現在のサーバーの状態を返す（サーバーがない場合は nil）
+func (h *handlerSwitch) state() *serverState {
+	if s := h.current.Load(); s != nil {
+		return s.state
+	}
+	return nil
+}
+
+func (h *handlerSwitch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// ライブリロードの接続は新しいサーバーに引き継ぐため、古いサーバーを閉じるまで待たない
+	if r.URL.Path == liveReloadPath {
+		h.current.Load().ServeHTTP(w, r)
+		return
+	}
+	s := h.acquire()
+	defer s.requests.end()
+	s.ServeHTTP(w, r)
+}
+
+// Admin は現在の設定の管理用インターフェースを返すハンドラー
+func (h *handlerSwitch) Admin() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 管理画面の Server-Sent Events は古いサーバーを閉じる前に切断し、新しいサーバーに接続し直させる
+		if r.URL.Path == dashboardEventsPath {
+			h.current.Load().admin.ServeHTTP(w, r)
+			return
+		}
+		s := h.acquire()
+		defer s.requests.end()
+		s.admin.ServeHTTP(w, r)
+	})
+}
+
+// requestTracker は処理中のリクエストを数える
+type requestTracker struct {
+	mu       sync.Mutex
+	active   int
+	draining bool
+	idle     chan struct{}
+}
+
+// begin はリクエストを数え始める（drain の後は false を返す）
+func (t *requestTracker) begin() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return false
+	}
+	t.active++
+	return true
+}
+
+func (t *requestTracker) end() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active--
+	if t.draining && t.active == 0 {
+		close(t.idle)
+	}
+}
+
+// drain は新しいリクエストを受け付けなくし、処理中のリクエストが終わるまで待つ
+// timeout を過ぎた場合は false を返す（0 の場合は期限なし）
+func (t *requestTracker) drain(timeout time.Duration) bool {
+	t.mu.Lock()
+	t.draining = true
+	t.idle = make(chan struct{})
+	if t.active == 0 {
+		close(t.idle)
+	}
+	idle := t.idle
+	t.mu.Unlock()
+	if timeout <= 0 {
+		<-idle
+		return true
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-idle:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// reloadOnSignal は SIGHUP を受け取るたびに設定を読み込み直し、新しいリクエストから適用する
+// ポートなどリスナーに関する設定は再起動するまで反映されない
+func reloadOnSignal(source *configSource, h *handlerSwitch) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	for range ch {
+		infof("Received SIGHUP, reloading configuration")
+		if err := reload(source, h); err != nil {
+			errorf("Error reloading configuration: %v", err)
+		}
+	}
+}
+
+// reloadMu は SIGHUP・Vault のリースの期限・KV ストアの設定の変更による読み込み直しを一つずつ行う
+var reloadMu sync.Mutex
+
+// reload は設定を読み込み直してハンドラーを差し替える（失敗した場合は現在の設定のまま）
+func reload(source *configSource, h *handlerSwitch) error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	used := false
+	defer func() { source.commitVaultLeases(used) }()
+
+	cfg, err := source.Load()
+	if err != nil {
+		return err
+	}
+	srv, err := newServer(cfg, withState(h.state()))
+	if err != nil {
+		return err
+	}
+	if err := setupLogging(cfg.Log); err != nil {
+		srv.Close()
+		return err
+	}
+	if err := setupTLS(cfg.TLS, cfg.Dev.TLS); err != nil {
+		srv.Close()
+		return err
+	}
+	if err := setupStatsd(cfg.Statsd); err != nil {
+		errorf("Error configuring statsd: %v", err)
+	}
+	old := h.current.Swap(srv)
+	used = true
+	if old != nil {
+		if listenerAddrs(old.cfg) != listenerAddrs(cfg) {
+			warnf("Listener address changes take effect after restart")
+		}
+		h.retire(old, srv)
+	}
+	infof("Configuration reloaded")
+	return nil
+}
+
+// listenerAddrs はリスナーに関する設定をまとめた文字列を返す（変更の検出用）
+func listenerAddrs(cfg Config) string {
+	return strings.Join([]string{
+		strings.Join(cfg.PublicAddrs(), ","),
+		strings.Join(cfg.TLS.Listen, ","),
+		cfg.Admin.Addr,
+		cfg.Metrics.Addr,
+	}, " ")
+}
@@ -0,0 +1,159 @@
+package spaserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+	configPath := filepath.Join(dir, "config.yaml")
+	os.WriteFile(configPath, []byte("watch_dist_dir: false\n"), 0644)
+	t.Setenv("DIST_DIR", dir)
+	t.Setenv("ALLOW_REMOTE_IPS", "")
+
+	source := newConfigSource(configPath, configFlags{})
+	h := &handlerSwitch{}
+	if err := reload(source, h); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func() int {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	if code := get(); code != http.StatusOK {
+		t.Fatalf("期待されるステータスコード %d, 実際のステータスコード %d", http.StatusOK, code)
+	}
+
+	// 設定ファイルの変更は再読み込み後のリクエストから反映される
+	state := h.state()
+	os.WriteFile(configPath, []byte("watch_dist_dir: false\nallow_remote_ips: [127.0.0.1]\n"), 0644)
+	if err := reload(source, h); err != nil {
+		t.Fatal(err)
+	}
+	// 管理 API による変更やメトリクスは新しいサーバーに引き継ぐ
+	if h.state() != state {
+		t.Error("再読み込み後のサーバーに状態が引き継がれていません")
+	}
+	if code := get(); code != http.StatusForbidden {
+		t.Errorf("期待されるステータスコード %d, 実際のステータスコード %d", http.StatusForbidden, code)
+	}
+
+	// 不正な設定の場合は現在の設定のまま
+	os.WriteFile(configPath, []byte("releases: [\n"), 0644)
+	if err := reload(source, h); err == nil {
+		t.Error("不正な設定ファイルの再読み込みはエラーになるべきです")
+	}
+	if code := get(); code != http.StatusForbidden {
+		t.Errorf("再読み込みに失敗した場合は現在の設定が維持されるべきです。実際のステータスコード %d", code)
+	}
+}
+
+func TestReloadDrainsPreviousServer(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+	configPath := filepath.Join(dir, "config.yaml")
+	os.WriteFile(configPath, []byte("watch_dist_dir: false\ndev:\n  enabled: true\n"), 0644)
+	t.Setenv("DIST_DIR", dir)
+	t.Setenv("ALLOW_REMOTE_IPS", "")
+
+	source := newConfigSource(configPath, configFlags{})
+	h := &handlerSwitch{}
+	if err := reload(source, h); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { h.current.Load().Close() }()
+
+	// 読み込み直す前に受け付けたリクエストが終わるまで古いサーバーを閉じない
+	old := h.acquire()
+	if err := reload(source, h); err != nil {
+		t.Fatal(err)
+	}
+	if s := h.acquire(); s == old {
+		t.Fatal("読み込み直した後のリクエストは新しいサーバーで処理する必要があります")
+	} else {
+		s.requests.end()
+	}
+	retired := make(chan struct{})
+	go func() {
+		h.retiring.Wait()
+		close(retired)
+	}()
+	select {
+	case <-retired:
+		t.Fatal("処理中のリクエストがある間は古いサーバーを閉じるべきではありません")
+	case <-time.After(50 * time.Millisecond):
+	}
+	old.requests.end()
+	select {
+	case <-retired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("処理中のリクエストが終わった後に古いサーバーを閉じる必要があります")
+	}
+
+	// ライブリロードの接続は新しいサーバーに引き継ぎ、閉じない
+	if h.current.Load().live != old.live {
+		t.Error("ライブリロードが新しいサーバーに引き継がれていません")
+	}
+	select {
+	case <-old.live.closed:
+		t.Error("引き継いだライブリロードの接続を閉じるべきではありません")
+	default:
+	}
+}
+
+func TestConfigSourceAppEnv(t *testing.T) {
+	keys := []string{"PORT", "BIND_ADDR", "APP_ENV"}
+	for _, key := range keys {
+		// 終了後に元の値に戻す
+		t.Setenv(key, "")
+	}
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, ".env"), []byte("PORT=9100\nBIND_ADDR=127.0.0.1\nAPP_ENV=staging\n"), 0644)
+	os.WriteFile(filepath.Join(dir, ".env.staging"), []byte("PORT=9200\n"), 0644)
+	os.WriteFile(filepath.Join(dir, ".env.production"), []byte("PORT=9300\n"), 0644)
+
+	// env を起動時の環境変数として読み込む
+	load := func(env map[string]string) Config {
+		t.Helper()
+		for _, key := range keys {
+			os.Unsetenv(key)
+		}
+		for key, value := range env {
+			os.Setenv(key, value)
+		}
+		source := newConfigSource("", configFlags{})
+		source.envDir = dir
+		cfg, err := source.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cfg
+	}
+
+	// .env の APP_ENV で選んだ .env.staging が .env を上書きする
+	if cfg := load(nil); cfg.Port != "9200" || cfg.BindAddr != "127.0.0.1" {
+		t.Errorf("期待される設定 9200 127.0.0.1, 実際の設定 %s %s", cfg.Port, cfg.BindAddr)
+	}
+	// 環境変数の APP_ENV は .env より優先する
+	if cfg := load(map[string]string{"APP_ENV": "production"}); cfg.Port != "9300" {
+		t.Errorf("期待される PORT 9300, 実際の PORT %s", cfg.Port)
+	}
+	// 環境変数は .env.<APP_ENV> より優先する
+	if cfg := load(map[string]string{"APP_ENV": "production", "PORT": "9400"}); cfg.Port != "9400" {
+		t.Errorf("期待される PORT 9400, 実際の PORT %s", cfg.Port)
+	}
+	// プロファイル名にパスは使えない
+	if cfg := load(map[string]string{"APP_ENV": "../staging"}); cfg.Port != "9100" {
+		t.Errorf("期待される PORT 9100, 実際の PORT %s", cfg.Port)
+	}
+}
@@ -0,0 +1,211 @@
+package spaserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KV ストアからの設定の読み込み
+// --config に consul+http://host:8500/キー や etcd+http://host:2379/キー を指定すると、設定ファイルの代わりに
+// Consul KV・etcd のキーの値（YAML）を読み込み、変更されたら SIGHUP と同じように読み込み直す。
+// 複数のサーバーの設定を KV ストアでまとめて変更できるようにする
+
+const (
+	// 読み込みのタイムアウト
+	remoteConfigTimeout = 10 * time.Second
+	// Consul のブロッキングクエリで待つ最長の時間
+	consulWatchWait = 5 * time.Minute
+	// etcd のキーの変更を確認する間隔
+	etcdPollInterval = 10 * time.Second
+	// 読み込みに失敗した場合に再び試すまでの時間
+	remoteConfigRetryInterval = 10 * time.Second
+)
+
+// remoteConfig は設定を置いた KV ストアのキー
+type remoteConfig interface {
+	// get は値とそのバージョンを返す
+	get(ctx context.Context) ([]byte, uint64, error)
+	// wait は値がバージョン version から変わるか一定時間が経つまで待ち、その時点のバージョンを返す
+	wait(ctx context.Context, version uint64) (uint64, error)
+}
+
+// isRemoteConfig は --config が KV ストアを指しているかを返す
+func isRemoteConfig(location string) bool {
+	return strings.HasPrefix(location, "consul+") || strings.HasPrefix(location, "etcd+")
+}
+
+// newRemoteConfig は consul+http(s)://host:port/キー・etcd+http(s)://host:port/キー から KV ストアのクライアントを作成する
+func newRemoteConfig(location string) (remoteConfig, error) {
+	kind, rest, _ := strings.Cut(location, "+")
+	u, err := url.Parse(rest)
+	if err != nil {
+		return nil, err
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || key == "" {
+		return nil, fmt.Errorf("%q must be %s+http(s)://host:port/key", location, kind)
+	}
+	base := u.Scheme + "://" + u.Host
+	switch kind {
+	case "consul":
+		return &consulKV{addr: base, key: key, token: envOrFile("CONSUL_HTTP_TOKEN"), client: &http.Client{}}, nil
+	case "etcd":
+		return &etcdKV{addr: base, key: key, client: &http.Client{Timeout: remoteConfigTimeout}}, nil
+	}
+	return nil, fmt.Errorf("unknown configuration store %q", kind)
+}
+
+// envOrFile は環境変数の値を返す（<名前>_FILE が設定されている場合はファイルの内容）
+// 設定を読み込む前に使う KV ストアのトークン用
+func envOrFile(key string) string {
+	if path := os.Getenv(key + secretFileSuffix); path != "" {
+		if data, err := os.ReadFile(path); err == nil {
+			return strings.TrimRight(string(data), "\r\n")
+		}
+	}
+	return os.Getenv(key)
+}
+
+// consulKV は Consul KV のキー
+type consulKV struct {
+	addr   string
+	key    string
+	token  string
+	client *http.Client
+}
+
+func (c *consulKV) request(ctx context.Context, query string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", c.addr+"/v1/kv/"+c.key+query, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("consul: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("consul: key %s not found", c.key)
+		}
+		return nil, fmt.Errorf("consul: %s returned %s", req.URL.Path, resp.Status)
+	}
+	return resp, nil
+}
+
+func (c *consulKV) get(ctx context.Context) ([]byte, uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, remoteConfigTimeout)
+	defer cancel()
+	resp, err := c.request(ctx, "")
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	var entries []struct {
+		Value       []byte
+		ModifyIndex uint64
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, 0, fmt.Errorf("consul: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, 0, fmt.Errorf("consul: key %s not found", c.key)
+	}
+	return entries[0].Value, entries[0].ModifyIndex, nil
+}
+
+// wait は Consul のブロッキングクエリでキーの変更を待つ
+func (c *consulKV) wait(ctx context.Context, version uint64) (uint64, error) {
+	ctx, cancel := context.WithTimeout(ctx, consulWatchWait+remoteConfigTimeout)
+	defer cancel()
+	query := fmt.Sprintf("?index=%d&wait=%ds", version, int(consulWatchWait.Seconds()))
+	resp, err := c.request(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	index, err := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if err != nil {
+		return 0, errors.New("consul: missing X-Consul-Index")
+	}
+	return index, nil
+}
+
+// etcdKV は etcd（v3 の JSON API）のキー
+type etcdKV struct {
+	addr   string
+	key    string
+	client *http.Client
+}
+
+func (e *etcdKV) get(ctx context.Context) ([]byte, uint64, error) {
+	body, _ := json.Marshal(map[string]string{"key": base64.StdEncoding.EncodeToString([]byte(e.key))})
+	req, err := http.NewRequestWithContext(ctx, "POST", e.addr+"/v3/kv/range", bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	var result struct {
+		// 64 ビットの整数は文字列で返される
+		Kvs []struct {
+			Value       []byte
+			ModRevision uint64 `json:"mod_revision,string"`
+		}
+	}
+	if err := getJSON(e.client, req, &result); err != nil {
+		return nil, 0, fmt.Errorf("etcd: %w", err)
+	}
+	if len(result.Kvs) == 0 {
+		return nil, 0, fmt.Errorf("etcd: key %s not found", e.key)
+	}
+	return result.Kvs[0].Value, result.Kvs[0].ModRevision, nil
+}
+
+// wait は一定間隔でキーのリビジョンを確認する
+func (e *etcdKV) wait(ctx context.Context, version uint64) (uint64, error) {
+	select {
+	case <-time.After(etcdPollInterval):
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+	_, revision, err := e.get(ctx)
+	return revision, err
+}
+
+// watchRemoteConfig は KV ストアの設定の変更を待ち、変更されたら読み込み直す
+func watchRemoteConfig(source *configSource, h *handlerSwitch) {
+	if source.remote == nil {
+		return
+	}
+	version := source.remoteVersion()
+	for {
+		v, err := source.remote.wait(context.Background(), version)
+		if err != nil {
+			warnf("Watching remote configuration: %v", err)
+			time.Sleep(remoteConfigRetryInterval)
+			continue
+		}
+		if v == version {
+			continue
+		}
+		infof("Remote configuration changed, reloading")
+		if err := reload(source, h); err != nil {
+			errorf("Error reloading configuration: %v", err)
+		}
+		// 読み込みに失敗した場合も、同じ値で繰り返し読み込み直さないよう新しいバージョンを待つ
+		version = v
+	}
+}
@@ -0,0 +1,135 @@
+package spaserver
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeConsulKV は1つのキーを持つ Consul KV（ブロッキングクエリに対応）
+type fakeConsulKV struct {
+	mu      sync.Mutex
+	value   string
+	index   uint64
+	changed chan struct{}
+}
+
+func (c *fakeConsulKV) set(value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.value, c.index = value, c.index+1
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *fakeConsulKV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/kv/spa-server/config" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	c.mu.Lock()
+	index, changed := c.index, c.changed
+	c.mu.Unlock()
+	if r.URL.Query().Get("index") == fmt.Sprint(index) {
+		select {
+		case <-changed:
+		case <-time.After(5 * time.Second):
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w.Header().Set("X-Consul-Index", fmt.Sprint(c.index))
+	json.NewEncoder(w).Encode([]map[string]interface{}{{"Value": []byte(c.value), "ModifyIndex": c.index}})
+}
+
+func TestRemoteConfigConsul(t *testing.T) {
+	for _, key := range []string{"PORT", "DIST_DIR"} {
+		t.Setenv(key, "")
+	}
+	kv := &fakeConsulKV{changed: make(chan struct{})}
+	kv.set("port: \"9000\"\ndist_dir: ./dist\n")
+	consul := httptest.NewServer(kv)
+	defer consul.Close()
+
+	source := newConfigSource("consul+"+consul.URL+"/spa-server/config", configFlags{})
+	cfg, err := source.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != "9000" || cfg.DistDir != "./dist" {
+		t.Errorf("KV ストアの設定が読み込まれていません: %s %s", cfg.Port, cfg.DistDir)
+	}
+	version := source.remoteVersion()
+
+	// 変更されるまで待つ
+	done := make(chan uint64)
+	go func() {
+		v, err := source.remote.wait(context.Background(), version)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- v
+	}()
+	time.Sleep(50 * time.Millisecond)
+	kv.set("port: \"9100\"\n")
+	select {
+	case v := <-done:
+		if v == version {
+			t.Errorf("変更後のバージョンが返されるべきです: %d", v)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("変更を待ち続けています")
+	}
+	if cfg, _ := source.Load(); cfg.Port != "9100" {
+		t.Errorf("期待される PORT 9100, 実際の PORT %s", cfg.Port)
+	}
+
+	// 環境変数は KV ストアの設定より優先する
+	t.Setenv("PORT", "9200")
+	if cfg, _ := source.Load(); cfg.Port != "9200" {
+		t.Errorf("期待される PORT 9200, 実際の PORT %s", cfg.Port)
+	}
+
+	missing := newConfigSource("consul+"+consul.URL+"/spa-server/missing", configFlags{})
+	if _, err := missing.Load(); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("存在しないキーはエラーになるべきです: %v", err)
+	}
+}
+
+func TestRemoteConfigEtcd(t *testing.T) {
+	t.Setenv("PORT", "")
+	etcd := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ Key []byte }
+		json.NewDecoder(r.Body).Decode(&req)
+		if r.URL.Path != "/v3/kv/range" || string(req.Key) != "spa-server/config" {
+			io.WriteString(w, `{"header":{"revision":"12"}}`)
+			return
+		}
+		value := base64.StdEncoding.EncodeToString([]byte("port: \"9300\"\n"))
+		fmt.Fprintf(w, `{"header":{"revision":"12"},"kvs":[{"key":"","value":"%s","mod_revision":"7"}],"count":"1"}`, value)
+	}))
+	defer etcd.Close()
+
+	source := newConfigSource("etcd+"+etcd.URL+"/spa-server/config", configFlags{})
+	cfg, err := source.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != "9300" || source.remoteVersion() != 7 {
+		t.Errorf("期待される設定 9300 (revision 7), 実際の設定 %s (revision %d)", cfg.Port, source.remoteVersion())
+	}
+
+	for _, location := range []string{"etcd+" + etcd.URL + "/", "etcd+ftp://localhost/key", "zookeeper+http://localhost/key"} {
+		if _, err := newRemoteConfig(location); err == nil {
+			t.Errorf("%s はエラーになるべきです", location)
+		}
+	}
+}
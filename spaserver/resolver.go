@@ -0,0 +1,218 @@
+package spaserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultResolveInterval は PROXY_RESOLVE_INTERVAL を指定しない場合のサービスディスカバリーの間隔
+const defaultResolveInterval = 30 * time.Second
+
+// プロキシ先の探し方を示す URL スキームの接頭辞
+//
+//	srv+http://_api._tcp.example.com   SRV レコード
+//	consul+http://api                  Consul のサービス
+//	k8s+http://api.default:8080        Kubernetes の Service の EndpointSlice
+var discoverySchemes = []string{"srv", "consul", "k8s"}
+
+// upstreamResolver はプロキシ先のホスト名を定期的に名前解決し、接続先のアドレスを更新する
+// 複数のアドレスがある場合は順番に接続する
+type upstreamResolver struct {
+	host     string
+	port     string
+	interval time.Duration
+	// サービスディスカバリーの種類（空の場合はホスト名の名前解決）
+	kind string
+
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+	lookupSRV  func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	consul     *consulDiscovery
+	k8s        *k8sDiscovery
+	// アドレスが変わったときに呼ばれる（古いアドレスへのアイドル接続を閉じる）
+	onChange func()
+
+	mu    sync.RWMutex
+	addrs []string
+	next  atomic.Uint64
+
+	stop chan struct{}
+}
+
+// splitDiscoveryScheme はプロキシ先 URL からサービスディスカバリーの種類を取り除く
+func splitDiscoveryScheme(raw string) (kind, rest string) {
+	for _, kind := range discoverySchemes {
+		if rest, ok := strings.CutPrefix(raw, kind+"+"); ok {
+			return kind, rest
+		}
+	}
+	return "", raw
+}
+
+// stripDiscoveryScheme はサービスディスカバリーの接頭辞を除いたプロキシ先 URL を返す
+func stripDiscoveryScheme(raw string) string {
+	_, rest := splitDiscoveryScheme(raw)
+	return rest
+}
+
+// isDiscoveryURL はプロキシ先をサービスディスカバリーで探す URL かを判定する
+func isDiscoveryURL(raw string) bool {
+	kind, _ := splitDiscoveryScheme(raw)
+	return kind != ""
+}
+
+// newUpstreamResolver はプロキシ先の URL から名前解決を行う resolver を作成する
+// IP アドレスを指定した場合は名前解決が不要なので nil を返す
+func newUpstreamResolver(rawURL string, cfg ProxyConfig) (*upstreamResolver, error) {
+	kind, rest := splitDiscoveryScheme(rawURL)
+	u, err := url.Parse(rest)
+	if err != nil {
+		return nil, err
+	}
+	host, port := u.Hostname(), u.Port()
+	if kind == "" && net.ParseIP(host) != nil {
+		return nil, nil
+	}
+	if port == "" && kind != "k8s" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	interval := cfg.ResolveInterval
+	if interval <= 0 {
+		interval = defaultResolveInterval
+	}
+	r := &upstreamResolver{
+		host:       host,
+		port:       port,
+		interval:   interval,
+		kind:       kind,
+		lookupHost: net.DefaultResolver.LookupHost,
+		lookupSRV:  net.DefaultResolver.LookupSRV,
+		stop:       make(chan struct{}),
+	}
+	switch kind {
+	case "consul":
+		r.consul = newConsulDiscovery(cfg.ConsulAddr, cfg.ConsulToken, host)
+	case "k8s":
+		if r.k8s, err = newK8sDiscovery(host, port); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// attach はトランスポートの接続先を名前解決したアドレスに置き換える
+func (r *upstreamResolver) attach(transport *upstreamTransport) {
+	dial := transport.DialContext
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if a := r.addr(); a != "" {
+			addr = a
+		} else if r.kind != "" {
+			return nil, fmt.Errorf("no addresses discovered for %s", r.host)
+		}
+		return dial(ctx, network, addr)
+	}
+	r.onChange = transport.CloseIdleConnections
+}
+
+// start は最初の名前解決を行い、以降は定期的に再解決する
+func (r *upstreamResolver) start() {
+	r.resolve()
+	go r.run()
+}
+
+func (r *upstreamResolver) run() {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.resolve()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// resolve は名前解決を行い、アドレスが変わっていれば更新する
+// 失敗した場合は前回のアドレスを使い続ける
+func (r *upstreamResolver) resolve() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	addrs, err := r.lookup(ctx)
+	if err != nil {
+		warnf("Resolving upstream %s: %v", r.host, err)
+		return
+	}
+	sort.Strings(addrs)
+	r.mu.Lock()
+	changed := strings.Join(addrs, ",") != strings.Join(r.addrs, ",")
+	r.addrs = addrs
+	r.mu.Unlock()
+	if changed {
+		infof("Upstream %s resolved to %s", r.host, strings.Join(addrs, ", "))
+		if r.onChange != nil {
+			r.onChange()
+		}
+	}
+}
+
+func (r *upstreamResolver) lookup(ctx context.Context) ([]string, error) {
+	var addrs []string
+	switch r.kind {
+	case "srv":
+		_, records, err := r.lookupSRV(ctx, "", "", r.host)
+		if err != nil {
+			return nil, err
+		}
+		for _, rec := range records {
+			addrs = append(addrs, net.JoinHostPort(strings.TrimSuffix(rec.Target, "."), strconv.Itoa(int(rec.Port))))
+		}
+	case "consul":
+		var err error
+		if addrs, err = r.consul.lookup(ctx); err != nil {
+			return nil, err
+		}
+	case "k8s":
+		var err error
+		if addrs, err = r.k8s.lookup(ctx); err != nil {
+			return nil, err
+		}
+	default:
+		ips, err := r.lookupHost(ctx, r.host)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			addrs = append(addrs, net.JoinHostPort(ip, r.port))
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses found")
+	}
+	return addrs, nil
+}
+
+// addr は次に接続するアドレスを返す（名前解決できていない場合は空文字列）
+func (r *upstreamResolver) addr() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.addrs) == 0 {
+		return ""
+	}
+	return r.addrs[r.next.Add(1)%uint64(len(r.addrs))]
+}
+
+// Close は定期的な名前解決を停止する
+func (r *upstreamResolver) Close() {
+	close(r.stop)
+}
@@ -0,0 +1,103 @@
+package spaserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+func TestUpstreamResolver(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Host))
+	}))
+	defer backend.Close()
+	u, _ := url.Parse(backend.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	tests := []struct {
+		name   string
+		target string
+	}{
+		{"A レコード", "http://backend.internal:" + u.Port()},
+		{"SRV レコード", "srv+http://_api._tcp.backend.internal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy, err := newProxy(tt.target, protocolAuto, nil, newServerMetrics())
+			if err != nil {
+				t.Fatal(err)
+			}
+			resolver, err := newUpstreamResolver(tt.target, ProxyConfig{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			changed := 0
+			resolver.lookupHost = func(ctx context.Context, host string) ([]string, error) {
+				if host != "backend.internal" {
+					return nil, errors.New("unknown host")
+				}
+				return []string{"127.0.0.1"}, nil
+			}
+			resolver.lookupSRV = func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+				return "", []*net.SRV{{Target: "127.0.0.1.", Port: uint16(port)}}, nil
+			}
+			resolver.attach(proxy.Transport.(*upstreamTransport))
+			resolver.onChange = func() { changed++ }
+			resolver.start()
+			defer resolver.Close()
+
+			rr := httptest.NewRecorder()
+			proxy.ServeHTTP(rr, httptest.NewRequest("GET", "/api", nil))
+			if rr.Code != http.StatusOK {
+				t.Errorf("期待されるステータスコード %d, 実際のステータスコード %d", http.StatusOK, rr.Code)
+			}
+			if changed != 1 {
+				t.Errorf("アドレスの変更は1回のはずです: %d", changed)
+			}
+			// 同じアドレスなら変更とみなさない
+			resolver.resolve()
+			if changed != 1 {
+				t.Errorf("同じアドレスで変更とみなされました: %d", changed)
+			}
+		})
+	}
+}
+
+func TestUpstreamResolverKeepsAddressesOnError(t *testing.T) {
+	resolver, err := newUpstreamResolver("http://backend.internal", ProxyConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fail := false
+	resolver.lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		if fail {
+			return nil, errors.New("temporary failure")
+		}
+		return []string{"10.0.0.2", "10.0.0.1"}, nil
+	}
+	resolver.resolve()
+	fail = true
+	resolver.resolve()
+	seen := map[string]bool{}
+	for i := 0; i < 4; i++ {
+		seen[resolver.addr()] = true
+	}
+	if len(seen) != 2 || !seen["10.0.0.1:80"] || !seen["10.0.0.2:80"] {
+		t.Errorf("名前解決に失敗しても前回のアドレスを順番に使うはずです: %v", seen)
+	}
+}
+
+func TestUpstreamResolverSkipsIPAddresses(t *testing.T) {
+	resolver, err := newUpstreamResolver("http://127.0.0.1:8080", ProxyConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolver != nil {
+		t.Error("IP アドレスのプロキシ先は名前解決しないはずです")
+	}
+}
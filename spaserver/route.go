@@ -0,0 +1,109 @@
+package spaserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// proxyRoute は条件式に一致したリクエストを指定したプロキシ先に振り分けるルール
+//
+//	when header("X-Env") == "beta" && path.startsWith("/api") to http://beta-api:8081
+type proxyRoute struct {
+	rule   string
+	when   func(r *http.Request) bool
+	target proxyTarget
+}
+
+// proxyTarget はプロキシ先
+type proxyTarget struct {
+	url     string
+	handler http.Handler
+}
+
+type proxyTargetKey struct{}
+
+// withProxyTarget は振り分けたプロキシ先をコンテキストに保存する
+func withProxyTarget(ctx context.Context, target proxyTarget) context.Context {
+	return context.WithValue(ctx, proxyTargetKey{}, target)
+}
+
+func proxyTargetFrom(ctx context.Context) (proxyTarget, bool) {
+	target, ok := ctx.Value(proxyTargetKey{}).(proxyTarget)
+	return target, ok
+}
+
+// parseRoute はルールを条件式とプロキシ先に分割する（先頭の route は省略可能）
+func parseRoute(rule string) (cond, target string, err error) {
+	s := strings.TrimSpace(rule)
+	s = strings.TrimSpace(strings.TrimPrefix(s, "route "))
+	if !strings.HasPrefix(s, "when ") {
+		return "", "", fmt.Errorf("%q: must start with \"when\"", rule)
+	}
+	s = s[len("when "):]
+
+	// 文字列リテラルの外にある最初の " to " で分割する
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case isSpace(c) && strings.HasPrefix(s[i+1:], "to") && i+3 < len(s) && isSpace(s[i+3]):
+			cond, target = strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+3:])
+			if unquoted, err := strconv.Unquote(target); err == nil {
+				target = unquoted
+			}
+			if cond == "" || target == "" {
+				break
+			}
+			return cond, target, nil
+		}
+	}
+	return "", "", fmt.Errorf("%q: expected \"when <condition> to <url>\"", rule)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+// parseRoutes はルールをコンパイルし、プロキシ先のハンドラーを用意する
+func (s *server) parseRoutes(rules []string) ([]*proxyRoute, error) {
+	var routes []*proxyRoute
+	for _, rule := range rules {
+		cond, target, err := parseRoute(rule)
+		if err != nil {
+			return nil, err
+		}
+		when, err := compileExpr(cond)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", rule, err)
+		}
+		if err := checkProxyURL(target); err != nil {
+			return nil, fmt.Errorf("%q: %w", rule, err)
+		}
+		upstream, err := s.upstreamFor(target)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", rule, err)
+		}
+		routes = append(routes, &proxyRoute{rule: rule, when: when, target: proxyTarget{url: target, handler: upstream}})
+	}
+	return routes, nil
+}
+
+// matchRoute は最初に条件が一致したルールを返す
+func (s *server) matchRoute(r *http.Request) *proxyRoute {
+	for _, route := range s.routes {
+		if route.when(r) {
+			return route
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package spaserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestParseRoute(t *testing.T) {
+	tests := []struct {
+		rule           string
+		expectedCond   string
+		expectedTarget string
+	}{
+		{`when header("X-Env") == "beta" to http://beta:8081`, `header("X-Env") == "beta"`, "http://beta:8081"},
+		{`route when path.startsWith(" to ") to "http://beta:8081"`, `path.startsWith(" to ")`, "http://beta:8081"},
+	}
+	for _, tt := range tests {
+		cond, target, err := parseRoute(tt.rule)
+		if err != nil {
+			t.Errorf("%s: %v", tt.rule, err)
+			continue
+		}
+		if cond != tt.expectedCond || target != tt.expectedTarget {
+			t.Errorf("%s: 期待される結果 %q %q, 実際の結果 %q %q", tt.rule, tt.expectedCond, tt.expectedTarget, cond, target)
+		}
+	}
+
+	for _, rule := range []string{`header("X-Env") == "beta" to http://beta:8081`, `when path == "/" to`, `when to http://beta:8081`} {
+		if _, _, err := parseRoute(rule); err == nil {
+			t.Errorf("%s: エラーになる必要があります", rule)
+		}
+	}
+}
+
+func TestProxyRoutes(t *testing.T) {
+	newBackend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+	}
+	stable, beta := newBackend("stable"), newBackend("beta")
+	defer stable.Close()
+	defer beta.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Proxy.URL = stable.URL
+	cfg.Proxy.Paths = []string{"/api"}
+	cfg.Proxy.Routes = []string{`when header("X-Env") == "beta" && path.startsWith("/api") to ` + beta.URL}
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		name         string
+		path         string
+		env          string
+		expectedBody string
+	}{
+		{"条件に一致", "/api/users", "beta", "beta"},
+		{"条件に一致しない", "/api/users", "", "stable"},
+		{"プロキシパス以外", "/users/1", "", "SPA"},
+		{"パスが条件に一致しない", "/users/1", "beta", "SPA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.env != "" {
+				req.Header.Set("X-Env", tt.env)
+			}
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, req)
+			if rr.Body.String() != tt.expectedBody {
+				t.Errorf("期待されるレスポンス %q, 実際のレスポンス %q", tt.expectedBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestProxyRoutesEnv(t *testing.T) {
+	t.Setenv("PROXY_ROUTES", `when query("a") == "1" || query("b") == "2" to http://a:8081; when true to http://b:8081`)
+	cfg := testConfig(t)
+	if len(cfg.Proxy.Routes) != 2 {
+		t.Errorf("セミコロンで区切られていません: %q", cfg.Proxy.Routes)
+	}
+}
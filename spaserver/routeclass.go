@@ -0,0 +1,59 @@
+package spaserver
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+// リクエストの種類
+// レイテンシのヒストグラムを種類ごとに分け、静的ファイルに埋もれずにプロキシの p99 などを監視できるようにする
+
+const (
+	// ハッシュ付きのファイルなどの静的ファイル（存在しないファイルと隠しファイルの 404 を含む）
+	routeStatic = "static"
+	// ルートと存在しないパスへの index.html
+	routeIndex = "index"
+	// プロキシパス（モックと記録したレスポンスを含む）
+	routeProxy = "proxy"
+	// BLOCKED_PATHS に一致したリクエスト
+	routeBlocked = "blocked"
+	// ヘルスチェック・拒否したリクエスト・開発用や管理用のパスなど
+	routeOther = "other"
+)
+
+// routeClass はリクエストの種類の記録先
+type routeClass struct {
+	name string
+}
+
+type routeClassKey struct{}
+
+// withRouteClass はリクエストのコンテキストに種類の記録先を追加する
+func withRouteClass(r *http.Request) (*http.Request, *routeClass) {
+	c := &routeClass{name: routeOther}
+	return r.WithContext(context.WithValue(r.Context(), routeClassKey{}, c)), c
+}
+
+// setRouteClass はリクエストの種類を記録する（記録先がない場合は何もしない）
+func setRouteClass(ctx context.Context, name string) {
+	if c, ok := ctx.Value(routeClassKey{}).(*routeClass); ok {
+		c.name = name
+	}
+}
+
+// routeClassOf は記録したリクエストの種類を返す（記録先がない場合は other）
+func routeClassOf(ctx context.Context) string {
+	if c, ok := ctx.Value(routeClassKey{}).(*routeClass); ok {
+		return c.name
+	}
+	return routeOther
+}
+
+// statusClass はステータスコードを 2xx のような区分にする
+func statusClass(code int) string {
+	if code < 100 || code > 599 {
+		return "other"
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
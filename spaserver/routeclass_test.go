@@ -0,0 +1,64 @@
+package spaserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRouteClassMetrics(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer backend.Close()
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+	os.WriteFile(filepath.Join(dir, "app.js"), []byte("app"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Proxy.URL = backend.URL
+	cfg.Proxy.Paths = []string{"/api"}
+	cfg.BlockedPaths = []string{"*.php"}
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, path := range []string{"/app.js", "/", "/users/1", "/api/users", "/wp-login.php", "/healthz"} {
+		s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	rr := httptest.NewRecorder()
+	s.state.metrics.ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	body := rr.Body.String()
+	for _, expected := range []struct {
+		class  string
+		status string
+		count  int
+	}{
+		{routeStatic, "2xx", 1},
+		{routeIndex, "2xx", 2},
+		{routeProxy, "5xx", 1},
+		{routeBlocked, "4xx", 1},
+		{routeOther, "2xx", 1},
+	} {
+		line := fmt.Sprintf(`spa_http_request_class_duration_seconds_count{class=%q,status=%q} %d`, expected.class, expected.status, expected.count)
+		if !strings.Contains(body, line) {
+			t.Errorf("メトリクスに %q が含まれていません:\n%s", line, body)
+		}
+	}
+}
+
+func TestStatusClass(t *testing.T) {
+	tests := map[int]string{200: "2xx", 304: "3xx", 404: "4xx", 503: "5xx", 0: "other"}
+	for code, expected := range tests {
+		if got := statusClass(code); got != expected {
+			t.Errorf("%d: 期待される区分 %q, 実際の区分 %q", code, expected, got)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package spaserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sentry へのエラーの送信
+// SENTRY_DSN を設定した場合、ハンドラーの panic・プロキシのエラー・5xx のレスポンスをリクエストの情報とともに Sentry に送る。
+// 送信はバックグラウンドで行い、Sentry に届かない場合や送信待ちが多すぎる場合は捨てる（リクエストの処理は待たせない）
+
+const (
+	// 送信待ちのイベント数の上限
+	sentryQueueSize = 100
+	// 1件の送信と終了時に残りを送る時間の上限
+	sentryTimeout = 5 * time.Second
+	// イベントに含めるスタックトレースのフレーム数の上限
+	sentryMaxFrames = 50
+)
+
+// sentryHeaders はイベントに含めるリクエストヘッダー（Cookie や Authorization などは送らない）
+var sentryHeaders = []string{"Accept", "Content-Length", "Content-Type", "Host", "Referer", "User-Agent", "X-Forwarded-For", "X-Forwarded-Proto"}
+
+// sentryDSN は SENTRY_DSN（https://公開キー@ホスト/プロジェクトID）を解析した送信先
+type sentryDSN struct {
+	endpoint string
+	key      string
+}
+
+func parseSentryDSN(dsn string) (sentryDSN, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return sentryDSN{}, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return sentryDSN{}, fmt.Errorf("scheme must be http or https")
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return sentryDSN{}, fmt.Errorf("missing public key")
+	}
+	i := strings.LastIndexByte(u.Path, '/')
+	if i < 0 || u.Path[i+1:] == "" {
+		return sentryDSN{}, fmt.Errorf("missing project ID")
+	}
+	prefix, project := u.Path[:i], u.Path[i+1:]
+	return sentryDSN{
+		endpoint: fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, prefix, project),
+		key:      u.User.Username(),
+	}, nil
+}
+
+// sentryEvent は Sentry のイベント
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Platform    string            `json:"platform"`
+	Level       string            `json:"level"`
+	Logger      string            `json:"logger"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Message     string            `json:"message,omitempty"`
+	Exception   *sentryExceptions `json:"exception,omitempty"`
+	Request     *sentryRequest    `json:"request,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+type sentryExceptions struct {
+	Values []sentryException `json:"values"`
+}
+
+type sentryException struct {
+	Type       string            `json:"type"`
+	Value      string            `json:"value"`
+	Stacktrace *sentryStacktrace `json:"stacktrace,omitempty"`
+}
+
+type sentryStacktrace struct {
+	Frames []sentryFrame `json:"frames"`
+}
+
+type sentryFrame struct {
+	Function string `json:"function"`
+	AbsPath  string `json:"abs_path"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+type sentryRequest struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+}
+
+// sentryReporter はイベントを Sentry に送る
+type sentryReporter struct {
+	dsn         sentryDSN
+	environment string
+	release     string
+	host        string
+	client      *http.Client
+	queue       chan sentryEvent
+	done        chan struct{}
+	// REMOTE_ADDR のIPアドレスの下位を 0 にする
+	anonymize bool
+
+	// 設定の再読み込み後も処理中のリクエストから capture が呼ばれるため、Close 後は捨てる
+	mu     sync.Mutex
+	closed bool
+}
+
+func newSentryReporter(cfg SentryConfig, anonymizeIPs bool) (*sentryReporter, error) {
+	if cfg.DSN == "" {
+		return nil, nil
+	}
+	dsn, err := parseSentryDSN(cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+	release := cfg.Release
+	if release == "" {
+		release = "spa-server@" + getVersionInfo().Version
+	}
+	host, _ := os.Hostname()
+	s := &sentryReporter{
+		dsn:         dsn,
+		environment: cfg.Environment,
+		release:     release,
+		host:        host,
+		anonymize:   anonymizeIPs,
+		client:      &http.Client{Timeout: sentryTimeout},
+		queue:       make(chan sentryEvent, sentryQueueSize),
+		done:        make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+func (s *sentryReporter) run() {
+	defer close(s.done)
+	for event := range s.queue {
+		if err := s.send(event); err != nil {
+			warnf("Sending event to Sentry: %v", err)
+		}
+	}
+}
+
+// Close は送信待ちのイベントを送ってから終了する（sentryTimeout まで待つ）
+func (s *sentryReporter) Close() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+	select {
+	case <-s.done:
+	case <-time.After(sentryTimeout):
+		warnf("Sentry: gave up sending %d queued events", len(s.queue))
+	}
+}
+
+// send はイベントを envelope 形式で送る
+func (s *sentryReporter) send(event sentryEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	fmt.Fprintf(&body, `{"event_id":%q,"sent_at":%q}`+"\n", event.EventID, time.Now().UTC().Format(time.RFC3339))
+	fmt.Fprintf(&body, `{"type":"event","length":%d}`+"\n", len(payload))
+	body.Write(payload)
+	body.WriteByte('\n')
+
+	req, err := http.NewRequest("POST", s.dsn.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", fmt.Sprintf("Sentry sentry_version=7, sentry_client=spa-server/%s, sentry_key=%s", getVersionInfo().Version, s.dsn.key))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
+
+// capture はリクエストの情報を付けたイベントを送信待ちにする（いっぱいの場合は捨てる）
+func (s *sentryReporter) capture(r *http.Request, status int, message string, exception *sentryException) {
+	id := make([]byte, 16)
+	rand.Read(id)
+	event := sentryEvent{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339Nano),
+		Platform:    "go",
+		Level:       "error",
+		Logger:      "spa-server",
+		ServerName:  s.host,
+		Release:     s.release,
+		Environment: s.environment,
+		Message:     message,
+		Request:     newSentryRequest(r, s.anonymize),
+		Tags:        map[string]string{"status_code": fmt.Sprint(status), "method": r.Method},
+	}
+	if exception != nil {
+		event.Exception = &sentryExceptions{Values: []sentryException{*exception}}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.queue <- event:
+	default:
+		debugf("Sentry: queue full, dropping event %q", message)
+	}
+}
+
+// newSentryRequest はイベントに含めるリクエストの情報を作る（クエリ文字列は送らない）
+func newSentryRequest(r *http.Request, anonymizeIPs bool) *sentryRequest {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	req := &sentryRequest{
+		URL:     scheme + "://" + r.Host + r.URL.Path,
+		Method:  r.Method,
+		Headers: map[string]string{},
+		Env:     map[string]string{"REMOTE_ADDR": logClientIP(r, anonymizeIPs)},
+	}
+	for _, name := range sentryHeaders {
+		if v := r.Header.Get(name); v != "" {
+			req.Headers[name] = v
+		}
+	}
+	return req
+}
+
+// panicStacktrace は panic した箇所までのスタックトレースを古い順に返す（recover した defer から呼ぶ）
+func panicStacktrace() *sentryStacktrace {
+	pcs := make([]uintptr, sentryMaxFrames+16)
+	n := runtime.Callers(1, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var list []sentryFrame
+	for {
+		frame, more := frames.Next()
+		if frame.Function == "runtime.gopanic" {
+			// ここまでは recover した側のフレーム
+			list = nil
+		} else {
+			list = append(list, sentryFrame{
+				Function: frame.Function,
+				AbsPath:  frame.File,
+				Lineno:   frame.Line,
+				InApp:    strings.HasPrefix(frame.Function, "github.com/ikasamt/spa-server/"),
+			})
+		}
+		if !more || len(list) >= sentryMaxFrames {
+			break
+		}
+	}
+	for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+		list[i], list[j] = list[j], list[i]
+	}
+	return &sentryStacktrace{Frames: list}
+}
+
+// sentryErrorKey はプロキシのエラーの記録先のコンテキストキー
+type sentryErrorKey struct{}
+
+// recordProxyError はプロキシのエラーをリクエストに記録する（Sentry が無効の場合は何もしない）
+func recordProxyError(ctx context.Context, err error) {
+	if p, ok := ctx.Value(sentryErrorKey{}).(*error); ok {
+		*p = err
+	}
+}
+
+// Wrap はハンドラーの panic を 500 にして送り、プロキシのエラーと 5xx のレスポンスも送る
+// ヘルスチェックやメンテナンスモードなど種類が other の 5xx は意図したものなので送らない
+func (s *sentryReporter) Wrap(next http.Handler) http.Handler {
+	if s == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var proxyErr error
+		r = r.WithContext(context.WithValue(r.Context(), sentryErrorKey{}, &proxyErr))
+		rec := &responseRecorder{ResponseWriter: w}
+		defer func() {
+			if v := recover(); v != nil {
+				// 接続の中断は panic として扱わない
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+				errorf("Panic serving %s %s: %v", r.Method, escapeLogValue(r.URL.Path), v)
+				s.capture(r, http.StatusInternalServerError, fmt.Sprintf("panic: %v", v), &sentryException{
+					Type:       "panic",
+					Value:      fmt.Sprint(v),
+					Stacktrace: panicStacktrace(),
+				})
+				if rec.status == 0 {
+					http.Error(rec, "Internal Server Error", http.StatusInternalServerError)
+				}
+				return
+			}
+			switch {
+			case proxyErr != nil:
+				s.capture(r, rec.Status(), fmt.Sprintf("proxy error: %s %s", r.Method, r.URL.Path), &sentryException{
+					Type:  "proxy error",
+					Value: proxyErr.Error(),
+				})
+			case rec.Status() >= 500 && routeClassOf(r.Context()) != routeOther:
+				s.capture(r, rec.Status(), fmt.Sprintf("%d %s %s", rec.Status(), r.Method, r.URL.Path), nil)
+			}
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
@@ -0,0 +1,122 @@
+package spaserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSentry(t *testing.T) {
+	var mu sync.Mutex
+	var events []sentryEvent
+	var auth string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		lines := bytes.Split(bytes.TrimSpace(body), []byte("\n"))
+		var event sentryEvent
+		if r.URL.Path != "/api/42/envelope/" || len(lines) != 3 || json.Unmarshal(lines[2], &event) != nil {
+			t.Errorf("envelope の形式が正しくありません: %s %s", r.URL.Path, body)
+		}
+		mu.Lock()
+		events = append(events, event)
+		auth = r.Header.Get("X-Sentry-Auth")
+		mu.Unlock()
+	}))
+	defer collector.Close()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer backend.Close()
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Proxy.URL = backend.URL
+	cfg.Proxy.Paths = []string{"/api"}
+	cfg.Sentry.DSN = strings.Replace(collector.URL, "://", "://publickey@", 1) + "/42"
+	cfg.Sentry.Environment = "test"
+	cfg.Health.CheckUpstream = true
+	panicker := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/panic" {
+				panic("boom")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+	s, err := newServer(cfg, WithMiddleware(MiddlewareStatic, panicker))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, expected := range map[string]int{
+		"/panic":    http.StatusInternalServerError,
+		"/api/fail": http.StatusServiceUnavailable,
+		"/":         http.StatusOK,
+	} {
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set("Cookie", "session=secret")
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, r)
+		if rr.Code != expected {
+			t.Errorf("%s: 期待されるステータスコード %d, 実際のステータスコード %d", path, expected, rr.Code)
+		}
+	}
+	// 閉じたプロキシ先へのリクエストはプロキシのエラーとして1件だけ送る
+	backend.Close()
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/down", nil))
+	// ヘルスチェックの 503 は送らない
+	s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/readyz", nil))
+
+	// 終了時に送信待ちのイベントを送る
+	s.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 3 {
+		t.Fatalf("期待されるイベント数 3, 実際のイベント数 %d: %+v", len(events), events)
+	}
+	if !strings.Contains(auth, "sentry_key=publickey") {
+		t.Errorf("X-Sentry-Auth が正しくありません: %q", auth)
+	}
+	byPath := map[string]sentryEvent{}
+	for _, event := range events {
+		byPath[strings.TrimPrefix(event.Request.URL, "http://example.com")] = event
+		if event.Environment != "test" || event.Request.Headers["Cookie"] != "" {
+			t.Errorf("イベントの内容が正しくありません: %+v", event)
+		}
+	}
+	if e := byPath["/panic"].Exception; e == nil || e.Values[0].Value != "boom" || len(e.Values[0].Stacktrace.Frames) == 0 {
+		t.Errorf("panic のイベントが正しくありません: %+v", byPath["/panic"])
+	} else if frames := e.Values[0].Stacktrace.Frames; !strings.Contains(frames[len(frames)-1].Function, "TestSentry.func") {
+		t.Errorf("スタックトレースの最後は panic した関数であるべきです: %+v", frames[len(frames)-1])
+	}
+	if byPath["/api/fail"].Tags["status_code"] != "503" {
+		t.Errorf("5xx のイベントが正しくありません: %+v", byPath["/api/fail"])
+	}
+	if e := byPath["/api/down"].Exception; e == nil || e.Values[0].Type != "proxy error" {
+		t.Errorf("プロキシのエラーのイベントが正しくありません: %+v", byPath["/api/down"])
+	}
+}
+
+func TestParseSentryDSN(t *testing.T) {
+	dsn, err := parseSentryDSN("https://abc@o1.ingest.sentry.io/sentry/123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dsn.endpoint != "https://o1.ingest.sentry.io/sentry/api/123/envelope/" || dsn.key != "abc" {
+		t.Errorf("解析結果が正しくありません: %+v", dsn)
+	}
+	for _, invalid := range []string{"https://o1.ingest.sentry.io/123", "https://abc@o1.ingest.sentry.io/", "ftp://abc@host/1"} {
+		if _, err := parseSentryDSN(invalid); err == nil {
+			t.Errorf("%q: エラーになるべきです", invalid)
+		}
+	}
+}
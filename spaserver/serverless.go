@@ -0,0 +1,283 @@
+package spaserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// サーバーレス環境での実行
+// AWS Lambda では AWS_LAMBDA_RUNTIME_API が設定されるので、リスナーを開く代わりに Lambda の Runtime API から
+// Function URL・API Gateway（HTTP API の 2.0 形式と REST API の 1.0 形式）のイベントを受け取り、同じハンドラーで処理する。
+// Cloud Run（K_SERVICE が設定される）では PORT に従って待ち受け、SIGTERM から強制終了までの猶予に収まるよう
+// SHUTDOWN_TIMEOUT の既定値を短くする
+
+const (
+	lambdaRuntimeAPIEnv = "AWS_LAMBDA_RUNTIME_API"
+	cloudRunServiceEnv  = "K_SERVICE"
+	// Cloud Run は SIGTERM から10秒後に強制終了する
+	cloudRunShutdownTimeout = 9 * time.Second
+)
+
+// applyPlatformDefaults は実行環境に合わせて既定値を変える（設定ファイル・環境変数で上書きできる）
+func applyPlatformDefaults(cfg *Config) {
+	if os.Getenv(cloudRunServiceEnv) != "" {
+		cfg.ShutdownTimeout = cloudRunShutdownTimeout
+	}
+	if os.Getenv(lambdaRuntimeAPIEnv) != "" {
+		// デプロイパッケージは読み取り専用で変更されない
+		cfg.WatchDistDir = false
+	}
+}
+
+// lambdaEvent は Function URL・API Gateway から届く HTTP リクエストのイベント（2.0 と 1.0 形式の両方の項目を持つ）
+type lambdaEvent struct {
+	Version string            `json:"version"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+	Base64  bool              `json:"isBase64Encoded"`
+
+	// 2.0 形式
+	RawPath        string   `json:"rawPath"`
+	RawQueryString string   `json:"rawQueryString"`
+	Cookies        []string `json:"cookies"`
+
+	// 1.0 形式
+	HTTPMethod        string              `json:"httpMethod"`
+	Path              string              `json:"path"`
+	Query             map[string]string   `json:"queryStringParameters"`
+	MultiValueQuery   map[string][]string `json:"multiValueQueryStringParameters"`
+	MultiValueHeaders map[string][]string `json:"multiValueHeaders"`
+
+	RequestContext struct {
+		DomainName string `json:"domainName"`
+		HTTP       struct {
+			Method   string `json:"method"`
+			SourceIP string `json:"sourceIp"`
+		} `json:"http"`
+		Identity struct {
+			SourceIP string `json:"sourceIp"`
+		} `json:"identity"`
+	} `json:"requestContext"`
+}
+
+// isV2 は 2.0 形式のイベントかを返す
+func (e *lambdaEvent) isV2() bool {
+	return e.Version == "2.0"
+}
+
+// request はイベントを HTTP リクエストにする
+func (e *lambdaEvent) request(ctx context.Context) (*http.Request, error) {
+	u := &url.URL{Path: e.Path}
+	method, sourceIP := e.HTTPMethod, e.RequestContext.Identity.SourceIP
+	if e.isV2() {
+		// rawPath はエンコードされたまま届く
+		var err error
+		if u, err = url.Parse(e.RawPath); err != nil {
+			return nil, err
+		}
+		u.RawQuery = e.RawQueryString
+		method, sourceIP = e.RequestContext.HTTP.Method, e.RequestContext.HTTP.SourceIP
+	} else if len(e.MultiValueQuery) > 0 {
+		u.RawQuery = url.Values(e.MultiValueQuery).Encode()
+	} else if len(e.Query) > 0 {
+		query := url.Values{}
+		for k, v := range e.Query {
+			query.Set(k, v)
+		}
+		u.RawQuery = query.Encode()
+	}
+	if method == "" || u.Path == "" {
+		return nil, errors.New("not an HTTP event from a function URL or API Gateway")
+	}
+
+	body := []byte(e.Body)
+	if e.Base64 {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(e.Body); err != nil {
+			return nil, fmt.Errorf("decoding body: %w", err)
+		}
+	}
+	r, err := http.NewRequestWithContext(ctx, method, u.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	r.RequestURI = u.RequestURI()
+	if len(e.MultiValueHeaders) > 0 {
+		for k, values := range e.MultiValueHeaders {
+			for _, v := range values {
+				r.Header.Add(k, v)
+			}
+		}
+	} else {
+		for k, v := range e.Headers {
+			r.Header.Set(k, v)
+		}
+	}
+	if len(e.Cookies) > 0 {
+		r.Header.Set("Cookie", strings.Join(e.Cookies, "; "))
+	}
+	r.Host = r.Header.Get("Host")
+	if r.Host == "" {
+		r.Host = e.RequestContext.DomainName
+	}
+	if sourceIP != "" {
+		r.RemoteAddr = net.JoinHostPort(sourceIP, "0")
+	}
+	return r, nil
+}
+
+// lambdaResponse は Function URL・API Gateway に返すレスポンス
+type lambdaResponse struct {
+	StatusCode        int                 `json:"statusCode"`
+	Headers           map[string]string   `json:"headers,omitempty"`
+	MultiValueHeaders map[string][]string `json:"multiValueHeaders,omitempty"`
+	Cookies           []string            `json:"cookies,omitempty"`
+	Body              string              `json:"body"`
+	Base64            bool                `json:"isBase64Encoded"`
+}
+
+// lambdaResponseWriter はレスポンスを溜めて、イベントの形式に合わせたレスポンスにする
+type lambdaResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newLambdaResponseWriter() *lambdaResponseWriter {
+	return &lambdaResponseWriter{header: http.Header{}}
+}
+
+func (w *lambdaResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *lambdaResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *lambdaResponseWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(p)
+}
+
+// Flush はストリーミングするハンドラーのために用意する（レスポンスはまとめて返す）
+func (w *lambdaResponseWriter) Flush() {}
+
+// response は溜めたレスポンスを返す（UTF-8 のテキストでない本文は Base64 にする）
+func (w *lambdaResponseWriter) response(v2 bool) lambdaResponse {
+	w.WriteHeader(http.StatusOK)
+	resp := lambdaResponse{StatusCode: w.status, Headers: map[string]string{}}
+	body := w.body.Bytes()
+	if w.header.Get("Content-Encoding") != "" || !utf8.Valid(body) {
+		resp.Body, resp.Base64 = base64.StdEncoding.EncodeToString(body), true
+	} else {
+		resp.Body = string(body)
+	}
+	if !v2 {
+		// 1.0 形式では headers と multiValueHeaders が合わせて返されるので、headers には値が1つのもの（同じ値は重複しない）だけを入れる
+		resp.MultiValueHeaders = map[string][]string(w.header.Clone())
+	}
+	for k, values := range w.header {
+		switch {
+		case v2 && k == "Set-Cookie":
+			resp.Cookies = values
+		case v2 || len(values) == 1:
+			resp.Headers[k] = strings.Join(values, ", ")
+		}
+	}
+	return resp
+}
+
+// lambdaRuntime は Lambda の Runtime API のクライアント
+type lambdaRuntime struct {
+	base   string
+	client *http.Client
+}
+
+func newLambdaRuntime(api string) *lambdaRuntime {
+	return &lambdaRuntime{base: "http://" + api + "/2018-06-01/runtime/invocation/", client: &http.Client{}}
+}
+
+// runLambda は Lambda の呼び出しを受け取り続ける
+func runLambda(api string, handler http.Handler) error {
+	rt := newLambdaRuntime(api)
+	for {
+		if err := rt.invoke(handler); err != nil {
+			return err
+		}
+	}
+}
+
+// invoke は次の呼び出しを受け取って処理し、結果を返す
+// Runtime API と通信できない場合だけエラーを返す（イベントの誤りは呼び出しのエラーとして返す）
+func (rt *lambdaRuntime) invoke(handler http.Handler) error {
+	resp, err := rt.client.Get(rt.base + "next")
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("runtime API returned %s", resp.Status)
+	}
+	id := resp.Header.Get("Lambda-Runtime-Aws-Request-Id")
+	ctx := context.Background()
+	if ms, err := strconv.ParseInt(resp.Header.Get("Lambda-Runtime-Deadline-Ms"), 10, 64); err == nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, time.UnixMilli(ms))
+		defer cancel()
+	}
+
+	var event lambdaEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return rt.post(id+"/error", lambdaError(err))
+	}
+	r, err := event.request(ctx)
+	if err != nil {
+		return rt.post(id+"/error", lambdaError(err))
+	}
+	w := newLambdaResponseWriter()
+	handler.ServeHTTP(w, r)
+	return rt.post(id+"/response", w.response(event.isV2()))
+}
+
+// lambdaError は呼び出しのエラーの本文
+func lambdaError(err error) map[string]string {
+	warnf("Lambda: %v", err)
+	return map[string]string{"errorMessage": err.Error(), "errorType": "InvalidEvent"}
+}
+
+func (rt *lambdaRuntime) post(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	resp, err := rt.client.Post(rt.base+path, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		// 応答が大きすぎるなどで受け付けられなかった場合も次の呼び出しを待つ
+		errorf("Lambda: runtime API returned %s for %s", resp.Status, path)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package spaserver
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeLambdaRuntime は1回分の呼び出しを返し、結果を記録する Runtime API
+func fakeLambdaRuntime(t *testing.T, event string) (*httptest.Server, chan string) {
+	results := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/2018-06-01/runtime/invocation/next":
+			w.Header().Set("Lambda-Runtime-Aws-Request-Id", "req-1")
+			w.Header().Set("Lambda-Runtime-Deadline-Ms", "4102444800000")
+			io.WriteString(w, event)
+		case "/2018-06-01/runtime/invocation/req-1/response", "/2018-06-01/runtime/invocation/req-1/error":
+			body, _ := io.ReadAll(r.Body)
+			results <- strings.TrimPrefix(r.URL.Path, "/2018-06-01/runtime/invocation/req-1/") + " " + string(body)
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			t.Errorf("想定しないパス %s", r.URL.Path)
+		}
+	}))
+	return ts, results
+}
+
+func TestLambdaFunctionURL(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+	os.WriteFile(filepath.Join(dir, "logo.png"), []byte{0x89, 'P', 'N', 'G', 0xff}, 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for _, tt := range []struct {
+		path     string
+		expected string
+		base64   bool
+	}{
+		{"/dashboard", "SPA", false},
+		{"/logo.png", string([]byte{0x89, 'P', 'N', 'G', 0xff}), true},
+	} {
+		event := `{"version":"2.0","rawPath":"` + tt.path + `","rawQueryString":"tab=1","cookies":["a=1","b=2"],
+			"headers":{"host":"abc.lambda-url.ap-northeast-1.on.aws","user-agent":"test"},
+			"requestContext":{"http":{"method":"GET","sourceIp":"203.0.113.7"}},"isBase64Encoded":false}`
+		ts, results := fakeLambdaRuntime(t, event)
+		if err := newLambdaRuntime(strings.TrimPrefix(ts.URL, "http://")).invoke(s); err != nil {
+			t.Fatal(err)
+		}
+		ts.Close()
+
+		result := <-results
+		kind, body, _ := strings.Cut(result, " ")
+		if kind != "response" {
+			t.Fatalf("%s: レスポンスが返されるべきです: %s", tt.path, result)
+		}
+		var resp lambdaResponse
+		if err := json.Unmarshal([]byte(body), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK || resp.Base64 != tt.base64 {
+			t.Errorf("%s: 期待されるレスポンス 200 base64=%v, 実際のレスポンス %d base64=%v", tt.path, tt.base64, resp.StatusCode, resp.Base64)
+		}
+		got := resp.Body
+		if resp.Base64 {
+			data, _ := base64.StdEncoding.DecodeString(resp.Body)
+			got = string(data)
+		}
+		if got != tt.expected {
+			t.Errorf("%s: 期待される本文 %q, 実際の本文 %q", tt.path, tt.expected, got)
+		}
+	}
+}
+
+func TestLambdaEventRequest(t *testing.T) {
+	// API Gateway の REST API（1.0 形式）
+	event := lambdaEvent{
+		HTTPMethod:        "POST",
+		Path:              "/api/items",
+		MultiValueQuery:   map[string][]string{"id": {"1", "2"}},
+		MultiValueHeaders: map[string][]string{"Host": {"api.example.com"}, "Accept": {"text/html", "application/json"}},
+		Body:              base64.StdEncoding.EncodeToString([]byte(`{"name":"x"}`)),
+		Base64:            true,
+	}
+	event.RequestContext.Identity.SourceIP = "198.51.100.1"
+	r, err := event.request(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(r.Body)
+	if r.Method != "POST" || r.URL.RequestURI() != "/api/items?id=1&id=2" || r.Host != "api.example.com" ||
+		len(r.Header.Values("Accept")) != 2 || string(body) != `{"name":"x"}` || r.RemoteAddr != "198.51.100.1:0" {
+		t.Errorf("リクエストが正しく変換されていません: %s %s %s %v %s %s", r.Method, r.URL, r.Host, r.Header, body, r.RemoteAddr)
+	}
+
+	w := newLambdaResponseWriter()
+	w.Header().Add("Set-Cookie", "a=1")
+	w.Header().Add("Set-Cookie", "b=2")
+	w.Header().Set("Content-Type", "text/plain")
+	io.WriteString(w, "ok")
+	resp := w.response(false)
+	if len(resp.MultiValueHeaders["Set-Cookie"]) != 2 || resp.Headers["Set-Cookie"] != "" || resp.Headers["Content-Type"] != "text/plain" {
+		t.Errorf("1.0 形式のヘッダーが正しくありません: %v %v", resp.Headers, resp.MultiValueHeaders)
+	}
+	if resp := w.response(true); len(resp.Cookies) != 2 || resp.MultiValueHeaders != nil {
+		t.Errorf("2.0 形式では Set-Cookie を cookies で返すべきです: %v", resp)
+	}
+
+	if _, err := (&lambdaEvent{}).request(context.Background()); err == nil {
+		t.Error("HTTP 以外のイベントはエラーになるべきです")
+	}
+}
+
+func TestPlatformDefaults(t *testing.T) {
+	t.Setenv("K_SERVICE", "web")
+	cfg, err := LoadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ShutdownTimeout != cloudRunShutdownTimeout {
+		t.Errorf("Cloud Run の SHUTDOWN_TIMEOUT の既定値 %s, 実際の値 %s", cloudRunShutdownTimeout, cfg.ShutdownTimeout)
+	}
+
+	t.Setenv("SHUTDOWN_TIMEOUT", "5s")
+	if cfg, _ := LoadConfig(""); cfg.ShutdownTimeout != 5*time.Second {
+		t.Errorf("SHUTDOWN_TIMEOUT を設定した場合はその値を使うべきです: %s", cfg.ShutdownTimeout)
+	}
+}
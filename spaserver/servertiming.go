@@ -0,0 +1,106 @@
+package spaserver
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Server-Timing ヘッダー
+// SERVER_TIMING が有効な場合、レスポンスヘッダーに処理の段階ごとの時間を付け、
+// ブラウザーの開発者ツールや RUM でサーバー側の時間の内訳を確認できるようにする
+//
+//	ip-filter: IP アドレスの確認まで
+//	route:     IP アドレスの確認からプロキシまたは静的ファイルの配信に振り分けるまで
+//	upstream:  プロキシ先へのリクエストから最初のバイトを受け取るまで（プロキシのみ）
+//	serve:     振り分けてからレスポンスヘッダーを送るまで（upstream を含む）
+
+// markIPFiltered は IP アドレスの確認が終わった時刻を記録する
+func (t *requestTiming) markIPFiltered() {
+	t.mu.Lock()
+	t.ipFiltered = time.Now()
+	t.mu.Unlock()
+}
+
+// markRouted はプロキシまたは静的ファイルの配信に振り分けた時刻を記録する
+func (t *requestTiming) markRouted() {
+	t.mu.Lock()
+	if t.routed.IsZero() {
+		t.routed = time.Now()
+	}
+	t.mu.Unlock()
+}
+
+// serverTiming は Server-Timing ヘッダーの値を返す
+func (t *requestTiming) serverTiming(start, now time.Time) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var parts []string
+	metric := func(name string, d time.Duration) {
+		parts = append(parts, fmt.Sprintf("%s;dur=%.3f", name, float64(d)/float64(time.Millisecond)))
+	}
+	if !t.ipFiltered.IsZero() {
+		metric("ip-filter", t.ipFiltered.Sub(start))
+		if !t.routed.IsZero() {
+			metric("route", t.routed.Sub(t.ipFiltered))
+		}
+	}
+	if t.upstreamTTFB > 0 {
+		metric("upstream", t.upstreamTTFB)
+	}
+	if !t.routed.IsZero() {
+		metric("serve", now.Sub(t.routed))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// serverTimingWriter はレスポンスヘッダーを送る直前に Server-Timing ヘッダーを追加する
+// プロキシ先が付けた Server-Timing はそのまま残す
+type serverTimingWriter struct {
+	http.ResponseWriter
+	timing      *requestTiming
+	start       time.Time
+	wroteHeader bool
+}
+
+// withServerTiming は Server-Timing ヘッダーを追加する ResponseWriter と、処理時間を記録するリクエストを返す
+func withServerTiming(w http.ResponseWriter, r *http.Request) (*serverTimingWriter, *http.Request) {
+	r, timing := withTiming(r)
+	return &serverTimingWriter{ResponseWriter: w, timing: timing, start: time.Now()}, r
+}
+
+func (sw *serverTimingWriter) WriteHeader(code int) {
+	if !sw.wroteHeader && code >= 200 {
+		sw.wroteHeader = true
+		if value := sw.timing.serverTiming(sw.start, time.Now()); value != "" {
+			sw.Header().Add("Server-Timing", value)
+		}
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *serverTimingWriter) Write(p []byte) (int, error) {
+	if !sw.wroteHeader {
+		sw.WriteHeader(http.StatusOK)
+	}
+	return sw.ResponseWriter.Write(p)
+}
+
+func (sw *serverTimingWriter) Flush() {
+	if !sw.wroteHeader {
+		sw.WriteHeader(http.StatusOK)
+	}
+	http.NewResponseController(sw.ResponseWriter).Flush()
+}
+
+// Hijack は WebSocket などのプロトコル切り替えのために接続を引き渡す
+func (sw *serverTimingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(sw.ResponseWriter).Hijack()
+}
+
+func (sw *serverTimingWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
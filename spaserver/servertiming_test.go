@@ -0,0 +1,66 @@
+package spaserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestServerTiming(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server-Timing", "db;dur=12")
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Proxy.URL = backend.URL
+	cfg.Proxy.Paths = []string{"/api"}
+	cfg.ServerTiming = true
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		name     string
+		path     string
+		expected []string
+	}{
+		{"静的ファイル", "/", []string{"ip-filter;dur=", "route;dur=", "serve;dur="}},
+		{"プロキシ", "/api/users", []string{"db;dur=12", "ip-filter;dur=", "route;dur=", "upstream;dur=", "serve;dur="}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+			header := strings.Join(rr.Header().Values("Server-Timing"), ", ")
+			for _, expected := range tt.expected {
+				if !strings.Contains(header, expected) {
+					t.Errorf("Server-Timing ヘッダーに %q が含まれていません: %q", expected, header)
+				}
+			}
+			if tt.path == "/" && strings.Contains(header, "upstream") {
+				t.Errorf("静的ファイルに upstream が含まれるべきではありません: %q", header)
+			}
+		})
+	}
+
+	cfg.ServerTiming = false
+	s2, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s2.Close()
+	rr := httptest.NewRecorder()
+	s2.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if got := rr.Header().Get("Server-Timing"); got != "" {
+		t.Errorf("SERVER_TIMING が無効の場合はヘッダーを付けるべきではありません: %q", got)
+	}
+}
@@ -0,0 +1,73 @@
+package spaserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Shutdown は新しい接続の受け付けを停止し、処理中のリクエストの完了を待つ
+// ctx の期限を過ぎた場合は残っている接続を閉じる
+func (l *listeners) Shutdown(ctx context.Context) error {
+	l.mu.Lock()
+	servers := append([]*http.Server(nil), l.servers...)
+	l.mu.Unlock()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(servers))
+	for i, srv := range servers {
+		wg.Add(1)
+		go func(i int, srv *http.Server) {
+			defer wg.Done()
+			if err := srv.Shutdown(ctx); err != nil {
+				srv.Close()
+				errs[i] = err
+			}
+		}(i, srv)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// shutdownOnSignal は SIGTERM・SIGINT を受け取るとリスナーを停止し、処理中のリクエストを待ってから終了処理を行う
+// 待ち時間は受け取った時点の設定の SHUTDOWN_TIMEOUT
+func shutdownOnSignal(l *listeners, h *handlerSwitch) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGTERM, os.Interrupt)
+	sig := <-ch
+	signal.Stop(ch)
+	timeout := h.current.Load().cfg.ShutdownTimeout
+	infof("Received %s, shutting down (timeout %s)", sig, timeout)
+	shutdown(l, h, timeout)
+}
+
+// shutdown はリスナーを停止し、バックグラウンド処理とプロキシ先への接続を閉じる
+func shutdown(l *listeners, h *handlerSwitch, timeout time.Duration) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	// 管理画面の Server-Sent Events は自分からは終わらないため、処理中のリクエストを待つ前に閉じる
+	if srv := h.current.Load(); srv != nil {
+		srv.dashboard.Close()
+	}
+	if err := l.Shutdown(ctx); err != nil {
+		warnf("In-flight requests did not finish before the shutdown timeout: %v", err)
+	}
+	// 設定の読み込み直しで差し替えたサーバーの Sentry への送信などを待つ
+	h.retiring.Wait()
+	if srv := h.current.Load(); srv != nil {
+		srv.Close()
+	}
+	if c := currentStatsd.Swap(nil); c != nil {
+		c.Close()
+	}
+	infof("Shutdown complete")
+}
@@ -0,0 +1,116 @@
+package spaserver
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestShutdownWaitsForInFlightRequests(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+
+	l := &listeners{}
+	served := make(chan error, 1)
+	go func() { served <- l.Serve(ln, handler) }()
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/")
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		body <- string(data)
+	}()
+	<-started
+
+	h := &handlerSwitch{}
+	shutdown(l, h, 5*time.Second)
+
+	// 処理中のリクエストは完了し、Serve は nil を返す
+	if got := <-body; got != "done" {
+		t.Errorf("処理中のリクエストが完了していません: %s", got)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Serve がエラーを返しました: %v", err)
+	}
+	// 新しい接続は受け付けない
+	if _, err := http.Get("http://" + ln.Addr().String() + "/"); err == nil {
+		t.Error("停止後に接続できてしまいます")
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+
+	l := &listeners{}
+	go l.Serve(ln, handler)
+	go http.Get("http://" + ln.Addr().String() + "/")
+	<-started
+
+	start := time.Now()
+	shutdown(l, &handlerSwitch{}, 100*time.Millisecond)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("タイムアウト後も待ち続けています: %s", elapsed)
+	}
+}
+
+func TestShutdownWithDashboardSubscriber(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.DistDir = t.TempDir()
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &handlerSwitch{}
+	h.current.Store(s)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &listeners{}
+	go l.Serve(ln, h.Admin())
+
+	// 管理画面を開いたままにする
+	resp, err := http.Get("http://" + ln.Addr().String() + dashboardEventsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, err := resp.Body.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	shutdown(l, h, 5*time.Second)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("管理画面の接続が停止を妨げています: %s", elapsed)
+	}
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Errorf("管理画面の接続が正常に終了していません: %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package spaserver
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+)
+
+// requestTiming はリクエストの処理時間の内訳
+type requestTiming struct {
+	mu       sync.Mutex
+	upstream string
+	reused   bool
+
+	// プロキシ先へのリクエストの各段階の開始時刻と所要時間
+	upstreamStart time.Time
+	dnsStart      time.Time
+	connectStart  time.Time
+	tlsStart      time.Time
+	dns           time.Duration
+	connect       time.Duration
+	tls           time.Duration
+	upstreamTTFB  time.Duration
+	// プロキシ先へのリクエストの開始からレスポンスボディを送り終えるまで
+	upstreamTime time.Duration
+
+	// Server-Timing ヘッダーの段階の終了時刻
+	ipFiltered time.Time
+	routed     time.Time
+}
+
+type timingKey struct{}
+
+// timingFrom はリクエストのコンテキストから処理時間の記録先を取得する（記録しない場合は nil）
+func timingFrom(ctx context.Context) *requestTiming {
+	t, _ := ctx.Value(timingKey{}).(*requestTiming)
+	return t
+}
+
+// withTiming はリクエストのコンテキストに処理時間の記録先がない場合に追加する
+// アクセスログと遅いリクエストの記録が同じ記録先を使う
+func withTiming(r *http.Request) (*http.Request, *requestTiming) {
+	if t := timingFrom(r.Context()); t != nil {
+		return r, t
+	}
+	t := &requestTiming{}
+	return r.WithContext(context.WithValue(r.Context(), timingKey{}, t)), t
+}
+
+// traceUpstream はプロキシ先へのリクエストの各段階の時間を記録するコンテキストを返す
+func (t *requestTiming) traceUpstream(ctx context.Context, upstream string) context.Context {
+	t.mu.Lock()
+	t.upstream = upstream
+	t.upstreamStart = time.Now()
+	t.mu.Unlock()
+
+	record := func(fn func()) {
+		t.mu.Lock()
+		fn()
+		t.mu.Unlock()
+	}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			record(func() { t.reused = info.Reused })
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			record(func() { t.dnsStart = time.Now() })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			record(func() { t.dns = time.Since(t.dnsStart) })
+		},
+		ConnectStart: func(string, string) {
+			record(func() { t.connectStart = time.Now() })
+		},
+		ConnectDone: func(string, string, error) {
+			record(func() { t.connect = time.Since(t.connectStart) })
+		},
+		TLSHandshakeStart: func() {
+			record(func() { t.tlsStart = time.Now() })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			record(func() { t.tls = time.Since(t.tlsStart) })
+		},
+		GotFirstResponseByte: func() {
+			record(func() { t.upstreamTTFB = time.Since(t.upstreamStart) })
+		},
+	})
+}
+
+// finishUpstream はプロキシ先からのレスポンスを送り終えた時点でプロキシ先の処理時間を記録する
+func (t *requestTiming) finishUpstream() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.upstreamStart.IsZero() {
+		t.upstreamTime = time.Since(t.upstreamStart)
+	}
+}
+
+// String は処理時間の内訳を key=value 形式で返す
+func (t *requestTiming) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.upstream == "" {
+		return "upstream=-"
+	}
+	parts := []string{"upstream=" + t.upstream}
+	if t.reused {
+		parts = append(parts, "conn=reused")
+	} else {
+		parts = append(parts, "dns="+formatDuration(t.dns), "connect="+formatDuration(t.connect))
+		if t.tls > 0 {
+			parts = append(parts, "tls="+formatDuration(t.tls))
+		}
+	}
+	parts = append(parts, "upstream_ttfb="+formatDuration(t.upstreamTTFB))
+	if t.upstreamTime > 0 {
+		parts = append(parts, "upstream_time="+formatDuration(t.upstreamTime))
+	}
+	return strings.Join(parts, " ")
+}
+
+func formatDuration(d time.Duration) string {
+	return d.Round(time.Microsecond).String()
+}
+
+// slowLogger は処理に時間のかかったリクエストを警告として出力する
+type slowLogger struct {
+	threshold time.Duration
+}
+
+func newSlowLogger(cfg LogConfig) *slowLogger {
+	if cfg.SlowRequestThreshold <= 0 {
+		return nil
+	}
+	return &slowLogger{threshold: cfg.SlowRequestThreshold}
+}
+
+// Wrap はハンドラーに遅いリクエストの記録を追加する
+func (l *slowLogger) Wrap(next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		r, timing := withTiming(r)
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		total := time.Since(start)
+		if total < l.threshold {
+			return
+		}
+		firstByte := "-"
+		if !rec.wroteHeaderAt.IsZero() {
+			firstByte = formatDuration(rec.wroteHeaderAt.Sub(start))
+		}
+		warnf("Slow request: %s %s %d total=%s first_byte=%s %s",
+			r.Method, escapeLogValue(r.URL.Path), rec.Status(), formatDuration(total), firstByte, timing)
+	})
+}
@@ -0,0 +1,58 @@
+package spaserver
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlowRequestLog(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/slow" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Proxy.URL = backend.URL
+	cfg.Proxy.Paths = []string{"/api"}
+	cfg.Log.SlowRequestThreshold = 30 * time.Millisecond
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/api/fast", "/", "/api/slow"} {
+		s.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	output := buf.String()
+	if strings.Count(output, "Slow request") != 1 {
+		t.Fatalf("遅いリクエストのみ出力されるべきです:\n%s", output)
+	}
+	for _, expected := range []string{"WARN Slow request: GET /api/slow 200", "total=", "first_byte=", "upstream=" + backend.URL, "upstream_ttfb="} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("ログに %q が含まれていません: %s", expected, output)
+		}
+	}
+}
+
+func TestSlowLoggerDisabled(t *testing.T) {
+	if newSlowLogger(LogConfig{}) != nil {
+		t.Error("SLOW_REQUEST_THRESHOLD が 0 の場合は無効になるべきです")
+	}
+}
@@ -0,0 +1,36 @@
+// Package spaserver はSPAの配信とバックエンドへのプロキシを行う http.Handler を提供する
+//
+// 他の Go のサービスに組み込む場合は Config を用意して New を呼ぶ:
+//
+//	cfg := spaserver.DefaultConfig()
+//	cfg.DistDir = "./dist"
+//	cfg.Proxy.URL = "http://localhost:3000"
+//	cfg.Proxy.Paths = []string{"/api"}
+//	handler, err := spaserver.New(cfg)
+//	defer handler.Close()
+//
+// ハンドラーはそれぞれ自分の状態（管理 API による変更、処理中のリクエスト数、メトリクスなど）を持つため、
+// 同じプロセスで異なる設定の New を複数呼んでも互いに影響しない
+package spaserver
+
+import (
+	"io"
+	"net/http"
+)
+
+// Handler は New が作成するハンドラー
+// 不要になったら Close を呼び、配信ディレクトリの監視やヘルスチェックなどのバックグラウンド処理を停止する
+type Handler interface {
+	http.Handler
+	io.Closer
+}
+
+// New は設定に従ってSPAの配信とプロキシを行うハンドラーを作成する
+// WithMiddleware で独自のミドルウェアを挿入できる
+func New(cfg Config, opts ...Option) (Handler, error) {
+	s, err := newServer(cfg, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
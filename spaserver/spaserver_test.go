@@ -0,0 +1,51 @@
+package spaserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("backend"))
+	}))
+	defer backend.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+	cfg := DefaultConfig()
+	cfg.DistDir = dir
+	cfg.Proxy.URL = backend.URL
+	cfg.Proxy.Paths = []string{"/api"}
+	handler, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handler.Close()
+
+	tests := []struct {
+		path         string
+		expectedBody string
+	}{
+		{"/api/users", "backend"},
+		{"/users/1", "SPA"},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+		if rr.Body.String() != tt.expectedBody {
+			t.Errorf("%s: 期待されるレスポンス %q, 実際のレスポンス %q", tt.path, tt.expectedBody, rr.Body.String())
+		}
+	}
+}
+
+func TestNewInvalidProxyURL(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.DistDir = t.TempDir()
+	cfg.Proxy.URL = "://invalid"
+	if _, err := New(cfg); err == nil {
+		t.Error("不正なプロキシURLでエラーになる必要があります")
+	}
+}
@@ -0,0 +1,54 @@
+package spaserver
+
+import "sync/atomic"
+
+// サーバーの状態
+// 管理 API による変更、処理中のリクエスト数、メトリクスとアクセス統計など、設定を読み込み直しても引き継ぐ値をまとめる。
+// New で作成したハンドラーはそれぞれ自分の状態を持つため、同じプロセスに複数のハンドラーを組み込んでも互いに影響しない。
+// spa-server コマンドでは handlerSwitch が現在のサーバーの状態を読み込み直した後のサーバーに渡す
+
+// serverState はハンドラーごとの、設定の再読み込みの前後で引き継ぐ状態
+type serverState struct {
+	metrics *serverMetrics
+	// 管理 API で変更した IP アドレスのルール・メンテナンスモード・カナリア版の割合・切り離したプロキシ先
+	ipRules    *ipRuleList
+	operations *runtimeOperations
+	// MAX_CONCURRENT_REQUESTS と MAX_CONNS_PER_IP で数える処理中のリクエスト（読み込み直しの前後で数が合うようにする）
+	queue *concurrencyLimiter
+	conns *connCounter
+	stats *accessStats
+	// 管理画面に表示する最近拒否したリクエストと、ALERT_COOLDOWN を判定する最後に通知した時刻
+	recentBlocked *blockedLog
+	lastAlerts    *alertTimes
+	// 開発モードでライブリロードに接続中のブラウザー（開発モードでない場合は nil）
+	live *liveReload
+	// RATE_LIMIT と RATE_LIMIT_PATHS のクライアントIPごとのバケット（上限の名前と値が同じ間は引き継ぐ）
+	// live と同じく newServer でのみ読み書きする
+	rateLimits map[string]*rateLimit
+}
+
+// expvarMetrics は /debug/vars の spa_server に出力するメトリクス
+// expvar はプロセス全体で1つのため、最初に作成したハンドラーのものを出力する
+var expvarMetrics atomic.Pointer[serverMetrics]
+
+func newServerState() *serverState {
+	st := &serverState{
+		metrics:       newServerMetrics(),
+		ipRules:       &ipRuleList{},
+		operations:    &runtimeOperations{},
+		queue:         &concurrencyLimiter{},
+		conns:         &connCounter{},
+		stats:         &accessStats{},
+		recentBlocked: &blockedLog{},
+		lastAlerts:    &alertTimes{},
+	}
+	expvarMetrics.CompareAndSwap(nil, st.metrics)
+	return st
+}
+
+// withState は st を引き継いでサーバーを作成する（nil の場合は新しい状態を使う）
+func withState(st *serverState) Option {
+	return func(o *options) {
+		o.state = st
+	}
+}
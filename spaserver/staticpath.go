@@ -0,0 +1,46 @@
+package spaserver
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// 静的ファイルのパスの検査
+// URL のパスから求めたファイルが DIST_DIR の外（シンボリックリンクの先を含む）を指す場合と、
+// ドットで始まるファイルやディレクトリ（.env や .git など）は配信しない。.well-known は例外
+
+// resolveStaticPath は URL のパスに対応する distDir 内のファイルパスを返す
+// distDir の外を指す場合は false を返す
+func resolveStaticPath(distDir, urlPath string) (string, bool) {
+	filePath := filepath.Join(distDir, filepath.FromSlash(path.Clean("/"+urlPath)))
+	if !withinDir(distDir, filePath) {
+		return "", false
+	}
+	// 存在しないファイルは index.html にフォールバックするため字句上の確認のみ
+	realPath, err := filepath.EvalSymlinks(filePath)
+	if err != nil {
+		return filePath, true
+	}
+	root, err := filepath.EvalSymlinks(distDir)
+	if err != nil {
+		return filePath, true
+	}
+	return filePath, withinDir(root, realPath)
+}
+
+// withinDir は p が dir またはその配下かを判定する
+func withinDir(dir, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+// isHiddenPath はパスにドットで始まるセグメント（.well-known 以外）が含まれるかを判定する
+func isHiddenPath(urlPath string) bool {
+	for _, seg := range strings.FieldsFunc(urlPath, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if strings.HasPrefix(seg, ".") && seg != "." && seg != ".." && seg != ".well-known" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package spaserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStaticPathContainment(t *testing.T) {
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644)
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+	os.WriteFile(filepath.Join(dir, ".env"), []byte("TOKEN=x"), 0644)
+	os.MkdirAll(filepath.Join(dir, ".git"), 0755)
+	os.WriteFile(filepath.Join(dir, ".git", "config"), []byte("[core]"), 0644)
+	os.MkdirAll(filepath.Join(dir, ".well-known"), 0755)
+	os.WriteFile(filepath.Join(dir, ".well-known", "security.txt"), []byte("Contact: x"), 0644)
+	if err := os.Symlink(outside, filepath.Join(dir, "linked")); err != nil {
+		t.Skip(err)
+	}
+
+	tests := []struct {
+		name         string
+		hidden       bool
+		path         string
+		expectedCode int
+		expected     string
+	}{
+		{"隠しファイルは配信しない", false, "/.env", http.StatusNotFound, ""},
+		{"隠しディレクトリは配信しない", false, "/.git/config", http.StatusNotFound, ""},
+		{".well-known は配信する", false, "/.well-known/security.txt", http.StatusOK, "Contact: x"},
+		{"設定すると隠しファイルも配信する", true, "/.env", http.StatusOK, "TOKEN=x"},
+		{"シンボリックリンクで外を参照しない", false, "/linked/secret.txt", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig(t)
+			cfg.DistDir = dir
+			cfg.ServeHiddenFiles = tt.hidden
+			cfg.NormalizePaths = false
+			s, err := newServer(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+			if rr.Code != tt.expectedCode {
+				t.Errorf("期待されるステータスコード %d, 実際のステータスコード %d", tt.expectedCode, rr.Code)
+			}
+			if tt.expected != "" && rr.Body.String() != tt.expected {
+				t.Errorf("期待されるボディ %s, 実際のボディ %s", tt.expected, rr.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package spaserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// アクセス統計
+// パスの先頭・ステータスコード・参照元・ブラウザーの種類ごとのリクエスト数をメモリで数え、/__stats で JSON として返す。
+// STATS_FILE を設定した場合は定期的に保存し、起動時に読み込んで続きから数える。
+// 値はサーバーの状態（serverState）に持ち、設定を読み込み直してもリセットされない
+
+const (
+	statsPath = "/__stats"
+	// 項目ごとに数える値の種類の上限（超えた値は (other) にまとめる）
+	maxStatsKeys = 1000
+	statsOther   = "(other)"
+)
+
+// statsSnapshot は保存・出力するアクセス統計
+type statsSnapshot struct {
+	Since      time.Time        `json:"since"`
+	Total      int64            `json:"total"`
+	Paths      map[string]int64 `json:"paths"`
+	Statuses   map[string]int64 `json:"statuses"`
+	Referrers  map[string]int64 `json:"referrers"`
+	UserAgents map[string]int64 `json:"user_agents"`
+}
+
+// accessStats はリクエスト数を数える
+type accessStats struct {
+	mu   sync.Mutex
+	data statsSnapshot
+	// 読み込んだ STATS_FILE（再読み込みのたびに読み直さない）
+	restored string
+}
+
+func (st *accessStats) init() {
+	if st.data.Paths == nil {
+		st.data = statsSnapshot{
+			Since:      time.Now(),
+			Paths:      map[string]int64{},
+			Statuses:   map[string]int64{},
+			Referrers:  map[string]int64{},
+			UserAgents: map[string]int64{},
+		}
+	}
+}
+
+// record はリクエストを数える
+func (st *accessStats) record(path, status, referrer, userAgent string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.init()
+	st.data.Total++
+	incrementStat(st.data.Paths, path)
+	incrementStat(st.data.Statuses, status)
+	if referrer != "" {
+		incrementStat(st.data.Referrers, referrer)
+	}
+	incrementStat(st.data.UserAgents, userAgent)
+}
+
+func incrementStat(m map[string]int64, key string) {
+	if _, ok := m[key]; !ok && len(m) >= maxStatsKeys {
+		key = statsOther
+	}
+	m[key]++
+}
+
+// snapshot は現在の値のコピーを返す
+func (st *accessStats) snapshot() statsSnapshot {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.init()
+	copyMap := func(m map[string]int64) map[string]int64 {
+		c := make(map[string]int64, len(m))
+		for k, v := range m {
+			c[k] = v
+		}
+		return c
+	}
+	return statsSnapshot{
+		Since:      st.data.Since,
+		Total:      st.data.Total,
+		Paths:      copyMap(st.data.Paths),
+		Statuses:   copyMap(st.data.Statuses),
+		Referrers:  copyMap(st.data.Referrers),
+		UserAgents: copyMap(st.data.UserAgents),
+	}
+}
+
+// restore は保存したファイルから値を読み込む（同じファイルは一度だけ）
+func (st *accessStats) restore(file string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.restored == file {
+		return
+	}
+	st.restored = file
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return
+	}
+	var saved statsSnapshot
+	if err == nil {
+		err = json.Unmarshal(data, &saved)
+	}
+	if err != nil {
+		warnf("Reading statistics from %s: %v", file, err)
+		return
+	}
+	st.init()
+	if saved.Since.Before(st.data.Since) {
+		st.data.Since = saved.Since
+	}
+	st.data.Total += saved.Total
+	for _, m := range []struct{ to, from map[string]int64 }{
+		{st.data.Paths, saved.Paths},
+		{st.data.Statuses, saved.Statuses},
+		{st.data.Referrers, saved.Referrers},
+		{st.data.UserAgents, saved.UserAgents},
+	} {
+		for k, v := range m.from {
+			if _, ok := m.to[k]; !ok && len(m.to) >= maxStatsKeys {
+				k = statsOther
+			}
+			m.to[k] += v
+		}
+	}
+	infof("Restored statistics from %s (%d requests since %s)", file, st.data.Total, st.data.Since.Format(time.RFC3339))
+}
+
+// save は現在の値をファイルに保存する（書き込み途中のファイルを読まないよう一時ファイルから置き換える）
+func (st *accessStats) save(file string) error {
+	data, err := json.Marshal(st.snapshot())
+	if err != nil {
+		return err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// ServeHTTP はアクセス統計を JSON で返す
+func (st *accessStats) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, staticMethods) {
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, st.snapshot())
+}
+
+// statsRecorder はリクエストをアクセス統計に記録し、STATS_FILE に定期的に保存する
+type statsRecorder struct {
+	cfg   StatsConfig
+	stats *accessStats
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func newStatsRecorder(cfg StatsConfig, stats *accessStats) *statsRecorder {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &statsRecorder{cfg: cfg, stats: stats}
+}
+
+// start は STATS_FILE から値を読み込み、定期的な保存を始める
+func (rec *statsRecorder) start() {
+	if rec == nil || rec.cfg.File == "" {
+		return
+	}
+	rec.stats.restore(rec.cfg.File)
+	rec.stop = make(chan struct{})
+	rec.done = make(chan struct{})
+	go rec.run()
+}
+
+func (rec *statsRecorder) run() {
+	defer close(rec.done)
+	ticker := time.NewTicker(rec.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := rec.stats.save(rec.cfg.File); err != nil {
+				warnf("Saving statistics to %s: %v", rec.cfg.File, err)
+			}
+		case <-rec.stop:
+			return
+		}
+	}
+}
+
+// Close は定期的な保存を止め、最後の値を保存する
+func (rec *statsRecorder) Close() {
+	if rec == nil || rec.stop == nil {
+		return
+	}
+	close(rec.stop)
+	<-rec.done
+	if err := rec.stats.save(rec.cfg.File); err != nil {
+		warnf("Saving statistics to %s: %v", rec.cfg.File, err)
+	}
+}
+
+// Wrap はハンドラーにアクセス統計の記録を追加する
+func (rec *statsRecorder) Wrap(next http.Handler) http.Handler {
+	if rec == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rr := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rr, r)
+		rec.stats.record(statsPathPrefix(r.URL.Path, rec.cfg.PathDepth), strconv.Itoa(rr.Status()), statsReferrer(r), userAgentFamily(r.UserAgent()))
+	})
+}
+
+// statsPathPrefix はパスを先頭から depth 個のセグメントにする（/users/1/posts は depth 1 で /users）
+func statsPathPrefix(urlPath string, depth int) string {
+	segments := strings.Split(strings.Trim(urlPath, "/"), "/")
+	if segments[0] == "" {
+		return "/"
+	}
+	if len(segments) > depth {
+		segments = segments[:depth]
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// statsReferrer は他のサイトからのリクエストの参照元のホスト名を返す（同じサイト内と参照元のない場合は空文字列）
+func statsReferrer(r *http.Request) string {
+	u, err := url.Parse(r.Referer())
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == strings.ToLower(hostWithoutPort(r.Host)) {
+		return ""
+	}
+	return host
+}
+
+func hostWithoutPort(host string) string {
+	if u, err := url.Parse("//" + host); err == nil {
+		return u.Hostname()
+	}
+	return host
+}
+
+// userAgentFamily は User-Agent をブラウザーやクライアントの種類にまとめる
+func userAgentFamily(ua string) string {
+	lower := strings.ToLower(ua)
+	switch {
+	case ua == "":
+		return "(none)"
+	case strings.Contains(lower, "bot") || strings.Contains(lower, "crawler") || strings.Contains(lower, "spider"):
+		return "Bot"
+	case strings.Contains(ua, "Edg/"):
+		return "Edge"
+	case strings.Contains(ua, "OPR/"):
+		return "Opera"
+	case strings.Contains(ua, "Firefox/"):
+		return "Firefox"
+	case strings.Contains(ua, "Chrome/") || strings.Contains(ua, "CriOS/"):
+		return "Chrome"
+	case strings.Contains(ua, "Safari/"):
+		return "Safari"
+	case strings.HasPrefix(lower, "curl/"):
+		return "curl"
+	}
+	return "Other"
+}
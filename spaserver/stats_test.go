@@ -0,0 +1,129 @@
+package spaserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+	statsFile := filepath.Join(t.TempDir(), "stats.json")
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Stats.Enabled = true
+	cfg.Stats.Endpoint = true
+	cfg.Stats.File = statsFile
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := []struct {
+		path      string
+		referrer  string
+		userAgent string
+	}{
+		{"/", "https://www.google.com/search?q=spa", "Mozilla/5.0 (Windows NT 10.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"},
+		{"/users/1", "http://example.com/", "Mozilla/5.0 (Macintosh) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Safari/605.1.15"},
+		{"/users/2", "", "Googlebot/2.1 (+http://www.google.com/bot.html)"},
+	}
+	for _, req := range requests {
+		r := httptest.NewRequest("GET", req.path, nil)
+		if req.referrer != "" {
+			r.Header.Set("Referer", req.referrer)
+		}
+		r.Header.Set("User-Agent", req.userAgent)
+		s.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest("GET", statsPath, nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("期待されるステータスコード %d, 実際のステータスコード %d", http.StatusOK, rr.Code)
+	}
+	var got statsSnapshot
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Total != 3 || got.Paths["/"] != 1 || got.Paths["/users"] != 2 || got.Statuses["200"] != 3 {
+		t.Errorf("リクエスト数が正しくありません: %+v", got)
+	}
+	if len(got.Referrers) != 1 || got.Referrers["www.google.com"] != 1 {
+		t.Errorf("他のサイトの参照元のみ数えるべきです: %v", got.Referrers)
+	}
+	if got.UserAgents["Chrome"] != 1 || got.UserAgents["Safari"] != 1 || got.UserAgents["Bot"] != 1 {
+		t.Errorf("ブラウザーの種類が正しくありません: %v", got.UserAgents)
+	}
+
+	// 終了時に保存し、次の起動時に続きから数える（/__stats へのリクエストを含む）
+	s.Close()
+	s, err = newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if total := s.state.stats.snapshot().Total; total != 4 {
+		t.Errorf("期待されるリクエスト数 4, 実際のリクエスト数 %d", total)
+	}
+}
+
+func TestStatsEndpointDisabled(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Stats.Enabled = true
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	rr := httptest.NewRecorder()
+	s.ServeHTTP(rr, httptest.NewRequest("GET", statsPath, nil))
+	if rr.Body.String() != "SPA" {
+		t.Errorf("STATS_ENDPOINT が無効の場合は公開ポートで提供するべきではありません: %q", rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	s.admin.ServeHTTP(rr, httptest.NewRequest("GET", statsPath, nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("管理用インターフェースでは提供するべきです: %d", rr.Code)
+	}
+}
+
+func TestStatsHelpers(t *testing.T) {
+	for path, expected := range map[string]string{"/": "/", "": "/", "/users/1/posts": "/users", "/about": "/about"} {
+		if got := statsPathPrefix(path, 1); got != expected {
+			t.Errorf("%q: 期待されるパス %q, 実際のパス %q", path, expected, got)
+		}
+	}
+	if got := statsPathPrefix("/users/1/posts", 2); got != "/users/1" {
+		t.Errorf("期待されるパス %q, 実際のパス %q", "/users/1", got)
+	}
+	for ua, expected := range map[string]string{
+		"":           "(none)",
+		"curl/8.4.0": "curl",
+		"Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0":                                    "Firefox",
+		"Mozilla/5.0 AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36 Edg/120.0":                   "Edge",
+		"Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)":                                   "Bot",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 CriOS/120.0 Mobile Safari/604": "Chrome",
+	} {
+		if got := userAgentFamily(ua); got != expected {
+			t.Errorf("%q: 期待される種類 %q, 実際の種類 %q", ua, expected, got)
+		}
+	}
+
+	st := &accessStats{}
+	for i := 0; i < maxStatsKeys+5; i++ {
+		st.record(fmt.Sprintf("/page%d", i), "200", "", "Other")
+	}
+	if paths := st.snapshot().Paths; len(paths) != maxStatsKeys+1 || paths[statsOther] != 5 {
+		t.Errorf("上限を超えた値は %s にまとめるべきです: %d 種類, %s=%d", statsOther, len(paths), statsOther, paths[statsOther])
+	}
+}
@@ -0,0 +1,175 @@
+package spaserver
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// statsdMaxPacket は1パケットの最大サイズ（一般的な MTU に収まる大きさ）
+	statsdMaxPacket = 1432
+	// statsdFlushInterval はバッファを送信する間隔
+	statsdFlushInterval = 100 * time.Millisecond
+	// statsdQueueSize は送信待ちの最大行数（超えた分は破棄する）
+	statsdQueueSize = 4096
+)
+
+// currentStatsd は現在の statsd クライアント（未設定の場合は nil）
+var currentStatsd atomic.Pointer[statsdClient]
+
+// statsdClient はメトリクスを statsd / DogStatsD に UDP で送信する
+type statsdClient struct {
+	cfg   StatsdConfig
+	conn  net.Conn
+	lines chan string
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+func newStatsdClient(cfg StatsdConfig) (*statsdClient, error) {
+	conn, err := net.Dial("udp", cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &statsdClient{cfg: cfg, conn: conn, lines: make(chan string, statsdQueueSize), done: make(chan struct{})}
+	c.wg.Add(1)
+	go c.run()
+	return c, nil
+}
+
+// setupStatsd は設定に応じて statsd クライアントを開始・変更・停止する
+func setupStatsd(cfg StatsdConfig) error {
+	old := currentStatsd.Load()
+	if old != nil && equalStatsdConfig(old.cfg, cfg) {
+		return nil
+	}
+	var c *statsdClient
+	if cfg.Addr != "" {
+		var err error
+		if c, err = newStatsdClient(cfg); err != nil {
+			return err
+		}
+		infof("Sending metrics to statsd at %s", cfg.Addr)
+	}
+	if old = currentStatsd.Swap(c); old != nil {
+		old.Close()
+	}
+	return nil
+}
+
+func equalStatsdConfig(a, b StatsdConfig) bool {
+	return a.Addr == b.Addr && a.Prefix == b.Prefix && a.DogStatsD == b.DogStatsD &&
+		strings.Join(a.Tags, ",") == strings.Join(b.Tags, ",")
+}
+
+// Close は残っているメトリクスを送信して停止する
+func (c *statsdClient) Close() {
+	close(c.done)
+	c.wg.Wait()
+	c.conn.Close()
+}
+
+// emit は metricVec の更新を statsd の行に変換して送信キューに入れる
+func (c *statsdClient) emit(v *metricVec, value float64, labelValues []string) {
+	var metricType string
+	switch v.kind {
+	case "counter":
+		metricType = "c"
+	case "gauge":
+		metricType = "g"
+	case "histogram":
+		// 秒単位の値をミリ秒のタイマーとして送信する
+		metricType = "ms"
+		value *= 1000
+	}
+
+	var b strings.Builder
+	b.WriteString(c.cfg.Prefix)
+	b.WriteString(v.name)
+	if !c.cfg.DogStatsD {
+		// 通常の statsd はタグに対応していないため、ラベルの値を名前に含める
+		for _, lv := range labelValues {
+			b.WriteByte('.')
+			b.WriteString(sanitizeStatsd(lv))
+		}
+	}
+	b.WriteByte(':')
+	b.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	b.WriteByte('|')
+	b.WriteString(metricType)
+	if c.cfg.DogStatsD {
+		tags := append([]string(nil), c.cfg.Tags...)
+		for i, name := range v.labels {
+			tags = append(tags, name+":"+sanitizeStatsd(labelValues[i]))
+		}
+		if len(tags) > 0 {
+			b.WriteString("|#")
+			b.WriteString(strings.Join(tags, ","))
+		}
+	}
+
+	select {
+	case c.lines <- b.String():
+	default:
+		// 送信が追いつかない場合はリクエスト処理を止めないよう破棄する
+	}
+}
+
+// run は送信キューの行をパケットにまとめて送信する
+func (c *statsdClient) run() {
+	defer c.wg.Done()
+	ticker := time.NewTicker(statsdFlushInterval)
+	defer ticker.Stop()
+
+	var buf bytes.Buffer
+	flush := func() {
+		if buf.Len() > 0 {
+			c.conn.Write(buf.Bytes())
+			buf.Reset()
+		}
+	}
+	add := func(line string) {
+		if buf.Len() > 0 && buf.Len()+1+len(line) > statsdMaxPacket {
+			flush()
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(line)
+	}
+	for {
+		select {
+		case line := <-c.lines:
+			add(line)
+		case <-ticker.C:
+			flush()
+		case <-c.done:
+			// キューに残っている行を送信してから終了する
+			for {
+				select {
+				case line := <-c.lines:
+					add(line)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// sanitizeStatsd は statsd の区切り文字を含まないように値を置き換える
+func sanitizeStatsd(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', '@', '#', ',', '\n', ' ':
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,71 @@
+package spaserver
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsd(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      StatsdConfig
+		expected []string
+	}{
+		{
+			name: "statsd形式ではラベルの値が名前に含まれる",
+			cfg:  StatsdConfig{Prefix: "spa."},
+			expected: []string{
+				"spa.test_requests_total.GET.200:1|c",
+				"spa.test_in_flight:3|g",
+				"spa.test_duration_seconds:250|ms",
+			},
+		},
+		{
+			name: "DogStatsD形式ではラベルがタグとして送信される",
+			cfg:  StatsdConfig{Prefix: "spa.", DogStatsD: true, Tags: []string{"env:test"}},
+			expected: []string{
+				"spa.test_requests_total:1|c|#env:test,method:GET,code:200",
+				"spa.test_in_flight:3|g|#env:test",
+				"spa.test_duration_seconds:250|ms|#env:test",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			tt.cfg.Addr = conn.LocalAddr().String()
+			if err := setupStatsd(tt.cfg); err != nil {
+				t.Fatal(err)
+			}
+			newCounterVec("test_requests_total", "", "method", "code").Add(1, "GET", "200")
+			newGaugeVec("test_in_flight", "").Set(3)
+			newHistogramVec("test_duration_seconds", "", defaultBuckets).Observe(0.25)
+			// 停止時にキューに残った行が送信される
+			setupStatsd(StatsdConfig{})
+
+			conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			var lines []string
+			buf := make([]byte, statsdMaxPacket)
+			for len(lines) < len(tt.expected) {
+				n, _, err := conn.ReadFrom(buf)
+				if err != nil {
+					t.Fatalf("メトリクスを受信できませんでした: %v (受信済み: %q)", err, lines)
+				}
+				lines = append(lines, strings.Split(string(buf[:n]), "\n")...)
+			}
+			for i, expected := range tt.expected {
+				if lines[i] != expected {
+					t.Errorf("期待される行 %q, 実際の行 %q", expected, lines[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package spaserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// プロキシ先に転送する前にリクエストから取り除くヘッダーとクッキー
+// PROXY_STRIP_HEADERS・PROXY_STRIP_COOKIES の "パターン=名前|名前" の項目のうち、パスに一致するものをすべて適用する
+
+// stripRule はプロキシパスのパターンごとに取り除く名前
+type stripRule struct {
+	pattern string
+	names   []string
+}
+
+// parseStripRules は "パターン=名前|名前" の一覧を解析する
+func parseStripRules(entries []string) ([]stripRule, error) {
+	var rules []stripRule
+	for _, entry := range entries {
+		pattern, value, ok := strings.Cut(entry, "=")
+		if !ok || pattern == "" || value == "" {
+			return nil, fmt.Errorf("invalid entry %q (use path=name|name)", entry)
+		}
+		var names []string
+		for _, name := range strings.Split(value, "|") {
+			if name = strings.TrimSpace(name); name == "" {
+				return nil, fmt.Errorf("empty name in %q", entry)
+			}
+			names = append(names, name)
+		}
+		rules = append(rules, stripRule{pattern: pattern, names: names})
+	}
+	return rules, nil
+}
+
+// namesFor はパスに一致するすべての項目の名前を返す
+func namesFor(rules []stripRule, path string) []string {
+	var names []string
+	for _, rule := range rules {
+		if matchProxyPath([]string{rule.pattern}, path) {
+			names = append(names, rule.names...)
+		}
+	}
+	return names
+}
+
+// stripRequest はプロキシ先に転送しないヘッダーとクッキーをリクエストから取り除く
+func (s *server) stripRequest(r *http.Request) {
+	for _, name := range namesFor(s.stripHeaders, r.URL.Path) {
+		r.Header.Del(name)
+	}
+	if names := namesFor(s.stripCookies, r.URL.Path); len(names) > 0 {
+		stripCookies(r.Header, names)
+	}
+}
+
+// stripCookies は Cookie ヘッダーから名前が一致するクッキーを取り除く（末尾の * は前方一致）
+// 残すクッキーの値は受け取ったまま転送する
+func stripCookies(h http.Header, names []string) {
+	var kept []string
+	for _, line := range h.Values("Cookie") {
+		for _, pair := range strings.Split(line, ";") {
+			pair = textproto.TrimString(pair)
+			if pair == "" {
+				continue
+			}
+			name, _, _ := strings.Cut(pair, "=")
+			if !matchCookieName(names, name) {
+				kept = append(kept, pair)
+			}
+		}
+	}
+	if len(kept) == 0 {
+		h.Del("Cookie")
+		return
+	}
+	h.Set("Cookie", strings.Join(kept, "; "))
+}
+
+func matchCookieName(names []string, name string) bool {
+	for _, n := range names {
+		if prefix, ok := strings.CutSuffix(n, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if n == name {
+			return true
+		}
+	}
+	return false
+}
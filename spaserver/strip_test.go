@@ -0,0 +1,57 @@
+package spaserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestStripRequest(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "cookie=%q debug=%q auth=%q", r.Header.Get("Cookie"), r.Header.Get("X-Debug"), r.Header.Get("Authorization"))
+	}))
+	defer backend.Close()
+
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+	cfg := testConfig(t)
+	cfg.DistDir = dir
+	cfg.Proxy.URL = backend.URL
+	cfg.Proxy.Paths = []string{"/api", "/public"}
+	cfg.Proxy.StripHeaders = []string{"/=X-Debug", "/public=Authorization"}
+	cfg.Proxy.StripCookies = []string{"/=_ga*|_fbp", "/public=session"}
+	s, err := newServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	tests := []struct {
+		name     string
+		path     string
+		cookie   string
+		expected string
+	}{
+		{"全体の項目のみ", "/api/items", "_ga=GA1.2; session=abc; _ga_XYZ=1; theme=\"dark mode\"", `cookie="session=abc; theme=\"dark mode\"" debug="" auth="Bearer t"`},
+		{"パスごとの項目も適用する", "/public/items", "session=abc; _fbp=fb", `cookie="" debug="" auth=""`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set("Cookie", tt.cookie)
+			req.Header.Set("X-Debug", "1")
+			req.Header.Set("Authorization", "Bearer t")
+			rr := httptest.NewRecorder()
+			s.ServeHTTP(rr, req)
+			if rr.Body.String() != tt.expected {
+				t.Errorf("期待されるボディ %s, 実際のボディ %s", tt.expected, rr.Body.String())
+			}
+		})
+	}
+
+	if _, err := parseStripRules([]string{"/api"}); err == nil {
+		t.Error("名前のない項目はエラーになるべきです")
+	}
+}
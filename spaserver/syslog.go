@@ -0,0 +1,195 @@
+package spaserver
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syslog への出力
+// SYSLOG_ADDR を設定した場合、アクセスログとエラーログを標準出力・標準エラー出力の代わりに RFC 5424 形式で syslog に送る。
+// MSGID はアクセスログが access、エラーログが error（監査ログは audit）で、エラーログの重要度はログレベルから決める。
+// 接続はログファイルと同じくプロセス全体で共有し、設定の再読み込み時も使い回す
+
+const (
+	syslogMsgAccess = "access"
+	syslogMsgError  = "error"
+	syslogMsgAudit  = "audit"
+	// 接続・送信のタイムアウト
+	syslogTimeout = 5 * time.Second
+)
+
+// syslog の重要度
+const (
+	syslogError   = 3
+	syslogWarning = 4
+	syslogInfo    = 6
+	syslogDebug   = 7
+)
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+var (
+	syslogWritersMu sync.Mutex
+	syslogWriters   = map[string]*syslogWriter{}
+)
+
+// parseSyslogAddr は SYSLOG_ADDR をネットワークとアドレスにする
+// local はこのホストの syslog（/dev/log）、udp://host:port・tcp://host:port・unix:/path はそれぞれの接続先、host:port は UDP
+func parseSyslogAddr(addr string) (network, address string, err error) {
+	switch {
+	case addr == "local":
+		if runtime.GOOS == "darwin" {
+			return "unixgram", "/var/run/syslog", nil
+		}
+		return "unixgram", "/dev/log", nil
+	case strings.HasPrefix(addr, "unix:"):
+		return "unixgram", strings.TrimPrefix(addr, "unix:"), nil
+	case strings.HasPrefix(addr, "udp://"):
+		network, address = "udp", strings.TrimPrefix(addr, "udp://")
+	case strings.HasPrefix(addr, "tcp://"):
+		network, address = "tcp", strings.TrimPrefix(addr, "tcp://")
+	default:
+		network, address = "udp", addr
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return "", "", err
+	}
+	return network, address, nil
+}
+
+// syslogWriter は1行ずつ syslog のメッセージとして送る
+type syslogWriter struct {
+	network  string
+	address  string
+	facility int
+	tag      string
+	msgID    string
+	hostname string
+	// 行から重要度を決める
+	severity func(line string) int
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// openSyslog は SYSLOG_ADDR への Writer を返す（同じ設定の場合は使い回す）
+func openSyslog(cfg LogConfig, msgID string) (io.Writer, error) {
+	network, address, err := parseSyslogAddr(cfg.SyslogAddr)
+	if err != nil {
+		return nil, fmt.Errorf("SYSLOG_ADDR: %w", err)
+	}
+	facility, ok := syslogFacilities[cfg.SyslogFacility]
+	if !ok {
+		return nil, fmt.Errorf("SYSLOG_FACILITY: unknown facility %q", cfg.SyslogFacility)
+	}
+
+	syslogWritersMu.Lock()
+	defer syslogWritersMu.Unlock()
+	key := strings.Join([]string{network, address, cfg.SyslogFacility, cfg.SyslogTag, msgID}, "|")
+	if w, ok := syslogWriters[key]; ok {
+		return w, nil
+	}
+	hostname, _ := os.Hostname()
+	w := &syslogWriter{
+		network:  network,
+		address:  address,
+		facility: facility,
+		tag:      cfg.SyslogTag,
+		msgID:    msgID,
+		hostname: hostname,
+		severity: func(string) int { return syslogInfo },
+	}
+	switch msgID {
+	case syslogMsgError:
+		w.severity = errorLogSeverity
+	case syslogMsgAudit:
+		w.severity = func(string) int { return syslogWarning }
+	}
+	// 起動時に接続できない設定に気付けるよう、最初の接続は失敗をエラーにする
+	if err := w.connect(); err != nil {
+		return nil, fmt.Errorf("connecting to syslog %s: %w", cfg.SyslogAddr, err)
+	}
+	syslogWriters[key] = w
+	return w, nil
+}
+
+func (w *syslogWriter) connect() error {
+	conn, err := net.DialTimeout(w.network, w.address, syslogTimeout)
+	if err != nil && w.network == "unixgram" {
+		// ストリーム形式のソケットの場合
+		conn, err = net.DialTimeout("unix", w.address, syslogTimeout)
+	}
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+// errorLogSeverity はエラーログの行のログレベル（最初に現れるもの）から重要度を決める
+func errorLogSeverity(line string) int {
+	// net/http などが標準の log パッケージに出力したものは警告にする
+	severity, first := syslogWarning, -1
+	for level, s := range map[logLevel]int{levelError: syslogError, levelWarn: syslogWarning, levelInfo: syslogInfo, levelDebug: syslogDebug} {
+		if i := strings.Index(" "+line, " "+levelNames[level]+" "); i >= 0 && (first < 0 || i < first) {
+			severity, first = s, i
+		}
+	}
+	return severity
+}
+
+// format は1行を RFC 5424 のメッセージにする
+func (w *syslogWriter) format(line string, now time.Time) string {
+	hostname := w.hostname
+	if hostname == "" {
+		hostname = "-"
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		w.facility*8+w.severity(line), now.Format("2006-01-02T15:04:05.000000Z07:00"), hostname, w.tag, os.Getpid(), w.msgID, line)
+}
+
+// Write は1行ずつ送る（送れない場合は一度だけ接続し直し、それでも失敗したら標準エラー出力に書く）
+func (w *syslogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := time.Now()
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		msg := w.format(line, now)
+		if w.network == "tcp" {
+			// RFC 6587 のオクテットカウント方式で区切る
+			msg = strconv.Itoa(len(msg)) + " " + msg
+		}
+		if err := w.send(msg); err != nil {
+			fmt.Fprintf(os.Stderr, "syslog: %v: %s\n", err, line)
+		}
+	}
+	return len(p), nil
+}
+
+func (w *syslogWriter) send(msg string) error {
+	for attempt := 0; ; attempt++ {
+		if w.conn == nil {
+			if err := w.connect(); err != nil {
+				return err
+			}
+		}
+		w.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+		_, err := io.WriteString(w.conn, msg)
+		if err == nil || attempt > 0 {
+			return err
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+}
@@ -0,0 +1,123 @@
+package spaserver
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	cfg := LogConfig{SyslogAddr: "udp://" + conn.LocalAddr().String(), SyslogFacility: "local0", SyslogTag: "spa-test"}
+	errorLog, err := openSyslog(cfg, syslogMsgError)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := openSyslog(cfg, syslogMsgError); again != errorLog {
+		t.Error("同じ設定の syslog への接続は共有されるべきです")
+	}
+	accessLog, err := openSyslog(cfg, syslogMsgAccess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errorLog.Write([]byte("proxy.go:10: ERROR upstream down\nmain.go:20: WARN slow\n"))
+	accessLog.Write([]byte(`127.0.0.1 - - [01/Jan/2024:00:00:00 +0000] "GET / HTTP/1.1" 200 3` + "\n"))
+
+	// local0 は 16 なので PRI は 16*8+重要度
+	expected := []string{
+		`^<131>1 \S+ \S+ spa-test \d+ error - proxy\.go:10: ERROR upstream down$`,
+		`^<132>1 \S+ \S+ spa-test \d+ error - main\.go:20: WARN slow$`,
+		`^<134>1 \S+ \S+ spa-test \d+ access - 127\.0\.0\.1 .*"GET / HTTP/1\.1" 200 3$`,
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 2048)
+	for _, pattern := range expected {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("syslog のメッセージを受信できませんでした: %v", err)
+		}
+		if !regexp.MustCompile(pattern).Match(buf[:n]) {
+			t.Errorf("期待される形式 %s, 実際のメッセージ %q", pattern, buf[:n])
+		}
+	}
+}
+
+func TestSyslogTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// オクテットカウント方式で区切られたメッセージを読む
+		r := bufio.NewReader(conn)
+		var length int
+		if _, err := fmt.Fscanf(r, "%d ", &length); err != nil {
+			return
+		}
+		msg := make([]byte, length)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			return
+		}
+		received <- string(msg)
+	}()
+
+	w, err := openSyslog(LogConfig{SyslogAddr: "tcp://" + ln.Addr().String(), SyslogFacility: "daemon", SyslogTag: "spa-server"}, syslogMsgAccess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("hello\n"))
+
+	select {
+	case msg := <-received:
+		if !strings.HasPrefix(msg, "<30>1 ") || !strings.HasSuffix(msg, fmt.Sprintf(" spa-server %d access - hello", os.Getpid())) {
+			t.Errorf("期待される形式ではありません: %q", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("syslog のメッセージを受信できませんでした")
+	}
+}
+
+func TestParseSyslogAddr(t *testing.T) {
+	tests := []struct {
+		addr            string
+		expectedNetwork string
+		expectedAddress string
+		expectedErr     bool
+	}{
+		{addr: "unix:/run/syslog.sock", expectedNetwork: "unixgram", expectedAddress: "/run/syslog.sock"},
+		{addr: "udp://logs:514", expectedNetwork: "udp", expectedAddress: "logs:514"},
+		{addr: "tcp://logs:6514", expectedNetwork: "tcp", expectedAddress: "logs:6514"},
+		{addr: "logs:514", expectedNetwork: "udp", expectedAddress: "logs:514"},
+		{addr: "tcp://logs", expectedErr: true},
+	}
+	for _, tt := range tests {
+		network, address, err := parseSyslogAddr(tt.addr)
+		if tt.expectedErr {
+			if err == nil {
+				t.Errorf("%s: エラーになるべきです", tt.addr)
+			}
+			continue
+		}
+		if err != nil || network != tt.expectedNetwork || address != tt.expectedAddress {
+			t.Errorf("%s: 期待される値 %s %s, 実際の値 %s %s (%v)", tt.addr, tt.expectedNetwork, tt.expectedAddress, network, address, err)
+		}
+	}
+}
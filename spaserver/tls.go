@@ -0,0 +1,58 @@
+package spaserver
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// 配信中の TLS 証明書（設定の再読み込みで差し替える）
+var currentCertificate atomic.Pointer[tls.Certificate]
+
+// 開発用に作成した証明書（設定の再読み込みでは作り直さない）
+var devCertificate *tls.Certificate
+
+// setupTLS は TLS 証明書を読み込む（SIGHUP で更新後の証明書を読み込み直せる）
+// 証明書が指定されておらず dev が true の場合は開発用の証明書を作成する
+func setupTLS(cfg TLSConfig, dev bool) error {
+	if cfg.CertFile == "" && cfg.KeyFile == "" {
+		if !dev {
+			currentCertificate.Store(nil)
+			return nil
+		}
+		if devCertificate == nil {
+			cert, trusted, err := generateDevCertificate(mkcertCARoot())
+			if err != nil {
+				return fmt.Errorf("generating development certificate: %w", err)
+			}
+			if trusted {
+				infof("Generated development certificate signed by the mkcert CA")
+			} else {
+				warnf("Generated self-signed development certificate (install mkcert and run \"mkcert -install\" to make browsers trust it)")
+			}
+			devCertificate = cert
+		}
+		currentCertificate.Store(devCertificate)
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return err
+	}
+	currentCertificate.Store(&cert)
+	return nil
+}
+
+// newTLSConfig は HTTPS リスナーの設定を作成する
+func newTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if cert := currentCertificate.Load(); cert != nil {
+				return cert, nil
+			}
+			return nil, errors.New("no TLS certificate configured")
+		},
+	}
+}
@@ -0,0 +1,109 @@
+package spaserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCertificate はテスト用の自己署名証明書を作成し、証明書と秘密鍵のパスを返す
+func writeTestCertificate(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+func TestServeTLS(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t)
+	if err := setupTLS(TLSConfig{CertFile: certFile, KeyFile: keyFile}, false); err != nil {
+		t.Fatal(err)
+	}
+	defer setupTLS(TLSConfig{}, false)
+
+	l := &listeners{}
+	plain, err := l.Listen("public", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secure, err := l.Listen("tls", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+	go l.Serve(plain, handler)
+	go l.ServeTLS(secure, handler, newTLSConfig())
+	defer shutdown(l, &handlerSwitch{}, time.Second)
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+	for url, expected := range map[string]string{
+		"http://" + plain.Addr().String() + "/":   "HTTP/1.1",
+		"https://" + secure.Addr().String() + "/": "HTTP/2.0",
+	} {
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatalf("%s: %v", url, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != expected {
+			t.Errorf("%s: 期待されるプロトコル %s, 実際のプロトコル %s", url, expected, body)
+		}
+	}
+}
+
+func TestPublicAddrs(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.BindAddr = "127.0.0.1"
+	if addrs := cfg.PublicAddrs(); len(addrs) != 1 || addrs[0] != "127.0.0.1:8080" {
+		t.Errorf("BIND_ADDR が反映されていません: %v", addrs)
+	}
+	cfg.BindAddr = "::1"
+	if addrs := cfg.PublicAddrs(); addrs[0] != "[::1]:8080" {
+		t.Errorf("IPv6 のアドレスが正しくありません: %v", addrs)
+	}
+	cfg.Listen = []string{"127.0.0.1:8080", "unix:/run/spa.sock"}
+	if addrs := cfg.PublicAddrs(); len(addrs) != 2 {
+		t.Errorf("LISTEN が反映されていません: %v", addrs)
+	}
+}
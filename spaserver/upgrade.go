@@ -0,0 +1,106 @@
+//go:build !windows
+
+package spaserver
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// upgradeParentEnv はアップグレードを開始した親プロセスの PID
+const upgradeParentEnv = "SPA_UPGRADE_PARENT"
+
+// upgradeOnSignal は SIGUSR2 を受け取ると新しいバイナリを起動してリスナーを引き継ぐ
+// 新しいプロセスの準備ができると SIGTERM が送られ、このプロセスは処理中のリクエストを待って終了する
+func upgradeOnSignal(l *listeners, source *configSource) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR2)
+	for range ch {
+		infof("Received SIGUSR2, starting new process")
+		if err := l.upgrade(source); err != nil {
+			errorf("Error starting new process: %v", err)
+		}
+	}
+}
+
+// upgrade は現在のリスナーを渡して同じ引数で新しいプロセスを起動する
+func (l *listeners) upgrade(source *configSource) error {
+	l.mu.Lock()
+	var names []string
+	var files []*os.File
+	for _, o := range l.opened {
+		fl, ok := o.ln.(interface{ File() (*os.File, error) })
+		if !ok {
+			continue
+		}
+		f, err := fl.File()
+		if err != nil {
+			l.mu.Unlock()
+			closeFiles(files)
+			return fmt.Errorf("%s listener: %w", o.name, err)
+		}
+		// 引き継いだ後に閉じてもソケットファイルを削除しない
+		if ul, ok := o.ln.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+		names = append(names, o.name)
+		files = append(files, f)
+	}
+	l.mu.Unlock()
+	defer closeFiles(files)
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = files
+	// .env から設定した環境変数は渡さない（新しいプロセスが .env を読み込み直す）
+	for _, kv := range os.Environ() {
+		key := strings.SplitN(kv, "=", 2)[0]
+		if !source.dotenvKeys[key] && key != inheritFDsEnv && key != upgradeParentEnv {
+			cmd.Env = append(cmd.Env, kv)
+		}
+	}
+	cmd.Env = append(cmd.Env,
+		inheritFDsEnv+"="+strings.Join(names, ","),
+		upgradeParentEnv+"="+strconv.Itoa(os.Getpid()),
+	)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	infof("Started new process (pid %d)", cmd.Process.Pid)
+	go func() {
+		// 新しいプロセスが起動に失敗した場合は、このプロセスがそのまま配信を続ける
+		if err := cmd.Wait(); err != nil {
+			errorf("New process (pid %d) exited: %v", cmd.Process.Pid, err)
+		}
+	}()
+	return nil
+}
+
+// notifyUpgradeParent はアップグレードで起動された場合に、親プロセスに終了を指示する
+func notifyUpgradeParent() {
+	pid, err := strconv.Atoi(os.Getenv(upgradeParentEnv))
+	os.Unsetenv(upgradeParentEnv)
+	if err != nil || pid != os.Getppid() {
+		return
+	}
+	infof("Listeners ready, stopping previous process (pid %d)", pid)
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
+		errorf("Error stopping previous process: %v", err)
+	}
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
@@ -0,0 +1,6 @@
+package spaserver
+
+// Windows ではリスナーの引き継ぎによるアップグレードに対応しない
+func upgradeOnSignal(l *listeners, source *configSource) {}
+
+func notifyUpgradeParent() {}
@@ -0,0 +1,533 @@
+package spaserver
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Validate は設定を検証し、問題をすべてまとめたエラーを返す
+func (c Config) Validate() error {
+	var errs []error
+	add := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 0 || port > 65535 {
+		add("PORT: invalid port %q", c.Port)
+	}
+	if c.BindAddr != "" && net.ParseIP(c.BindAddr) == nil {
+		add("BIND_ADDR: %q is not an IP address", c.BindAddr)
+	}
+	for _, addr := range c.Listen {
+		if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+			if path == "" {
+				add("LISTEN: missing socket path in %q", addr)
+			}
+		} else if _, _, err := net.SplitHostPort(addr); err != nil {
+			add("LISTEN: %v (use host:port or unix:/path)", err)
+		}
+	}
+	if _, err := parseFileMode(c.SocketMode); err != nil {
+		add("LISTEN_SOCKET_MODE: %v", err)
+	}
+
+	switch c.Log.AccessFormat {
+	case "", accessLogCommon, accessLogCombined:
+	default:
+		add("ACCESS_LOG_FORMAT: unknown format %q", c.Log.AccessFormat)
+	}
+
+	if c.Log.AuditFile == auditLogSyslog && c.Log.SyslogAddr == "" {
+		add("AUDIT_LOG_FILE: syslog requires SYSLOG_ADDR")
+	}
+	if c.Log.AccessSampleStatic < 0 {
+		add("ACCESS_LOG_SAMPLE_STATIC: must not be negative")
+	}
+
+	if _, err := parseLogLevel(c.Log.Level); err != nil {
+		add("LOG_LEVEL: %v", err)
+	}
+	if c.Log.SyslogAddr != "" {
+		if _, _, err := parseSyslogAddr(c.Log.SyslogAddr); err != nil {
+			add("SYSLOG_ADDR: %v (use local, udp://host:port, tcp://host:port or unix:/path)", err)
+		}
+		if _, ok := syslogFacilities[c.Log.SyslogFacility]; !ok {
+			add("SYSLOG_FACILITY: unknown facility %q", c.Log.SyslogFacility)
+		}
+		if c.Log.AccessFile != "" || c.Log.ErrorFile != "" {
+			add("SYSLOG_ADDR: cannot be combined with ACCESS_LOG_FILE or ERROR_LOG_FILE")
+		}
+	}
+
+	// 配信ディレクトリ
+	switch {
+	case c.Releases.Dir != "":
+		if err := checkDir(c.Releases.Dir); err != nil {
+			add("RELEASES_DIR: %v", err)
+		} else if _, err := listReleases(c.Releases.Dir); err != nil {
+			add("RELEASES_DIR: %v", err)
+		}
+	case c.DistDir != "":
+		if err := checkDir(c.DistDir); err != nil {
+			add("DIST_DIR: %v", err)
+		} else if _, err := os.Stat(filepath.Join(c.DistDir, "index.html")); err != nil {
+			add("DIST_DIR: index.html not found in %s", c.DistDir)
+		}
+	default:
+		add("DIST_DIR: not defined")
+	}
+	if c.DistWait < 0 {
+		add("DIST_DIR_WAIT: must not be negative")
+	}
+	if c.Releases.Keep < 0 {
+		add("RELEASES_KEEP: must not be negative")
+	}
+
+	// カナリアリリース
+	if c.Canary.Dir != "" {
+		if err := checkDir(c.Canary.Dir); err != nil {
+			add("DIST_DIR_CANARY: %v", err)
+		}
+	}
+	if c.Canary.Percent < 0 || c.Canary.Percent > 100 {
+		add("CANARY_PERCENT: must be between 0 and 100")
+	}
+
+	// IPアドレスの許可リスト
+	for _, ip := range c.AllowRemoteIPs {
+		if err := checkIPPattern(ip); err != nil {
+			add("ALLOW_REMOTE_IPS: %v", err)
+		}
+	}
+
+	// プロキシ
+	if c.Proxy.URL != "" {
+		if err := checkProxyURL(c.Proxy.URL); err != nil {
+			add("PROXY_URL: %v", err)
+		}
+	}
+	if len(c.Proxy.Upstreams) > 0 {
+		if c.Proxy.URL != "" {
+			add("PROXY_UPSTREAMS: cannot be used together with PROXY_URL")
+		}
+		if _, err := parseUpstreams(c.Proxy.Upstreams); err != nil {
+			add("PROXY_UPSTREAMS: %v", err)
+		}
+	} else if c.Proxy.AffinityCookie != "" {
+		add("PROXY_AFFINITY_COOKIE: requires PROXY_UPSTREAMS")
+	}
+	for _, rule := range c.Proxy.Routes {
+		cond, target, err := parseRoute(rule)
+		if err == nil {
+			if _, err = compileExpr(cond); err != nil {
+				err = fmt.Errorf("%q: %w", rule, err)
+			} else if err = checkProxyURL(target); err != nil {
+				err = fmt.Errorf("%q: %w", rule, err)
+			}
+		}
+		if err != nil {
+			add("PROXY_ROUTES: %v", err)
+		}
+	}
+	for _, entry := range c.Proxy.Paths {
+		if _, err := parseProxyRule(entry); err != nil {
+			add("PROXY_PATHS: %v", err)
+		}
+	}
+	// gRPC
+	if c.GRPC.URL != "" {
+		if err := checkProxyURL(c.GRPC.URL); err != nil {
+			add("GRPC_URL: %v", err)
+		}
+	}
+	if len(c.GRPC.Paths) > 0 && c.GRPC.URL == "" && c.Proxy.URL == "" {
+		add("GRPC_PATHS: requires GRPC_URL or PROXY_URL")
+	}
+	if c.GRPC.Web && len(c.GRPC.Paths) == 0 {
+		add("GRPC_WEB: requires GRPC_PATHS")
+	}
+	// 画像の形式
+	for _, format := range c.ImageFormats {
+		if format != "avif" && format != "webp" {
+			add("IMAGE_FORMATS: unsupported format %q (use avif or webp)", format)
+		}
+	}
+	if c.AssetManifest != "" && (filepath.IsAbs(c.AssetManifest) || strings.HasPrefix(filepath.Clean(c.AssetManifest), "..")) {
+		add("ASSET_MANIFEST: must be a path inside DIST_DIR")
+	}
+	if c.EarlyHints && !c.PreloadLinks {
+		add("EARLY_HINTS: requires PRELOAD_LINKS")
+	}
+	// ブロックするパス
+	for _, pattern := range c.BlockedPaths {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			add("BLOCKED_PATHS: invalid pattern %q", pattern)
+		}
+	}
+	for _, pattern := range c.Log.AccessExclude {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			add("ACCESS_LOG_EXCLUDE: invalid pattern %q", pattern)
+		}
+	}
+	// 受け付けるメソッド
+	for _, method := range c.AllowedMethods {
+		if !isMethodList(method) || strings.Contains(method, "|") {
+			add("ALLOWED_METHODS: invalid method %q", method)
+		} else if method == "TRACE" || method == "TRACK" {
+			add("ALLOWED_METHODS: %s is always rejected", method)
+		}
+	}
+	if _, err := parsePathMethods(c.PathMethods); err != nil {
+		add("PATH_METHODS: %v", err)
+	}
+	// 画像のリサイズ
+	if c.Images.MaxWidth <= 0 {
+		add("IMAGE_RESIZE_MAX_WIDTH: must be positive")
+	} else if _, err := parseImageWidths(c.Images.Widths, c.Images.MaxWidth); err != nil {
+		add("IMAGE_RESIZE_WIDTHS: %v", err)
+	}
+	if c.Images.WidthStep <= 0 {
+		add("IMAGE_RESIZE_WIDTH_STEP: must be positive")
+	}
+	if c.Images.Quality < 1 || c.Images.Quality > 100 {
+		add("IMAGE_RESIZE_QUALITY: must be between 1 and 100")
+	}
+	if c.Images.CacheBytes < 0 {
+		add("IMAGE_RESIZE_CACHE_BYTES: must not be negative")
+	}
+	if c.Images.CacheDirBytes < 0 {
+		add("IMAGE_RESIZE_CACHE_DIR_BYTES: must not be negative")
+	}
+	// CORS
+	if len(c.CORS.Paths) > 0 && len(c.CORS.Origins) == 0 {
+		add("CORS_PATHS: requires CORS_ALLOWED_ORIGINS")
+	}
+	if c.CORS.Credentials && slices.Contains(c.CORS.Origins, "*") {
+		add("CORS_ALLOW_CREDENTIALS: cannot be combined with CORS_ALLOWED_ORIGINS=* (list the origins instead)")
+	}
+	if c.CORS.MaxAge < 0 {
+		add("CORS_MAX_AGE: must not be negative")
+	}
+	// GraphQL
+	if c.GraphQL.QueryHash && len(c.GraphQL.Paths) == 0 {
+		add("GRAPHQL_QUERY_HASH: requires GRAPHQL_PATHS")
+	}
+	if c.Proxy.MockDir != "" {
+		if err := checkDir(c.Proxy.MockDir); err != nil {
+			add("MOCK_DIR: %v", err)
+		}
+	}
+	if c.Proxy.ReplayDir != "" {
+		if err := checkDir(c.Proxy.ReplayDir); err != nil {
+			add("PROXY_REPLAY_DIR: %v", err)
+		}
+		if c.Proxy.RecordDir != "" {
+			add("PROXY_RECORD_DIR: cannot be used together with PROXY_REPLAY_DIR")
+		}
+	}
+	if c.Proxy.RecordDir != "" && c.Proxy.URL == "" && len(c.Proxy.Upstreams) == 0 {
+		add("PROXY_RECORD_DIR: requires PROXY_URL or PROXY_UPSTREAMS")
+	}
+
+	if c.Health.UpstreamPath != "" && !strings.HasPrefix(c.Health.UpstreamPath, "/") {
+		add("UPSTREAM_HEALTH_PATH: %q must start with /", c.Health.UpstreamPath)
+	}
+	if c.Health.UpstreamInterval <= 0 {
+		add("UPSTREAM_HEALTH_INTERVAL: must be positive")
+	}
+	if c.Health.CheckUpstream && c.Proxy.URL == "" {
+		add("READY_CHECK_UPSTREAM: requires PROXY_URL")
+	}
+
+	if len(c.Plugins) > 0 && !pluginsSupported {
+		// ファイルごとに同じエラーを出さない
+		add("PLUGINS: %v", errPluginsUnsupported)
+	} else {
+		for _, path := range c.Plugins {
+			if _, err := loadPlugin(path); err != nil {
+				add("PLUGINS: %v", err)
+			}
+		}
+	}
+
+	if c.ShutdownTimeout < 0 {
+		add("SHUTDOWN_TIMEOUT: must not be negative")
+	}
+	if c.IdleTimeout < 0 {
+		add("IDLE_TIMEOUT: must not be negative")
+	}
+
+	if c.Log.SlowRequestThreshold < 0 {
+		add("SLOW_REQUEST_THRESHOLD: must not be negative")
+	}
+
+	if c.Dump.BodyBytes < 0 {
+		add("DEBUG_DUMP_BODY_BYTES: must not be negative")
+	}
+
+	for name, percent := range map[string]float64{
+		"CHAOS_LATENCY_PERCENT": c.Chaos.LatencyPercent,
+		"CHAOS_ERROR_PERCENT":   c.Chaos.ErrorPercent,
+		"CHAOS_DROP_PERCENT":    c.Chaos.DropPercent,
+	} {
+		if percent < 0 || percent > 100 {
+			add("%s: must be between 0 and 100", name)
+		}
+	}
+	if c.Chaos.ErrorStatus < 400 || c.Chaos.ErrorStatus > 599 {
+		add("CHAOS_ERROR_STATUS: %d is not an error status", c.Chaos.ErrorStatus)
+	}
+
+	if c.Stats.Enabled {
+		if c.Stats.PathDepth < 1 {
+			add("STATS_PATH_DEPTH: must be at least 1")
+		}
+		if c.Stats.File != "" && c.Stats.Interval <= 0 {
+			add("STATS_SAVE_INTERVAL: must be positive when STATS_FILE is set")
+		}
+	}
+
+	if c.Alert.WebhookURL != "" {
+		if u, err := url.Parse(c.Alert.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("ALERT_WEBHOOK_URL: must be an http or https URL")
+		}
+		if c.Alert.ErrorPercent <= 0 && c.Alert.ProxyErrors <= 0 {
+			add("ALERT_WEBHOOK_URL: requires ALERT_5XX_PERCENT or ALERT_PROXY_ERRORS")
+		}
+		if c.Alert.ErrorPercent < 0 || c.Alert.ErrorPercent > 100 {
+			add("ALERT_5XX_PERCENT: must be between 0 and 100")
+		}
+		if c.Alert.Window <= 0 {
+			add("ALERT_WINDOW: must be positive")
+		}
+		if c.Alert.Cooldown < 0 {
+			add("ALERT_COOLDOWN: must not be negative")
+		}
+	}
+	if c.Sentry.DSN != "" {
+		if _, err := parseSentryDSN(c.Sentry.DSN); err != nil {
+			add("SENTRY_DSN: %v", err)
+		}
+	}
+	if c.Maintenance.Page != "" {
+		if _, err := os.Stat(c.Maintenance.Page); err != nil {
+			add("MAINTENANCE_PAGE: %v", err)
+		}
+	}
+	if c.Maintenance.RetryAfter < 0 {
+		add("MAINTENANCE_RETRY_AFTER: must not be negative")
+	}
+
+	if c.Dev.Open && !c.Dev.Enabled {
+		add("DEV_OPEN: requires DEV")
+	}
+
+	// リクエストサイズの上限
+	if c.Limits.MaxHeaderBytes < 0 {
+		add("MAX_HEADER_BYTES: must not be negative")
+	}
+	if c.Limits.MaxURLBytes < 0 {
+		add("MAX_URL_BYTES: must not be negative")
+	}
+	if c.Limits.MaxBodyBytes < 0 {
+		add("MAX_BODY_BYTES: must not be negative")
+	}
+	if c.Limits.MaxConcurrentRequests < 0 {
+		add("MAX_CONCURRENT_REQUESTS: must not be negative")
+	}
+	if c.Limits.QueueSize < 0 {
+		add("REQUEST_QUEUE_SIZE: must not be negative")
+	}
+	if c.Limits.QueueSize > 0 && c.Limits.QueueTimeout <= 0 {
+		add("REQUEST_QUEUE_TIMEOUT: must be positive when REQUEST_QUEUE_SIZE is set")
+	}
+	if _, err := newRateLimiter(c.RateLimit); err != nil {
+		add("%v", err)
+	}
+	if c.RateLimit.MaxConnsPerIP < 0 {
+		add("MAX_CONNS_PER_IP: must not be negative")
+	}
+	if _, err := parseBodyLimits(c.Proxy.MaxBodyBytes); err != nil {
+		add("PROXY_MAX_BODY_BYTES: %v", err)
+	}
+	if c.Proxy.BufferBytes < 0 {
+		add("PROXY_BUFFER_BYTES: must not be negative")
+	}
+	if c.Proxy.BufferMaxBytes < 0 {
+		add("PROXY_BUFFER_MAX_BYTES: must not be negative")
+	}
+	if c.Proxy.BufferDir != "" {
+		if err := checkDir(c.Proxy.BufferDir); err != nil {
+			add("PROXY_BUFFER_DIR: %v", err)
+		}
+		if c.Proxy.BufferBytes == 0 {
+			add("PROXY_BUFFER_DIR: requires PROXY_BUFFER_BYTES")
+		}
+	}
+	switch c.Proxy.Protocol {
+	case "", protocolAuto, protocolH2C, protocolHTTP1:
+	default:
+		add("PROXY_PROTOCOL: unknown protocol %q (use auto, h2c or http1)", c.Proxy.Protocol)
+	}
+	if _, err := parseStripRules(c.Proxy.StripHeaders); err != nil {
+		add("PROXY_STRIP_HEADERS: %v", err)
+	}
+	if _, err := parseStripRules(c.Proxy.StripCookies); err != nil {
+		add("PROXY_STRIP_COOKIES: %v", err)
+	}
+	if _, err := parseTrustedProxies(c.Proxy.TrustedProxies); err != nil {
+		add("PROXY_TRUSTED_PROXIES: %v", err)
+	}
+	if c.Proxy.MaxIdleConns < 0 {
+		add("PROXY_MAX_IDLE_CONNS: must not be negative")
+	}
+	if c.Proxy.MaxIdleConnsPerHost < 0 {
+		add("PROXY_MAX_IDLE_CONNS_PER_HOST: must not be negative")
+	}
+	if c.Proxy.MaxConnsPerHost < 0 {
+		add("PROXY_MAX_CONNS_PER_HOST: must not be negative")
+	}
+	if c.Proxy.IdleConnTimeout < 0 {
+		add("PROXY_IDLE_CONN_TIMEOUT: must not be negative")
+	}
+	if c.Proxy.ResolveInterval < 0 {
+		add("PROXY_RESOLVE_INTERVAL: must not be negative")
+	}
+	if c.Proxy.HedgeDelay < 0 {
+		add("PROXY_HEDGE_DELAY: must not be negative")
+	}
+	if c.Proxy.Timeout < 0 {
+		add("PROXY_TIMEOUT: must not be negative")
+	}
+	if _, err := parseProxyTimeouts(c.Proxy.Timeouts); err != nil {
+		add("PROXY_TIMEOUTS: %v", err)
+	}
+	if _, err := parseFlushIntervals(c.Proxy.FlushIntervals); err != nil {
+		add("PROXY_FLUSH_INTERVALS: %v", err)
+	}
+	if c.Proxy.CompressMinBytes < 0 {
+		add("PROXY_COMPRESS_MIN_BYTES: must not be negative")
+	}
+	if len(c.Proxy.CompressPaths) > 0 && len(c.Proxy.CompressTypes) == 0 {
+		add("PROXY_COMPRESS_PATHS: requires PROXY_COMPRESS_TYPES")
+	}
+
+	// TLS
+	for _, addr := range c.TLS.Listen {
+		if _, _, err := net.SplitHostPort(addr); err != nil && !strings.HasPrefix(addr, "unix:") {
+			add("TLS_LISTEN: %v", err)
+		}
+	}
+	if len(c.TLS.Listen) > 0 && !c.Dev.TLS && (c.TLS.CertFile == "" || c.TLS.KeyFile == "") {
+		add("TLS_LISTEN: requires TLS_CERT_FILE and TLS_KEY_FILE (or --dev-tls)")
+	}
+	if c.TLS.CertFile != "" || c.TLS.KeyFile != "" {
+		if _, err := tls.LoadX509KeyPair(c.TLS.CertFile, c.TLS.KeyFile); err != nil {
+			add("TLS_CERT_FILE: %v", err)
+		}
+	}
+
+	// 管理用インターフェース・メトリクス
+	if c.Admin.Addr != "" {
+		if _, _, err := net.SplitHostPort(c.Admin.Addr); err != nil {
+			add("ADMIN_ADDR: %v", err)
+		}
+	}
+	if c.Admin.Pprof && c.Admin.Addr == "" {
+		add("ENABLE_PPROF: requires ADMIN_ADDR")
+	}
+	if c.Metrics.Addr != "" {
+		if _, _, err := net.SplitHostPort(c.Metrics.Addr); err != nil {
+			add("METRICS_ADDR: %v", err)
+		}
+	}
+	// 管理用・メトリクス用のリスナーは公開用リスナーと別のポートで待ち受ける
+	for _, addr := range append(c.PublicAddrs(), c.TLS.Listen...) {
+		if overlappingAddrs(addr, c.Admin.Addr) {
+			add("ADMIN_ADDR: %s overlaps the public listener %s", c.Admin.Addr, addr)
+		}
+		if overlappingAddrs(addr, c.Metrics.Addr) {
+			add("METRICS_ADDR: %s overlaps the public listener %s", c.Metrics.Addr, addr)
+		}
+	}
+	if overlappingAddrs(c.Admin.Addr, c.Metrics.Addr) {
+		add("METRICS_ADDR: %s overlaps ADMIN_ADDR", c.Metrics.Addr)
+	}
+	if c.Vault.Addr != "" {
+		if u, err := url.Parse(c.Vault.Addr); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("VAULT_ADDR: %q must be an absolute http(s) URL", c.Vault.Addr)
+		}
+	}
+	if c.Statsd.Addr != "" {
+		if _, _, err := net.SplitHostPort(c.Statsd.Addr); err != nil {
+			add("STATSD_ADDR: %v", err)
+		}
+	}
+	if !strings.HasPrefix(c.Metrics.Path, "/") {
+		add("METRICS_PATH: %q must start with /", c.Metrics.Path)
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkProxyURL はプロキシ先が http(s) の絶対 URL であることを確認する（srv+ などの接頭辞も可）
+func checkProxyURL(raw string) error {
+	u, err := url.Parse(stripDiscoveryScheme(raw))
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q must be an absolute http(s) URL", raw)
+	}
+	return nil
+}
+
+func checkDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return nil
+}
+
+// checkIPPattern は許可リストの要素がIPアドレスまたはその前方一致パターンかを確認する
+func checkIPPattern(pattern string) error {
+	if net.ParseIP(pattern) != nil {
+		return nil
+	}
+	if strings.Contains(pattern, "/") {
+		return fmt.Errorf("%q: CIDR notation is not supported, use a prefix such as 192.168.1.", pattern)
+	}
+	for _, r := range pattern {
+		if !strings.ContainsRune("0123456789abcdefABCDEF.:", r) {
+			return fmt.Errorf("%q is not an IP address or prefix", pattern)
+		}
+	}
+	return nil
+}
+
+// overlappingAddrs は2つの host:port が同じポートで重なるかを確認する
+// ホストが同じか、どちらかがすべてのインターフェース（空・0.0.0.0・::）の場合に重なる。ポート 0 と unix ソケットは対象外
+func overlappingAddrs(a, b string) bool {
+	hostA, portA, errA := net.SplitHostPort(a)
+	hostB, portB, errB := net.SplitHostPort(b)
+	if errA != nil || errB != nil || portA != portB || portA == "0" {
+		return false
+	}
+	anyHost := func(host string) bool {
+		return host == "" || host == "0.0.0.0" || host == "::"
+	}
+	return hostA == hostB || anyHost(hostA) || anyHost(hostB)
+}
@@ -0,0 +1,134 @@
+package spaserver
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.html"), []byte("SPA"), 0644)
+
+	tests := []struct {
+		name        string
+		modify      func(cfg *Config)
+		expectedErr []string
+	}{
+		{
+			name:   "正しい設定はエラーにならない",
+			modify: func(cfg *Config) {},
+		},
+		{
+			name: "存在しないディレクトリはエラーになる",
+			modify: func(cfg *Config) {
+				cfg.DistDir = filepath.Join(dir, "missing")
+			},
+			expectedErr: []string{"DIST_DIR"},
+		},
+		{
+			name: "複数の問題はまとめて報告される",
+			modify: func(cfg *Config) {
+				cfg.Proxy.URL = "backend:8081/api"
+				cfg.Proxy.Paths = []string{"api"}
+				cfg.AllowRemoteIPs = []string{"192.168.1.0/24", "localhost"}
+				cfg.Canary.Percent = 150
+			},
+			expectedErr: []string{"PROXY_URL", "PROXY_PATHS", "192.168.1.0/24", "localhost", "CANARY_PERCENT"},
+		},
+		{
+			name: "待ち受けアドレスの形式",
+			modify: func(cfg *Config) {
+				cfg.Listen = []string{"unix:"}
+				cfg.SocketMode = "rw"
+			},
+			expectedErr: []string{"LISTEN", "LISTEN_SOCKET_MODE"},
+		},
+		{
+			name: "レート制限の形式",
+			modify: func(cfg *Config) {
+				cfg.RateLimit.Limit = "600"
+			},
+			expectedErr: []string{"RATE_LIMIT"},
+		},
+		{
+			name: "syslog の設定",
+			modify: func(cfg *Config) {
+				cfg.Log.SyslogAddr = "tcp://logs"
+				cfg.Log.SyslogFacility = "local9"
+				cfg.Log.ErrorFile = "/var/log/spa-server/error.log"
+			},
+			expectedErr: []string{"SYSLOG_ADDR", "SYSLOG_FACILITY", "ERROR_LOG_FILE"},
+		},
+		{
+			name: "振り分けルールの形式",
+			modify: func(cfg *Config) {
+				cfg.Proxy.Routes = []string{
+					`when header("X-Env") == "beta" to http://beta:8081`,
+					`when path.startsWith("/api") to beta:8081`,
+					`when path == to http://beta:8081`,
+				}
+			},
+			expectedErr: []string{"PROXY_ROUTES", "beta:8081", "expected value"},
+		},
+		{
+			name: "SRV レコードのプロキシ先",
+			modify: func(cfg *Config) {
+				cfg.Proxy.URL = "srv+http://_api._tcp.backend.internal"
+				cfg.Proxy.ResolveInterval = 10 * time.Second
+			},
+		},
+		{
+			name: "pprof は管理用インターフェースが必要",
+			modify: func(cfg *Config) {
+				cfg.Admin.Pprof = true
+			},
+			expectedErr: []string{"ENABLE_PPROF"},
+		},
+		{
+			name: "管理用・メトリクス用のリスナーは公開用リスナーと別のポートにする",
+			modify: func(cfg *Config) {
+				cfg.Port = "8080"
+				cfg.Admin.Addr = "127.0.0.1:8080"
+				cfg.Metrics.Addr = "127.0.0.1:8080"
+			},
+			expectedErr: []string{"ADMIN_ADDR: 127.0.0.1:8080 overlaps", "METRICS_ADDR: 127.0.0.1:8080 overlaps ADMIN_ADDR"},
+		},
+		{
+			name: "ホストが異なる場合は同じポートでもよい",
+			modify: func(cfg *Config) {
+				cfg.BindAddr = "192.0.2.10"
+				cfg.Port = "8080"
+				cfg.Admin.Addr = "127.0.0.1:8080"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.DistDir = dir
+			cfg.AllowRemoteIPs = []string{"127.0.0.1", "192.168.1."}
+			cfg.Proxy.URL = "http://localhost:8081"
+			tt.modify(&cfg)
+
+			err := cfg.Validate()
+			if len(tt.expectedErr) == 0 {
+				if err != nil {
+					t.Errorf("エラーになるべきではありません: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("エラーになるべきです")
+			}
+			for _, expected := range tt.expectedErr {
+				if !strings.Contains(err.Error(), expected) {
+					t.Errorf("エラーに %q が含まれていません: %v", expected, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package spaserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// HashiCorp Vault からの秘密の値の読み込み
+// secret タグの付いた項目（ADMIN_TOKEN など）に vault:<パス>#<キー> を設定すると、起動時と設定の再読み込み時に
+// VAULT_ADDR の Vault から読み込む。動的シークレットなどリースの期間がある値は、期間の 2/3 が過ぎたら
+// sys/leases/renew でリースを更新する。更新できない場合（更新できないリース、最大の期間に達したリースなど）だけ
+// 設定を読み込み直して新しい値に差し替え、使われなくなったリースは取り消す
+
+const (
+	vaultPrefix  = "vault:"
+	vaultTimeout = 10 * time.Second
+	// 差し替えの時期を確認する間隔
+	vaultRenewCheckInterval = 10 * time.Second
+	// 読み込み直しに失敗した場合に再び試すまでの時間
+	vaultRetryInterval = 30 * time.Second
+	// 更新後の期間がこれより短いリースは最大の期間に達したとみなし、値を読み込み直す
+	vaultMinLease = 3 * vaultRenewCheckInterval
+)
+
+// vaultClient は Vault の HTTP API のクライアント
+type vaultClient struct {
+	addr      string
+	token     string
+	namespace string
+	client    *http.Client
+}
+
+func newVaultClient(cfg VaultConfig) *vaultClient {
+	return &vaultClient{
+		addr:      strings.TrimSuffix(cfg.Addr, "/"),
+		token:     cfg.Token,
+		namespace: cfg.Namespace,
+		client:    &http.Client{Timeout: vaultTimeout},
+	}
+}
+
+// vaultSecret は Vault から読み込んだ秘密（KV v2 の場合は data.data に値がある）
+type vaultSecret struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int                    `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data"`
+}
+
+// vaultLease は読み込んだ値のリース
+type vaultLease struct {
+	path      string
+	id        string
+	duration  time.Duration
+	renewable bool
+}
+
+// vaultLeases は設定ごとの Vault のリースと、更新・取り消しに使う接続先
+type vaultLeases struct {
+	vault  VaultConfig
+	leases []vaultLease
+}
+
+// renewAt はリースを更新する時刻を返す（最も短いリースの期間の 2/3 が過ぎた時点、ない場合はゼロ）
+func (l *vaultLeases) renewAt() time.Time {
+	var min time.Duration
+	for _, lease := range l.leases {
+		if min == 0 || lease.duration < min {
+			min = lease.duration
+		}
+	}
+	if min == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(min * 2 / 3)
+}
+
+// value は key の値を返す
+func (s *vaultSecret) value(key string) (string, bool) {
+	data := s.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, found := data[key]; !found {
+			data = nested
+		}
+	}
+	value, ok := data[key].(string)
+	return value, ok
+}
+
+func (v *vaultClient) read(ctx context.Context, path string) (*vaultSecret, error) {
+	var secret vaultSecret
+	if err := v.do(ctx, "GET", path, nil, &secret); err != nil {
+		return nil, err
+	}
+	return &secret, nil
+}
+
+// renew はリースを更新し、更新後の期間を返す
+func (v *vaultClient) renew(ctx context.Context, id string, increment time.Duration) (time.Duration, error) {
+	body := map[string]interface{}{"lease_id": id, "increment": int(increment / time.Second)}
+	var secret vaultSecret
+	if err := v.do(ctx, "PUT", "sys/leases/renew", body, &secret); err != nil {
+		return 0, err
+	}
+	return time.Duration(secret.LeaseDuration) * time.Second, nil
+}
+
+// revoke はリースを取り消す
+func (v *vaultClient) revoke(ctx context.Context, id string) error {
+	return v.do(ctx, "PUT", "sys/leases/revoke", map[string]interface{}{"lease_id": id}, nil)
+}
+
+// do は Vault の API を呼び出し、応答の JSON を v に読み込む（v が nil の場合は読み込まない）
+func (v *vaultClient) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, v.addr+"/v1/"+strings.TrimPrefix(path, "/"), reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+	if out == nil {
+		resp, err := v.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("vault: %w", err)
+		}
+		resp.Body.Close()
+		// sys/leases/revoke は 204 を返す
+		if resp.StatusCode/100 != 2 {
+			return fmt.Errorf("vault: %s returned %s", req.URL.Path, resp.Status)
+		}
+		return nil
+	}
+	if err := getJSON(v.client, req, out); err != nil {
+		return fmt.Errorf("vault: %w", err)
+	}
+	return nil
+}
+
+// resolveVaultSecrets は vault: で始まる秘密の値を Vault から読み込み、リースの期間がある値のリースを返す
+func resolveVaultSecrets(cfg *Config) ([]vaultLease, error) {
+	type ref struct {
+		key   string
+		field reflect.Value
+		value string
+	}
+	var refs []ref
+	walkFields(reflect.ValueOf(cfg).Elem(), func(field reflect.Value, tag reflect.StructTag) {
+		if tag.Get("secret") == "true" && strings.HasPrefix(field.String(), vaultPrefix) {
+			refs = append(refs, ref{key: tag.Get("env"), field: field, value: field.String()})
+		}
+	})
+	if len(refs) == 0 {
+		return nil, nil
+	}
+	if cfg.Vault.Addr == "" {
+		return nil, fmt.Errorf("%s: VAULT_ADDR is required to read %s", refs[0].key, refs[0].value)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), vaultTimeout)
+	defer cancel()
+	client := newVaultClient(cfg.Vault)
+	// 同じパスは一度だけ読み込む
+	secrets := map[string]*vaultSecret{}
+	var leases []vaultLease
+	for _, r := range refs {
+		path, key, ok := strings.Cut(strings.TrimPrefix(r.value, vaultPrefix), "#")
+		if !ok || path == "" || key == "" {
+			return nil, fmt.Errorf("%s: invalid Vault reference %q (use vault:path#key)", r.key, r.value)
+		}
+		secret, ok := secrets[path]
+		if !ok {
+			var err error
+			if secret, err = client.read(ctx, path); err != nil {
+				return nil, fmt.Errorf("%s: %w", r.key, err)
+			}
+			secrets[path] = secret
+			if secret.LeaseDuration > 0 {
+				leases = append(leases, vaultLease{
+					path:      path,
+					id:        secret.LeaseID,
+					duration:  time.Duration(secret.LeaseDuration) * time.Second,
+					renewable: secret.Renewable,
+				})
+			}
+		}
+		value, ok := secret.value(key)
+		if !ok {
+			return nil, fmt.Errorf("%s: no string value %q in %s", r.key, key, path)
+		}
+		r.field.SetString(value)
+	}
+	return leases, nil
+}
+
+// renewVaultSecrets はリースの期間がある Vault の値のリースを期限の前に更新し、更新できない場合は値を読み込み直す
+func renewVaultSecrets(source *configSource, h *handlerSwitch) {
+	ticker := time.NewTicker(vaultRenewCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		at := source.vaultRenewAt()
+		if at.IsZero() || time.Now().Before(at) {
+			continue
+		}
+		// 読み込み直しと同時にリースを取り消さないように、設定の読み込み直しと順に行う
+		reloadMu.Lock()
+		err := source.renewVaultLeases()
+		reloadMu.Unlock()
+		if err == nil {
+			debugf("Vault leases renewed")
+			continue
+		}
+		infof("Cannot renew Vault lease (%v), reloading secrets", err)
+		if err := reload(source, h); err != nil {
+			errorf("Error reloading Vault secrets: %v", err)
+			source.setVaultRenewAt(time.Now().Add(vaultRetryInterval))
+		}
+	}
+}
+
+// renewVaultLeases は使用中の設定の Vault のリースを更新する
+// 更新できないリースや最大の期間に達したリースがある場合はエラーを返す（値を読み込み直す必要がある）
+func (c *configSource) renewVaultLeases() error {
+	c.mu.Lock()
+	active := c.leases
+	c.mu.Unlock()
+	if active == nil || len(active.leases) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), vaultTimeout)
+	defer cancel()
+	client := newVaultClient(active.vault)
+	renewed := make([]vaultLease, 0, len(active.leases))
+	for _, lease := range active.leases {
+		if lease.id == "" || !lease.renewable {
+			return fmt.Errorf("lease of %s is not renewable", lease.path)
+		}
+		d, err := client.renew(ctx, lease.id, lease.duration)
+		if err != nil {
+			return fmt.Errorf("%s: %w", lease.path, err)
+		}
+		if d < vaultMinLease {
+			return fmt.Errorf("lease of %s is reaching its max TTL", lease.path)
+		}
+		lease.duration = d
+		renewed = append(renewed, lease)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	active.leases = renewed
+	c.renewAt = active.renewAt()
+	return nil
+}
+
+// commitVaultLeases は読み込み直した設定を使い始めた（used）か破棄した後に、使われなくなった方のリースを取り消す
+func (c *configSource) commitVaultLeases(used bool) {
+	c.mu.Lock()
+	loaded := c.loadedLeases
+	c.loadedLeases = nil
+	if loaded == nil {
+		c.mu.Unlock()
+		return
+	}
+	unused, kept := loaded, c.leases
+	if used {
+		unused, kept = c.leases, loaded
+		c.leases = loaded
+		c.renewAt = loaded.renewAt()
+	}
+	c.mu.Unlock()
+	if unused != nil {
+		unused.revoke(kept)
+	}
+}
+
+// revoke は kept にないリースを取り消す
+func (l *vaultLeases) revoke(kept *vaultLeases) {
+	keep := map[string]bool{}
+	if kept != nil {
+		for _, lease := range kept.leases {
+			keep[lease.id] = true
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), vaultTimeout)
+	defer cancel()
+	client := newVaultClient(l.vault)
+	for _, lease := range l.leases {
+		if lease.id == "" || keep[lease.id] {
+			continue
+		}
+		if err := client.revoke(ctx, lease.id); err != nil {
+			warnf("Error revoking Vault lease of %s: %v", lease.path, err)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package spaserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResolveVaultSecrets(t *testing.T) {
+	reads := map[string]int{}
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" || r.Header.Get("X-Vault-Namespace") != "team" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		reads[r.URL.Path]++
+		switch r.URL.Path {
+		case "/v1/secret/data/spa-server":
+			// KV v2
+			io.WriteString(w, `{"lease_duration":0,"data":{"data":{"admin_token":"kv-token","sentry_dsn":"https://key@sentry.example.com/1"},"metadata":{"version":3}}}`)
+		case "/v1/webhooks/creds/slack":
+			// リースの期間がある動的シークレット
+			io.WriteString(w, `{"lease_id":"webhooks/creds/slack/1","lease_duration":90,"renewable":true,"data":{"url":"https://hooks.example.com/abc"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer vault.Close()
+
+	cfg := DefaultConfig()
+	cfg.Vault = VaultConfig{Addr: vault.URL, Token: "root", Namespace: "team"}
+	cfg.Admin.Token = "vault:secret/data/spa-server#admin_token"
+	cfg.Sentry.DSN = "vault:secret/data/spa-server#sentry_dsn"
+	cfg.Alert.WebhookURL = "vault:webhooks/creds/slack#url"
+	// secret タグのない項目はそのまま
+	cfg.DistDir = "vault:secret/data/spa-server#admin_token"
+
+	leases, err := resolveVaultSecrets(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Admin.Token != "kv-token" || cfg.Sentry.DSN != "https://key@sentry.example.com/1" || cfg.Alert.WebhookURL != "https://hooks.example.com/abc" {
+		t.Errorf("Vault の値が読み込まれていません: %q %q %q", cfg.Admin.Token, cfg.Sentry.DSN, cfg.Alert.WebhookURL)
+	}
+	if cfg.DistDir != "vault:secret/data/spa-server#admin_token" {
+		t.Errorf("secret タグのない項目は読み込むべきではありません: %s", cfg.DistDir)
+	}
+	// リースの期間がある値のリースだけを返す
+	expected := []vaultLease{{path: "webhooks/creds/slack", id: "webhooks/creds/slack/1", duration: 90 * time.Second, renewable: true}}
+	if !reflect.DeepEqual(leases, expected) {
+		t.Errorf("期待されるリース %+v, 実際のリース %+v", expected, leases)
+	}
+	if reads["/v1/secret/data/spa-server"] != 1 {
+		t.Errorf("同じパスは一度だけ読み込むべきです: %d 回", reads["/v1/secret/data/spa-server"])
+	}
+
+	for _, tt := range []struct {
+		name     string
+		modify   func(cfg *Config)
+		expected string
+	}{
+		{"VAULT_ADDR がない", func(cfg *Config) { cfg.Vault.Addr = "" }, "VAULT_ADDR"},
+		{"キーがない参照", func(cfg *Config) { cfg.Admin.Token = "vault:secret/data/spa-server" }, "vault:path#key"},
+		{"存在しないキー", func(cfg *Config) { cfg.Admin.Token = "vault:secret/data/spa-server#missing" }, "missing"},
+		{"存在しないパス", func(cfg *Config) { cfg.Admin.Token = "vault:secret/data/other#key" }, "404"},
+	} {
+		cfg := DefaultConfig()
+		cfg.Vault = VaultConfig{Addr: vault.URL, Token: "root", Namespace: "team"}
+		cfg.Admin.Token = "vault:secret/data/spa-server#admin_token"
+		tt.modify(&cfg)
+		if _, err := resolveVaultSecrets(&cfg); err == nil || !strings.Contains(err.Error(), tt.expected) || !strings.Contains(err.Error(), "ADMIN_TOKEN") {
+			t.Errorf("%s: エラーに ADMIN_TOKEN と %q が含まれるべきです: %v", tt.name, tt.expected, err)
+		}
+	}
+}
+
+func TestConfigSourceVaultRenewAt(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"lease_duration":90,"data":{"token":"dynamic"}}`)
+	}))
+	defer vault.Close()
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("ADMIN_TOKEN", "vault:auth/creds/admin#token")
+
+	source := newConfigSource("", configFlags{})
+	cfg, err := source.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Admin.Token != "dynamic" {
+		t.Errorf("期待される ADMIN_TOKEN dynamic, 実際の値 %q", cfg.Admin.Token)
+	}
+	// リースの期間の 2/3 が過ぎたら更新する
+	if at := source.vaultRenewAt(); at.Before(time.Now().Add(55*time.Second)) || at.After(time.Now().Add(61*time.Second)) {
+		t.Errorf("更新する時刻は約60秒後になるべきです: %s", time.Until(at))
+	}
+}
+
+func TestRenewVaultLeases(t *testing.T) {
+	var mu sync.Mutex
+	reads := 0
+	renewDuration := 90
+	var renewed, revoked []string
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/v1/auth/creds/admin":
+			reads++
+			fmt.Fprintf(w, `{"lease_id":"auth/creds/admin/%d","lease_duration":90,"renewable":true,"data":{"token":"dynamic-%d"}}`, reads, reads)
+		case "/v1/sys/leases/renew":
+			var body struct {
+				LeaseID   string `json:"lease_id"`
+				Increment int    `json:"increment"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			renewed = append(renewed, body.LeaseID)
+			fmt.Fprintf(w, `{"lease_id":%q,"lease_duration":%d,"renewable":true}`, body.LeaseID, renewDuration)
+		case "/v1/sys/leases/revoke":
+			var body struct {
+				LeaseID string `json:"lease_id"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			revoked = append(revoked, body.LeaseID)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer vault.Close()
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("ADMIN_TOKEN", "vault:auth/creds/admin#token")
+
+	source := newConfigSource("", configFlags{})
+	if _, err := source.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 値を読み込み直さずにリースを更新する
+	source.setVaultRenewAt(time.Now())
+	if err := source.renewVaultLeases(); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	if reads != 1 || len(renewed) != 1 || renewed[0] != "auth/creds/admin/1" {
+		t.Errorf("リースを更新するべきです: reads=%d renewed=%v", reads, renewed)
+	}
+	mu.Unlock()
+	if at := source.vaultRenewAt(); time.Until(at) < 55*time.Second {
+		t.Errorf("更新後の期間から次に更新する時刻を決めるべきです: %s", time.Until(at))
+	}
+
+	// 最大の期間に達して短いリースしか得られない場合は読み込み直しが必要
+	mu.Lock()
+	renewDuration = 5
+	mu.Unlock()
+	if err := source.renewVaultLeases(); err == nil {
+		t.Error("最大の期間に達したリースの更新はエラーになるべきです")
+	}
+
+	// 読み込み直した設定を使い始めたら古いリースを取り消す
+	if _, err := source.Load(); err != nil {
+		t.Fatal(err)
+	}
+	source.commitVaultLeases(true)
+	// 読み込み直した設定を破棄した場合は新しいリースを取り消す
+	if _, err := source.Load(); err != nil {
+		t.Fatal(err)
+	}
+	source.commitVaultLeases(false)
+	mu.Lock()
+	defer mu.Unlock()
+	if expected := []string{"auth/creds/admin/1", "auth/creds/admin/3"}; !reflect.DeepEqual(revoked, expected) {
+		t.Errorf("期待される取り消したリース %v, 実際のリース %v", expected, revoked)
+	}
+	if source.leases.leases[0].id != "auth/creds/admin/2" {
+		t.Errorf("使用中のリースは auth/creds/admin/2 になるべきです: %s", source.leases.leases[0].id)
+	}
+}
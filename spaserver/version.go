@@ -0,0 +1,46 @@
+package spaserver
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// ビルド時に -ldflags "-X github.com/ikasamt/spa-server/spaserver.version=..." で埋め込まれる
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+type versionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// getVersionInfo はバージョン情報を返す（ldflags で未指定の場合は Go のビルド情報を使う）
+func getVersionInfo() versionInfo {
+	info := versionInfo{Version: version, Commit: commit, BuildDate: buildDate, GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "unknown":
+				info.Commit = s.Value
+			case s.Key == "vcs.time" && info.BuildDate == "unknown":
+				info.BuildDate = s.Value
+			}
+		}
+	}
+	return info
+}
+
+func (v versionInfo) String() string {
+	return fmt.Sprintf("spa-server %s (commit %s, built %s, %s)", v.Version, v.Commit, v.BuildDate, v.GoVersion)
+}
+
+func serveVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, getVersionInfo())
+}
@@ -0,0 +1,37 @@
+package spaserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestVersionEndpoint(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(dir+"/index.html", []byte("SPA"), 0644)
+
+	for _, enabled := range []bool{true, false} {
+		cfg := testConfig(t)
+		cfg.DistDir = dir
+		cfg.VersionEndpoint = enabled
+		s, err := newServer(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		s.ServeHTTP(rr, httptest.NewRequest("GET", "/__version", nil))
+
+		var info versionInfo
+		err = json.Unmarshal(rr.Body.Bytes(), &info)
+		if enabled && (rr.Code != http.StatusOK || err != nil || info.Version != version) {
+			t.Errorf("バージョン情報が返されていません: %d %s", rr.Code, rr.Body.String())
+		}
+		// 無効の場合は SPA のルートとして扱われる
+		if !enabled && rr.Body.String() != "SPA" {
+			t.Errorf("無効の場合は index.html が返されるべきです: %s", rr.Body.String())
+		}
+	}
+}
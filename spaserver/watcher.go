@@ -0,0 +1,98 @@
+package spaserver
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce はデプロイ中の連続した変更をまとめるための待ち時間
+const watchDebounce = 250 * time.Millisecond
+
+// dirWatcher はディレクトリ配下（再帰的）の変更を監視し、変更がまとまった時点でコールバックを呼ぶ
+type dirWatcher struct {
+	w        *fsnotify.Watcher
+	onChange func()
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func newDirWatcher(dirs []string, onChange func()) (*dirWatcher, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	dw := &dirWatcher{w: w, onChange: onChange, done: make(chan struct{})}
+	for _, dir := range dirs {
+		if err := dw.AddTree(dir); err != nil {
+			w.Close()
+			return nil, err
+		}
+	}
+	dw.wg.Add(1)
+	go dw.run()
+	return dw, nil
+}
+
+// Add はディレクトリを監視対象に追加する（サブディレクトリは含まない）
+func (dw *dirWatcher) Add(dir string) error {
+	return dw.w.Add(dir)
+}
+
+// AddTree はディレクトリとそのサブディレクトリを監視対象に追加する
+func (dw *dirWatcher) AddTree(root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return dw.w.Add(path)
+		}
+		return nil
+	})
+}
+
+func (dw *dirWatcher) run() {
+	defer dw.wg.Done()
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+	for {
+		select {
+		case event, ok := <-dw.w.Events:
+			if !ok {
+				return
+			}
+			// 新しく作成されたディレクトリも監視する
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := dw.AddTree(event.Name); err != nil {
+						errorf("Error watching %s: %v", event.Name, err)
+					}
+				}
+			}
+			timer.Reset(watchDebounce)
+		case err, ok := <-dw.w.Errors:
+			if !ok {
+				return
+			}
+			errorf("Watcher error: %v", err)
+		case <-timer.C:
+			dw.onChange()
+		case <-dw.done:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// Close は監視を停止する
+func (dw *dirWatcher) Close() error {
+	close(dw.done)
+	err := dw.w.Close()
+	dw.wg.Wait()
+	return err
+}
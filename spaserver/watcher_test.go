@@ -0,0 +1,39 @@
+package spaserver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDirWatcher(t *testing.T) {
+	dir := t.TempDir()
+	changed := make(chan struct{}, 1)
+	w, err := newDirWatcher([]string{dir}, func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// 監視開始後に作成したサブディレクトリ内の変更も検知される
+	sub := filepath.Join(dir, "assets")
+	os.Mkdir(sub, 0755)
+	select {
+	case <-changed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("ディレクトリの作成が検知されませんでした")
+	}
+
+	os.WriteFile(filepath.Join(sub, "app.js"), []byte("console.log(1)"), 0644)
+	select {
+	case <-changed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("サブディレクトリ内のファイル変更が検知されませんでした")
+	}
+}